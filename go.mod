@@ -1,12 +1,17 @@
 module github.com/rs/rest-layer
 
+go 1.27.1
+
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/evanphx/json-patch v4.1.0+incompatible
 	github.com/graphql-go/graphql v0.7.6
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rs/cors v1.6.0
 	github.com/rs/xid v1.2.1
 	github.com/stretchr/testify v1.2.2
 	golang.org/x/crypto v0.0.0-20181127143415-eb0de9b17e85
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
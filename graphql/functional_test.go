@@ -224,3 +224,56 @@ func TestHandler(t *testing.T) {
 	assert.Equal(t, "Method Not Allowed\n", b)
 
 }
+
+// prefixEncrypter is a test Encrypter storing values with an "enc:" prefix.
+type prefixEncrypter struct{}
+
+func (prefixEncrypter) Encrypt(value interface{}) (interface{}, error) {
+	return fmt.Sprintf("enc:%v", value), nil
+}
+
+func (prefixEncrypter) Decrypt(value interface{}) (interface{}, error) {
+	s, _ := value.(string)
+	if !strings.HasPrefix(s, "enc:") {
+		return nil, errors.New("not encrypted")
+	}
+	return strings.TrimPrefix(s, "enc:"), nil
+}
+
+type revealKey struct{}
+
+func TestHandlerEncryptedAndHiddenFields(t *testing.T) {
+	index := resource.NewIndex()
+	h := mem.NewHandler()
+	h.Insert(context.Background(), []*resource.Item{
+		{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "ssn": "enc:123", "note": "secret", "password": "hash"}},
+	})
+	index.Bind("accounts", schema.Schema{Fields: schema.Fields{
+		"id":  {},
+		"ssn": {Encrypter: prefixEncrypter{}},
+		"note": {
+			Hidden:       true,
+			HiddenUnless: func(ctx context.Context) bool { return ctx.Value(revealKey{}) != nil },
+		},
+		"password": {Hidden: true},
+	}}, h, resource.Conf{AllowedModes: resource.ReadOnly})
+	gql, err := NewHandler(index)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r, _ := http.NewRequest("GET", `/?query={accounts(id:"1"){id,ssn,note}}`, nil)
+	s, b := performRequest(gql, r)
+	assert.Equal(t, 200, s)
+	assert.Equal(t, "{\"data\":{\"accounts\":{\"id\":\"1\",\"note\":null,\"ssn\":\"123\"}}}\n", b)
+
+	r = r.WithContext(context.WithValue(r.Context(), revealKey{}, true))
+	s, b = performRequest(gql, r)
+	assert.Equal(t, 200, s)
+	assert.Equal(t, "{\"data\":{\"accounts\":{\"id\":\"1\",\"note\":\"secret\",\"ssn\":\"123\"}}}\n", b)
+
+	// Always hidden fields are not part of the GraphQL schema.
+	r, _ = http.NewRequest("GET", `/?query={accounts(id:"1"){password}}`, nil)
+	_, b = performRequest(gql, r)
+	assert.Contains(t, b, `Cannot query field \"password\"`)
+}
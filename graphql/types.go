@@ -113,7 +113,9 @@ func getFields(idx resource.Index, s schema.Schema) graphql.Fields {
 	flds := graphql.Fields{}
 	// Iter fields
 	for name, def := range s.Fields {
-		if def.Hidden {
+		if def.Hidden && def.HiddenUnless == nil {
+			// Fields revealed by HiddenUnless are hidden by their resolver
+			// for the requests they are not revealed to.
 			continue
 		}
 		if _, ok := def.Validator.(*schema.Reference); ok {
@@ -155,22 +157,33 @@ func getFArgs(p schema.Params) graphql.FieldConfigArgument {
 // getFResolver returns a GraphQL field resolver for REST layer field handler.
 func getFResolver(fieldName string, f schema.Field) graphql.FieldResolveFn {
 	s, serialize := f.Validator.(schema.FieldSerializer)
-	if !serialize && f.Handler == nil {
+	cs, ctxSerialize := f.Validator.(schema.FieldContextSerializer)
+	if !serialize && !ctxSerialize && f.Handler == nil && f.Marshal == nil && f.Enabled == nil && f.Encrypter == nil && !f.Hidden {
 		return nil
 	}
 	return func(rp graphql.ResolveParams) (interface{}, error) {
 		data, ok := rp.Source.(map[string]interface{})
-		if !ok {
+		if !ok || !f.IsEnabled(rp.Context) || f.IsHidden(rp.Context) {
 			return nil, nil
 		}
 		var err error
 		val := data[fieldName]
+		if f.Encrypter != nil && val != nil {
+			if val, err = f.Encrypter.Decrypt(val); err != nil {
+				return nil, fmt.Errorf("%s: %v", fieldName, err)
+			}
+		}
 		if f.Handler != nil {
 			val, err = f.Handler(rp.Context, val, rp.Args)
 		}
-		if err == nil && serialize {
+		if err == nil && ctxSerialize {
+			val, err = cs.SerializeContext(rp.Context, val)
+		} else if err == nil && serialize {
 			val, err = s.Serialize(val)
 		}
+		if err == nil && f.Marshal != nil && val != nil {
+			val, err = f.Marshal(val)
+		}
 		return val, err
 	}
 }
@@ -0,0 +1,74 @@
+package openapi
+
+// errorSchema is the schema of the errors returned by the rest package.
+var errorSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"code": map[string]interface{}{
+			"type":        "integer",
+			"description": "The HTTP status code",
+		},
+		"message": map[string]interface{}{
+			"type":        "string",
+			"description": "The error message",
+		},
+		"issues": map[string]interface{}{
+			"type":        "object",
+			"description": "The list of issues by field",
+			"additionalProperties": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{},
+			},
+		},
+	},
+	"required": []string{"code", "message"},
+}
+
+// parameters are the query and header parameters shared by the operations.
+var parameters = map[string]interface{}{
+	"page":                queryParam("page", "The page number", "integer"),
+	"limit":               queryParam("limit", "The number of items to return per page", "integer"),
+	"skip":                queryParam("skip", "The number of items to skip", "integer"),
+	"sort":                queryParam("sort", "The field(s) to sort on", "string"),
+	"filter":              queryParam("filter", "The filter query", "string"),
+	"fields":              queryParam("fields", "The fields to return (field selection)", "string"),
+	"If-Match":            headerParam("If-Match", "Only perform the operation if the item's etag matches"),
+	"If-None-Match":       headerParam("If-None-Match", "Only return the item if its etag doesn't match"),
+	"If-Modified-Since":   headerParam("If-Modified-Since", "Only return the item if modified after the date"),
+	"If-Unmodified-Since": headerParam("If-Unmodified-Since", "Only perform the operation if the item wasn't modified after the date"),
+	"X-If-Match-Version":  headerParam("X-If-Match-Version", "Only perform the operation if the collection version matches"),
+}
+
+// responses are the error responses shared by the operations.
+var responses = map[string]interface{}{
+	"Error":               errorResponse("An error occurred"),
+	"NotFound":            errorResponse("The item was not found"),
+	"Conflict":            errorResponse("The item conflicts with an existing item"),
+	"PreconditionFailed":  errorResponse("A condition of the request is not met"),
+	"UnprocessableEntity": errorResponse("The document contains errors"),
+}
+
+func queryParam(name, description, typ string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": typ},
+	}
+}
+
+func headerParam(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "header",
+		"description": description,
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
+
+func errorResponse(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content":     jsonContent(schemaRef("Error")),
+	}
+}
@@ -0,0 +1,9 @@
+/*
+Package openapi generates the OpenAPI 3 specification of the resources bound
+to a REST Layer index, with the path operations allowed by their modes, and
+serves it as an openapi.json document.
+
+This package is part of the rest-layer project. See http://rest-layer.io for
+full REST Layer documentation.
+*/
+package openapi
@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/rest-layer/resource"
+)
+
+// Handler is a net/http compatible handler serving the OpenAPI specification of
+// an index as an openapi.json document.
+type Handler struct {
+	spec []byte
+}
+
+// NewHandler compiles the index i if needed and creates a handler serving its
+// OpenAPI specification. The specification is generated once, so resources
+// bound after the handler creation are not listed.
+func NewHandler(i resource.Index, info Info) (*Handler, error) {
+	if c, ok := i.(resource.Compiler); ok {
+		if err := c.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	spec, err := Build(i, info)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{spec: b}, nil
+}
+
+// ServeHTTP writes the specification.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.spec)
+}
@@ -0,0 +1,296 @@
+package openapi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema/encoding/jsonschema"
+)
+
+// Version is the version of the OpenAPI specification generated.
+const Version = "3.0.3"
+
+// Info holds the metadata of the API.
+type Info struct {
+	// Title is the title of the API.
+	Title string
+	// Version is the version of the API (not of the OpenAPI specification).
+	Version string
+	// Description is an optional description of the API.
+	Description string
+}
+
+// Build returns the OpenAPI specification of the resources bound to i and their
+// sub-resources. Each resource gets a collection and an item path, with the
+// operations allowed by the resource's modes. The schemas of the resources are
+// converted using the jsonschema package, so Build fails with the same errors
+// on validators not supporting the conversion.
+func Build(i resource.Index, info Info) (map[string]interface{}, error) {
+	b := builder{
+		paths:   map[string]interface{}{},
+		schemas: map[string]interface{}{"Error": errorSchema},
+	}
+	if err := b.addResources("", nil, i.GetResources()); err != nil {
+		return nil, err
+	}
+	infoMap := map[string]interface{}{
+		"title":   info.Title,
+		"version": info.Version,
+	}
+	if info.Description != "" {
+		infoMap["description"] = info.Description
+	}
+	return map[string]interface{}{
+		"openapi": Version,
+		"info":    infoMap,
+		"paths":   b.paths,
+		"components": map[string]interface{}{
+			"schemas":    b.schemas,
+			"parameters": parameters,
+			"responses":  responses,
+		},
+	}, nil
+}
+
+// builder accumulates the paths and schemas of the resources.
+type builder struct {
+	paths   map[string]interface{}
+	schemas map[string]interface{}
+}
+
+// addResources adds the paths of rsrcs, bound under the prefix path with the
+// given path parameters, and of their sub-resources.
+func (b *builder) addResources(prefix string, pathParams []interface{}, rsrcs []*resource.Resource) error {
+	for _, r := range rsrcs {
+		s := r.Schema()
+		m, err := jsonschema.Build(&s)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.Path(), err)
+		}
+		b.schemas[r.Path()] = m
+
+		collection := prefix + "/" + r.Name()
+		idParam := r.Name() + "_id"
+		itemParams := append(append([]interface{}{}, pathParams...), map[string]interface{}{
+			"name":        idParam,
+			"in":          "path",
+			"required":    true,
+			"description": "The id of the " + r.Name() + " item",
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+		if ops := collectionOperations(r); len(ops) > 0 {
+			b.paths[collection] = pathItem(s.Description, pathParams, ops)
+		}
+		item := collection + "/{" + idParam + "}"
+		if ops := itemOperations(r); len(ops) > 0 {
+			b.paths[item] = pathItem(s.Description, itemParams, ops)
+		}
+		if err := b.addResources(item, itemParams, r.GetResources()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pathItem(description string, params []interface{}, ops map[string]interface{}) map[string]interface{} {
+	if description != "" {
+		ops["description"] = description
+	}
+	if len(params) > 0 {
+		ops["parameters"] = params
+	}
+	return ops
+}
+
+// collectionOperations returns the operations allowed on the collection URL of
+// r, by lowercase method.
+func collectionOperations(r *resource.Resource) map[string]interface{} {
+	conf := r.Conf()
+	ops := map[string]interface{}{}
+	if conf.IsModeAllowed(resource.List) {
+		ops["get"] = operation(r, resource.List, "Lists the items",
+			paramRefs("page", "limit", "skip", "sort", "filter", "fields"),
+			nil,
+			map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "The list of items",
+					"headers": map[string]interface{}{
+						"X-Total": map[string]interface{}{
+							"description": "The total number of items, if known",
+							"schema":      map[string]interface{}{"type": "integer"},
+						},
+					},
+					"content": jsonContent(map[string]interface{}{
+						"type":  "array",
+						"items": schemaRef(r.Path()),
+					}),
+				},
+			})
+	}
+	if conf.IsModeAllowed(resource.Create) {
+		ops["post"] = operation(r, resource.Create, "Creates an item",
+			nil,
+			requestBody(r),
+			map[string]interface{}{
+				strconv.Itoa(conf.CreatedStatus()): itemResponse(r, "The created item"),
+				"409":                              responseRef("Conflict"),
+				"422":                              responseRef("UnprocessableEntity"),
+			})
+	}
+	if conf.IsModeAllowed(resource.Update) {
+		ops["patch"] = operation(r, resource.Update, "Updates a batch of items",
+			nil,
+			map[string]interface{}{
+				"required": true,
+				"content": jsonContent(map[string]interface{}{
+					"type":  "array",
+					"items": schemaRef(r.Path()),
+				}),
+			},
+			map[string]interface{}{
+				strconv.Itoa(conf.ReplacedStatus()): map[string]interface{}{
+					"description": "The updated items",
+					"content": jsonContent(map[string]interface{}{
+						"type":  "array",
+						"items": schemaRef(r.Path()),
+					}),
+				},
+				"422": responseRef("UnprocessableEntity"),
+			})
+	}
+	if conf.IsModeAllowed(resource.Clear) {
+		ops["delete"] = operation(r, resource.Clear, "Deletes the items matching the filter",
+			paramRefs("filter", "X-If-Match-Version"),
+			nil,
+			map[string]interface{}{
+				"204": map[string]interface{}{"description": "The items have been deleted"},
+				"412": responseRef("PreconditionFailed"),
+			})
+	}
+	return ops
+}
+
+// itemOperations returns the operations allowed on the item URL of r, by
+// lowercase method.
+func itemOperations(r *resource.Resource) map[string]interface{} {
+	conf := r.Conf()
+	ops := map[string]interface{}{}
+	if conf.IsModeAllowed(resource.Read) {
+		ops["get"] = operation(r, resource.Read, "Gets an item",
+			paramRefs("fields", "If-None-Match", "If-Modified-Since"),
+			nil,
+			map[string]interface{}{
+				"200": itemResponse(r, "The item"),
+				"304": map[string]interface{}{"description": "The item has not been modified"},
+				"404": responseRef("NotFound"),
+			})
+	}
+	if create, replace := conf.IsModeAllowed(resource.Create), conf.IsModeAllowed(resource.Replace); create || replace {
+		mode := resource.Replace
+		resps := map[string]interface{}{
+			"412": responseRef("PreconditionFailed"),
+			"422": responseRef("UnprocessableEntity"),
+		}
+		if replace {
+			resps[strconv.Itoa(conf.ReplacedStatus())] = itemResponse(r, "The replaced item")
+		}
+		if create {
+			resps[strconv.Itoa(conf.CreatedStatus())] = itemResponse(r, "The created item")
+		} else {
+			resps["404"] = responseRef("NotFound")
+		}
+		if !replace {
+			mode = resource.Create
+		}
+		ops["put"] = operation(r, mode, "Creates or replaces an item",
+			paramRefs("If-Match", "If-Unmodified-Since"),
+			requestBody(r),
+			resps)
+	}
+	if conf.IsModeAllowed(resource.Update) {
+		ops["patch"] = operation(r, resource.Update, "Updates an item",
+			paramRefs("If-Match", "If-Unmodified-Since"),
+			requestBody(r),
+			map[string]interface{}{
+				"200": itemResponse(r, "The updated item"),
+				"404": responseRef("NotFound"),
+				"412": responseRef("PreconditionFailed"),
+				"422": responseRef("UnprocessableEntity"),
+			})
+	}
+	if conf.IsModeAllowed(resource.Delete) {
+		ops["delete"] = operation(r, resource.Delete, "Deletes an item",
+			paramRefs("If-Match", "If-Unmodified-Since"),
+			nil,
+			map[string]interface{}{
+				"204": map[string]interface{}{"description": "The item has been deleted"},
+				"404": responseRef("NotFound"),
+				"412": responseRef("PreconditionFailed"),
+			})
+	}
+	return ops
+}
+
+func operation(r *resource.Resource, mode resource.Mode, summary string, params []interface{}, body map[string]interface{}, resps map[string]interface{}) map[string]interface{} {
+	resps["default"] = responseRef("Error")
+	op := map[string]interface{}{
+		"operationId": r.Path() + "." + mode.String(),
+		"summary":     summary,
+		"tags":        []string{r.Path()},
+		"responses":   resps,
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = body
+	}
+	return op
+}
+
+func requestBody(r *resource.Resource) map[string]interface{} {
+	return map[string]interface{}{
+		"required": true,
+		"content":  jsonContent(schemaRef(r.Path())),
+	}
+}
+
+func itemResponse(r *resource.Resource, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"headers": map[string]interface{}{
+			"ETag": map[string]interface{}{
+				"description": "The etag of the item",
+				"schema":      map[string]interface{}{"type": "string"},
+			},
+			"Last-Modified": map[string]interface{}{
+				"description": "The last modification date of the item",
+				"schema":      map[string]interface{}{"type": "string"},
+			},
+		},
+		"content": jsonContent(schemaRef(r.Path())),
+	}
+}
+
+func jsonContent(s map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": s},
+	}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func responseRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/responses/" + name}
+}
+
+func paramRefs(names ...string) []interface{} {
+	refs := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, map[string]interface{}{"$ref": "#/components/parameters/" + name})
+	}
+	return refs
+}
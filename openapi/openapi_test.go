@@ -0,0 +1,146 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/rs/rest-layer/openapi"
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIndex() resource.Index {
+	i := resource.NewIndex()
+	users := i.Bind("users", schema.Schema{
+		Description: "The users",
+		Fields: schema.Fields{
+			"id":   {ReadOnly: true, Validator: &schema.String{}},
+			"name": {Required: true, Validator: &schema.String{MaxLen: 150}},
+		},
+	}, mem.NewHandler(), resource.DefaultConf)
+	users.Bind("posts", "user", schema.Schema{
+		Fields: schema.Fields{
+			"id":    {ReadOnly: true, Validator: &schema.String{}},
+			"user":  {Validator: &schema.Reference{Path: "users"}},
+			"title": {Validator: &schema.String{}},
+		},
+	}, mem.NewHandler(), resource.Conf{
+		AllowedModes: resource.ReadOnly,
+	})
+	return i
+}
+
+// lookup returns the value at the path of keys in the decoded document v.
+func lookup(v interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// keys returns the sorted keys of the object at the path of keys in v.
+func keys(v interface{}, path ...string) []string {
+	m, _ := lookup(v, path...).(map[string]interface{})
+	k := make([]string, 0, len(m))
+	for key := range m {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
+
+// params returns the references to the shared parameters of an operation.
+func params(v interface{}, path ...string) []string {
+	l, _ := lookup(v, path...).([]interface{})
+	refs := []string{}
+	for _, p := range l {
+		if ref, ok := lookup(p, "$ref").(string); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+func TestHandler(t *testing.T) {
+	h, err := openapi.NewHandler(newIndex(), openapi.Info{Title: "Test", Version: "1.0"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/openapi.json", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var spec interface{}
+	if !assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec)) {
+		return
+	}
+
+	assert.Equal(t, "3.0.3", lookup(spec, "openapi"))
+	assert.Equal(t, "Test", lookup(spec, "info", "title"))
+	assert.Equal(t, []string{
+		"/users",
+		"/users/{users_id}",
+		"/users/{users_id}/posts",
+		"/users/{users_id}/posts/{posts_id}",
+	}, keys(spec, "paths"))
+	assert.Equal(t, "The users", lookup(spec, "paths", "/users", "description"))
+
+	// Read/write resource.
+	assert.Equal(t, []string{"delete", "description", "get", "patch", "post"}, keys(spec, "paths", "/users"))
+	assert.Equal(t, []string{
+		"#/components/parameters/page",
+		"#/components/parameters/limit",
+		"#/components/parameters/skip",
+		"#/components/parameters/sort",
+		"#/components/parameters/filter",
+		"#/components/parameters/fields",
+	}, params(spec, "paths", "/users", "get", "parameters"))
+	assert.Equal(t, "#/components/schemas/users", lookup(spec, "paths", "/users", "get", "responses", "200", "content", "application/json", "schema", "items", "$ref"))
+	assert.Equal(t, "#/components/schemas/users", lookup(spec, "paths", "/users", "post", "requestBody", "content", "application/json", "schema", "$ref"))
+	assert.Equal(t, []string{"201", "409", "422", "default"}, keys(spec, "paths", "/users", "post", "responses"))
+	assert.Equal(t, "users.create", lookup(spec, "paths", "/users", "post", "operationId"))
+	assert.Equal(t, []string{"delete", "description", "get", "parameters", "patch", "put"}, keys(spec, "paths", "/users/{users_id}"))
+	assert.Equal(t, []string{
+		"#/components/parameters/If-Match",
+		"#/components/parameters/If-Unmodified-Since",
+	}, params(spec, "paths", "/users/{users_id}", "patch", "parameters"))
+	assert.Equal(t, []string{"200", "201", "412", "422", "default"}, keys(spec, "paths", "/users/{users_id}", "put", "responses"))
+	assert.Equal(t, []string{"200", "304", "404", "default"}, keys(spec, "paths", "/users/{users_id}", "get", "responses"))
+
+	// Read only sub-resource.
+	assert.Equal(t, []string{"get", "parameters"}, keys(spec, "paths", "/users/{users_id}/posts"))
+	assert.Equal(t, []string{"get", "parameters"}, keys(spec, "paths", "/users/{users_id}/posts/{posts_id}"))
+	assert.Equal(t, "users_id", lookup(spec, "paths", "/users/{users_id}/posts/{posts_id}", "parameters").([]interface{})[0].(map[string]interface{})["name"])
+	assert.Equal(t, "posts_id", lookup(spec, "paths", "/users/{users_id}/posts/{posts_id}", "parameters").([]interface{})[1].(map[string]interface{})["name"])
+
+	// Schemas.
+	assert.Equal(t, []string{"Error", "users", "users.posts"}, keys(spec, "components", "schemas"))
+	assert.Equal(t, []interface{}{"name"}, lookup(spec, "components", "schemas", "users", "required"))
+	assert.Equal(t, "header", lookup(spec, "components", "parameters", "If-Match", "in"))
+}
+
+func TestBuildStatus(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.Conf{
+		AllowedModes: []resource.Mode{resource.Create},
+		CreateStatus: http.StatusOK,
+	})
+	spec, err := openapi.Build(i, openapi.Info{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"post"}, keys(spec, "paths", "/foo"))
+	assert.Equal(t, []string{"200", "409", "422", "default"}, keys(spec, "paths", "/foo", "post", "responses"))
+	assert.Equal(t, []string{"parameters", "put"}, keys(spec, "paths", "/foo/{foo_id}"))
+	assert.Equal(t, []string{"200", "412", "422", "default"}, keys(spec, "paths", "/foo/{foo_id}", "put", "responses"))
+	assert.Equal(t, "foo.create", lookup(spec, "paths", "/foo/{foo_id}", "put", "operationId"))
+}
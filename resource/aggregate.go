@@ -0,0 +1,95 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/rest-layer/schema"
+)
+
+// AggregateOp defines the operation computed by a Metric.
+type AggregateOp string
+
+const (
+	// Count counts the number of items in the group.
+	Count AggregateOp = "count"
+	// Sum computes the sum of a numeric field over the items of the group.
+	Sum AggregateOp = "sum"
+	// Avg computes the average of a numeric field over the items of the group.
+	Avg AggregateOp = "avg"
+	// Min returns the smallest value of a field in the group.
+	Min AggregateOp = "min"
+	// Max returns the largest value of a field in the group.
+	Max AggregateOp = "max"
+)
+
+// Metric defines a value to compute for each group of an aggregation.
+type Metric struct {
+	// Op is the operation to compute.
+	Op AggregateOp
+	// Field is the field the operation is computed on. It must be empty for
+	// the Count operation.
+	Field string
+}
+
+// Name returns the name of the metric as used in AggResult.Metrics (i.e.:
+// count or sum(price)).
+func (m Metric) Name() string {
+	if m.Field == "" {
+		return string(m.Op)
+	}
+	return fmt.Sprintf("%s(%s)", m.Op, m.Field)
+}
+
+// Validate validates the metric against the provided validator.
+func (m Metric) Validate(validator schema.Validator) error {
+	switch m.Op {
+	case Count:
+		if m.Field != "" {
+			return fmt.Errorf("%s: does not take a field", m.Op)
+		}
+		return nil
+	case Sum, Avg, Min, Max:
+		if m.Field == "" {
+			return fmt.Errorf("%s: missing field", m.Op)
+		}
+		if validator.GetField(m.Field) == nil {
+			return fmt.Errorf("%s: unknown field", m.Field)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s: unknown metric", m.Op)
+	}
+}
+
+// ParseMetrics parses a comma separated list of metrics expressed as op or
+// op(field) (i.e.: count,avg(price)).
+func ParseMetrics(metrics string) ([]Metric, error) {
+	ms := []Metric{}
+	for _, s := range strings.Split(metrics, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, errors.New("empty metric")
+		}
+		m := Metric{Op: AggregateOp(s)}
+		if i := strings.IndexByte(s, '('); i != -1 {
+			if s[len(s)-1] != ')' {
+				return nil, fmt.Errorf("%s: missing closing parenthesis", s)
+			}
+			m.Op = AggregateOp(strings.TrimSpace(s[:i]))
+			m.Field = strings.TrimSpace(s[i+1 : len(s)-1])
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// AggResult holds the metrics computed for a group of items.
+type AggResult struct {
+	// Group holds the value of each groupBy field shared by the items of the
+	// group.
+	Group map[string]interface{}
+	// Metrics holds the computed metrics indexed by Metric.Name().
+	Metrics map[string]interface{}
+}
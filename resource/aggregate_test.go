@@ -0,0 +1,33 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetrics(t *testing.T) {
+	m, err := ParseMetrics("count, avg(price) ,max( price )")
+	assert.NoError(t, err)
+	assert.Equal(t, []Metric{{Op: Count}, {Op: Avg, Field: "price"}, {Op: Max, Field: "price"}}, m)
+	_, err = ParseMetrics("count,")
+	assert.EqualError(t, err, "empty metric")
+	_, err = ParseMetrics("sum(price")
+	assert.EqualError(t, err, "sum(price: missing closing parenthesis")
+}
+
+func TestMetricName(t *testing.T) {
+	assert.Equal(t, "count", Metric{Op: Count}.Name())
+	assert.Equal(t, "sum(price)", Metric{Op: Sum, Field: "price"}.Name())
+}
+
+func TestMetricValidate(t *testing.T) {
+	s := schema.Schema{Fields: schema.Fields{"price": {}}}
+	assert.NoError(t, Metric{Op: Count}.Validate(s))
+	assert.NoError(t, Metric{Op: Min, Field: "price"}.Validate(s))
+	assert.EqualError(t, Metric{Op: Count, Field: "price"}.Validate(s), "count: does not take a field")
+	assert.EqualError(t, Metric{Op: Sum}.Validate(s), "sum: missing field")
+	assert.EqualError(t, Metric{Op: Avg, Field: "foo"}.Validate(s), "foo: unknown field")
+	assert.EqualError(t, Metric{Op: "median", Field: "price"}.Validate(s), "median: unknown metric")
+}
@@ -0,0 +1,36 @@
+package resource
+
+import (
+	"context"
+	"time"
+)
+
+// AuditLogger records the field-level changes of the items replaced or
+// modified thru the API (see Conf.AuditLogger).
+type AuditLogger interface {
+	// LogAudit is called asynchronously after an item has been successfully
+	// updated. The context is the request's one, without its cancellation.
+	LogAudit(ctx context.Context, entry AuditEntry)
+}
+
+// AuditEntry describes the changes made to an item.
+type AuditEntry struct {
+	// Actor identifies who made the change, as returned by Conf.AuditActor.
+	Actor string
+	// Time is the time of the change.
+	Time time.Time
+	// Resource is the path of the resource (i.e.: users.posts).
+	Resource string
+	// ID is the id of the changed item.
+	ID interface{}
+	// Changes holds the changed fields, fields hidden from the actor (see
+	// schema.Field.IsHidden) excluded.
+	Changes map[string]FieldChange
+}
+
+// FieldChange holds the value of a field before and after a change. A nil
+// value means the field was not set.
+type FieldChange struct {
+	Before interface{}
+	After  interface{}
+}
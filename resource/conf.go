@@ -1,5 +1,14 @@
 package resource
 
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/rest-layer/schema/query"
+)
+
 // Conf defines the configuration for a given resource.
 type Conf struct {
 	// AllowedModes is the list of Mode allowed for the resource.
@@ -21,6 +30,188 @@ type Conf struct {
 	//
 	// TotalDenied prevents the user from requesting the total.
 	ForceTotal ForceTotalMode
+	// TotalEstimateThreshold enables the estimation of the total number of
+	// items when it must be computed, for storage handlers implementing the
+	// resource.CountEstimator interface. Estimations below the threshold are
+	// discarded and the items are counted exactly, as they are for storage
+	// handlers not implementing the interface. Estimated totals are flagged
+	// with the X-Total-Estimated header.
+	TotalEstimateThreshold int
+	// AllowPatchUpsert allows a PATCH on a non existing item to create it
+	// instead of returning a 404 error, as permitted by RFC 5789. The Create
+	// mode must be allowed for the item to be created.
+	AllowPatchUpsert bool
+	// IdempotentDelete makes a DELETE on a non existing item succeed with a
+	// 204 status instead of returning a 404 error, so retried deletes don't
+	// fail. Conditional deletes (If-Match) on a non existing item still fail.
+	IdempotentDelete bool
+	// LookupScoper returns field/value pairs derived from the request context
+	// (i.e.: a tenant id) that are merged into the lookup of all operations on
+	// the resource, including when its items are embedded in another
+	// resource's response, and set on created or modified documents. This ensures
+	// clients can't access or move items outside of their scope, even by
+	// crafting ids.
+	LookupScoper func(ctx context.Context) map[string]interface{}
+	// LookupHook is called with the query of all operations on the resource,
+	// once the lookup (route, filter and scope) is built and before it is
+	// handed to the storage handler. It can alter the query (i.e.: add a
+	// predicate excluding archived items for non-admin users). The mode is
+	// the operation the query is built for. A returned error aborts the
+	// request; return a *rest.Error to control the response status.
+	LookupHook func(ctx context.Context, mode Mode, q *query.Query) error
+	// DefaultSort defines the sort applied to list requests when the client
+	// does not provide any. Setting it to a unique field (i.e.: id) ensures
+	// a stable order between pages. Fields must be sortable; this is checked
+	// when the resource is compiled.
+	DefaultSort query.Sort
+	// ValidationCache, if set, caches the result of the validation of
+	// documents so identical payloads re-submitted within ValidationCacheTTL
+	// are not validated again. As validators are not re-run, only use it with
+	// schemas whose validation does not depend on external state (i.e.:
+	// references).
+	ValidationCache ValidationCache
+	// ValidationCacheTTL is the duration results are kept in the
+	// ValidationCache. If not set, DefaultValidationCacheTTL is used.
+	ValidationCacheTTL time.Duration
+	// Retry defines how the Get, MultiGet, Find, Insert, Update and Delete
+	// storage operations failing with a transient error are retried. Insert,
+	// Update and Delete are only retried if the error tells nothing was
+	// written (see RetryPolicy). By default, operations are not retried.
+	Retry RetryPolicy
+	// PartialFindTimeout, if set, is a soft deadline given to the storage Find
+	// operation of list requests. If the storage handler stops on this
+	// deadline and returns the items it fetched so far along with the context
+	// error, these items are returned as a partial list (ItemList.Partial)
+	// instead of failing the request. Storage handlers not returning partial
+	// results still fail with a context.DeadlineExceeded error. Other lookups
+	// (item requests, embedded items, parent checks...) are not given this
+	// deadline (see WithPartialResults).
+	PartialFindTimeout time.Duration
+	// Middleware is a list of standard net/http middleware wrapping the
+	// handling of the requests routed to the resource (excluding its
+	// sub-resources). The first middleware is the outermost. The context of
+	// the request passed down by the middleware is used for the rest of the
+	// request handling.
+	Middleware []func(http.Handler) http.Handler
+	// CacheControl defines the Cache-Control directives sent on successful
+	// item and list GET responses. If not set, no Cache-Control header is
+	// sent.
+	CacheControl *CacheControl
+	// AfterChange is called after an item has been successfully inserted,
+	// updated or deleted in the storage, with action set to ActionInsert,
+	// ActionUpdate or ActionDelete. The original item is nil on insert and the
+	// item is nil on delete. It is intended to emit events (i.e.: to a queue or
+	// a webhook). Returned errors are logged and do not fail the operation. The
+	// function is called synchronously so long running tasks should be
+	// performed asynchronously. It is not called on Clear.
+	AfterChange func(ctx context.Context, action string, item *Item, original *Item) error
+	// RangeField designates a large string or binary field which content can
+	// be fetched partially by sending a Range header (with an optional
+	// If-Range) on the item URL. Partial responses contain the raw content of
+	// the field.
+	RangeField string
+	// DraftField designates a boolean field set to true when a document is
+	// stored with a partial validation (`Prefer: validation=partial` header),
+	// skipping the required fields, and to false once stored with a full
+	// validation. The field should be ReadOnly.
+	DraftField string
+	// UseJSONNumber decodes numbers of request bodies as json.Number instead
+	// of float64, so integers larger than 2^53 (i.e.: 64-bit ids) are not
+	// silently rounded. Custom validators of the resource must accept
+	// json.Number values when enabled; the Integer and Float validators do.
+	UseJSONNumber bool
+	// Unlisted excludes the resource, and its sub-resources, from the
+	// resource catalog returned on OPTIONS requests on the API root. The
+	// resource remains accessible.
+	Unlisted bool
+	// SunsetDate, if set, announces the retirement of the resource on this
+	// date thru a Sunset header (RFC 8594) sent on every response of the
+	// resource.
+	SunsetDate time.Time
+	// SunsetLink is an optional URL documenting the retirement of the
+	// resource, sent with the Sunset header as a Link header with the sunset
+	// relation.
+	SunsetLink string
+	// IDDecoder, if set, converts the item ids found in the URL path into
+	// their typed representation (i.e.: integers or UUIDs) before they are
+	// validated and given to the storage handler. Ids it fails to decode are
+	// rejected with a 400 error before the storage is queried.
+	IDDecoder func(raw string) (interface{}, error)
+	// DeriveID, if set, computes the id of the documents created by POST
+	// requests without id from their validated content (i.e.: a slug of a
+	// title or a hash of natural keys). Encrypted fields are given in
+	// plaintext. It must be deterministic so retried requests produce the same
+	// id, and conflict with the item created by the first attempt instead of
+	// creating a duplicate. Documents which id collides with an existing item
+	// are rejected with a 409 error.
+	DeriveID func(doc map[string]interface{}) (interface{}, error)
+	// ContentionCooldown, if set, requires conditional PUT and PATCH requests
+	// (If-Match or If-Unmodified-Since headers) on the items which update
+	// failed with a conflict within this duration. Unconditional requests on
+	// such items are rejected with a 428 Precondition Required error, while
+	// the other items can still be written unconditionally.
+	ContentionCooldown time.Duration
+	// CreateStatus is the status of the responses of successful create
+	// operations: POST, PUT on a non existing item and PATCH upserts. If not
+	// set, 201 is used.
+	CreateStatus int
+	// ReplaceStatus is the status of the responses of successful PUT and
+	// PATCH requests on existing items. If not set, 200 is used.
+	ReplaceStatus int
+	// EchoValidFields returns, with the 422 error of an invalid document, the
+	// fields of the document which passed the validation, in a valid
+	// section, so the client doesn't lose them (i.e.: form UIs). Clients may
+	// also request them with the `Prefer: valid-fields` header.
+	EchoValidFields bool
+	// InputKeyCase converts the keys of request documents, sub-documents
+	// included, the paths of JSON Patch operations and the field names of the
+	// filter, sort and fields query parameters to the naming convention of the
+	// schema (i.e.: KeyCaseSnake to accept camelCase keys for snake_case
+	// fields) before validation. Only the sub-documents of fields declared
+	// with a sub-schema are converted, the keys of dicts and free-form maps
+	// are left untouched.
+	InputKeyCase KeyCase
+	// OutputKeyCase converts the keys of response documents, sub-documents
+	// and error issues included, to the naming convention expected by the
+	// clients (i.e.: KeyCaseCamel to output snake_case fields in camelCase).
+	OutputKeyCase KeyCase
+	// AuditLogger, if set, is given the field-level changes of the items
+	// updated by PUT and PATCH requests, hidden fields excluded. It is called
+	// asynchronously so it doesn't delay the response.
+	AuditLogger AuditLogger
+	// AuditActor returns the identity of the author of a change (i.e.: a user
+	// id stored in the context by an authentication middleware), recorded as
+	// the AuditEntry.Actor.
+	AuditActor func(ctx context.Context) string
+	// AsyncWrites declares the storage handler as processing writes
+	// asynchronously (i.e.: Insert and Update enqueue the change and return
+	// before it is applied). Successful POST, PUT and PATCH requests then
+	// return a 202 Accepted status with a Content-Location header pointing at
+	// the eventual item, and no body, instead of the stored item.
+	AsyncWrites bool
+}
+
+// Actions passed to Conf.AfterChange.
+const (
+	ActionInsert = "insert"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// CacheControl defines the caching policy of a resource's read responses.
+type CacheControl struct {
+	// MaxAge is the duration the response is considered fresh.
+	MaxAge time.Duration
+	// StaleWhileRevalidate is the duration a stale response may still be
+	// served while it is revalidated in the background.
+	StaleWhileRevalidate time.Duration
+	// Public allows shared caches (i.e.: CDNs) to store the response. By
+	// default, responses may only be stored by the client's private cache.
+	Public bool
+	// RequiresAuth indicates responses depend on the authenticated user. In
+	// this case, and whenever the request carries credentials, responses are
+	// marked "private, no-store" regardless of the other directives.
+	RequiresAuth bool
 }
 
 // ForceTotalMode defines Conf.ForceTotal modes.
@@ -57,10 +248,24 @@ const (
 	Clear
 	// List mode represents the GET method on a collection URL.
 	List
+	// BulkDelete mode represents the DELETE method on a collection URL with a
+	// list of ids, deleting only the listed items. It is not part of the
+	// ReadWrite and WriteOnly shortcuts and must be allowed explicitly.
+	BulkDelete
 )
 
+var modeNames = [...]string{"create", "read", "update", "replace", "delete", "clear", "list", "bulk_delete"}
+
+// String returns the lowercase name of the mode (i.e.: create).
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return "Mode(" + strconv.Itoa(int(m)) + ")"
+	}
+	return modeNames[m]
+}
+
 var (
-	// ReadWrite is a shortcut for all modes.
+	// ReadWrite is a shortcut for all modes but BulkDelete.
 	ReadWrite = []Mode{Create, Read, Update, Replace, Delete, List, Clear}
 	// ReadOnly is a shortcut for Read and List modes.
 	ReadOnly = []Mode{Read, List}
@@ -84,3 +289,21 @@ func (c Conf) IsModeAllowed(mode Mode) bool {
 	}
 	return false
 }
+
+// CreatedStatus returns the status of the responses of successful create
+// operations, CreateStatus or 201 if not set.
+func (c Conf) CreatedStatus() int {
+	if c.CreateStatus != 0 {
+		return c.CreateStatus
+	}
+	return http.StatusCreated
+}
+
+// ReplacedStatus returns the status of the responses of successful replace and
+// update operations, ReplaceStatus or 200 if not set.
+func (c Conf) ReplacedStatus() int {
+	if c.ReplaceStatus != 0 {
+		return c.ReplaceStatus
+	}
+	return http.StatusOK
+}
@@ -44,3 +44,12 @@ func TestModeAllowedWriteOnly(t *testing.T) {
 	assert.True(t, c.IsModeAllowed(Clear))
 	assert.False(t, c.IsModeAllowed(List))
 }
+
+func TestConfStatus(t *testing.T) {
+	c := Conf{}
+	assert.Equal(t, 201, c.CreatedStatus())
+	assert.Equal(t, 200, c.ReplacedStatus())
+	c = Conf{CreateStatus: 200, ReplaceStatus: 204}
+	assert.Equal(t, 200, c.CreatedStatus())
+	assert.Equal(t, 204, c.ReplacedStatus())
+}
@@ -0,0 +1,47 @@
+package resource
+
+import (
+	"context"
+
+	"github.com/rs/rest-layer/schema/query"
+)
+
+// Consistency defines the consistency of the storage reads requested by the
+// client.
+type Consistency int
+
+const (
+	// DefaultConsistency reads with the normal consistency of the storage
+	// handler.
+	DefaultConsistency Consistency = iota
+	// StrongConsistency requests reads reflecting all the acknowledged writes
+	// (i.e.: to read an item right after it was written on an eventually
+	// consistent backend).
+	StrongConsistency
+)
+
+// ConsistencyReader is an optional interface a Storer can implement to honor
+// the read consistency requested by the client. When a consistency other than
+// DefaultConsistency is stored in the context (see WithConsistency),
+// FindWithConsistency is called in place of Find. Other storage handlers read
+// with their normal consistency.
+type ConsistencyReader interface {
+	// FindWithConsistency behaves like Find with reads performed with the
+	// requested consistency.
+	FindWithConsistency(ctx context.Context, q *query.Query, c Consistency) (*ItemList, error)
+}
+
+type consistencyKey struct{}
+
+// WithConsistency returns a copy of ctx holding the read consistency requested
+// by the client.
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// ConsistencyFromContext returns the read consistency stored in ctx by
+// WithConsistency, or DefaultConsistency if none.
+func ConsistencyFromContext(ctx context.Context) Consistency {
+	c, _ := ctx.Value(consistencyKey{}).(Consistency)
+	return c
+}
@@ -0,0 +1,72 @@
+package resource
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// contentionTracker records the items which updates recently failed with a
+// conflict, until their cooldown expires.
+type contentionTracker struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+	// queue lists the recorded entries by record time so the expired ones
+	// can be forgotten without scanning the map.
+	queue []contentionEntry
+}
+
+type contentionEntry struct {
+	key   string
+	until time.Time
+}
+
+// contentionKey returns the map key of the item id, as ids may be of types
+// which can't be used as map keys.
+func contentionKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+// record marks the item with the id as contended for the duration d.
+func (t *contentionTracker) record(id interface{}, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.until == nil {
+		t.until = map[string]time.Time{}
+	}
+	// Forget the expired entries at the front of the queue so the map only
+	// holds contended items. The cooldown of a resource doesn't change, so the
+	// entries expire in the order they are recorded.
+	for len(t.queue) > 0 && !now.Before(t.queue[0].until) {
+		e := t.queue[0]
+		if t.until[e.key] == e.until {
+			// Not recorded again since.
+			delete(t.until, e.key)
+		}
+		t.queue = t.queue[1:]
+	}
+	key := contentionKey(id)
+	until := now.Add(d)
+	t.until[key] = until
+	t.queue = append(t.queue, contentionEntry{key, until})
+}
+
+// contended returns true if the item with the id is still contended.
+func (t *contentionTracker) contended(id interface{}) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := contentionKey(id)
+	until, found := t.until[key]
+	if found && !time.Now().Before(until) {
+		delete(t.until, key)
+		return false
+	}
+	return found
+}
+
+// Contended returns true if an update of the item with the id failed with a
+// conflict within the last Conf.ContentionCooldown.
+func (r *Resource) Contended(id interface{}) bool {
+	return r.conf.ContentionCooldown > 0 && r.contention.contended(id)
+}
@@ -0,0 +1,38 @@
+package resource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentionTracker(t *testing.T) {
+	c := &contentionTracker{}
+	assert.False(t, c.contended("a"))
+	c.record("a", -time.Second)
+	// Expired entries are forgotten when a later entry is recorded.
+	c.record("b", -time.Second)
+	assert.Len(t, c.until, 1)
+	assert.Len(t, c.queue, 1)
+	// Or when looked up.
+	assert.False(t, c.contended("b"))
+	assert.Len(t, c.until, 0)
+	c.record("c", time.Hour)
+	c.record("c", time.Hour)
+	assert.True(t, c.contended("c"))
+	assert.Len(t, c.until, 1)
+	assert.Len(t, c.queue, 2)
+}
+
+func TestContentionTrackerIDs(t *testing.T) {
+	c := &contentionTracker{}
+	// Ids which can't be map keys don't panic.
+	c.record([]byte("a"), time.Hour)
+	assert.True(t, c.contended([]byte("a")))
+	assert.False(t, c.contended([]byte("b")))
+	// Ids of different types don't collide.
+	c.record(1, time.Hour)
+	assert.True(t, c.contended(1))
+	assert.False(t, c.contended("1"))
+}
@@ -18,4 +18,16 @@ var (
 	// ErrNoStorage is returned when not storage handler has been set on the
 	// resource.
 	ErrNoStorage = errors.New("No Storage Defined")
+	// ErrNoAggregator is returned when an aggregation is requested on a
+	// resource which storage handler does not implement the Aggregator
+	// interface.
+	ErrNoAggregator = errors.New("Aggregation Not Supported")
+	// ErrNoSearcher is returned when a full text search is requested on a
+	// resource which storage handler does not implement the Searcher
+	// interface.
+	ErrNoSearcher = errors.New("Search Not Supported")
+	// ErrNoChangeTracker is returned when the changes of a resource are
+	// requested while its storage handler does not implement the
+	// ChangeTracker interface.
+	ErrNoChangeTracker = errors.New("Change Tracking Not Supported")
 )
@@ -2,11 +2,13 @@ package resource
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
 
 	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
 )
 
 // Index is an interface defining a type able to bind and retrieve resources
@@ -130,13 +132,52 @@ func (rc refChecker) ReferenceChecker(path string) (schema.FieldValidator, schem
 		}
 
 		_, err = rsc.Get(context.TODO(), id)
-		if err != nil {
+		if err == ErrNotFound {
+			return nil, schema.ReferenceNotFoundError{Path: path, ID: id}
+		} else if err != nil {
 			return nil, err
 		}
 		return id, nil
 	}), rsc.Validator()
 }
 
+// referenceValuesPageSize is the number of items fetched at once to list the
+// values of a referenced field.
+const referenceValuesPageSize = 1000
+
+// ReferenceValues implements the schema.ReferenceValuesChecker interface.
+func (rc refChecker) ReferenceValues(path, field string) func(ctx context.Context) ([]interface{}, error) {
+	rsc, exists := rc.index.GetResource(path, nil)
+	if !exists {
+		return nil
+	}
+	if _, found := rsc.Schema().Fields[field]; !found {
+		return nil
+	}
+	return func(ctx context.Context) ([]interface{}, error) {
+		values := []interface{}{}
+		// Fetch the items by pages so large resources are not loaded at once.
+		for offset := 0; ; offset += referenceValuesPageSize {
+			list, err := rsc.Find(ctx, &query.Query{
+				Sort:   query.Sort{{Name: "id"}},
+				Window: &query.Window{Offset: offset, Limit: referenceValuesPageSize},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if list.Partial {
+				return nil, errors.New("partial list of reference values")
+			}
+			for _, item := range list.Items {
+				values = append(values, item.Payload[field])
+			}
+			if len(list.Items) < referenceValuesPageSize {
+				return values, nil
+			}
+		}
+	}
+}
+
 // assertNotBound asserts a given resource name is not already bound.
 func assertNotBound(name string, resources subResources, aliases map[string]url.Values) {
 	for _, r := range resources {
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -64,6 +65,18 @@ func TestIndexCompileSubError(t *testing.T) {
 	assert.EqualError(t, r.Compile(), "foo.bar.baz: schema compilation error: f: invalid regexp: error parsing regexp: missing closing ]: `[`")
 }
 
+func TestIndexCompileDefaultSortError(t *testing.T) {
+	r, ok := NewIndex().(*index)
+	if !assert.True(t, ok) {
+		return
+	}
+	conf := DefaultConf
+	conf.DefaultSort = query.Sort{{Name: "f"}}
+	foo := r.Bind("foo", schema.Schema{Fields: schema.Fields{"f": {}}}, nil, DefaultConf)
+	foo.Bind("bar", "f", schema.Schema{Fields: schema.Fields{"f": {}}}, nil, conf)
+	assert.EqualError(t, r.Compile(), "foo.bar: invalid default sort: f: field is not sortable")
+}
+
 func TestIndexCompileReferenceChecker(t *testing.T) {
 	i, ok := NewIndex().(*index)
 	if !assert.True(t, ok) {
@@ -29,6 +29,12 @@ type ItemList struct {
 	// current context. If the storage handler cannot compute this value, -1 is
 	// set.
 	Total int
+	// TotalEstimated is true when Total is an estimation returned by a
+	// CountEstimator rather than an exact count.
+	TotalEstimated bool
+	// Partial is true when the list has been cut short by the
+	// Conf.PartialFindTimeout deadline and may be missing some items.
+	Partial bool
 	// Offset is the index of the first item of the list in the global
 	// collection.
 	Offset int
@@ -39,6 +45,27 @@ type ItemList struct {
 	Items []*Item
 }
 
+// Change is an entry of a ChangeList: either the current version of an item
+// created or updated since the requested token, or the tombstone of a deleted
+// item.
+type Change struct {
+	// ID is the id of the changed item.
+	ID interface{}
+	// Deleted is true if the item has been deleted.
+	Deleted bool
+	// Item is the current version of the item, nil if Deleted is true.
+	Item *Item
+}
+
+// ChangeList represents the changes of a collection since a given token.
+type ChangeList struct {
+	// Changes is the list of changes, one per changed item.
+	Changes []Change
+	// Token identifies the position of the list in the history of the
+	// collection, to be given as the since token of the next request.
+	Token string
+}
+
 // NewItem creates a new item from a payload.
 func NewItem(payload map[string]interface{}) (*Item, error) {
 	id, found := payload["id"]
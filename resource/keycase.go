@@ -0,0 +1,72 @@
+package resource
+
+import (
+	"strings"
+	"unicode"
+)
+
+// KeyCase defines a naming convention of document keys, used by
+// Conf.InputKeyCase and Conf.OutputKeyCase.
+type KeyCase int
+
+const (
+	// KeyCaseNone leaves keys untouched.
+	KeyCaseNone KeyCase = iota
+	// KeyCaseSnake converts keys to snake_case (i.e.: first_name).
+	KeyCaseSnake
+	// KeyCaseCamel converts keys to camelCase (i.e.: firstName).
+	KeyCaseCamel
+)
+
+// Convert returns key converted to the convention. Leading underscores (i.e.:
+// _etag) are preserved.
+func (c KeyCase) Convert(key string) string {
+	prefix := key[:len(key)-len(strings.TrimLeft(key, "_"))]
+	name := key[len(prefix):]
+	switch c {
+	case KeyCaseSnake:
+		return prefix + toSnake(name)
+	case KeyCaseCamel:
+		return prefix + toCamel(name)
+	}
+	return key
+}
+
+// toSnake converts a camelCase name to snake_case. Acronyms are kept
+// together (i.e.: userID becomes user_id).
+func toSnake(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			if i > 0 && rs[i-1] != '_' && (!unicode.IsUpper(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// toCamel converts a snake_case name to camelCase.
+func toCamel(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if upper {
+		// Keep trailing underscores so the conversion stays reversible.
+		b.WriteByte('_')
+	}
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyCaseConvert(t *testing.T) {
+	for snake, camel := range map[string]string{
+		"id":              "id",
+		"first_name":      "firstName",
+		"address_line2":   "addressLine2",
+		"_etag":           "_etag",
+		"_created_at":     "_createdAt",
+		"user_id":         "userId",
+		"":                "",
+		"already_snake_x": "alreadySnakeX",
+	} {
+		assert.Equal(t, camel, KeyCaseCamel.Convert(snake), snake)
+		assert.Equal(t, snake, KeyCaseSnake.Convert(camel), camel)
+	}
+	assert.Equal(t, "user_id", KeyCaseSnake.Convert("userID"))
+	assert.Equal(t, "http_server", KeyCaseSnake.Convert("HTTPServer"))
+	assert.Equal(t, "first_name", KeyCaseSnake.Convert("first_name"))
+	assert.Equal(t, "firstName", KeyCaseCamel.Convert("firstName"))
+	assert.Equal(t, "First_Name", KeyCaseNone.Convert("First_Name"))
+}
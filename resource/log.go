@@ -29,14 +29,14 @@ var Logger = func(ctx context.Context, level LogLevel, msg string, fields map[st
 
 func logErrorf(ctx context.Context, format string, a ...interface{}) {
 	if LoggerLevel <= LogLevelError && Logger != nil {
-		Logger(ctx, LogLevelError, fmt.Sprintf(format, a...), nil)
+		Logger(ctx, LogLevelError, fmt.Sprintf(format, a...), logFields(ctx))
 	}
 }
 
 func logPanicf(ctx context.Context, format string, a ...interface{}) {
 	msg := fmt.Sprintf(format, a...)
 	if LoggerLevel <= LogLevelFatal && Logger != nil {
-		Logger(ctx, LogLevelFatal, msg, nil)
+		Logger(ctx, LogLevelFatal, msg, logFields(ctx))
 	}
 	panic(msg)
 }
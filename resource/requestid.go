@@ -0,0 +1,30 @@
+package resource
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx holding the correlation id of the
+// request, used to trace it across services.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the correlation id of the request stored in ctx
+// by WithRequestID (i.e.: by the rest.RequestID middleware), or an empty
+// string if none.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logFields returns the fields to log with the messages related to ctx.
+func logFields(ctx context.Context) map[string]interface{} {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return map[string]interface{}{"request_id": id}
+	}
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"reflect"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/rest-layer/schema"
@@ -23,6 +25,10 @@ type Resource struct {
 	resources   subResources
 	aliases     map[string]url.Values
 	hooks       eventHandler
+	versions    map[string]*Resource
+	contention  *contentionTracker
+	// version is incremented each time the resource is compiled.
+	version uint64
 }
 
 type subResources []*Resource
@@ -67,6 +73,32 @@ func (v validatorFallback) GetField(name string) *schema.Field {
 	return v.fallback.GetField(name)
 }
 
+// ValidateMode implements schema.ModeValidator.
+func (v validatorFallback) ValidateMode(changes map[string]interface{}, base map[string]interface{}, mode schema.Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	return schema.ValidateWithMode(v.Validator, changes, base, mode)
+}
+
+// ValidateContext implements schema.ContextValidator.
+func (v validatorFallback) ValidateContext(ctx context.Context, changes map[string]interface{}, base map[string]interface{}, mode schema.Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	return schema.ValidateWithContext(ctx, v.Validator, changes, base, mode)
+}
+
+// Variants implements schema.VariantSelector.
+func (v validatorFallback) Variants(ctx context.Context) string {
+	if vs, ok := v.Validator.(schema.VariantSelector); ok {
+		return vs.Variants(ctx)
+	}
+	return ""
+}
+
+// ExternalState implements schema.ExternalStateSelector.
+func (v validatorFallback) ExternalState() (string, bool) {
+	if es, ok := v.Validator.(schema.ExternalStateSelector); ok {
+		return es.ExternalState()
+	}
+	return "", true
+}
+
 // newResource creates a new resource with provided spec, handler and config.
 func newResource(name string, s schema.Schema, h Storer, c Conf) *Resource {
 	return &Resource{
@@ -77,10 +109,11 @@ func newResource(name string, s schema.Schema, h Storer, c Conf) *Resource {
 			Validator: s,
 			fallback:  schema.Schema{Fields: schema.Fields{}},
 		},
-		storage:   storageWrapper{h},
-		conf:      c,
-		resources: subResources{},
-		aliases:   map[string]url.Values{},
+		storage:    storageWrapper{h},
+		conf:       c,
+		resources:  subResources{},
+		aliases:    map[string]url.Values{},
+		contention: &contentionTracker{},
 	}
 }
 
@@ -103,12 +136,27 @@ func (r *Resource) ParentField() string {
 
 // Compile the resource graph and report any error.
 func (r *Resource) Compile(rc schema.ReferenceChecker) error {
+	atomic.AddUint64(&r.version, 1)
 	// Compile schema and panic on any compilation error.
 	if c, ok := r.validator.Validator.(schema.Compiler); ok {
 		if err := c.Compile(rc); err != nil {
 			return fmt.Errorf(": schema compilation error: %s", err)
 		}
 	}
+	if err := r.conf.DefaultSort.Validate(r.validator); err != nil {
+		return fmt.Errorf(": invalid default sort: %s", err)
+	}
+	if f := r.conf.RangeField; f != "" && r.validator.GetField(f) == nil {
+		return fmt.Errorf(": invalid range field: %s: unknown field", f)
+	}
+	if f := r.conf.DraftField; f != "" && r.validator.GetField(f) == nil {
+		return fmt.Errorf(": invalid draft field: %s: unknown field", f)
+	}
+	for version, vr := range r.versions {
+		if err := vr.Compile(rc); err != nil {
+			return fmt.Errorf(": version %s%s", version, err)
+		}
+	}
 	for _, r := range r.resources {
 		if err := r.Compile(rc); err != nil {
 			if err.Error()[0] == ':' {
@@ -216,8 +264,21 @@ func (r *Resource) Schema() schema.Schema {
 	return r.schema
 }
 
-// Validator returns the resource's validator.
+// Validator returns the resource's validator. If a Conf.ValidationCache is
+// set, the results of the validator's Validate method are cached.
 func (r *Resource) Validator() schema.Validator {
+	if r.conf.ValidationCache != nil {
+		ttl := r.conf.ValidationCacheTTL
+		if ttl <= 0 {
+			ttl = DefaultValidationCacheTTL
+		}
+		return cachedValidator{
+			Validator: r.validator,
+			cache:     r.conf.ValidationCache,
+			ttl:       ttl,
+			prefix:    fmt.Sprintf("%s@%d", r.path, atomic.LoadUint64(&r.version)),
+		}
+	}
 	return r.validator
 }
 
@@ -245,7 +306,10 @@ func (r *Resource) Get(ctx context.Context, id interface{}) (item *Item, err err
 		}(time.Now())
 	}
 	if err = r.hooks.onGet(ctx, id); err == nil {
-		item, err = r.storage.Get(ctx, id)
+		err = r.conf.Retry.do(ctx, func() (err error) {
+			item, err = r.storage.Get(ctx, id)
+			return err
+		})
 	}
 	r.hooks.onGot(ctx, &item, &err)
 	return
@@ -273,7 +337,10 @@ func (r *Resource) MultiGet(ctx context.Context, ids []interface{}) (items []*It
 	}
 	// Perform the storage request if none of the pre-hook returned an err.
 	if err == nil {
-		items, err = r.storage.MultiGet(ctx, ids)
+		err = r.conf.Retry.do(ctx, func() (err error) {
+			items, err = r.storage.MultiGet(ctx, ids)
+			return err
+		})
 	}
 	var errOverwrite error
 	for i := range ids {
@@ -310,9 +377,10 @@ func (r *Resource) Find(ctx context.Context, q *query.Query) (list *ItemList, er
 
 // FindWithTotal calls the Find method on the storage handler with the
 // corresponding pre/post hooks. If the storage is not able to compute the
-// total, this method will call the Count method on the storage. If the storage
-// Find does not compute the total and the Counter interface is not implemented,
-// an ErrNotImplemented error is returned.
+// total, this method will call the Count method on the storage, or its
+// EstimateCount method for large collections if Conf.TotalEstimateThreshold is
+// set. If the storage Find does not compute the total and the Counter
+// interface is not implemented, an ErrNotImplemented error is returned.
 func (r *Resource) FindWithTotal(ctx context.Context, q *query.Query) (list *ItemList, err error) {
 	return r.find(ctx, q, true)
 }
@@ -332,17 +400,158 @@ func (r *Resource) find(ctx context.Context, q *query.Query, forceTotal bool) (l
 		}(time.Now())
 	}
 	if err = r.hooks.onFind(ctx, q); err == nil {
-		list, err = r.storage.Find(ctx, q)
+		list, err = r.findPartial(ctx, q)
 		if err == nil && list.Total == -1 && forceTotal {
 			// Send a query with no window so the storage won't be tempted to
 			// count within the window.
-			list.Total, err = r.storage.Count(ctx, &query.Query{Predicate: q.Predicate})
+			list.Total, list.TotalEstimated, err = r.count(ctx, &query.Query{Predicate: q.Predicate})
+		}
+	}
+	r.hooks.onFound(ctx, q, &list, &err)
+	return
+}
+
+type partialResultsKey struct{}
+
+// WithPartialResults returns a copy of ctx allowing Find and FindWithTotal to
+// return a partial list when the resource's Conf.PartialFindTimeout deadline
+// is reached (see ItemList.Partial). It must only be used by callers handling
+// partial lists, like list requests: other lookups (i.e.: fetching an item
+// before updating it) would otherwise take missing items as non existing.
+func WithPartialResults(ctx context.Context) context.Context {
+	return context.WithValue(ctx, partialResultsKey{}, true)
+}
+
+// findPartial calls the storage Find with the retry policy of the resource.
+// If the resource is configured with a PartialFindTimeout and ctx allows
+// partial results (see WithPartialResults), the storage is given this
+// deadline and the items returned with the deadline error are flagged as a
+// partial list.
+func (r *Resource) findPartial(ctx context.Context, q *query.Query) (list *ItemList, err error) {
+	findCtx := ctx
+	if timeout := r.conf.PartialFindTimeout; timeout > 0 && ctx.Value(partialResultsKey{}) != nil {
+		var cancel context.CancelFunc
+		findCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err = r.conf.Retry.do(findCtx, func() (err error) {
+		list, err = r.storage.Find(findCtx, q)
+		return err
+	})
+	if err != nil && list != nil && findCtx != ctx && findCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		list.Partial = true
+		err = nil
+	}
+	return list, err
+}
+
+// count returns the total number of items matching q. When the resource is
+// configured with a TotalEstimateThreshold and the storage implements the
+// CountEstimator interface, the estimation is returned if it is not below the
+// threshold, with estimated set to true. Otherwise the items are counted.
+func (r *Resource) count(ctx context.Context, q *query.Query) (total int, estimated bool, err error) {
+	if threshold := r.conf.TotalEstimateThreshold; threshold > 0 {
+		total, err = r.storage.EstimateCount(ctx, q)
+		if err == nil && total >= threshold {
+			return total, true, nil
 		}
+		if err != nil && err != ErrNotImplemented {
+			return -1, false, err
+		}
+	}
+	total, err = r.storage.Count(ctx, q)
+	return total, false, err
+}
+
+// CollectionVersion returns the version token of the collection for the query
+// lookup. The Find hooks are called first with a copy of the query, so a hook
+// denying the lookup fails the call. If the storage handler does not implement
+// the CollectionVersioner interface, ErrNotImplemented is returned.
+func (r *Resource) CollectionVersion(ctx context.Context, q *query.Query) (string, error) {
+	hq := *q
+	hq.Predicate = append(query.Predicate{}, q.Predicate...)
+	if err := r.hooks.onFind(ctx, &hq); err != nil {
+		return "", err
+	}
+	return r.storage.CollectionVersion(ctx, &hq)
+}
+
+// Changes returns the changes of the items matching the query lookup since the
+// since token, deleted items included. The Find hooks are called with the
+// query. If the storage handler does not implement the ChangeTracker
+// interface, ErrNoChangeTracker is returned.
+func (r *Resource) Changes(ctx context.Context, q *query.Query, since string) (changes *ChangeList, err error) {
+	if LoggerLevel <= LogLevelDebug && Logger != nil {
+		defer func(t time.Time) {
+			found := -1
+			if changes != nil {
+				found = len(changes.Changes)
+			}
+			Logger(ctx, LogLevelDebug, fmt.Sprintf("%s.Changes(%q)", r.path, since), map[string]interface{}{
+				"duration": time.Since(t),
+				"found":    found,
+				"error":    err,
+			})
+		}(time.Now())
+	}
+	if err = r.hooks.onFind(ctx, q); err != nil {
+		return nil, err
+	}
+	return r.storage.Changes(ctx, q, since)
+}
+
+// WithTransaction calls fn with a copy of the resource performing its storage
+// operations in a transaction of the storage handler, so several items can be
+// written atomically while the hooks of the resource are still called. The
+// transaction is committed if fn returns nil and rolled back otherwise. If the
+// storage handler does not implement the Transactional interface,
+// ErrNotImplemented is returned.
+func (r *Resource) WithTransaction(ctx context.Context, fn func(tx *Resource) error) error {
+	return r.storage.WithTransaction(ctx, func(s Storer) error {
+		tx := *r
+		tx.storage = storageWrapper{s}
+		return fn(&tx)
+	})
+}
+
+// Search calls the Search method on the storage handler with the Find pre/post
+// hooks. The text is searched on the fields of the schema flagged as
+// Searchable. If the storage handler does not implement the Searcher
+// interface, ErrNoSearcher is returned.
+func (r *Resource) Search(ctx context.Context, text string, q *query.Query) (list *ItemList, err error) {
+	if LoggerLevel <= LogLevelDebug && Logger != nil {
+		defer func(t time.Time) {
+			found := -1
+			if list != nil {
+				found = len(list.Items)
+			}
+			Logger(ctx, LogLevelDebug, fmt.Sprintf("%s.Search(%q)", r.path, text), map[string]interface{}{
+				"duration": time.Since(t),
+				"found":    found,
+				"error":    err,
+			})
+		}(time.Now())
+	}
+	if err = r.hooks.onFind(ctx, q); err == nil {
+		list, err = r.storage.Search(ctx, text, r.SearchableFields(), q)
 	}
 	r.hooks.onFound(ctx, q, &list, &err)
 	return
 }
 
+// SearchableFields returns the sorted names of the schema fields flagged as
+// Searchable.
+func (r *Resource) SearchableFields() []string {
+	fields := []string{}
+	for name, f := range r.schema.Fields {
+		if f.Searchable {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
 // Insert implements Storer interface.
 func (r *Resource) Insert(ctx context.Context, items []*Item) (err error) {
 	if LoggerLevel <= LogLevelDebug && Logger != nil {
@@ -354,14 +563,34 @@ func (r *Resource) Insert(ctx context.Context, items []*Item) (err error) {
 		}(time.Now())
 	}
 	if err = r.hooks.onInsert(ctx, items); err == nil {
-		if err = recalcEtag(items); err == nil {
-			err = r.storage.Insert(ctx, items)
+		if err = r.checkUnique(ctx, items, nil); err == nil {
+			if err = recalcEtag(items); err == nil {
+				err = r.conf.Retry.doWrite(ctx, func() error {
+					return r.storage.Insert(ctx, items)
+				})
+			}
 		}
 	}
 	r.hooks.onInserted(ctx, items, &err)
+	if err == nil {
+		for _, item := range items {
+			r.afterChange(ctx, ActionInsert, item, nil)
+		}
+	}
 	return
 }
 
+// afterChange calls the Conf.AfterChange function if any and logs the
+// returned error.
+func (r *Resource) afterChange(ctx context.Context, action string, item, original *Item) {
+	if r.conf.AfterChange == nil {
+		return
+	}
+	if err := r.conf.AfterChange(ctx, action, item, original); err != nil {
+		logErrorf(ctx, "%s: after %s hook error: %v", r.path, action, err)
+	}
+}
+
 func recalcEtag(items []*Item) error {
 	if items == nil {
 		return nil
@@ -391,14 +620,58 @@ func (r *Resource) Update(ctx context.Context, item *Item, original *Item) (err
 		}(time.Now())
 	}
 	if err = r.hooks.onUpdate(ctx, item, original); err == nil {
-		if err = recalcEtag([]*Item{item}); err == nil {
-			err = r.storage.Update(ctx, item, original)
+		if err = r.checkUnique(ctx, []*Item{item}, original); err == nil {
+			if err = recalcEtag([]*Item{item}); err == nil {
+				err = r.conf.Retry.doWrite(ctx, func() error {
+					return r.storage.Update(ctx, item, original)
+				})
+			}
 		}
 	}
 	r.hooks.onUpdated(ctx, item, original, &err)
+	if err == nil {
+		r.afterChange(ctx, ActionUpdate, item, original)
+	} else if err == ErrConflict && r.conf.ContentionCooldown > 0 {
+		r.contention.record(original.ID, r.conf.ContentionCooldown)
+	}
 	return
 }
 
+// CheckInsert returns the error Insert would return because of a conflict of
+// the items with the stored items or between themselves: ErrConflict if an
+// item has the id of another one, or a *UniqueError if a UniqueTogether
+// constraint is violated. Nothing is stored and no hook is called, so dry
+// runs can report these errors.
+func (r *Resource) CheckInsert(ctx context.Context, items []*Item) error {
+	ids := make([]query.Value, 0, len(items))
+	for _, item := range items {
+		for _, id := range ids {
+			if reflect.DeepEqual(id, item.ID) {
+				return ErrConflict
+			}
+		}
+		ids = append(ids, item.ID)
+	}
+	l, err := r.storage.Find(ctx, &query.Query{
+		Predicate: query.Predicate{&query.In{Field: "id", Values: ids}},
+		Window:    &query.Window{Limit: 1},
+	})
+	if err != nil {
+		return err
+	}
+	if len(l.Items) > 0 {
+		return ErrConflict
+	}
+	return r.checkUnique(ctx, items, nil)
+}
+
+// CheckUpdate returns the *UniqueError Update would return if replacing
+// original by item violates a UniqueTogether constraint. Nothing is stored and
+// no hook is called, so dry runs can report this error.
+func (r *Resource) CheckUpdate(ctx context.Context, item *Item, original *Item) error {
+	return r.checkUnique(ctx, []*Item{item}, original)
+}
+
 // Delete implements Storer interface.
 func (r *Resource) Delete(ctx context.Context, item *Item) (err error) {
 	if LoggerLevel <= LogLevelDebug && Logger != nil {
@@ -410,9 +683,14 @@ func (r *Resource) Delete(ctx context.Context, item *Item) (err error) {
 		}(time.Now())
 	}
 	if err = r.hooks.onDelete(ctx, item); err == nil {
-		err = r.storage.Delete(ctx, item)
+		err = r.conf.Retry.doWrite(ctx, func() error {
+			return r.storage.Delete(ctx, item)
+		})
 	}
 	r.hooks.onDeleted(ctx, item, &err)
+	if err == nil {
+		r.afterChange(ctx, ActionDelete, nil, item)
+	}
 	return
 }
 
@@ -433,3 +711,24 @@ func (r *Resource) Clear(ctx context.Context, q *query.Query) (deleted int, err
 	r.hooks.onCleared(ctx, q, &deleted, &err)
 	return
 }
+
+// Aggregate calls the Aggregate method on the storage handler. The OnFind
+// hooks are called first with a query holding the lookup, and may alter it.
+// If the storage handler does not implement the Aggregator interface,
+// ErrNoAggregator is returned.
+func (r *Resource) Aggregate(ctx context.Context, lookup query.Predicate, groupBy []string, metrics []Metric) (results []AggResult, err error) {
+	if LoggerLevel <= LogLevelDebug && Logger != nil {
+		defer func(t time.Time) {
+			Logger(ctx, LogLevelDebug, fmt.Sprintf("%s.Aggregate(%v, %v)", r.path, groupBy, metrics), map[string]interface{}{
+				"duration": time.Since(t),
+				"groups":   len(results),
+				"error":    err,
+			})
+		}(time.Now())
+	}
+	q := &query.Query{Predicate: lookup}
+	if err = r.hooks.onFind(ctx, q); err != nil {
+		return nil, err
+	}
+	return r.storage.Aggregate(ctx, q.Predicate, groupBy, metrics)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/rs/rest-layer/schema"
 	"github.com/rs/rest-layer/schema/query"
@@ -412,6 +413,56 @@ func TestResourceFindError(t *testing.T) {
 	assert.True(t, postHook)
 }
 
+func TestResourceFindPartial(t *testing.T) {
+	s := newTestStorer()
+	// Streams items until the context is done, and returns what it got so far.
+	s.find = func(ctx context.Context, q *query.Query) (*ItemList, error) {
+		list := &ItemList{Total: -1}
+		for i := 1; i <= 2; i++ {
+			list.Items = append(list.Items, &Item{ID: i})
+		}
+		<-ctx.Done()
+		return list, ctx.Err()
+	}
+	ctx := context.Background()
+
+	// Without PartialFindTimeout, the storage is not given a deadline.
+	r := newResource("foo", schema.Schema{}, s, DefaultConf)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := r.Find(cctx, &query.Query{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	conf := DefaultConf
+	conf.PartialFindTimeout = 10 * time.Millisecond
+	r = newResource("foo", schema.Schema{}, s, conf)
+	l, err := r.Find(WithPartialResults(ctx), &query.Query{})
+	if assert.NoError(t, err) {
+		assert.True(t, l.Partial)
+		assert.Len(t, l.Items, 2)
+	}
+
+	// Callers not handling partial results are not given the deadline.
+	cctx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = r.Find(cctx, &query.Query{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// A cancellation of the request is not turned into a partial result.
+	cctx, cancel = context.WithCancel(WithPartialResults(ctx))
+	cancel()
+	_, err = r.Find(cctx, &query.Query{})
+	assert.Equal(t, context.Canceled, err)
+
+	// Storage handlers not returning partial results still fail.
+	s.find = func(ctx context.Context, q *query.Query) (*ItemList, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	_, err = r.Find(WithPartialResults(ctx), &query.Query{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
 func TestResourceFindPreHookError(t *testing.T) {
 	var preHook, postHook, handler bool
 	i := NewIndex()
@@ -929,3 +980,14 @@ func TestResourceClearPostHookError(t *testing.T) {
 	assert.True(t, handler)
 	assert.True(t, postHook)
 }
+
+func TestResourceWithTransactionNotImplemented(t *testing.T) {
+	r := newResource("foo", schema.Schema{}, newTestStorer(), DefaultConf)
+	called := false
+	err := r.WithTransaction(context.Background(), func(tx *Resource) error {
+		called = true
+		return nil
+	})
+	assert.Equal(t, ErrNotImplemented, err)
+	assert.False(t, called)
+}
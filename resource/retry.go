@@ -0,0 +1,75 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy defines how storage operations failing with a transient error
+// are retried. An error is transient if it, or any error it wraps, implements
+// a `Temporary() bool` method returning true (i.e.: a deadlock or a timeout
+// reported by the backend). Other errors fail immediately.
+//
+// As a transient error, like a timeout, doesn't tell if a write reached the
+// storage, retrying it could apply it twice. Writes are thus only retried if
+// the error also implements a `NotApplied() bool` method returning true,
+// telling nothing was written (i.e.: a deadlock rolled back by the backend or
+// a connection refused before the request was sent).
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// Operations are not retried if lower than 2.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled on each subsequent
+	// retry.
+	Backoff time.Duration
+}
+
+// do calls the read operation fn until it succeeds, fails with a non transient
+// error, the attempts are exhausted or the context is done.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	return p.retry(ctx, isTemporary, fn)
+}
+
+// doWrite is like do for the write operation fn, which is only retried if it
+// failed without writing anything.
+func (p RetryPolicy) doWrite(ctx context.Context, fn func() error) error {
+	return p.retry(ctx, func(err error) bool {
+		return isTemporary(err) && isNotApplied(err)
+	}, fn)
+}
+
+// retry calls fn until it succeeds, fails with an error which can't be
+// retried, the attempts are exhausted or the context is done.
+func (p RetryPolicy) retry(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	delay := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+			delay *= 2
+		}
+	}
+}
+
+// isTemporary returns true if the error is flagged as temporary.
+func isTemporary(err error) bool {
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// isNotApplied returns true if the error is flagged as having left no write
+// behind.
+func isNotApplied(err error) bool {
+	var n interface{ NotApplied() bool }
+	return errors.As(err, &n) && n.NotApplied()
+}
@@ -0,0 +1,84 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+	"github.com/stretchr/testify/assert"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "deadlock" }
+func (temporaryError) Temporary() bool { return true }
+
+// rolledBackError is a transient error which left no write behind.
+type rolledBackError struct{ temporaryError }
+
+func (rolledBackError) NotApplied() bool { return true }
+
+func TestResourceRetry(t *testing.T) {
+	s := newTestStorer()
+	failures, calls := 0, 0
+	s.find = func(ctx context.Context, q *query.Query) (*ItemList, error) {
+		calls++
+		if calls <= failures {
+			return nil, fmt.Errorf("find: %w", temporaryError{})
+		}
+		return &ItemList{Items: []*Item{{ID: 1}}}, nil
+	}
+	var insertErr error = rolledBackError{}
+	s.insert = func(ctx context.Context, items []*Item) error {
+		calls++
+		if calls <= failures {
+			return insertErr
+		}
+		return nil
+	}
+	conf := DefaultConf
+	conf.Retry = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	r := newResource("foo", schema.Schema{}, s, conf)
+	ctx := context.Background()
+
+	// Succeeds within the retry budget.
+	failures, calls = 2, 0
+	l, err := r.Find(ctx, &query.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, l.Items, 1)
+	assert.Equal(t, 3, calls)
+	failures, calls = 2, 0
+	assert.NoError(t, r.Insert(ctx, []*Item{{ID: 1, Payload: map[string]interface{}{"id": 1}}}))
+	assert.Equal(t, 3, calls)
+
+	// Writes which may have been applied are not retried.
+	failures, calls, insertErr = 2, 0, temporaryError{}
+	assert.EqualError(t, r.Insert(ctx, []*Item{{ID: 1, Payload: map[string]interface{}{"id": 1}}}), "deadlock")
+	assert.Equal(t, 1, calls)
+
+	// Fails once the attempts are exhausted.
+	failures, calls = 3, 0
+	_, err = r.Find(ctx, &query.Query{})
+	assert.EqualError(t, err, "find: deadlock")
+	assert.Equal(t, 3, calls)
+
+	// Non temporary errors fail immediately.
+	calls = 0
+	s.delete = func(ctx context.Context, item *Item) error {
+		calls++
+		return errors.New("broken")
+	}
+	assert.EqualError(t, r.Delete(ctx, &Item{ID: 1}), "broken")
+	assert.Equal(t, 1, calls)
+
+	// No retry by default.
+	failures, calls = 1, 0
+	r = newResource("foo", schema.Schema{}, s, DefaultConf)
+	_, err = r.Find(ctx, &query.Query{})
+	assert.EqualError(t, err, "find: deadlock")
+	assert.Equal(t, 1, calls)
+}
@@ -27,7 +27,9 @@ type Storer interface {
 	// If the fetching of the data is not immediate, the method must listen for
 	// cancellation on the passed ctx. If the operation is stopped due to
 	// context cancellation, the function must return the result of the
-	// ctx.Err() method.
+	// ctx.Err() method. The items fetched before the cancellation may be
+	// returned along with this error, so they can be used as a partial result
+	// (see Conf.PartialFindTimeout).
 	Find(ctx context.Context, q *query.Query) (*ItemList, error)
 	// Insert stores new items in the backend store. If any of the items does
 	// already exist, no item should be inserted and a resource.ErrConflict must
@@ -107,10 +109,90 @@ type Counter interface {
 	Count(ctx context.Context, q *query.Query) (int, error)
 }
 
+// CountEstimator is an optional interface a Storer can implement to provide a
+// cheap estimation of the total number of items a query would return (i.e.:
+// from the table statistics), used instead of Counter on large collections
+// when Conf.TotalEstimateThreshold is set.
+type CountEstimator interface {
+	// EstimateCount returns an estimation of the total number of items in the
+	// collection given the provided query filter.
+	EstimateCount(ctx context.Context, q *query.Query) (int, error)
+}
+
+// CollectionVersioner is an optional interface a Storer can implement to expose
+// a cheap version token of the collection (i.e.: a sequence incremented on
+// each write). It lets REST Layer answer list requests with a 304 Not Modified
+// when the collection did not change since the client's last request.
+type CollectionVersioner interface {
+	// CollectionVersion returns a token changing whenever the items matching
+	// the query lookup may have changed. A collection wide version satisfies
+	// this contract.
+	CollectionVersion(ctx context.Context, q *query.Query) (string, error)
+}
+
+// ChangeTracker is an optional interface a Storer can implement to track the
+// changes of its items, deletions included (i.e.: thru tombstones or a
+// changelog), so sync clients can fetch the delta of a collection since their
+// last synchronization.
+type ChangeTracker interface {
+	// Changes returns the last change of the items matching the query lookup
+	// which changed after the since token, being either a timestamp or a
+	// token previously returned as ChangeList.Token. An empty since returns
+	// all the items.
+	//
+	// Deleted items are returned as tombstones, which must be scoped by the
+	// query lookup as well, i.e.: by keeping in the tombstones the fields the
+	// lookup may filter on, like the owner of the item, so the ids of the
+	// items out of the lookup are not disclosed.
+	//
+	// If the query has a window, at most Window.Limit changes are returned,
+	// the oldest first, and the token identifies the last returned change so
+	// the next changes can be fetched with it.
+	Changes(ctx context.Context, q *query.Query, since string) (*ChangeList, error)
+}
+
+// Aggregator is an optional interface a Storer can implement to compute
+// metrics over groups of items directly in the storage engine.
+type Aggregator interface {
+	// Aggregate groups the items matching the lookup predicate by the values
+	// of the groupBy fields and computes the requested metrics for each group.
+	// If groupBy is empty, a single group with all matching items must be
+	// returned.
+	//
+	// If a metric operation is not implemented by the storage handler, a
+	// resource.ErrNotImplemented must be returned.
+	Aggregate(ctx context.Context, lookup query.Predicate, groupBy []string, metrics []Metric) ([]AggResult, error)
+}
+
+// Searcher is an optional interface a Storer can implement to provide full
+// text search.
+type Searcher interface {
+	// Search returns the items matching both the query and the full text
+	// search text on at least one of the given searchable fields. The sort
+	// and window of the query must be applied as for Find.
+	Search(ctx context.Context, text string, fields []string, q *query.Query) (*ItemList, error)
+}
+
+// Transactional is an optional interface a Storer can implement to perform
+// several writes atomically (i.e.: a parent item and its children).
+type Transactional interface {
+	// WithTransaction calls fn with a Storer performing its operations in a
+	// single transaction. The transaction must be committed if fn returns
+	// nil, or rolled back if it returns an error, which must be returned as
+	// is.
+	WithTransaction(ctx context.Context, fn func(tx Storer) error) error
+}
+
 type storageHandler interface {
 	Storer
 	MultiGetter
 	Counter
+	CountEstimator
+	CollectionVersioner
+	ChangeTracker
+	Aggregator
+	Searcher
+	Transactional
 	Get(ctx context.Context, id interface{}) (item *Item, err error)
 }
 
@@ -183,11 +265,18 @@ func (s storageWrapper) MultiGet(ctx context.Context, ids []interface{}) (items
 	return items, nil
 }
 
-// Find tries to use storer MultiGet with some pattern or Find otherwise.
+// Find uses the storer FindWithConsistency if a read consistency is requested
+// and supported, then tries to use storer MultiGet with some pattern or Find
+// otherwise.
 func (s storageWrapper) Find(ctx context.Context, q *query.Query) (list *ItemList, err error) {
 	if s.Storer == nil {
 		return nil, ErrNoStorage
 	}
+	if c := ConsistencyFromContext(ctx); c != DefaultConsistency {
+		if cr, ok := s.Storer.(ConsistencyReader); ok {
+			return cr.FindWithConsistency(ctx, q, c)
+		}
+	}
 	if mg, ok := s.Storer.(MultiGetter); ok {
 		// If storage supports MultiGetter interface, detect some common find
 		// pattern that could be converted to multi get.
@@ -272,3 +361,94 @@ func (s storageWrapper) Count(ctx context.Context, q *query.Query) (total int, e
 	}
 	return -1, ErrNotImplemented
 }
+
+// EstimateCount calls the storage's EstimateCount method if it implements the
+// CountEstimator interface or returns ErrNotImplemented otherwise.
+func (s storageWrapper) EstimateCount(ctx context.Context, q *query.Query) (total int, err error) {
+	if s.Storer == nil {
+		return -1, ErrNoStorage
+	}
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if c, ok := s.Storer.(CountEstimator); ok {
+		return c.EstimateCount(ctx, q)
+	}
+	return -1, ErrNotImplemented
+}
+
+// CollectionVersion calls the storage's CollectionVersion method if it
+// implements the CollectionVersioner interface or returns ErrNotImplemented
+// otherwise.
+func (s storageWrapper) CollectionVersion(ctx context.Context, q *query.Query) (string, error) {
+	if s.Storer == nil {
+		return "", ErrNoStorage
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if v, ok := s.Storer.(CollectionVersioner); ok {
+		return v.CollectionVersion(ctx, q)
+	}
+	return "", ErrNotImplemented
+}
+
+// Changes calls the storage's Changes method if it implements the
+// ChangeTracker interface or returns ErrNoChangeTracker otherwise.
+func (s storageWrapper) Changes(ctx context.Context, q *query.Query, since string) (*ChangeList, error) {
+	if s.Storer == nil {
+		return nil, ErrNoStorage
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if c, ok := s.Storer.(ChangeTracker); ok {
+		return c.Changes(ctx, q, since)
+	}
+	return nil, ErrNoChangeTracker
+}
+
+// Aggregate calls the storage's Aggregate method if it implements the
+// Aggregator interface or returns ErrNoAggregator otherwise.
+func (s storageWrapper) Aggregate(ctx context.Context, lookup query.Predicate, groupBy []string, metrics []Metric) ([]AggResult, error) {
+	if s.Storer == nil {
+		return nil, ErrNoStorage
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if a, ok := s.Storer.(Aggregator); ok {
+		return a.Aggregate(ctx, lookup, groupBy, metrics)
+	}
+	return nil, ErrNoAggregator
+}
+
+// Search calls the storage's Search method if it implements the Searcher
+// interface or returns ErrNoSearcher otherwise.
+func (s storageWrapper) Search(ctx context.Context, text string, fields []string, q *query.Query) (*ItemList, error) {
+	if s.Storer == nil {
+		return nil, ErrNoStorage
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if sr, ok := s.Storer.(Searcher); ok {
+		return sr.Search(ctx, text, fields, q)
+	}
+	return nil, ErrNoSearcher
+}
+
+// WithTransaction calls the storage's WithTransaction method if it implements
+// the Transactional interface or returns ErrNotImplemented otherwise.
+func (s storageWrapper) WithTransaction(ctx context.Context, fn func(tx Storer) error) error {
+	if s.Storer == nil {
+		return ErrNoStorage
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if t, ok := s.Storer.(Transactional); ok {
+		return t.WithTransaction(ctx, fn)
+	}
+	return ErrNotImplemented
+}
@@ -6,6 +6,8 @@ import (
 	"context"
 	"encoding/gob"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,6 +25,8 @@ type MemoryHandler struct {
 
 	items map[interface{}][]byte
 	ids   []interface{}
+	// version is incremented on each write.
+	version uint64
 }
 
 func init() {
@@ -56,6 +60,7 @@ func (m *MemoryHandler) store(item *resource.Item) error {
 		return err
 	}
 	m.items[item.ID] = data.Bytes()
+	m.version++
 	return nil
 }
 
@@ -76,6 +81,7 @@ func (m *MemoryHandler) fetch(id interface{}) (*resource.Item, bool, error) {
 // delete removes an item by this id without locking.
 func (m *MemoryHandler) delete(id interface{}) {
 	delete(m.items, id)
+	m.version++
 	// Remove id from id list
 	for i, _id := range m.ids {
 		if _id == id {
@@ -93,6 +99,11 @@ func (m *MemoryHandler) delete(id interface{}) {
 func (m *MemoryHandler) Insert(ctx context.Context, items []*resource.Item) (err error) {
 	m.Lock()
 	defer m.Unlock()
+	return m.insert(ctx, items)
+}
+
+// insert inserts new items without locking.
+func (m *MemoryHandler) insert(ctx context.Context, items []*resource.Item) (err error) {
 	err = handleWithLatency(m.Latency, ctx, func() error {
 		for _, item := range items {
 			if _, found := m.items[item.ID]; found {
@@ -115,6 +126,11 @@ func (m *MemoryHandler) Insert(ctx context.Context, items []*resource.Item) (err
 func (m *MemoryHandler) Update(ctx context.Context, item *resource.Item, original *resource.Item) (err error) {
 	m.Lock()
 	defer m.Unlock()
+	return m.update(ctx, item, original)
+}
+
+// update replaces an item without locking.
+func (m *MemoryHandler) update(ctx context.Context, item *resource.Item, original *resource.Item) (err error) {
 	err = handleWithLatency(m.Latency, ctx, func() error {
 		o, found, err := m.fetch(original.ID)
 		if !found {
@@ -135,6 +151,11 @@ func (m *MemoryHandler) Update(ctx context.Context, item *resource.Item, origina
 func (m *MemoryHandler) Delete(ctx context.Context, item *resource.Item) (err error) {
 	m.Lock()
 	defer m.Unlock()
+	return m.deleteItem(ctx, item)
+}
+
+// deleteItem deletes an item without locking.
+func (m *MemoryHandler) deleteItem(ctx context.Context, item *resource.Item) (err error) {
 	err = handleWithLatency(m.Latency, ctx, func() error {
 		o, found, err := m.fetch(item.ID)
 		if !found {
@@ -156,8 +177,13 @@ func (m *MemoryHandler) Delete(ctx context.Context, item *resource.Item) (err er
 func (m *MemoryHandler) Clear(ctx context.Context, q *query.Query) (total int, err error) {
 	m.Lock()
 	defer m.Unlock()
+	return m.clear(ctx, q)
+}
+
+// clear clears the items matching q without locking.
+func (m *MemoryHandler) clear(ctx context.Context, q *query.Query) (total int, err error) {
 	err = handleWithLatency(m.Latency, ctx, func() error {
-		list, err := m.find(ctx, q)
+		list, err := m.find(ctx, q, nil)
 		if err != nil {
 			return err
 		}
@@ -174,15 +200,98 @@ func (m *MemoryHandler) Clear(ctx context.Context, q *query.Query) (total int, e
 func (m *MemoryHandler) Find(ctx context.Context, q *query.Query) (list *resource.ItemList, err error) {
 	m.RLock()
 	defer m.RUnlock()
+	return m.findWithLatency(ctx, q)
+}
+
+// findWithLatency finds the items matching q without locking.
+func (m *MemoryHandler) findWithLatency(ctx context.Context, q *query.Query) (list *resource.ItemList, err error) {
+	err = handleWithLatency(m.Latency, ctx, func() error {
+		list, err = m.find(ctx, q, nil)
+		return err
+	})
+	return list, err
+}
+
+// WithTransaction implements resource.Transactional. The handler is locked for
+// the duration of the transaction, and the snapshot of its items taken before
+// calling fn is restored if fn returns an error.
+func (m *MemoryHandler) WithTransaction(ctx context.Context, fn func(tx resource.Storer) error) error {
+	m.Lock()
+	defer m.Unlock()
+	items := make(map[interface{}][]byte, len(m.items))
+	for id, data := range m.items {
+		items[id] = data
+	}
+	ids := append([]interface{}{}, m.ids...)
+	version := m.version
+	if err := fn(memoryTx{m}); err != nil {
+		m.items, m.ids, m.version = items, ids, version
+		return err
+	}
+	return nil
+}
 
+// memoryTx is the resource.Storer given to WithTransaction functions,
+// operating on the locked handler.
+type memoryTx struct {
+	m *MemoryHandler
+}
+
+func (tx memoryTx) Find(ctx context.Context, q *query.Query) (*resource.ItemList, error) {
+	return tx.m.findWithLatency(ctx, q)
+}
+
+func (tx memoryTx) Insert(ctx context.Context, items []*resource.Item) error {
+	return tx.m.insert(ctx, items)
+}
+
+func (tx memoryTx) Update(ctx context.Context, item *resource.Item, original *resource.Item) error {
+	return tx.m.update(ctx, item, original)
+}
+
+func (tx memoryTx) Delete(ctx context.Context, item *resource.Item) error {
+	return tx.m.deleteItem(ctx, item)
+}
+
+func (tx memoryTx) Clear(ctx context.Context, q *query.Query) (int, error) {
+	return tx.m.clear(ctx, q)
+}
+
+func (tx memoryTx) CollectionVersion(ctx context.Context, q *query.Query) (string, error) {
+	return strconv.FormatUint(tx.m.version, 10), nil
+}
+
+// CollectionVersion returns the number of writes performed on the handler.
+func (m *MemoryHandler) CollectionVersion(ctx context.Context, q *query.Query) (string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return strconv.FormatUint(m.version, 10), nil
+}
+
+// Search items from memory matching q and containing text, ignoring case, in
+// the string value of one of the given fields.
+func (m *MemoryHandler) Search(ctx context.Context, text string, fields []string, q *query.Query) (list *resource.ItemList, err error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	text = strings.ToLower(text)
+	match := func(payload map[string]interface{}) bool {
+		for _, field := range fields {
+			if s, ok := payload[field].(string); ok && strings.Contains(strings.ToLower(s), text) {
+				return true
+			}
+		}
+		return false
+	}
 	err = handleWithLatency(m.Latency, ctx, func() error {
-		list, err = m.find(ctx, q)
+		list, err = m.find(ctx, q, match)
 		return err
 	})
 	return list, err
 }
 
-func (m *MemoryHandler) find(ctx context.Context, q *query.Query) (*resource.ItemList, error) {
+// find returns the items matching q and the optional match function.
+func (m *MemoryHandler) find(ctx context.Context, q *query.Query, match func(payload map[string]interface{}) bool) (*resource.ItemList, error) {
 	// Fetch all items matching the filter
 	list := resource.ItemList{Items: []*resource.Item{}}
 	for _, id := range m.ids {
@@ -190,7 +299,7 @@ func (m *MemoryHandler) find(ctx context.Context, q *query.Query) (*resource.Ite
 		if err != nil {
 			return nil, err
 		}
-		if !q.Predicate.Match(item.Payload) {
+		if !q.Predicate.Match(item.Payload) || (match != nil && !match(item.Payload)) {
 			continue
 		}
 		list.Items = append(list.Items, item)
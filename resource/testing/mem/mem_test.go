@@ -0,0 +1,58 @@
+package mem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryHandlerTransaction(t *testing.T) {
+	h := NewHandler()
+	ctx := context.Background()
+	h.Insert(ctx, []*resource.Item{{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1"}}})
+	idx := resource.NewIndex()
+	rsrc := idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, h, resource.DefaultConf)
+	ids := func() []interface{} {
+		l, err := h.Find(ctx, &query.Query{})
+		assert.NoError(t, err)
+		ids := []interface{}{}
+		for _, item := range l.Items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	// A failure in the middle of the transaction leaves no partial write.
+	errFailed := errors.New("failed")
+	err := rsrc.WithTransaction(ctx, func(tx *resource.Resource) error {
+		if err := tx.Insert(ctx, []*resource.Item{{ID: "2", Payload: map[string]interface{}{"id": "2"}}}); err != nil {
+			return err
+		}
+		original, err := tx.Get(ctx, "1")
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, original); err != nil {
+			return err
+		}
+		assert.Len(t, h.items, 1)
+		return errFailed
+	})
+	assert.Equal(t, errFailed, err)
+	assert.Equal(t, []interface{}{"1"}, ids())
+
+	// Writes are committed when the function succeeds.
+	err = rsrc.WithTransaction(ctx, func(tx *resource.Resource) error {
+		return tx.Insert(ctx, []*resource.Item{
+			{ID: "2", Payload: map[string]interface{}{"id": "2"}},
+			{ID: "3", Payload: map[string]interface{}{"id": "3"}},
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"1", "2", "3"}, ids())
+}
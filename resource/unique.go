@@ -0,0 +1,76 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/rs/rest-layer/schema/query"
+)
+
+// UniqueError is returned when storing an item would violate one of the
+// schema.Schema.UniqueTogether constraints of the resource.
+type UniqueError struct {
+	// Fields are the fields of the violated constraint.
+	Fields []string
+}
+
+// Error implements the error interface.
+func (e *UniqueError) Error() string {
+	return fmt.Sprintf("Duplicate value for unique fields %s", strings.Join(e.Fields, ", "))
+}
+
+// checkUnique returns a *UniqueError if any of the items shares the values of
+// a UniqueTogether constraint with another item of the batch or a stored item
+// other than the original.
+func (r *Resource) checkUnique(ctx context.Context, items []*Item, original *Item) error {
+	for _, fields := range r.schema.UniqueTogether {
+		for i, item := range items {
+			values, ok := uniqueValues(item, fields)
+			if !ok {
+				continue
+			}
+			if original != nil {
+				if ovalues, ok := uniqueValues(original, fields); ok && reflect.DeepEqual(values, ovalues) {
+					// Unchanged values can't introduce a conflict.
+					continue
+				}
+			}
+			for _, other := range items[:i] {
+				if ovalues, ok := uniqueValues(other, fields); ok && reflect.DeepEqual(values, ovalues) {
+					return &UniqueError{Fields: fields}
+				}
+			}
+			q := &query.Query{Window: &query.Window{Limit: 1}}
+			for j, field := range fields {
+				q.Predicate = append(q.Predicate, &query.Equal{Field: field, Value: values[j]})
+			}
+			if original != nil {
+				q.Predicate = append(q.Predicate, &query.NotEqual{Field: "id", Value: original.ID})
+			}
+			l, err := r.storage.Find(ctx, q)
+			if err != nil {
+				return err
+			}
+			if len(l.Items) > 0 {
+				return &UniqueError{Fields: fields}
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueValues returns the values of the fields in the item's payload, or
+// false if any of them is missing or null.
+func uniqueValues(item *Item, fields []string) ([]interface{}, bool) {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		v, found := item.Payload[field]
+		if !found || v == nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
@@ -0,0 +1,268 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/rest-layer/schema"
+)
+
+// DefaultValidationCacheTTL is the duration validation results are cached
+// when Conf.ValidationCacheTTL is not set.
+const DefaultValidationCacheTTL = 10 * time.Second
+
+// ValidationResult holds the result of a schema validation.
+type ValidationResult struct {
+	Doc  map[string]interface{}
+	Errs map[string][]interface{}
+	// Warnings holds the warnings raised by the validation (see
+	// schema.WithWarnings).
+	Warnings []string
+}
+
+// ValidationCache is an interface to a cache storing the result of schema
+// validations. It may be shared between resources and implemented on top of
+// a distributed cache. Keys are unique for a given resource, schema
+// compilation and validated payload.
+type ValidationCache interface {
+	// Get returns the result stored for key if any and not expired.
+	Get(key string) (ValidationResult, bool)
+	// Set stores the result for key for the duration of ttl.
+	Set(key string, res ValidationResult, ttl time.Duration)
+}
+
+// MemoryValidationCache is an in memory ValidationCache.
+type MemoryValidationCache struct {
+	mu      sync.Mutex
+	entries map[string]validationCacheEntry
+	purged  time.Time
+}
+
+type validationCacheEntry struct {
+	res     ValidationResult
+	expires time.Time
+}
+
+// NewMemoryValidationCache creates an empty in memory validation cache.
+func NewMemoryValidationCache() *MemoryValidationCache {
+	return &MemoryValidationCache{entries: map[string]validationCacheEntry{}}
+}
+
+// Get implements ValidationCache.
+func (c *MemoryValidationCache) Get(key string) (ValidationResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.entries[key]
+	if !found {
+		return ValidationResult{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return ValidationResult{}, false
+	}
+	return e.res, true
+}
+
+// Set implements ValidationCache. Expired entries are purged at most once per
+// second.
+func (c *MemoryValidationCache) Set(key string, res ValidationResult, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.purged) >= time.Second {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.purged = now
+	}
+	c.entries[key] = validationCacheEntry{res: res, expires: now.Add(ttl)}
+}
+
+// cachedValidator wraps a validator to memoize the results of Validate in a
+// ValidationCache.
+type cachedValidator struct {
+	schema.Validator
+	cache ValidationCache
+	ttl   time.Duration
+	// prefix identifies the resource and the compilation of its schema so
+	// results are invalidated when the schema is recompiled.
+	prefix string
+}
+
+// Validate implements schema.Validator.
+func (v cachedValidator) Validate(changes map[string]interface{}, base map[string]interface{}) (doc map[string]interface{}, errs map[string][]interface{}) {
+	return v.ValidateMode(changes, base, 0)
+}
+
+// ValidateMode implements schema.ModeValidator. A zero mode uses the
+// validator's Validate method.
+func (v cachedValidator) ValidateMode(changes map[string]interface{}, base map[string]interface{}, mode schema.Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	validate := func(context.Context) (map[string]interface{}, map[string][]interface{}) {
+		if mode == 0 {
+			return v.Validator.Validate(changes, base)
+		}
+		return schema.ValidateWithMode(v.Validator, changes, base, mode)
+	}
+	state, cacheable := v.externalState()
+	if !cacheable {
+		return validate(context.Background())
+	}
+	return v.cached(context.Background(), v.key(changes, base, mode, "", state, nil), validate)
+}
+
+// ValidateContext implements schema.ContextValidator. The variants of the
+// validators selected for ctx and the parent document of the item, if any, are
+// part of the cache key. The warnings collected in ctx, if any, are cached
+// with the result.
+func (v cachedValidator) ValidateContext(ctx context.Context, changes map[string]interface{}, base map[string]interface{}, mode schema.Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	validate := func(ctx context.Context) (map[string]interface{}, map[string][]interface{}) {
+		return schema.ValidateWithContext(ctx, v.Validator, changes, base, mode)
+	}
+	state, cacheable := v.externalState()
+	if !cacheable {
+		return validate(ctx)
+	}
+	var variants string
+	if vs, ok := v.Validator.(schema.VariantSelector); ok {
+		variants = vs.Variants(ctx)
+	}
+	return v.cached(ctx, v.key(changes, base, mode, variants, state, schema.ParentFromContext(ctx)), validate)
+}
+
+// externalState returns the state of the external data the validator depends
+// on, and false if its results must not be cached (see
+// schema.ExternalStateSelector).
+func (v cachedValidator) externalState() (string, bool) {
+	if es, ok := v.Validator.(schema.ExternalStateSelector); ok {
+		return es.ExternalState()
+	}
+	return "", true
+}
+
+// cached returns the validation result stored under key or stores the result
+// of validate. The warnings of the validation are reported in ctx either way.
+func (v cachedValidator) cached(ctx context.Context, key string, validate func(ctx context.Context) (map[string]interface{}, map[string][]interface{})) (doc map[string]interface{}, errs map[string][]interface{}) {
+	if res, found := v.cache.Get(key); found {
+		schema.AddWarnings(ctx, res.Warnings...)
+		return copyValidationResult(res)
+	}
+	// Collect the warnings of this validation alone so they can be cached.
+	vctx := schema.WithWarnings(ctx)
+	doc, errs = validate(vctx)
+	warnings := schema.WarningsFromContext(vctx)
+	schema.AddWarnings(ctx, warnings...)
+	// Store a copy so the caller can't alter the cached result.
+	v.cache.Set(key, ValidationResult{Doc: copyMap(doc), Errs: errs, Warnings: warnings}, v.ttl)
+	return doc, errs
+}
+
+// key computes the cache key of the validation of changes and base for mode
+// with the given validator variants, external state and parent document.
+func (v cachedValidator) key(changes, base map[string]interface{}, mode schema.Mode, variants, state string, parent map[string]interface{}) string {
+	var b bytes.Buffer
+	b.WriteString(strconv.Itoa(int(mode)))
+	b.WriteByte(0)
+	b.WriteString(variants)
+	b.WriteByte(0)
+	b.WriteString(state)
+	b.WriteByte(0)
+	writeKeyValue(&b, changes)
+	b.WriteByte(0)
+	writeKeyValue(&b, base)
+	if parent != nil {
+		b.WriteByte(0)
+		writeKeyValue(&b, parent)
+	}
+	return fmt.Sprintf("%s:%x", v.prefix, sha1.Sum(b.Bytes()))
+}
+
+// writeKeyValue writes a deterministic representation of v. Unlike JSON, the
+// representation differentiates types (i.e.: int vs float64) and tombstones.
+func writeKeyValue(b *bytes.Buffer, v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for _, k := range keys {
+			b.WriteString(strconv.Quote(k))
+			b.WriteByte(':')
+			writeKeyValue(b, t[k])
+			b.WriteByte(',')
+		}
+		b.WriteByte('}')
+	case []interface{}:
+		b.WriteByte('[')
+		for _, e := range t {
+			writeKeyValue(b, e)
+			b.WriteByte(',')
+		}
+		b.WriteByte(']')
+	case string:
+		b.WriteString(strconv.Quote(t))
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case float64:
+		b.WriteString("f")
+		b.WriteString(strconv.FormatFloat(t, 'g', -1, 64))
+	case int:
+		b.WriteString("i")
+		b.WriteString(strconv.Itoa(t))
+	case nil:
+		b.WriteString("null")
+	default:
+		if v == schema.Tombstone {
+			b.WriteString("tombstone")
+			return
+		}
+		fmt.Fprintf(b, "%T(%#v)", v, v)
+	}
+}
+
+func copyValidationResult(res ValidationResult) (map[string]interface{}, map[string][]interface{}) {
+	var errs map[string][]interface{}
+	if res.Errs != nil {
+		errs = make(map[string][]interface{}, len(res.Errs))
+		for k, v := range res.Errs {
+			errs[k] = v
+		}
+	}
+	return copyMap(res.Doc), errs
+}
+
+// copyMap deep copies maps and slices found in m.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = copyValue(v)
+	}
+	return c
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return copyMap(t)
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, e := range t {
+			s[i] = copyValue(e)
+		}
+		return s
+	}
+	return v
+}
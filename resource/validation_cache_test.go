@@ -0,0 +1,246 @@
+package resource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingCache struct {
+	*MemoryValidationCache
+	hits int
+}
+
+func (c *countingCache) Get(key string) (ValidationResult, bool) {
+	res, found := c.MemoryValidationCache.Get(key)
+	if found {
+		c.hits++
+	}
+	return res, found
+}
+
+func TestValidationCache(t *testing.T) {
+	cache := &countingCache{MemoryValidationCache: NewMemoryValidationCache()}
+	i := NewIndex()
+	conf := DefaultConf
+	conf.ValidationCache = cache
+	r := i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"name": {Validator: &schema.String{MaxLen: 5}},
+		"tags": {},
+	}}, nil, conf)
+	if !assert.NoError(t, i.(*index).Compile()) {
+		return
+	}
+
+	doc, errs := r.Validator().Validate(map[string]interface{}{"name": "foo", "tags": []interface{}{"a"}}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo", "tags": []interface{}{"a"}}, doc)
+	assert.Equal(t, 0, cache.hits)
+
+	// Altering the returned doc must not alter the cached result.
+	doc["name"] = "bar"
+	doc["tags"].([]interface{})[0] = "b"
+	doc, errs = r.Validator().Validate(map[string]interface{}{"name": "foo", "tags": []interface{}{"a"}}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo", "tags": []interface{}{"a"}}, doc)
+	assert.Equal(t, 1, cache.hits)
+
+	// A changed payload must not be served the cached result.
+	doc, errs = r.Validator().Validate(map[string]interface{}{"name": "foobar", "tags": []interface{}{"a"}}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"name": {"is longer than 5"}}, errs)
+	assert.Equal(t, 1, cache.hits)
+	doc, errs = r.Validator().Validate(map[string]interface{}{"name": "foo"}, map[string]interface{}{"tags": []interface{}{"b"}})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo", "tags": []interface{}{"b"}}, doc)
+	assert.Equal(t, 1, cache.hits)
+
+	// Recompiling the schema invalidates the cache.
+	assert.NoError(t, i.(*index).Compile())
+	r.Validator().Validate(map[string]interface{}{"name": "foo", "tags": []interface{}{"a"}}, map[string]interface{}{})
+	assert.Equal(t, 1, cache.hits)
+}
+
+func TestValidationCacheMode(t *testing.T) {
+	cache := &countingCache{MemoryValidationCache: NewMemoryValidationCache()}
+	i := NewIndex()
+	conf := DefaultConf
+	conf.ValidationCache = cache
+	r := i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"name": {RequiredOn: []schema.Mode{schema.Create}},
+		"tags": {},
+	}}, nil, conf)
+	if !assert.NoError(t, i.(*index).Compile()) {
+		return
+	}
+	changes := map[string]interface{}{"tags": []interface{}{"a"}}
+
+	_, errs := schema.ValidateWithMode(r.Validator(), changes, map[string]interface{}{}, schema.Create)
+	assert.Equal(t, map[string][]interface{}{"name": {"required"}}, errs)
+	// The cached result of a mode must not be used for another one.
+	_, errs = schema.ValidateWithMode(r.Validator(), changes, map[string]interface{}{}, schema.Update)
+	assert.Len(t, errs, 0)
+	_, errs = schema.ValidateWithMode(r.Validator(), changes, map[string]interface{}{}, schema.Create)
+	assert.Equal(t, map[string][]interface{}{"name": {"required"}}, errs)
+	assert.Equal(t, 1, cache.hits)
+}
+
+func TestValidationCacheVariants(t *testing.T) {
+	type cohortKey struct{}
+	cache := &countingCache{MemoryValidationCache: NewMemoryValidationCache()}
+	i := NewIndex()
+	conf := DefaultConf
+	conf.ValidationCache = cache
+	r := i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"name": {
+			Validator: &schema.String{MaxLen: 5},
+			VariantValidators: map[string]schema.FieldValidator{
+				"strict": &schema.String{MaxLen: 2},
+			},
+			Variant: func(ctx context.Context) string {
+				cohort, _ := ctx.Value(cohortKey{}).(string)
+				return cohort
+			},
+		},
+	}}, nil, conf)
+	if !assert.NoError(t, i.(*index).Compile()) {
+		return
+	}
+	changes := map[string]interface{}{"name": "foo"}
+	strict := context.WithValue(context.Background(), cohortKey{}, "strict")
+
+	_, errs := schema.ValidateWithContext(context.Background(), r.Validator(), changes, map[string]interface{}{}, schema.Create)
+	assert.Len(t, errs, 0)
+	// The cached result of a variant must not be used for another one.
+	_, errs = schema.ValidateWithContext(strict, r.Validator(), changes, map[string]interface{}{}, schema.Create)
+	assert.Equal(t, map[string][]interface{}{"name": {"is longer than 2"}}, errs)
+	_, errs = schema.ValidateWithContext(context.Background(), r.Validator(), changes, map[string]interface{}{}, schema.Create)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, 1, cache.hits)
+}
+
+// shortWarner accepts any string and warns on those shorter than 3 bytes.
+type shortWarner struct{}
+
+func (v shortWarner) Validate(value interface{}) (interface{}, error) {
+	value, _, err := v.ValidateWarn(value)
+	return value, err
+}
+
+func (shortWarner) ValidateWarn(value interface{}) (interface{}, []string, error) {
+	if s, _ := value.(string); len(s) < 3 {
+		return value, []string{"short"}, nil
+	}
+	return value, nil, nil
+}
+
+func TestValidationCacheWarnings(t *testing.T) {
+	cache := &countingCache{MemoryValidationCache: NewMemoryValidationCache()}
+	i := NewIndex()
+	conf := DefaultConf
+	conf.ValidationCache = cache
+	r := i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"name": {Validator: &shortWarner{}},
+	}}, nil, conf)
+	if !assert.NoError(t, i.(*index).Compile()) {
+		return
+	}
+	changes := map[string]interface{}{"name": "fo"}
+
+	// Warnings are cached even when not collected by the first validation.
+	schema.ValidateWithContext(context.Background(), r.Validator(), changes, map[string]interface{}{}, schema.Create)
+	ctx := schema.WithWarnings(context.Background())
+	_, errs := schema.ValidateWithContext(ctx, r.Validator(), changes, map[string]interface{}{}, schema.Create)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, 1, cache.hits)
+	assert.Equal(t, []string{"name: short"}, schema.WarningsFromContext(ctx))
+}
+
+func TestValidationCacheReferenceEnum(t *testing.T) {
+	statuses := []*Item{{ID: "1", Payload: map[string]interface{}{"id": "1", "name": "draft"}}}
+	s := newTestStorer()
+	s.find = func(ctx context.Context, q *query.Query) (*ItemList, error) {
+		return &ItemList{Items: statuses}, nil
+	}
+	cache := &countingCache{MemoryValidationCache: NewMemoryValidationCache()}
+	conf := DefaultConf
+	conf.ValidationCache = cache
+	status := &schema.ReferenceEnum{Path: "statuses", Field: "name"}
+	uncached := &schema.ReferenceEnum{Path: "statuses", Field: "name", CacheTTL: -1}
+	i := NewIndex()
+	i.Bind("statuses", schema.Schema{Fields: schema.Fields{"id": {}, "name": {}}}, s, DefaultConf)
+	posts := i.Bind("posts", schema.Schema{Fields: schema.Fields{
+		"status": {Validator: status},
+	}}, nil, conf)
+	drafts := i.Bind("drafts", schema.Schema{Fields: schema.Fields{
+		"status": {Validator: &schema.Array{Values: schema.Field{Validator: uncached}}},
+	}}, nil, conf)
+	if !assert.NoError(t, i.(*index).Compile()) {
+		return
+	}
+
+	_, errs := posts.Validator().Validate(map[string]interface{}{"status": "published"}, map[string]interface{}{})
+	assert.Len(t, errs, 1)
+	statuses = append(statuses, &Item{ID: "2", Payload: map[string]interface{}{"id": "2", "name": "published"}})
+	_, errs = posts.Validator().Validate(map[string]interface{}{"status": "published"}, map[string]interface{}{})
+	assert.Len(t, errs, 1)
+	assert.Equal(t, 1, cache.hits)
+
+	// Invalidating the enum invalidates the cached results.
+	status.Invalidate()
+	_, errs = posts.Validator().Validate(map[string]interface{}{"status": "published"}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, 1, cache.hits)
+
+	// The results of enums which values are not cached are not cached either.
+	_, errs = drafts.Validator().Validate(map[string]interface{}{"status": []interface{}{"published"}}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	statuses = statuses[:1]
+	_, errs = drafts.Validator().Validate(map[string]interface{}{"status": []interface{}{"published"}}, map[string]interface{}{})
+	assert.Len(t, errs, 1)
+	assert.Equal(t, 1, cache.hits)
+}
+
+func TestMemoryValidationCacheExpire(t *testing.T) {
+	c := NewMemoryValidationCache()
+	c.Set("a", ValidationResult{Doc: map[string]interface{}{"foo": "bar"}}, time.Hour)
+	c.Set("b", ValidationResult{}, -time.Second)
+	res, found := c.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, res.Doc)
+	_, found = c.Get("b")
+	assert.False(t, found)
+}
+
+func BenchmarkValidationCache(b *testing.B) {
+	s := schema.Schema{Fields: schema.Fields{
+		"name":  {Validator: &schema.String{Regexp: "^[a-z ]+$"}},
+		"email": {Validator: &schema.String{Regexp: "^[^@]+@[^@]+$"}},
+		"age":   {Validator: &schema.Integer{}},
+		"tags":  {Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{}}}},
+	}}
+	changes := map[string]interface{}{
+		"name":  "john doe",
+		"email": "john@example.com",
+		"age":   42,
+		"tags":  []interface{}{"foo", "bar", "baz"},
+	}
+	for name, cache := range map[string]ValidationCache{"NoCache": nil, "Cache": NewMemoryValidationCache()} {
+		conf := DefaultConf
+		conf.ValidationCache = cache
+		i := NewIndex()
+		r := i.Bind("foo", s, nil, conf)
+		if err := i.(*index).Compile(); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.Validator().Validate(changes, map[string]interface{}{})
+			}
+		})
+	}
+}
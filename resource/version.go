@@ -0,0 +1,398 @@
+package resource
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+)
+
+// AddVersion registers an alternative version of the resource, with its own
+// schema, sharing the storage of the resource. The rest package selects the
+// version of a request from a vendor media type in its Accept header (i.e.:
+// application/vnd.myapi.v2+json) or from a path prefix (i.e.: /v2/users).
+//
+// The mapping maps the fields of the version's schema to the stored fields
+// they are persisted as; fields not listed are stored under their own name.
+// Each version, including the resource itself once a version is added, only
+// sees the stored fields part of its schema, the other ones being preserved on
+// update.
+//
+// The returned resource inherits the configuration of the resource. Hooks must
+// be registered on it separately.
+//
+// This method will panic if the version is already registered.
+func (r *Resource) AddVersion(version string, s schema.Schema, mapping map[string]string) *Resource {
+	if _, found := r.versions[version]; found {
+		logPanicf(nil, "Cannot add version `%s' to `%s': already registered", version, r.path)
+	}
+	var shared storageHandler
+	if vs, ok := r.versionStorer(); ok {
+		shared = vs.storage
+	} else {
+		shared = r.storage
+		r.storage = storageWrapper{newVersionStorer(shared, r.schema, nil)}
+	}
+	vr := newResource(r.name, s, newVersionStorer(shared, s, mapping), r.conf)
+	vr.path = r.path
+	vr.parentField = r.parentField
+	if r.versions == nil {
+		r.versions = map[string]*Resource{}
+	}
+	r.versions[version] = vr
+	return vr
+}
+
+// Versions returns the sorted names of the versions registered with
+// AddVersion.
+func (r *Resource) Versions() []string {
+	versions := make([]string, 0, len(r.versions))
+	for version := range r.versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// versionStorer returns the version storer wrapping the storage of r, if a
+// version has been added to r.
+func (r *Resource) versionStorer() (*versionStorer, bool) {
+	sw, ok := r.storage.(storageWrapper)
+	if !ok {
+		return nil, false
+	}
+	vs, ok := sw.Storer.(*versionStorer)
+	return vs, ok
+}
+
+// GetVersion returns the version of the resource registered with AddVersion.
+func (r *Resource) GetVersion(version string) (*Resource, bool) {
+	vr, found := r.versions[version]
+	return vr, found
+}
+
+// versionStorer presents the documents of a shared storage thru the view of a
+// resource version. It implements all the optional storage interfaces, which
+// return the same errors as the shared storage when it does not implement
+// them.
+type versionStorer struct {
+	storage storageHandler
+	// toStorage maps view fields to stored fields.
+	toStorage map[string]string
+	// toView maps stored fields to the view fields.
+	toView map[string]string
+}
+
+func newVersionStorer(storage storageHandler, s schema.Schema, mapping map[string]string) *versionStorer {
+	vs := &versionStorer{
+		storage:   storage,
+		toStorage: map[string]string{},
+		toView:    map[string]string{},
+	}
+	for name := range s.Fields {
+		stored := name
+		if m, found := mapping[name]; found {
+			stored = m
+		}
+		vs.toStorage[name] = stored
+		vs.toView[stored] = name
+	}
+	return vs
+}
+
+// storageField returns the stored name of a (possibly dotted) view field.
+func (vs *versionStorer) storageField(name string) string {
+	field, sub := name, ""
+	if i := strings.IndexByte(name, '.'); i != -1 {
+		field, sub = name[:i], name[i:]
+	}
+	if stored, found := vs.toStorage[field]; found {
+		return stored + sub
+	}
+	return name
+}
+
+// storageItem returns a copy of the item with its payload translated to the
+// stored fields.
+func (vs *versionStorer) storageItem(item *Item) *Item {
+	i := *item
+	i.Payload = make(map[string]interface{}, len(item.Payload))
+	for k, v := range item.Payload {
+		i.Payload[vs.storageField(k)] = v
+	}
+	return &i
+}
+
+// viewItem returns a copy of the item with its payload translated to the view
+// fields, hiding the stored fields not part of the view.
+func (vs *versionStorer) viewItem(item *Item) *Item {
+	i := *item
+	i.Payload = make(map[string]interface{}, len(item.Payload))
+	for k, v := range item.Payload {
+		if name, found := vs.toView[k]; found {
+			i.Payload[name] = v
+		}
+	}
+	return &i
+}
+
+func (vs *versionStorer) storageQuery(q *query.Query) *query.Query {
+	sq := *q
+	sq.Predicate = vs.storagePredicate(q.Predicate)
+	if len(q.Sort) > 0 {
+		sq.Sort = make(query.Sort, len(q.Sort))
+		for i, s := range q.Sort {
+			sq.Sort[i] = query.SortField{Name: vs.storageField(s.Name), Reversed: s.Reversed}
+		}
+	}
+	return &sq
+}
+
+// storagePredicate returns a copy of the predicate with its fields translated
+// to the stored fields.
+func (vs *versionStorer) storagePredicate(p query.Predicate) query.Predicate {
+	if p == nil {
+		return nil
+	}
+	sp := make(query.Predicate, len(p))
+	for i, exp := range p {
+		sp[i] = vs.storageExpression(exp)
+	}
+	return sp
+}
+
+func (vs *versionStorer) storageExpression(exp query.Expression) query.Expression {
+	switch t := exp.(type) {
+	case *query.And:
+		and := query.And(vs.storagePredicate(query.Predicate(*t)))
+		return &and
+	case *query.Or:
+		or := query.Or(vs.storagePredicate(query.Predicate(*t)))
+		return &or
+	case *query.In:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.NotIn:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.Equal:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.NotEqual:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.Exist:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.NotExist:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.GreaterThan:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.GreaterOrEqual:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.LowerThan:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.LowerOrEqual:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.Regex:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	case *query.ElemMatch:
+		e := *t
+		e.Field = vs.storageField(e.Field)
+		return &e
+	}
+	return exp
+}
+
+// Insert implements Storer.
+func (vs *versionStorer) Insert(ctx context.Context, items []*Item) error {
+	stored := make([]*Item, len(items))
+	for i, item := range items {
+		stored[i] = vs.storageItem(item)
+	}
+	return vs.storage.Insert(ctx, stored)
+}
+
+// Update implements Storer. The stored fields not part of the view are
+// preserved.
+func (vs *versionStorer) Update(ctx context.Context, item *Item, original *Item) error {
+	l, err := vs.storage.Find(ctx, &query.Query{
+		Predicate: query.Predicate{&query.Equal{Field: "id", Value: original.ID}},
+		Window:    &query.Window{Limit: 1},
+	})
+	if err != nil {
+		return err
+	}
+	if len(l.Items) == 0 {
+		return ErrNotFound
+	}
+	current := l.Items[0]
+	stored := vs.storageItem(item)
+	for k, v := range current.Payload {
+		if _, visible := vs.toView[k]; !visible {
+			stored.Payload[k] = v
+		}
+	}
+	return vs.storage.Update(ctx, stored, original)
+}
+
+// Delete implements Storer.
+func (vs *versionStorer) Delete(ctx context.Context, item *Item) error {
+	return vs.storage.Delete(ctx, item)
+}
+
+// Clear implements Storer.
+func (vs *versionStorer) Clear(ctx context.Context, q *query.Query) (int, error) {
+	return vs.storage.Clear(ctx, vs.storageQuery(q))
+}
+
+// viewList returns a copy of the list with its items translated to the view
+// fields. The error is returned as is so partial lists are translated too.
+func (vs *versionStorer) viewList(l *ItemList, err error) (*ItemList, error) {
+	if l == nil {
+		return l, err
+	}
+	vl := *l
+	vl.Items = make([]*Item, len(l.Items))
+	for i, item := range l.Items {
+		if item != nil {
+			vl.Items[i] = vs.viewItem(item)
+		}
+	}
+	return &vl, err
+}
+
+// Find implements Storer.
+func (vs *versionStorer) Find(ctx context.Context, q *query.Query) (*ItemList, error) {
+	return vs.viewList(vs.storage.Find(ctx, vs.storageQuery(q)))
+}
+
+// FindWithConsistency implements ConsistencyReader.
+func (vs *versionStorer) FindWithConsistency(ctx context.Context, q *query.Query, c Consistency) (*ItemList, error) {
+	return vs.viewList(vs.storage.Find(WithConsistency(ctx, c), vs.storageQuery(q)))
+}
+
+// MultiGet implements MultiGetter. Items not found are omitted.
+func (vs *versionStorer) MultiGet(ctx context.Context, ids []interface{}) ([]*Item, error) {
+	items, err := vs.storage.MultiGet(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	vitems := make([]*Item, 0, len(items))
+	for _, item := range items {
+		if item != nil {
+			vitems = append(vitems, vs.viewItem(item))
+		}
+	}
+	return vitems, nil
+}
+
+// Count implements Counter.
+func (vs *versionStorer) Count(ctx context.Context, q *query.Query) (int, error) {
+	return vs.storage.Count(ctx, vs.storageQuery(q))
+}
+
+// EstimateCount implements CountEstimator.
+func (vs *versionStorer) EstimateCount(ctx context.Context, q *query.Query) (int, error) {
+	return vs.storage.EstimateCount(ctx, vs.storageQuery(q))
+}
+
+// CollectionVersion implements CollectionVersioner.
+func (vs *versionStorer) CollectionVersion(ctx context.Context, q *query.Query) (string, error) {
+	return vs.storage.CollectionVersion(ctx, vs.storageQuery(q))
+}
+
+// Changes implements ChangeTracker.
+func (vs *versionStorer) Changes(ctx context.Context, q *query.Query, since string) (*ChangeList, error) {
+	l, err := vs.storage.Changes(ctx, vs.storageQuery(q), since)
+	if err != nil || l == nil {
+		return l, err
+	}
+	vl := *l
+	vl.Changes = make([]Change, len(l.Changes))
+	for i, c := range l.Changes {
+		if c.Item != nil {
+			c.Item = vs.viewItem(c.Item)
+		}
+		vl.Changes[i] = c
+	}
+	return &vl, nil
+}
+
+// Aggregate implements Aggregator.
+func (vs *versionStorer) Aggregate(ctx context.Context, lookup query.Predicate, groupBy []string, metrics []Metric) ([]AggResult, error) {
+	storedGroupBy := make([]string, len(groupBy))
+	for i, field := range groupBy {
+		storedGroupBy[i] = vs.storageField(field)
+	}
+	storedMetrics := make([]Metric, len(metrics))
+	for i, m := range metrics {
+		if m.Field != "" {
+			m.Field = vs.storageField(m.Field)
+		}
+		storedMetrics[i] = m
+	}
+	results, err := vs.storage.Aggregate(ctx, vs.storagePredicate(lookup), storedGroupBy, storedMetrics)
+	if err != nil {
+		return nil, err
+	}
+	vresults := make([]AggResult, len(results))
+	for i, res := range results {
+		vres := AggResult{
+			Group:   make(map[string]interface{}, len(groupBy)),
+			Metrics: make(map[string]interface{}, len(metrics)),
+		}
+		for j, field := range groupBy {
+			if v, found := res.Group[storedGroupBy[j]]; found {
+				vres.Group[field] = v
+			}
+		}
+		for j, m := range metrics {
+			if v, found := res.Metrics[storedMetrics[j].Name()]; found {
+				vres.Metrics[m.Name()] = v
+			}
+		}
+		vresults[i] = vres
+	}
+	return vresults, nil
+}
+
+// Search implements Searcher.
+func (vs *versionStorer) Search(ctx context.Context, text string, fields []string, q *query.Query) (*ItemList, error) {
+	storedFields := make([]string, len(fields))
+	for i, field := range fields {
+		storedFields[i] = vs.storageField(field)
+	}
+	return vs.viewList(vs.storage.Search(ctx, text, storedFields, vs.storageQuery(q)))
+}
+
+// WithTransaction implements Transactional. The Storer given to fn presents
+// the documents thru the view of the version.
+func (vs *versionStorer) WithTransaction(ctx context.Context, fn func(tx Storer) error) error {
+	return vs.storage.WithTransaction(ctx, func(tx Storer) error {
+		return fn(&versionStorer{
+			storage:   storageWrapper{tx},
+			toStorage: vs.toStorage,
+			toView:    vs.toView,
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceAddVersion(t *testing.T) {
+	s := newTestStorer()
+	var found *query.Query
+	s.find = func(ctx context.Context, q *query.Query) (*ItemList, error) {
+		found = q
+		return &ItemList{Total: 1, Items: []*Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "name": "John", "secret": "x"}},
+		}}, nil
+	}
+	r := newResource("users", schema.Schema{Fields: schema.Fields{"id": {}, "name": {}}}, s, DefaultConf)
+	v2 := r.AddVersion("v2", schema.Schema{Fields: schema.Fields{"id": {}, "full_name": {}}}, map[string]string{"full_name": "name"})
+	assert.Equal(t, "users", v2.Name())
+	vr, ok := r.GetVersion("v2")
+	assert.True(t, ok)
+	assert.Equal(t, v2, vr)
+	_, ok = r.GetVersion("v3")
+	assert.False(t, ok)
+	log.SetOutput(ioutil.Discard)
+	assert.Panics(t, func() {
+		r.AddVersion("v2", schema.Schema{}, nil)
+	})
+
+	l, err := v2.Find(context.Background(), &query.Query{
+		Predicate: query.MustParsePredicate(`{$or: [{full_name: "John"}, {full_name: {$exists: false}}]}`),
+		Sort:      query.Sort{{Name: "full_name", Reversed: true}},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"id": "1", "full_name": "John"}, l.Items[0].Payload)
+	}
+	assert.Equal(t, `{$or: [{name: "John"}, {name: {$exists: false}}]}`, found.Predicate.String())
+	assert.Equal(t, query.Sort{{Name: "name", Reversed: true}}, found.Sort)
+
+	// The resource itself hides the fields not part of its schema.
+	l, err = r.Find(context.Background(), &query.Query{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"id": "1", "name": "John"}, l.Items[0].Payload)
+	}
+}
+
+// versionedStorer is a test storer with collection versions and aggregations.
+type versionedStorer struct {
+	*testMStorer
+	lookup  query.Predicate
+	groupBy []string
+	metrics []Metric
+}
+
+func (s *versionedStorer) CollectionVersion(ctx context.Context, q *query.Query) (string, error) {
+	return "v1", nil
+}
+
+func (s *versionedStorer) Aggregate(ctx context.Context, lookup query.Predicate, groupBy []string, metrics []Metric) ([]AggResult, error) {
+	s.lookup, s.groupBy, s.metrics = lookup, groupBy, metrics
+	return []AggResult{{
+		Group:   map[string]interface{}{"name": "John"},
+		Metrics: map[string]interface{}{"count": 2, "max(age)": 42},
+	}}, nil
+}
+
+func TestResourceAddVersionOptionalInterfaces(t *testing.T) {
+	s := &versionedStorer{testMStorer: newTestMStorer()}
+	s.multiGet = func(ctx context.Context, ids []interface{}) ([]*Item, error) {
+		return []*Item{{ID: "1", Payload: map[string]interface{}{"id": "1", "name": "John", "age": 42}}}, nil
+	}
+	r := newResource("users", schema.Schema{Fields: schema.Fields{"id": {}, "name": {}, "age": {}}}, s, DefaultConf)
+	v2 := r.AddVersion("v2", schema.Schema{Fields: schema.Fields{"id": {}, "full_name": {}, "years": {}}}, map[string]string{
+		"full_name": "name",
+		"years":     "age",
+	})
+	ctx := context.Background()
+
+	items, err := v2.MultiGet(ctx, []interface{}{"1", "2"})
+	if assert.NoError(t, err) && assert.Len(t, items, 2) {
+		assert.Equal(t, map[string]interface{}{"id": "1", "full_name": "John", "years": 42}, items[0].Payload)
+		assert.Nil(t, items[1])
+	}
+
+	version, err := v2.CollectionVersion(ctx, &query.Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", version)
+
+	results, err := v2.Aggregate(ctx, query.MustParsePredicate(`{full_name: "John"}`), []string{"full_name"}, []Metric{
+		{Op: Count},
+		{Op: Max, Field: "years"},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []AggResult{{
+			Group:   map[string]interface{}{"full_name": "John"},
+			Metrics: map[string]interface{}{"count": 2, "max(years)": 42},
+		}}, results)
+	}
+	assert.Equal(t, `{name: "John"}`, s.lookup.String())
+	assert.Equal(t, []string{"name"}, s.groupBy)
+	assert.Equal(t, []Metric{{Op: Count}, {Op: Max, Field: "age"}}, s.metrics)
+
+	// Interfaces not implemented by the shared storage still fail.
+	_, err = v2.Changes(ctx, &query.Query{}, "")
+	assert.Equal(t, ErrNoChangeTracker, err)
+}
@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rs/rest-layer/resource"
+)
+
+// catalog returns the description of the resources of the index, as returned
+// on OPTIONS requests on the API root. Resources configured as Unlisted are
+// omitted.
+func catalog(index resource.Index) map[string]interface{} {
+	return map[string]interface{}{
+		"resources": catalogResources(index.GetResources(), ""),
+	}
+}
+
+func catalogResources(rsrcs []*resource.Resource, prefix string) []interface{} {
+	entries := []interface{}{}
+	for _, rsrc := range rsrcs {
+		conf := rsrc.Conf()
+		if conf.Unlisted {
+			continue
+		}
+		path := prefix + "/" + rsrc.Name()
+		modes := make([]interface{}, 0, len(conf.AllowedModes))
+		for _, m := range conf.AllowedModes {
+			modes = append(modes, m.String())
+		}
+		entry := map[string]interface{}{
+			"name":  rsrc.Name(),
+			"path":  path,
+			"modes": modes,
+		}
+		if desc := rsrc.Schema().Description; desc != "" {
+			entry["description"] = desc
+		}
+		if unique := rsrc.Schema().UniqueTogether; len(unique) > 0 {
+			entry["uniqueTogether"] = unique
+		}
+		if subs := catalogResources(rsrc.GetResources(), path+"/{id}"); len(subs) > 0 {
+			entry["resources"] = subs
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// isRootOptions returns true if the request is an OPTIONS request on the API
+// root.
+func isRootOptions(r *http.Request) bool {
+	return r.Method == http.MethodOptions && strings.Trim(r.URL.Path, "/") == ""
+}
@@ -0,0 +1,261 @@
+package rest
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+)
+
+// CSVSerializer is the built-in text/csv Serializer, used to export lists.
+// Each item is written as a row, with its sub-documents flattened into dotted
+// columns (i.e.: address.city) and its arrays JSON encoded in a cell.
+//
+// When used by the DefaultResponseSender, the columns of item lists follow the
+// field selection of the request or, by default, the fields of the resource's
+// schema, and the list is sent as an attachment. Responses other than lists
+// are sent as JSON. CSV request bodies are not supported.
+//
+// String cells starting with =, +, -, @, a tab or a carriage return are
+// prefixed with a single quote so spreadsheet applications don't evaluate them
+// as formulas, unless KeepFormulas is set.
+type CSVSerializer struct {
+	// KeepFormulas writes the string cells as is, even those that would be
+	// evaluated as formulas by spreadsheet applications.
+	KeepFormulas bool
+}
+
+// MediaType implements Serializer.
+func (s CSVSerializer) MediaType() string {
+	return "text/csv"
+}
+
+// Encode implements Serializer. The columns are the sorted keys of the rows.
+func (s CSVSerializer) Encode(w io.Writer, v interface{}) error {
+	switch t := v.(type) {
+	case []map[string]interface{}:
+		return s.encode(w, nil, t)
+	case map[string]interface{}:
+		return s.encode(w, nil, []map[string]interface{}{t})
+	}
+	return fmt.Errorf("cannot encode %T as CSV", v)
+}
+
+// Decode implements Serializer.
+func (s CSVSerializer) Decode(r io.Reader, v interface{}) error {
+	return errors.New("CSV request bodies are not supported")
+}
+
+// encode writes the rows with a header row of the columns, or of the flattened
+// keys of the rows if columns is nil.
+func (s CSVSerializer) encode(w io.Writer, columns []string, rows []map[string]interface{}) error {
+	if columns == nil {
+		keys := map[string]bool{}
+		for _, row := range rows {
+			csvKeys(keys, "", row)
+		}
+		columns = make([]string, 0, len(keys))
+		for key := range keys {
+			columns = append(columns, key)
+		}
+		sort.Strings(columns)
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			cell, err := csvCell(csvValue(row, column), !s.KeepFormulas)
+			if err != nil {
+				return fmt.Errorf("%s: %v", column, err)
+			}
+			record[i] = cell
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvKeys adds the dotted paths of the non-object values of doc to keys.
+func csvKeys(keys map[string]bool, prefix string, doc map[string]interface{}) {
+	for k, v := range doc {
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+			csvKeys(keys, prefix+k+".", sub)
+			continue
+		}
+		keys[prefix+k] = true
+	}
+}
+
+// csvValue returns the value at the dotted path of the column in row.
+func csvValue(row map[string]interface{}, column string) interface{} {
+	var v interface{} = row
+	for _, k := range strings.Split(column, ".") {
+		doc, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = doc[k]
+	}
+	return v
+}
+
+// csvCell returns the representation of v in a cell: strings as is and other
+// values, including arrays and objects, JSON encoded. If escape is true,
+// strings that would be evaluated as formulas are prefixed with a quote.
+func csvCell(v interface{}, escape bool) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return csvString(t, escape), nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	if len(b) > 0 && b[0] == '"' {
+		// Values represented as JSON strings, like dates, are unquoted.
+		var s string
+		if err := json.Unmarshal(b, &s); err == nil {
+			return csvString(s, escape), nil
+		}
+	}
+	return string(b), nil
+}
+
+// csvString returns s prefixed with a quote if escape is true and s starts
+// with a character making spreadsheet applications evaluate it as a formula.
+func csvString(s string, escape bool) string {
+	if escape && s != "" && strings.IndexByte("=+-@\t\r", s[0]) >= 0 {
+		return "'" + s
+	}
+	return s
+}
+
+type csvColumnsKey struct{}
+
+// contextWithCSVColumns stores in ctx the columns of the CSV export of the item
+// list of the routed resource, if the negotiated response format is CSV.
+func contextWithCSVColumns(ctx context.Context) context.Context {
+	if _, ok := responseSerializerFromContext(ctx).(CSVSerializer); !ok {
+		return ctx
+	}
+	route, ok := RouteFromContext(ctx)
+	if !ok || route.Resource() == nil {
+		return ctx
+	}
+	_, keyCase := routeKeyCases(ctx)
+	s := route.Resource().Schema()
+	var columns []string
+	if fields := route.Params.Get("fields"); fields != "" {
+		if p, err := query.ParseProjection(fields); err == nil {
+			columns = projectionColumns(ctx, nil, "", p, &s, keyCase)
+		}
+	}
+	if columns == nil {
+		columns = schemaColumns(ctx, nil, "", s, keyCase)
+	}
+	return context.WithValue(ctx, csvColumnsKey{}, columns)
+}
+
+// csvColumnsFromContext returns the columns stored by contextWithCSVColumns.
+func csvColumnsFromContext(ctx context.Context) ([]string, bool) {
+	columns, ok := ctx.Value(csvColumnsKey{}).([]string)
+	return columns, ok
+}
+
+// schemaColumns appends the columns of the visible fields of s, sorted by name
+// with the id first, to columns.
+func schemaColumns(ctx context.Context, columns []string, prefix string, s schema.Schema, c resource.KeyCase) []string {
+	names := make([]string, 0, len(s.Fields))
+	for name, def := range s.Fields {
+		if !def.IsHidden(ctx) && def.IsEnabled(ctx) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "id" || names[j] == "id" {
+			return names[i] == "id"
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		column := prefix + c.Convert(name)
+		if sub := subSchema(s.Fields[name]); sub != nil {
+			columns = schemaColumns(ctx, columns, column+".", *sub, c)
+		} else {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// projectionColumns appends the columns of the fields selected by p, in their
+// selection order, to columns. The fields of s, if known, are used to expand
+// the selected sub-documents and wildcards.
+func projectionColumns(ctx context.Context, columns []string, prefix string, p query.Projection, s *schema.Schema, c resource.KeyCase) []string {
+	for _, pf := range p {
+		if pf.Name == "*" {
+			if s != nil {
+				columns = schemaColumns(ctx, columns, prefix, *s, c)
+			}
+			continue
+		}
+		name := pf.Alias
+		if name == "" {
+			name = c.Convert(pf.Name)
+		}
+		var sub *schema.Schema
+		if s != nil {
+			if def, found := s.Fields[pf.Name]; found {
+				sub = subSchema(def)
+			}
+		}
+		switch {
+		case len(pf.Children) > 0:
+			columns = projectionColumns(ctx, columns, prefix+name+".", pf.Children, sub, c)
+		case sub != nil:
+			columns = schemaColumns(ctx, columns, prefix+name+".", *sub, c)
+		default:
+			columns = append(columns, prefix+name)
+		}
+	}
+	return columns
+}
+
+// subSchema returns the schema of the sub-documents of the field, if any.
+func subSchema(def schema.Field) *schema.Schema {
+	if def.Schema != nil {
+		return def.Schema
+	}
+	if obj, ok := def.Validator.(*schema.Object); ok {
+		return obj.Schema
+	}
+	return nil
+}
+
+// setCSVAttachment sets the Content-Disposition header of a CSV export of the
+// routed resource.
+func setCSVAttachment(ctx context.Context, headers http.Header) {
+	name := "export"
+	if route, ok := RouteFromContext(ctx); ok && route.Resource() != nil {
+		name = route.Resource().Name()
+	}
+	headers.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".csv"}))
+}
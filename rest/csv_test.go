@@ -0,0 +1,103 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/rest"
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVSerializerEncode(t *testing.T) {
+	var buf bytes.Buffer
+	err := rest.CSVSerializer{}.Encode(&buf, []map[string]interface{}{
+		{"b": "x, y", "a": map[string]interface{}{"c": 1.5, "d": true}},
+		{"b": `say "hi"`, "e": []interface{}{"f", 2}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "a.c,a.d,b,e\n"+
+		"1.5,true,\"x, y\",\n"+
+		",,\"say \"\"hi\"\"\",\"[\"\"f\"\",2]\"\n", buf.String())
+	assert.Error(t, rest.CSVSerializer{}.Decode(&buf, &map[string]interface{}{}))
+
+	// Cells that would be evaluated as formulas are escaped.
+	rows := []map[string]interface{}{{"a": "=1+1", "b": "@SUM(A1)", "c": "-5", "d": -5, "e": "\tx", "f": "a=b"}}
+	buf.Reset()
+	assert.NoError(t, rest.CSVSerializer{}.Encode(&buf, rows))
+	assert.Equal(t, "a,b,c,d,e,f\n'=1+1,'@SUM(A1),'-5,-5,'\tx,a=b\n", buf.String())
+	buf.Reset()
+	assert.NoError(t, rest.CSVSerializer{KeepFormulas: true}.Encode(&buf, rows))
+	assert.Equal(t, "a,b,c,d,e,f\n=1+1,@SUM(A1),-5,-5,\"\tx\",a=b\n", buf.String())
+}
+
+func TestHandlerCSV(t *testing.T) {
+	i := resource.NewIndex()
+	s := mem.NewHandler()
+	s.Insert(context.Background(), []*resource.Item{
+		{ID: "1", ETag: "a", Payload: map[string]interface{}{
+			"id":      "1",
+			"name":    "Smith, John",
+			"age":     42,
+			"address": map[string]interface{}{"city": "Paris", "zip": "75001"},
+			"tags":    []interface{}{"a", "b"},
+			"secret":  "s",
+		}},
+		{ID: "2", ETag: "b", Payload: map[string]interface{}{
+			"id":   "2",
+			"name": "Jane",
+		}},
+	})
+	i.Bind("users", schema.Schema{Fields: schema.Fields{
+		"id":   {Sortable: true},
+		"name": {Validator: &schema.String{}},
+		"age":  {Validator: &schema.Integer{}},
+		"address": {Schema: &schema.Schema{Fields: schema.Fields{
+			"city": {Validator: &schema.String{}},
+			"zip":  {Validator: &schema.String{}},
+		}}},
+		"tags":   {Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{}}}},
+		"secret": {Hidden: true},
+	}}, s, resource.DefaultConf)
+	h, err := rest.NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+	get := func(url string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", url, nil)
+		r.Header.Set("Accept", "text/csv")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/users?sort=id")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=users.csv`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	assert.Equal(t, "id,address.city,address.zip,age,name,tags\n"+
+		"1,Paris,75001,42,\"Smith, John\",\"[\"\"a\"\",\"\"b\"\"]\"\n"+
+		"2,,,,Jane,\n", w.Body.String())
+
+	// Field selection picks and orders the columns.
+	w = get("/users?sort=id&fields=name,n:age,address{city}")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "name,n,address.city\n"+
+		"\"Smith, John\",42,Paris\n"+
+		"Jane,,\n", w.Body.String())
+
+	// Other responses are sent as JSON.
+	w = get("/users/1")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "", w.Header().Get("Content-Disposition"))
+	w = get("/users?filter=invalid")
+	assert.Equal(t, 422, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
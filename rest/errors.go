@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
 )
 
 var (
@@ -14,6 +15,9 @@ var (
 	ErrForbidden = &Error{http.StatusForbidden, "Forbidden", nil}
 	// ErrPreconditionFailed happens when a conditional request condition is not met.
 	ErrPreconditionFailed = &Error{http.StatusPreconditionFailed, "Precondition Failed", nil}
+	// ErrPreconditionRequired happens when a write on a contended item is not
+	// conditional.
+	ErrPreconditionRequired = &Error{http.StatusPreconditionRequired, "Precondition Required", nil}
 	// ErrConflict happens when another thread or node modified the data
 	// concurrently with our own thread in such a way we can't securely apply
 	// the requested changes.
@@ -29,6 +33,9 @@ var (
 	// ErrGatewayTimeout is returned when the specified timeout for the request
 	// has been reached before the server was able to process it.
 	ErrGatewayTimeout = &Error{http.StatusGatewayTimeout, "Deadline Exceeded", nil}
+	// ErrServiceUnavailable is returned when the handler is in maintenance
+	// mode.
+	ErrServiceUnavailable = &Error{http.StatusServiceUnavailable, "Service Unavailable", nil}
 	// ErrUnknown is thrown when the origin of the error can't be identified.
 	ErrUnknown = &Error{520, "Unknown Error", nil}
 )
@@ -44,6 +51,26 @@ type Error struct {
 	Issues map[string][]interface{}
 }
 
+// ValidationError is the body of a 422 error reporting the issues of an invalid
+// document along with the fields which passed the validation, in API format,
+// when requested by the client (see Conf.EchoValidFields).
+type ValidationError struct {
+	// Err is the 422 error reporting the issues of the document.
+	Err *Error
+	// Valid holds the fields of the document which passed the validation.
+	Valid map[string]interface{}
+}
+
+// Error returns the error as string
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying Error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 // NewError returns a rest.Error from an standard error.
 //
 // If the the inputted error is recognized, the appropriate rest.Error is mapped.
@@ -51,6 +78,13 @@ func NewError(err error) *Error {
 	if Err, ok := err.(*Error); ok {
 		return Err
 	}
+	if ue, ok := err.(*resource.UniqueError); ok {
+		issues := map[string][]interface{}{}
+		for _, f := range ue.Fields {
+			issues[f] = []interface{}{"not unique"}
+		}
+		return &Error{http.StatusConflict, ue.Error(), issues}
+	}
 	switch err {
 	case context.Canceled:
 		return ErrClientClosedRequest
@@ -66,6 +100,8 @@ func NewError(err error) *Error {
 		return ErrNotImplemented
 	case resource.ErrNoStorage:
 		return &Error{501, err.Error(), nil}
+	case resource.ErrNoAggregator, resource.ErrNoSearcher, resource.ErrNoChangeTracker:
+		return &Error{http.StatusMethodNotAllowed, err.Error(), nil}
 	case nil:
 		return nil
 	default:
@@ -77,3 +113,53 @@ func NewError(err error) *Error {
 func (e *Error) Error() string {
 	return e.Message
 }
+
+// issuesStatus returns the status of a 422 error body with its issues, or the
+// most severe status declared by its issues implementing schema.StatusError:
+// the lowest one, so authorization errors (401, 403) prevail over conflicts
+// (409), which prevail over the default 422.
+func issuesStatus(status int, body interface{}) int {
+	var e *Error
+	switch t := body.(type) {
+	case *Error:
+		e = t
+	case *ValidationError:
+		e = t.Err
+	}
+	if e == nil || e.Code != http.StatusUnprocessableEntity || e.Issues == nil {
+		return status
+	}
+	if s := issueListStatus(0, e.Issues); s != 0 {
+		e.Code = s
+		return s
+	}
+	return status
+}
+
+// issueListStatus returns the most severe of status and the statuses declared
+// by the (possibly nested) issues.
+func issueListStatus(status int, issues interface{}) int {
+	switch t := issues.(type) {
+	case schema.StatusError:
+		if s := t.HTTPStatus(); s != 0 && (status == 0 || s < status) {
+			status = s
+		}
+	case map[string][]interface{}:
+		for _, errs := range t {
+			status = issueListStatus(status, errs)
+		}
+	case schema.ErrorMap:
+		for _, errs := range t {
+			status = issueListStatus(status, errs)
+		}
+	case map[string]interface{}:
+		for _, err := range t {
+			status = issueListStatus(status, err)
+		}
+	case []interface{}:
+		for _, err := range t {
+			status = issueListStatus(status, err)
+		}
+	}
+	return status
+}
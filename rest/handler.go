@@ -3,9 +3,12 @@ package rest
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
 )
 
 // Handler is a net/http compatible handler used to serve the configured REST
@@ -18,8 +21,35 @@ type Handler struct {
 	// FallbackHandlerFunc is called when REST layer doesn't find a route for
 	// the request. If not set, a 404 or 405 standard REST error is returned.
 	FallbackHandlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request)
+	// ResponseHook is called just before the response is sent, for both
+	// successful and error responses. It can be used to add computed headers
+	// derived from the response. The resource is nil when the request did not
+	// match any resource.
+	ResponseHook func(ctx context.Context, rsrc *resource.Resource, status int, headers http.Header)
+	// Uploads configures the handling of multipart/form-data request bodies.
+	// Unless Uploads.FileStore is set, such requests are rejected as
+	// unsupported.
+	Uploads Uploads
+	// Serializers holds the serializers used to decode request bodies and
+	// encode responses, selected by content negotiation. NewHandler sets a
+	// registry with the JSONSerializer registered.
+	Serializers *SerializerRegistry
+	// MaxBodySize is a hard cap on the number of bytes read from request
+	// bodies, whether their length is announced with Content-Length or not
+	// (i.e.: chunked transfer encoding). Requests exceeding it are rejected
+	// with a 413 error. If zero, the size is not limited.
+	MaxBodySize int64
+	// AllowedMethods restricts the HTTP methods served on resource routes on
+	// top of the modes allowed by the resources' configuration, so the same
+	// index can be served read-only by a public handler (i.e.: GET) and
+	// writable by an internal one. Other methods are rejected with a 405
+	// error. HEAD is allowed with GET and OPTIONS is always allowed. If empty,
+	// all methods are allowed.
+	AllowedMethods []string
 	// index stores the resource router.
 	index resource.Index
+	// maintenance stores the current *Maintenance mode, if any.
+	maintenance atomic.Value
 }
 
 type methodHandler func(ctx context.Context, r *http.Request, route *RouteMatch) (int, http.Header, interface{})
@@ -35,6 +65,7 @@ func NewHandler(i resource.Index) (*Handler, error) {
 	h := &Handler{
 		ResponseFormatter: DefaultResponseFormatter{},
 		ResponseSender:    DefaultResponseSender{},
+		Serializers:       NewSerializerRegistry(),
 		index:             i,
 	}
 	return h, nil
@@ -50,7 +81,35 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	// Skip body if method is HEAD
 	skipBody := r.Method == "HEAD"
-	route, err := FindRoute(h.index, r)
+	sr := h.Serializers
+	if sr == nil {
+		sr = defaultSerializers
+	}
+	serializer := sr.Negotiate(r.Header.Get("Accept"))
+	ctx = contextWithSerializers(ctx, sr, serializer)
+	if sr.negotiable() {
+		ctx = contextWithVary(ctx, "Accept")
+	}
+	if mt := serializer.MediaType(); mt != "application/json" {
+		ctx = contextWithVariant(ctx, mt)
+	}
+	if m, _ := h.maintenance.Load().(*Maintenance); m != nil && !m.allows(r.Method) {
+		headers := http.Header{}
+		m.setRetryAfter(headers)
+		h.sendResponse(ctx, w, 0, headers, ErrServiceUnavailable, skipBody)
+		return
+	}
+	if h.MaxBodySize > 0 && r.Body != nil {
+		r.Body = limitBody(w, r.Body, h.MaxBodySize)
+	}
+	if isRootOptions(r) {
+		headers := http.Header{}
+		headers.Set("Allow", "OPTIONS")
+		h.sendResponse(ctx, w, 200, headers, catalog(h.index), skipBody)
+		return
+	}
+	version, path := requestVersion(h.index, r)
+	route, err := findRouteAt(h.index, r, path)
 	if err != nil {
 		if h.FallbackHandlerFunc != nil {
 			h.FallbackHandlerFunc(ctx, w, r)
@@ -60,16 +119,67 @@ func (h *Handler) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http
 		return
 	}
 	defer route.Release()
+	if route.ResourcePath.hasVersions() {
+		ctx = contextWithVary(ctx, "Accept")
+	}
+	if version != "" {
+		route.ResourcePath.useVersion(version)
+		ctx = contextWithVariant(ctx, "version="+version)
+	}
 	// Store the route and the router in the context
 	ctx = contextWithRoute(ctx, route)
 	ctx = contextWithIndex(ctx, h.index)
+	if h.Uploads.FileStore != nil {
+		ctx = contextWithUploads(ctx, h.Uploads)
+	}
+	langs := requestLanguages(r, route)
+	if len(langs) > 0 {
+		ctx = schema.WithLanguages(ctx, langs...)
+	}
+	if rsrc := route.Resource(); rsrc != nil {
+		if s := rsrc.Schema(); hasLocalizedFields(&s) {
+			ctx = contextWithVary(ctx, "Accept-Language")
+			if len(langs) > 0 {
+				ctx = contextWithVariant(ctx, "lang="+strings.Join(langs, ","))
+			}
+		}
+	}
+	if c, e := requestConsistency(r); e != nil {
+		h.sendResponse(ctx, w, 0, http.Header{}, e, skipBody)
+		return
+	} else if c != resource.DefaultConsistency {
+		ctx = resource.WithConsistency(ctx, c)
+	}
 
+	if rsrc := route.Resource(); rsrc != nil && len(rsrc.Conf().Middleware) > 0 {
+		// Wrap the route handling with the resource's middleware, the first
+		// middleware being the outermost. The request context, as altered
+		// by the middleware, is used for the rest of the request handling.
+		var next http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.serveRoute(r.Context(), w, r, route, skipBody)
+		})
+		mw := rsrc.Conf().Middleware
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+	h.serveRoute(ctx, w, r, route, skipBody)
+}
+
+// serveRoute executes the route handler for a matched route and sends the
+// response.
+func (h *Handler) serveRoute(ctx context.Context, w http.ResponseWriter, r *http.Request, route *RouteMatch, skipBody bool) {
 	// Execute the main route handler
-	status, headers, body := routeHandler(ctx, r, route)
+	status, headers, body := routeHandler(ctx, r, route, h.AllowedMethods)
 	if headers == nil {
 		headers = http.Header{}
 	}
-	if h.FallbackHandlerFunc != nil && (body == errResourceNotFound || body == ErrInvalidMethod) {
+	if rsrc := route.Resource(); rsrc != nil {
+		setSunset(headers, rsrc.Conf())
+	}
+	if h.FallbackHandlerFunc != nil && (body == errResourceNotFound || isInvalidMethod(body)) {
 		h.FallbackHandlerFunc(ctx, w, r)
 		return
 	}
@@ -83,12 +193,17 @@ func (h *Handler) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http
 }
 
 // routeHandler executes the appropriate method handler for the request if
-// allowed by the route configuration.
-func routeHandler(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
+// allowed by the route configuration and listed in methods, if not empty.
+func routeHandler(ctx context.Context, r *http.Request, route *RouteMatch, methods []string) (status int, headers http.Header, body interface{}) {
 	// Check route's resource parent(s) exists.
-	if err := route.ResourcePath.ParentsExist(ctx); err != nil {
+	parent, err := route.ResourcePath.parent(ctx)
+	if err != nil {
 		return 0, http.Header{}, err
 	}
+	if parent != nil {
+		// Expose the parent document to the validators of sub-resources.
+		ctx = schema.WithParent(ctx, parent.Payload)
+	}
 	rsrc := route.Resource()
 	if rsrc == nil {
 		return http.StatusNotFound, nil, errResourceNotFound
@@ -96,31 +211,109 @@ func routeHandler(ctx context.Context, r *http.Request, route *RouteMatch) (stat
 	conf := rsrc.Conf()
 	isItem := route.ResourceID() != nil
 	mh := getAllowedMethodHandler(isItem, route.Method, conf)
-	if mh == nil {
+	if mh == nil || !isMethodListed(methods, route.Method) {
 		headers = http.Header{}
 		setAllowHeader(headers, isItem, conf)
-		return ErrInvalidMethod.Code, headers, ErrInvalidMethod
+		filterAllowHeader(headers, methods)
+		reason := "mode not enabled"
+		if getMethodHandler(isItem, route.Method) == nil {
+			reason = "not supported"
+		} else if !isMethodListed(methods, route.Method) {
+			reason = "not allowed by the handler"
+		}
+		return ErrInvalidMethod.Code, headers, methodNotAllowed(ErrInvalidMethod, route.Method, reason, headers)
 	}
-	return mh(ctx, r, route)
+	status, headers, body = mh(ctx, r, route)
+	filterAllowHeader(headers, methods)
+	if status == http.StatusUnprocessableEntity {
+		// Validation errors may declare another status (see
+		// schema.StatusError).
+		status = issuesStatus(status, body)
+	}
+	if e, ok := body.(*Error); ok && status == http.StatusMethodNotAllowed && e.Issues == nil && headers["Allow"] != nil {
+		// The method handler rejected the request as the mode it requires
+		// (i.e.: Replace for a PUT on an existing item) is not enabled. The
+		// Allow header may be empty if no method applies.
+		body = methodNotAllowed(e, route.Method, "mode not enabled", headers)
+	}
+	return status, headers, body
+}
+
+// isInvalidMethod returns true if body is the error returned for methods not
+// handled on the route.
+func isInvalidMethod(body interface{}) bool {
+	e, ok := body.(*Error)
+	return ok && e.Code == ErrInvalidMethod.Code && e.Message == ErrInvalidMethod.Message
 }
 
 // sendResponse format and send the API response.
 func (h *Handler) sendResponse(ctx context.Context, w http.ResponseWriter, status int, headers http.Header, res interface{}, skipBody bool) {
+	setVary(ctx, headers)
 	ctx, status, body := formatResponse(ctx, h.ResponseFormatter, w, status, headers, res, skipBody)
+	if h.ResponseHook != nil {
+		var rsrc *resource.Resource
+		if route, ok := RouteFromContext(ctx); ok {
+			rsrc = route.Resource()
+		}
+		h.ResponseHook(ctx, rsrc, status, headers)
+	}
 	h.ResponseSender.Send(ctx, w, status, headers, body)
 }
 
 func isNoContent(r *http.Request) bool {
+	// From https://tools.ietf.org/html/rfc7240#section-4.2 and
+	// https://msdn.microsoft.com/en-us/library/hh537533.aspx
+	return hasPreference(r, "return=minimal", "return-no-content")
+}
+
+// isDryRun returns true if the request asks for its payload to be validated
+// without being stored, using either the `dry-run=true` query parameter or the
+// `Prefer: dry-run` header.
+func isDryRun(r *http.Request) bool {
+	if v := r.URL.Query().Get("dry-run"); v != "" {
+		dryRun, _ := strconv.ParseBool(v)
+		return dryRun
+	}
+	return hasPreference(r, "dry-run")
+}
+
+// dryRunCheck returns the error a write of item would return because of a
+// conflict with the stored items (see resource.Resource.CheckInsert and
+// resource.Resource.CheckUpdate), so dry runs report them like real writes.
+// Item is inserted if original is nil.
+func dryRunCheck(ctx context.Context, rsrc *resource.Resource, item, original *resource.Item) *Error {
+	var err error
+	if original != nil {
+		err = rsrc.CheckUpdate(ctx, item, original)
+	} else {
+		err = rsrc.CheckInsert(ctx, []*resource.Item{item})
+	}
+	if err != nil {
+		return NewError(err)
+	}
+	return nil
+}
+
+// dryRunHeaders returns the headers of a dry-run response.
+func dryRunHeaders(r *http.Request) http.Header {
+	headers := http.Header{}
+	if hasPreference(r, "dry-run") {
+		headers.Set("Preference-Applied", "dry-run")
+	}
+	return headers
+}
+
+// hasPreference returns true if any of the given preferences is expressed in
+// the Prefer header of the request.
+func hasPreference(r *http.Request, prefs ...string) bool {
 	if pr := r.Header.Get("Prefer"); pr != "" {
-		items := strings.SplitN(pr, ";", -1)
+		items := strings.FieldsFunc(pr, func(c rune) bool { return c == ';' || c == ',' })
 		for _, item := range items {
-			switch strings.TrimSpace(item) {
-			case "return=minimal":
-				// From https://tools.ietf.org/html/rfc7240#section-4.2
-				return true
-			case "return-no-content":
-				// From https://msdn.microsoft.com/en-us/library/hh537533.aspx
-				return true
+			item = strings.TrimSpace(item)
+			for _, pref := range prefs {
+				if item == pref {
+					return true
+				}
 			}
 		}
 	}
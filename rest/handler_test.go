@@ -1,15 +1,23 @@
 package rest
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rs/rest-layer/resource"
 	"github.com/rs/rest-layer/resource/testing/mem"
 	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,6 +38,29 @@ func newRecorder() *closeNotifyRecorder {
 	return &closeNotifyRecorder{httptest.NewRecorder(), make(chan bool, 1)}
 }
 
+// serveRequest serves a request with the given method, url and body with h and
+// returns the recorded response. The non empty header values, given as name
+// and value pairs, are set on the request.
+func serveRequest(h http.Handler, method, url, body string, header ...string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		if header[i+1] != "" {
+			r.Header.Set(header[i], header[i+1])
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// withContextValue returns a handler serving requests with h once key is set
+// to value in their context.
+func withContextValue(h http.Handler, key, value interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key, value)))
+	})
+}
+
 func TestNewHandler(t *testing.T) {
 	i := resource.NewIndex()
 	h, err := NewHandler(i)
@@ -102,6 +133,1258 @@ func TestHandlerFallbackHandlerRouteFound(t *testing.T) {
 	assert.Equal(t, "[]", string(b))
 }
 
+func TestHandlerResponseHook(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("test", schema.Schema{}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	h.ResponseHook = func(ctx context.Context, rsrc *resource.Resource, status int, headers http.Header) {
+		name := "none"
+		if rsrc != nil {
+			name = rsrc.Name()
+		}
+		headers.Set("X-Request-Cost", fmt.Sprintf("%s:%d", name, status))
+	}
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "test:200", w.Header().Get("X-Request-Cost"))
+
+	r, _ = http.NewRequest("GET", "/unknown", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "none:404", w.Header().Get("X-Request-Cost"))
+}
+
+func TestHandlerMaintenance(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("test", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		body := ""
+		if method == "POST" {
+			body = `{"id": "1"}`
+		}
+		return serveRequest(h, method, path, body)
+	}
+
+	h.SetMaintenance(&Maintenance{RetryAfter: 90 * time.Second})
+	for _, method := range []string{"GET", "POST"} {
+		w := serve(method, "/test")
+		assert.Equal(t, 503, w.Code, method)
+		assert.Equal(t, "90", w.Header().Get("Retry-After"), method)
+		assert.JSONEq(t, `{"code": 503, "message": "Service Unavailable"}`, w.Body.String(), method)
+	}
+	// Routing is bypassed.
+	w := serve("GET", "/unknown")
+	assert.Equal(t, 503, w.Code)
+
+	h.SetMaintenance(&Maintenance{ReadOnly: true})
+	w = serve("GET", "/test")
+	assert.Equal(t, 200, w.Code)
+	w = serve("POST", "/test")
+	assert.Equal(t, 503, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	h.SetMaintenance(nil)
+	w = serve("POST", "/test")
+	assert.Equal(t, 201, w.Code)
+}
+
+func TestHandlerChunkedBody(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("test", schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}}}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	h.MaxBodySize = 64
+	var contentLength int64
+	var transferEncoding []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength, transferEncoding = r.ContentLength, r.TransferEncoding
+		h.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	post := func(body string) *http.Response {
+		// Wrapping the body hides its length so the client sends it chunked.
+		res, err := http.Post(s.URL+"/test", "application/json", ioutil.NopCloser(strings.NewReader(body)))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return res
+	}
+
+	res := post(`{"id": "1", "foo": "bar"}`)
+	defer res.Body.Close()
+	assert.Equal(t, int64(-1), contentLength)
+	assert.Equal(t, []string{"chunked"}, transferEncoding)
+	assert.Equal(t, 201, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.JSONEq(t, `{"id": "1", "foo": "bar"}`, string(b))
+
+	res = post(`{"id": "2", "foo": "` + strings.Repeat("a", 100) + `"}`)
+	defer res.Body.Close()
+	assert.Equal(t, 413, res.StatusCode)
+	b, _ = ioutil.ReadAll(res.Body)
+	assert.JSONEq(t, `{"code": 413, "message": "Request body exceeds maximum size of 64 bytes"}`, string(b))
+}
+
+type middlewareKey struct{}
+
+func TestHandlerResourceMiddleware(t *testing.T) {
+	trace := []string{}
+	tracer := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	owner := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "owner")
+			ctx := context.WithValue(r.Context(), middlewareKey{}, "john")
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	conf := resource.DefaultConf
+	conf.Middleware = []func(http.Handler) http.Handler{tracer("first"), owner, tracer("last")}
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id": {},
+		"owner": {
+			OnInit: func(ctx context.Context, value interface{}) interface{} {
+				owner, _ := ctx.Value(middlewareKey{}).(string)
+				return owner
+			},
+			Validator: &schema.String{MinLen: 1},
+		},
+	}}, mem.NewHandler(), conf)
+	i.Bind("bar", schema.Schema{}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+
+	r, _ := http.NewRequest("PUT", "/foo/1", bytes.NewBufferString(`{}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "owner", w.Header().Get("X-Middleware"))
+	assert.JSONEq(t, `{"id": "1", "owner": "john"}`, w.Body.String())
+	assert.Equal(t, []string{"first", "last"}, trace)
+
+	// Middleware is not applied to other resources.
+	trace = trace[:0]
+	r, _ = http.NewRequest("GET", "/bar", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "", w.Header().Get("X-Middleware"))
+	assert.Len(t, trace, 0)
+}
+
+type adminKey struct{}
+
+func TestHandlerLookupHook(t *testing.T) {
+	modes := []resource.Mode{}
+	conf := resource.DefaultConf
+	conf.LookupHook = func(ctx context.Context, mode resource.Mode, q *query.Query) error {
+		modes = append(modes, mode)
+		if mode == resource.Clear {
+			return &Error{403, "Clear Not Allowed", nil}
+		}
+		if admin, _ := ctx.Value(adminKey{}).(bool); !admin {
+			q.Predicate = append(q.Predicate, &query.NotEqual{Field: "status", Value: "archived"})
+		}
+		return nil
+	}
+	s := &mockHandler{}
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":     {Filterable: true},
+		"status": {Filterable: true},
+	}}, s, conf)
+	h, _ := NewHandler(i)
+
+	r, _ := http.NewRequest("GET", `/foo?filter={"id":"1"}`, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	r, _ = http.NewRequest("GET", "/foo/1", nil)
+	r = r.WithContext(context.WithValue(r.Context(), adminKey{}, true))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 404, w.Code)
+	if assert.Len(t, s.queries, 2) {
+		assert.Equal(t, query.Predicate{
+			&query.Equal{Field: "id", Value: "1"},
+			&query.NotEqual{Field: "status", Value: "archived"},
+		}, s.queries[0].Predicate)
+		assert.Equal(t, query.Predicate{
+			&query.Equal{Field: "id", Value: "1"},
+		}, s.queries[1].Predicate)
+	}
+
+	// An error returned by the hook aborts the request.
+	r, _ = http.NewRequest("DELETE", "/foo", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 403, w.Code)
+	assert.JSONEq(t, `{"code": 403, "message": "Clear Not Allowed"}`, w.Body.String())
+	assert.Len(t, s.queries, 2)
+	assert.Equal(t, []resource.Mode{resource.List, resource.Read, resource.Clear}, modes)
+}
+
+func TestHandlerAfterChange(t *testing.T) {
+	type change struct {
+		action         string
+		item, original interface{}
+	}
+	changes := []change{}
+	payload := func(i *resource.Item) interface{} {
+		if i == nil {
+			return nil
+		}
+		return i.Payload
+	}
+	conf := resource.DefaultConf
+	conf.AfterChange = func(ctx context.Context, action string, item, original *resource.Item) error {
+		changes = append(changes, change{action, payload(item), payload(original)})
+		return errors.New("not blocking")
+	}
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}}}, mem.NewHandler(), conf)
+	h, _ := NewHandler(i)
+
+	assert.Equal(t, 201, serveRequest(h, "POST", "/foo", `{"id": "1", "foo": "a"}`).Code)
+	assert.Equal(t, 201, serveRequest(h, "PUT", "/foo/2", `{"foo": "b"}`).Code)
+	assert.Equal(t, 200, serveRequest(h, "PUT", "/foo/2", `{"foo": "c"}`).Code)
+	assert.Equal(t, 200, serveRequest(h, "PATCH", "/foo/1", `{"foo": "d"}`).Code)
+	assert.Equal(t, 204, serveRequest(h, "DELETE", "/foo/2", ``).Code)
+	// Failed operations don't trigger the hook.
+	assert.Equal(t, 409, serveRequest(h, "POST", "/foo", `{"id": "1", "foo": "e"}`).Code)
+	assert.Equal(t, 404, serveRequest(h, "DELETE", "/foo/3", ``).Code)
+
+	assert.Equal(t, []change{
+		{resource.ActionInsert, map[string]interface{}{"id": "1", "foo": "a"}, nil},
+		{resource.ActionInsert, map[string]interface{}{"id": "2", "foo": "b"}, nil},
+		{resource.ActionUpdate, map[string]interface{}{"id": "2", "foo": "c"}, map[string]interface{}{"id": "2", "foo": "b"}},
+		{resource.ActionUpdate, map[string]interface{}{"id": "1", "foo": "d"}, map[string]interface{}{"id": "1", "foo": "a"}},
+		{resource.ActionDelete, nil, map[string]interface{}{"id": "2", "foo": "c"}},
+	}, changes)
+}
+
+// writeCountingHandler is a resource.Storer counting the calls to its write
+// methods.
+type writeCountingHandler struct {
+	resource.Storer
+	writes int
+}
+
+func (h *writeCountingHandler) Insert(ctx context.Context, items []*resource.Item) error {
+	h.writes++
+	return h.Storer.Insert(ctx, items)
+}
+
+func (h *writeCountingHandler) Update(ctx context.Context, item *resource.Item, original *resource.Item) error {
+	h.writes++
+	return h.Storer.Update(ctx, item, original)
+}
+
+func TestHandlerDryRun(t *testing.T) {
+	original, _ := resource.NewItem(map[string]interface{}{"id": "1", "foo": "a"})
+	m := mem.NewHandler()
+	m.Insert(context.Background(), []*resource.Item{original})
+	s := &writeCountingHandler{Storer: m}
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{
+		Fields: schema.Fields{
+			"id":  {},
+			"foo": {Validator: &schema.String{MaxLen: 2}},
+		},
+		UniqueTogether: [][]string{{"foo"}},
+	}, s, resource.DefaultConf)
+	h, _ := NewHandler(i)
+	serve := func(method, url, prefer, body string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, url, body, "Prefer", prefer)
+	}
+
+	w := serve("POST", "/foo?dry-run=true", "", `{"id": "2", "foo": "b"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "2", "foo": "b"}`, w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Preference-Applied"))
+	w = serve("POST", "/foo", "dry-run", `[{"id": "2", "foo": "b"}, {"id": "3", "foo": "c"}]`)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"3"`)
+	assert.Equal(t, "dry-run", w.Header().Get("Preference-Applied"))
+	w = serve("PUT", "/foo/1", "dry-run", `{"foo": "c"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "1", "foo": "c"}`, w.Body.String())
+	assert.Equal(t, "dry-run", w.Header().Get("Preference-Applied"))
+	w = serve("PATCH", "/foo/1?dry-run=1", "", `{"foo": "d"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "1", "foo": "d"}`, w.Body.String())
+
+	// Validation errors are reported as for real writes.
+	w = serve("POST", "/foo?dry-run=true", "", `{"id": "2", "foo": "too long"}`)
+	assert.Equal(t, 422, w.Code)
+	w = serve("PATCH", "/foo/1", "dry-run", `{"foo": "too long"}`)
+	assert.Equal(t, 422, w.Code)
+
+	// Storage conflicts are reported as for real writes.
+	w = serve("POST", "/foo?dry-run=true", "", `{"id": "1", "foo": "b"}`)
+	assert.Equal(t, 409, w.Code)
+	w = serve("POST", "/foo", "dry-run", `[{"id": "2", "foo": "b"}, {"id": "2", "foo": "c"}]`)
+	assert.Equal(t, 409, w.Code)
+	w = serve("POST", "/foo?dry-run=true", "", `{"id": "2", "foo": "a"}`)
+	assert.Equal(t, 409, w.Code)
+	assert.Contains(t, w.Body.String(), `"foo":["not unique"]`)
+
+	assert.Equal(t, 0, s.writes)
+
+	// Without dry-run, the storage is called.
+	w = serve("POST", "/foo?dry-run=false", "", `{"id": "2", "foo": "b"}`)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, 1, s.writes)
+	w = serve("PUT", "/foo/1", "dry-run", `{"foo": "b"}`)
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, 1, s.writes)
+}
+
+func TestHandlerAsyncWrites(t *testing.T) {
+	conf := resource.DefaultConf
+	conf.AsyncWrites = true
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":  {},
+		"foo": {Validator: &schema.String{MaxLen: 2}},
+	}}, mem.NewHandler(), conf)
+	h, _ := NewHandler(i)
+	serve := func(method, url, prefer, body string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, url, body, "Prefer", prefer)
+	}
+
+	w := serve("POST", "/foo", "", `{"id": "1", "foo": "a"}`)
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, "/foo/1", w.Header().Get("Content-Location"))
+	assert.Equal(t, "", w.Header().Get("Etag"))
+	assert.Equal(t, "", w.Body.String())
+	w = serve("PUT", "/foo/2", "", `{"foo": "b"}`)
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, "/foo/2", w.Header().Get("Content-Location"))
+	assert.Equal(t, "", w.Body.String())
+	w = serve("PATCH", "/foo/1", "return=changes", `{"foo": "c"}`)
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, "/foo/1", w.Header().Get("Content-Location"))
+	assert.Equal(t, "", w.Body.String())
+	w = serve("POST", "/foo", "", `[{"id": "3", "foo": "d"}, {"id": "4", "foo": "e"}]`)
+	assert.Equal(t, 202, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	w = serve("POST", "/foo", "handling=lenient", `[{"id": "5", "foo": "f"}, {"id": "6", "foo": "too long"}]`)
+	assert.Equal(t, 207, w.Code)
+	assert.JSONEq(t, `[
+		{"status": 202},
+		{"status": 422, "body": {"code": 422, "message": "Document contains error(s)", "issues": {"foo": ["is longer than 2"]}}}
+	]`, w.Body.String())
+
+	// Errors and dry-run requests are not affected.
+	w = serve("POST", "/foo", "", `{"id": "7", "foo": "too long"}`)
+	assert.Equal(t, 422, w.Code)
+	w = serve("PUT", "/foo/2", "dry-run", `{"foo": "g"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "2", "foo": "g"}`, w.Body.String())
+
+	w = serve("GET", "/foo/1", "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "1", "foo": "c"}`, w.Body.String())
+}
+
+func TestHandlerPartialValidation(t *testing.T) {
+	conf := resource.DefaultConf
+	conf.DraftField = "draft"
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":    {},
+		"title": {Required: true, Validator: &schema.String{}},
+		"body":  {Required: true, Validator: &schema.String{MaxLen: 5}},
+		"draft": {ReadOnly: true, Validator: &schema.Bool{}},
+	}}, mem.NewHandler(), conf)
+	h, err := NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+	serve := func(method, url, prefer, body string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, url, body, "Prefer", prefer)
+	}
+
+	// Drafts are stored without their required fields.
+	w := serve("POST", "/foo", "validation=partial", `{"id": "1", "title": "foo"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "title": "foo", "draft": true}`, w.Body.String())
+	// Provided fields are still validated.
+	w = serve("PUT", "/foo/2", "validation=partial", `{"body": "too long"}`)
+	assert.Equal(t, 422, w.Code)
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {"body": ["is longer than 5"]}}`, w.Body.String())
+	w = serve("PATCH", "/foo/1", "validation=partial", `{"title": "bar"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "title": "bar", "draft": true}`, w.Body.String())
+
+	// Publishing the draft enforces the required fields.
+	w = serve("PATCH", "/foo/1", "", `{}`)
+	assert.Equal(t, 422, w.Code)
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {"body": ["required"]}}`, w.Body.String())
+	w = serve("PATCH", "/foo/1", "", `{"body": "baz"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "title": "bar", "body": "baz", "draft": false}`, w.Body.String())
+	w = serve("POST", "/foo", "", `{"id": "3", "title": "foo"}`)
+	assert.Equal(t, 422, w.Code)
+}
+
+func TestHandlerProvenance(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":     {OnInit: func(ctx context.Context, v interface{}) interface{} { return "1" }},
+		"name":   {},
+		"status": {Default: "new"},
+	}}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	serve := func(method, url, prefer, body string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, url, body, "Prefer", prefer)
+	}
+
+	w := serve("POST", "/foo", "return=representation, provenance", `{"name": "foo"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.Equal(t, "id, status", w.Header().Get("X-Generated-Fields"))
+	assert.Equal(t, []string{"provenance"}, w.Header()["Preference-Applied"])
+	assert.JSONEq(t, `{"id": "1", "name": "foo", "status": "new"}`, w.Body.String())
+	// The id of the URL is provided by the client.
+	w = serve("PUT", "/foo/2", "provenance", `{"name": "bar", "status": "done"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.Equal(t, []string{""}, w.Header()["X-Generated-Fields"])
+	// Updates and requests without the preference are not affected.
+	w = serve("PATCH", "/foo/2", "provenance", `{"name": "baz"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Nil(t, w.Header()["X-Generated-Fields"])
+	w = serve("PUT", "/foo/3", "", `{"name": "foo"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.Nil(t, w.Header()["X-Generated-Fields"])
+}
+
+func TestHandlerAllowedMethods(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":  {},
+		"foo": {},
+	}}, mem.NewHandler(), resource.DefaultConf)
+	public, _ := NewHandler(i)
+	public.AllowedMethods = []string{"GET"}
+	internal, _ := NewHandler(i)
+
+	w := serveRequest(public, "POST", "/foo", `{"id": "1", "foo": "bar"}`)
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+	assert.JSONEq(t, `{"code": 405, "message": "Invalid Method", "issues": {
+		"method": ["POST: not allowed by the handler"],
+		"allowed_methods": ["GET", "HEAD"]
+	}}`, w.Body.String())
+	w = serveRequest(internal, "POST", "/foo", `{"id": "1", "foo": "bar"}`)
+	assert.Equal(t, 201, w.Code)
+
+	w = serveRequest(public, "GET", "/foo/1", "")
+	assert.Equal(t, 200, w.Code)
+	w = serveRequest(public, "HEAD", "/foo/1", "")
+	assert.Equal(t, 200, w.Code)
+	w = serveRequest(public, "PATCH", "/foo/1", `{"foo": "baz"}`)
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+	assert.Equal(t, "", w.Header().Get("Allow-Patch"))
+	w = serveRequest(public, "DELETE", "/foo", "")
+	assert.Equal(t, 405, w.Code)
+	w = serveRequest(public, "OPTIONS", "/foo/1", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+	w = serveRequest(internal, "OPTIONS", "/foo/1", "")
+	assert.Equal(t, "DELETE, GET, HEAD, PATCH, PUT", w.Header().Get("Allow"))
+}
+
+func TestHandlerUniqueTogether(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("members", schema.Schema{
+		Fields: schema.Fields{
+			"id":   {},
+			"team": {},
+			"user": {},
+		},
+		UniqueTogether: [][]string{{"team", "user"}},
+	}, mem.NewHandler(), resource.DefaultConf)
+	h, err := NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	w := serveRequest(h, "POST", "/members", `{"id": "1", "team": "a", "user": "john"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	// Sharing a single field of the constraint is allowed.
+	w = serveRequest(h, "POST", "/members", `{"id": "2", "team": "b", "user": "john"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	w = serveRequest(h, "POST", "/members", `{"id": "3", "team": "a", "user": "jane"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+
+	conflict := `{"code": 409, "message": "Duplicate value for unique fields team, user", "issues": {"team": ["not unique"], "user": ["not unique"]}}`
+	w = serveRequest(h, "POST", "/members", `{"id": "4", "team": "a", "user": "john"}`)
+	assert.Equal(t, 409, w.Code)
+	assert.JSONEq(t, conflict, w.Body.String())
+	w = serveRequest(h, "POST", "/members", `[{"id": "5", "team": "c", "user": "john"}, {"id": "6", "team": "c", "user": "john"}]`)
+	assert.Equal(t, 409, w.Code)
+	w = serveRequest(h, "PATCH", "/members/2", `{"team": "a"}`)
+	assert.Equal(t, 409, w.Code)
+	assert.JSONEq(t, conflict, w.Body.String())
+
+	// The current document is excluded on update.
+	w = serveRequest(h, "PUT", "/members/1", `{"team": "a", "user": "john"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = serveRequest(h, "PATCH", "/members/1", `{"team": "c"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+}
+
+type auditLoggerFunc func(ctx context.Context, entry resource.AuditEntry)
+
+func (f auditLoggerFunc) LogAudit(ctx context.Context, entry resource.AuditEntry) {
+	f(ctx, entry)
+}
+
+func TestHandlerAuditLogger(t *testing.T) {
+	type actorKey struct{}
+	entries := make(chan resource.AuditEntry, 10)
+	conf := resource.DefaultConf
+	conf.AuditLogger = auditLoggerFunc(func(ctx context.Context, entry resource.AuditEntry) {
+		entries <- entry
+	})
+	conf.AuditActor = func(ctx context.Context) string {
+		actor, _ := ctx.Value(actorKey{}).(string)
+		return actor
+	}
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":     {},
+		"name":   {},
+		"status": {},
+		"note":   {},
+		"secret": {Hidden: true},
+		"level": {
+			Hidden: true,
+			HiddenUnless: func(ctx context.Context) bool {
+				return ctx.Value(actorKey{}) == "john"
+			},
+		},
+	}}, mem.NewHandler(), conf)
+	h, _ := NewHandler(i)
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		return serveRequest(withContextValue(h, actorKey{}, "john"), method, url, body)
+	}
+	next := func() resource.AuditEntry {
+		select {
+		case entry := <-entries:
+			return entry
+		case <-time.After(time.Second):
+			t.Fatal("no audit entry")
+		}
+		return resource.AuditEntry{}
+	}
+
+	// Creations are not audited.
+	w := serve("PUT", "/foo/1", `{"name": "foo", "status": "new", "note": "n", "secret": "a"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	w = serve("PATCH", "/foo/1", `{"name": "foo", "status": "done", "secret": "b"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	entry := next()
+	assert.Equal(t, "john", entry.Actor)
+	assert.Equal(t, "foo", entry.Resource)
+	assert.Equal(t, "1", entry.ID)
+	assert.WithinDuration(t, time.Now(), entry.Time, time.Second)
+	assert.Equal(t, map[string]resource.FieldChange{
+		"status": {Before: "new", After: "done"},
+	}, entry.Changes)
+
+	w = serve("PUT", "/foo/1", `{"name": "bar", "status": "done", "secret": "b"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, map[string]resource.FieldChange{
+		"name": {Before: "foo", After: "bar"},
+		"note": {Before: "n", After: nil},
+	}, next().Changes)
+
+	// Hidden fields revealed to the actor are audited.
+	w = serve("PATCH", "/foo/1", `{"level": 2}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, map[string]resource.FieldChange{
+		"level": {Before: nil, After: float64(2)},
+	}, next().Changes)
+
+	// Dry-run and unchanged documents are not audited.
+	w = serve("PATCH", "/foo/1?dry-run=true", `{"name": "baz"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = serve("PATCH", "/foo/1", `{"name": "bar"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	select {
+	case entry := <-entries:
+		t.Errorf("unexpected audit entry: %v", entry)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHandlerHiddenUnless(t *testing.T) {
+	type adminKey struct{}
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":   {},
+		"name": {},
+		"secret": {
+			Hidden: true,
+			HiddenUnless: func(ctx context.Context) bool {
+				return ctx.Value(adminKey{}) != nil
+			},
+		},
+	}}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	serve := func(admin bool, method, url, body string) *httptest.ResponseRecorder {
+		if admin {
+			return serveRequest(withContextValue(h, adminKey{}, true), method, url, body)
+		}
+		return serveRequest(h, method, url, body)
+	}
+
+	w := serve(false, "PUT", "/foo/1", `{"name": "foo", "secret": "a"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "secret")
+	w = serve(false, "GET", "/foo/1?fields=id,secret", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1"}`, w.Body.String())
+	w = serve(true, "GET", "/foo/1?fields=id,secret", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "secret": "a"}`, w.Body.String())
+
+	// The value is preserved when replaced by a caller who can't see it...
+	w = serve(false, "PUT", "/foo/1", `{"name": "bar"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = serve(true, "GET", "/foo", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"secret":"a"`)
+
+	// ...but removed when replaced by a caller who can.
+	w = serve(true, "PUT", "/foo/1", `{"name": "bar"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "secret")
+	w = serve(true, "GET", "/foo/1", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "secret")
+}
+
+// phoneValidator warns on phone numbers without a country code.
+type phoneValidator struct{}
+
+func (v phoneValidator) Validate(value interface{}) (interface{}, error) {
+	value, _, err := v.ValidateWarn(value)
+	return value, err
+}
+
+func (phoneValidator) ValidateWarn(value interface{}) (interface{}, []string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, nil, errors.New("not a string")
+	}
+	if !strings.HasPrefix(s, "+") {
+		return s, []string{`format is unusual but accepted ("+" prefix missing)`}, nil
+	}
+	return s, nil, nil
+}
+
+func TestHandlerValidationWarnings(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":    {},
+		"phone": {Validator: &phoneValidator{}},
+	}}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	warning := []string{`phone: format is unusual but accepted ("+" prefix missing)`}
+
+	w := serveRequest(h, "POST", "/foo", `{"id": "1", "phone": "5551234"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.Equal(t, warning, w.Header()["X-Validation-Warning"])
+	w = serveRequest(h, "PUT", "/foo/2", `{"phone": "5551234"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.Equal(t, warning, w.Header()["X-Validation-Warning"])
+	w = serveRequest(h, "PATCH", "/foo/2", `{"phone": "+15551234"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Nil(t, w.Header()["X-Validation-Warning"])
+	w = serveRequest(h, "PATCH", "/foo/2", `{"phone": "5551234"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, warning, w.Header()["X-Validation-Warning"])
+
+	// Failed writes don't report warnings.
+	w = serveRequest(h, "PUT", "/foo/3", `{"phone": "5551234", "unknown": true}`)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.Nil(t, w.Header()["X-Validation-Warning"])
+}
+
+// reverseEncrypter is a non deterministic test Encrypter storing values
+// reversed behind a nonce.
+type reverseEncrypter struct {
+	nonce int
+}
+
+func (e *reverseEncrypter) Encrypt(value interface{}) (interface{}, error) {
+	s, _ := value.(string)
+	e.nonce++
+	return fmt.Sprintf("%d$%s", e.nonce, reverse(s)), nil
+}
+
+func (e *reverseEncrypter) Decrypt(value interface{}) (interface{}, error) {
+	s, _ := value.(string)
+	p := strings.SplitN(s, "$", 2)
+	if len(p) != 2 {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return reverse(p[1]), nil
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func TestHandlerEncryptedField(t *testing.T) {
+	type adminKey struct{}
+	i := resource.NewIndex()
+	foo := i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":   {},
+		"name": {},
+		"ssn": {
+			Validator: &schema.String{},
+			Encrypter: &reverseEncrypter{},
+			Hidden:    true,
+			HiddenUnless: func(ctx context.Context) bool {
+				return ctx.Value(adminKey{}) != nil
+			},
+		},
+	}}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	serve := func(admin bool, method, url, body string) *httptest.ResponseRecorder {
+		if admin {
+			return serveRequest(withContextValue(h, adminKey{}, true), method, url, body)
+		}
+		return serveRequest(h, method, url, body)
+	}
+	stored := func() interface{} {
+		item, err := foo.Get(context.Background(), "1")
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		return item.Payload["ssn"]
+	}
+
+	w := serve(true, "PUT", "/foo/1", `{"name": "foo", "ssn": "123-45"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "name": "foo", "ssn": "123-45"}`, w.Body.String())
+	ciphertext := stored()
+	assert.NotEqual(t, "123-45", ciphertext)
+	w = serve(false, "GET", "/foo/1", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "name": "foo"}`, w.Body.String())
+	w = serve(true, "GET", "/foo/1", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "name": "foo", "ssn": "123-45"}`, w.Body.String())
+
+	// Patching the field with the same plaintext is not a change.
+	w = serve(true, "PATCH", "/foo/1", `{"ssn": "123-45"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, ciphertext, stored())
+	w = serve(true, "PATCH", "/foo/1", `{"ssn": "678-90"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "name": "foo", "ssn": "678-90"}`, w.Body.String())
+	assert.NotEqual(t, "678-90", stored())
+
+	// If-Match-Fields compares the plaintext, only for clients reading it.
+	ifMatchFields := func(admin bool, fields string) int {
+		h := http.Handler(h)
+		if admin {
+			h = withContextValue(h, adminKey{}, true)
+		}
+		return serveRequest(h, "PATCH", "/foo/1", `{"name": "bar"}`, "If-Match-Fields", fields).Code
+	}
+	assert.Equal(t, 412, ifMatchFields(true, `{"ssn": "123-45"}`))
+	assert.Equal(t, 400, ifMatchFields(false, `{"ssn": "678-90"}`))
+	assert.Equal(t, 200, ifMatchFields(true, `{"ssn": "678-90"}`))
+}
+
+func TestHandlerValidFields(t *testing.T) {
+	s := schema.Schema{Fields: schema.Fields{
+		"id":     {},
+		"name":   {Validator: &schema.String{}},
+		"age":    {Validator: &schema.Integer{Boundaries: &schema.Boundaries{Min: 0, Max: 150}}},
+		"email":  {Validator: &schema.String{Regexp: "^.+@.+$"}},
+		"secret": {Hidden: true},
+	}}
+	i := resource.NewIndex()
+	i.Bind("foo", s, mem.NewHandler(), resource.DefaultConf)
+	conf := resource.DefaultConf
+	conf.EchoValidFields = true
+	i.Bind("bar", s, mem.NewHandler(), conf)
+	h, _ := NewHandler(i)
+	serve := func(method, url, prefer, body string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, url, body, "Prefer", prefer)
+	}
+	invalid := `{"name": "foo", "age": 200, "email": "nope", "secret": "s"}`
+
+	w := serve("POST", "/foo", "", invalid)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {
+		"age": ["is greater than 150"],
+		"email": ["does not match ^.+@.+$"]
+	}}`, w.Body.String())
+
+	w = serve("POST", "/foo", "valid-fields", invalid)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {
+		"age": ["is greater than 150"],
+		"email": ["does not match ^.+@.+$"]
+	}, "valid": {"name": "foo"}}`, w.Body.String())
+
+	w = serve("PUT", "/bar/1", "", invalid)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {
+		"age": ["is greater than 150"],
+		"email": ["does not match ^.+@.+$"]
+	}, "valid": {"id": "1", "name": "foo"}}`, w.Body.String())
+
+	// Patched documents echo the stored fields which are still valid.
+	w = serve("PUT", "/bar/1", "", `{"name": "foo", "age": 20}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	w = serve("PATCH", "/bar/1", "", `{"name": "bar", "email": "nope"}`)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {
+		"email": ["does not match ^.+@.+$"]
+	}, "valid": {"id": "1", "name": "bar", "age": 20}}`, w.Body.String())
+}
+
+func TestHandlerKeyCase(t *testing.T) {
+	s := schema.Schema{Fields: schema.Fields{
+		"id":         {},
+		"first_name": {Validator: &schema.String{}, Filterable: true, Sortable: true},
+		"home_address": {Schema: &schema.Schema{Fields: schema.Fields{
+			"street_name": {Validator: &schema.String{}},
+			"zip_code":    {Validator: &schema.String{MaxLen: 5}, Filterable: true},
+		}}},
+		"labels": {Validator: &schema.Dict{Values: schema.Field{Validator: &schema.String{}}}},
+	}}
+	conf := resource.DefaultConf
+	conf.InputKeyCase = resource.KeyCaseSnake
+	conf.OutputKeyCase = resource.KeyCaseCamel
+	st := mem.NewHandler()
+	i := resource.NewIndex()
+	i.Bind("foo", s, st, conf)
+	h, _ := NewHandler(i)
+
+	w := serveRequest(h, "PUT", "/foo/1", `{"firstName": "John", "homeAddress": {"streetName": "Main St", "zipCode": "12345"}, "labels": {"some_key": "a", "otherKey": "b"}}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "firstName": "John", "homeAddress": {"streetName": "Main St", "zipCode": "12345"}, "labels": {"some_key": "a", "otherKey": "b"}}`, w.Body.String())
+
+	// Documents are stored with the schema convention.
+	l, err := st.Find(context.Background(), &query.Query{})
+	assert.NoError(t, err)
+	if assert.Len(t, l.Items, 1) {
+		assert.Equal(t, map[string]interface{}{
+			"id":           "1",
+			"first_name":   "John",
+			"home_address": map[string]interface{}{"street_name": "Main St", "zip_code": "12345"},
+			"labels":       map[string]interface{}{"some_key": "a", "otherKey": "b"},
+		}, l.Items[0].Payload)
+	}
+
+	w = serveRequest(h, "GET", "/foo", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"homeAddress":{"streetName":"Main St","zipCode":"12345"}`)
+
+	// Query field names are given with the input convention too.
+	w = serveRequest(h, "GET", `/foo?filter={firstName:"John",homeAddress.zipCode:"12345"}&sort=-firstName&fields=firstName,homeAddress{zipCode}`, "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"firstName":"John","homeAddress":{"zipCode":"12345"}`)
+
+	// JSON Patch paths and values are given with the input convention.
+	w = serveRequest(h, "PATCH", "/foo/1", `[
+		{"op": "replace", "path": "/firstName", "value": "Jane"},
+		{"op": "test", "path": "/homeAddress/zipCode", "value": "12345"},
+		{"op": "replace", "path": "/homeAddress", "value": {"streetName": "Side St", "zipCode": "54321"}},
+		{"op": "add", "path": "/labels/newKey", "value": "c"}
+	]`, "Content-Type", "application/json-patch+json")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": "1", "firstName": "Jane", "homeAddress": {"streetName": "Side St", "zipCode": "54321"}, "labels": {"some_key": "a", "otherKey": "b", "newKey": "c"}}`, w.Body.String())
+
+	// Issues are reported with the output convention.
+	w = serveRequest(h, "PATCH", "/foo/1", `{"homeAddress": {"streetName": "Main St", "zipCode": "123456"}}`)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {
+		"homeAddress": [{"zipCode": ["is longer than 5"]}]
+	}}`, w.Body.String())
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	var hookID string
+	i := resource.NewIndex()
+	foo := i.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.DefaultConf)
+	foo.Use(resource.FindEventHandlerFunc(func(ctx context.Context, q *query.Query) error {
+		hookID = resource.RequestIDFromContext(ctx)
+		return nil
+	}))
+	h, _ := NewHandler(i)
+	serve := func(header ...string) *httptest.ResponseRecorder {
+		hookID = ""
+		return serveRequest(RequestID(h), "GET", "/foo/1", "", header...)
+	}
+
+	// Generated when absent.
+	w := serve()
+	id := w.Header().Get("X-Request-ID")
+	assert.Len(t, id, 20)
+	assert.Equal(t, id, hookID)
+	assert.JSONEq(t, `{"code": 404, "message": "Not Found", "request_id": "`+id+`"}`, w.Body.String())
+	assert.NotEqual(t, id, serve().Header().Get("X-Request-ID"))
+
+	// Propagated when provided.
+	w = serve("X-Request-ID", "abc-123")
+	assert.Equal(t, "abc-123", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "abc-123", hookID)
+	assert.JSONEq(t, `{"code": 404, "message": "Not Found", "request_id": "abc-123"}`, w.Body.String())
+
+	w = serve("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hookID)
+
+	// Invalid ids are replaced.
+	w = serve("X-Request-ID", strings.Repeat("a", 129), "traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	assert.Len(t, w.Header().Get("X-Request-ID"), 20)
+}
+
+func TestHandlerWriteStatus(t *testing.T) {
+	s := schema.Schema{Fields: schema.Fields{
+		"id":  {},
+		"foo": {},
+	}}
+	i := resource.NewIndex()
+	conf := resource.DefaultConf
+	conf.AllowPatchUpsert = true
+	i.Bind("default", s, mem.NewHandler(), conf)
+	conf.CreateStatus = 200
+	conf.ReplaceStatus = 200
+	i.Bind("ok", s, mem.NewHandler(), conf)
+	h, _ := NewHandler(i)
+	for rsrc, want := range map[string][2]int{"default": {201, 200}, "ok": {200, 200}} {
+		create, replace := want[0], want[1]
+		assert.Equal(t, create, serveRequest(h, "POST", "/"+rsrc, `{"id": "p", "foo": "bar"}`).Code, rsrc+": POST")
+		assert.Equal(t, create, serveRequest(h, "POST", "/"+rsrc, `[{"id": "b1"}, {"id": "b2"}]`).Code, rsrc+": POST batch")
+		assert.Equal(t, create, serveRequest(h, "PUT", "/"+rsrc+"/1", `{"foo": "bar"}`).Code, rsrc+": PUT create")
+		assert.Equal(t, replace, serveRequest(h, "PUT", "/"+rsrc+"/1", `{"foo": "baz"}`).Code, rsrc+": PUT replace")
+		assert.Equal(t, create, serveRequest(h, "PATCH", "/"+rsrc+"/2", `{"foo": "bar"}`).Code, rsrc+": PATCH upsert")
+		assert.Equal(t, replace, serveRequest(h, "PATCH", "/"+rsrc+"/2", `{"foo": "baz"}`).Code, rsrc+": PATCH update")
+	}
+}
+
+func TestHandlerValidationStatus(t *testing.T) {
+	taken := schema.FieldValidatorFunc(func(value interface{}) (interface{}, error) {
+		if value == "taken" {
+			return nil, schema.WithStatus(errors.New("already taken"), http.StatusConflict)
+		}
+		return value, nil
+	})
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{
+		Fields: schema.Fields{
+			"id":    {},
+			"name":  {Validator: &taken},
+			"size":  {Validator: &schema.Integer{}},
+			"admin": {Validator: &schema.Bool{}},
+		},
+		Rules: []schema.Rule{adminOnly{}},
+	}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+
+	w := serveRequest(h, "POST", "/foo", `{"id": "1", "size": "big"}`)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+
+	w = serveRequest(h, "POST", "/foo", `{"id": "1", "name": "taken", "size": "big"}`)
+	assert.Equal(t, 409, w.Code, w.Body.String())
+	assert.JSONEq(t, `{
+		"code": 409,
+		"message": "Document contains error(s)",
+		"issues": {"name": ["already taken"], "size": ["not an integer"]}
+	}`, w.Body.String())
+
+	w = serveRequest(h, "PUT", "/foo/1", `{"name": "taken", "admin": true}`)
+	assert.Equal(t, 403, w.Code, w.Body.String())
+	assert.JSONEq(t, `{
+		"code": 403,
+		"message": "Document contains error(s)",
+		"issues": {"name": ["already taken"], "admin": ["reserved to administrators"]}
+	}`, w.Body.String())
+}
+
+// adminOnly rejects documents setting the admin field with a 403 error.
+type adminOnly struct{}
+
+func (adminOnly) Check(doc map[string]interface{}) (string, error) {
+	if _, found := doc["admin"]; found {
+		return "admin", schema.WithStatus(errors.New("reserved to administrators"), http.StatusForbidden)
+	}
+	return "", nil
+}
+
+func TestHandlerPreValidate(t *testing.T) {
+	var preValidated, validated int
+	name := schema.FieldValidatorFunc(func(value interface{}) (interface{}, error) {
+		validated++
+		return value, nil
+	})
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{
+		Fields: schema.Fields{
+			"id":   {},
+			"kind": {},
+			"name": {Validator: &name},
+		},
+		PreValidate: func(ctx context.Context, payload map[string]interface{}) error {
+			preValidated++
+			assert.Equal(t, 0, validated, "field validation ran first")
+			switch payload["kind"] {
+			case nil:
+				return schema.ErrorMap{"kind": {"required"}}
+			case "a", "b":
+				return nil
+			default:
+				return errors.New("unsupported kind")
+			}
+		},
+	}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		preValidated, validated = 0, 0
+		return serveRequest(h, method, url, body)
+	}
+
+	w := serve("POST", "/foo", `{"name": "foo"}`)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {"kind": ["required"]}}`, w.Body.String())
+	assert.Equal(t, 1, preValidated)
+	assert.Equal(t, 0, validated)
+
+	w = serve("PUT", "/foo/1", `{"kind": "c", "name": "foo"}`)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 422, "message": "unsupported kind"}`, w.Body.String())
+	assert.Equal(t, 0, validated)
+
+	w = serve("PUT", "/foo/1", `{"kind": "a", "name": "foo"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.Equal(t, 1, preValidated)
+	assert.Equal(t, 1, validated)
+
+	// Merge patches are given the patch document.
+	w = serve("PATCH", "/foo/1", `{"name": "bar"}`)
+	assert.Equal(t, 422, w.Code, w.Body.String())
+	w = serve("PATCH", "/foo/1", `{"kind": "b", "name": "bar"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+}
+
+type findRecorder struct {
+	resource.Storer
+	queries []*query.Query
+}
+
+func (s *findRecorder) Find(ctx context.Context, q *query.Query) (*resource.ItemList, error) {
+	s.queries = append(s.queries, q)
+	return s.Storer.Find(ctx, q)
+}
+
+// callCounter counts the calls made to the storage handler.
+type callCounter struct {
+	resource.Storer
+	calls int
+}
+
+func (s *callCounter) Find(ctx context.Context, q *query.Query) (*resource.ItemList, error) {
+	s.calls++
+	return s.Storer.Find(ctx, q)
+}
+
+func (s *callCounter) Insert(ctx context.Context, items []*resource.Item) error {
+	s.calls++
+	return s.Storer.Insert(ctx, items)
+}
+
+func (s *callCounter) Update(ctx context.Context, item *resource.Item, original *resource.Item) error {
+	s.calls++
+	return s.Storer.Update(ctx, item, original)
+}
+
+func (s *callCounter) Delete(ctx context.Context, item *resource.Item) error {
+	s.calls++
+	return s.Storer.Delete(ctx, item)
+}
+
+func (s *callCounter) Clear(ctx context.Context, q *query.Query) (int, error) {
+	s.calls++
+	return s.Storer.Clear(ctx, q)
+}
+
+func TestHandlerInvalidQueryParams(t *testing.T) {
+	s := &callCounter{Storer: mem.NewHandler()}
+	s.Insert(context.Background(), []*resource.Item{
+		{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "bar"}},
+	})
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":  {Filterable: true},
+		"foo": {},
+	}}, s, resource.DefaultConf)
+	h, _ := NewHandler(i)
+
+	for _, tc := range []struct {
+		method, url, body, param string
+	}{
+		{"GET", "/foo?filter=invalid", "", "filter"},
+		{"GET", "/foo?sort=foo", "", "sort"},
+		{"GET", "/foo?fields=unknown", "", "fields"},
+		{"DELETE", "/foo?filter={\"foo\":\"bar\"}", "", "filter"},
+		{"GET", "/foo/1?fields=unknown", "", "fields"},
+		{"DELETE", "/foo/1?filter=invalid", "", "filter"},
+		{"POST", "/foo?fields=unknown", `{"id": "2"}`, "fields"},
+		{"PUT", "/foo/1?fields=unknown", `{"foo": "baz"}`, "fields"},
+		{"PATCH", "/foo/1?fields=unknown", `{"foo": "baz"}`, "fields"},
+	} {
+		s.calls = 0
+		r, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		name := tc.method + " " + tc.url
+		assert.Equal(t, 422, w.Code, name)
+		// A single error document is sent, with the issue of the parameter.
+		var body struct {
+			Issues map[string][]interface{}
+		}
+		dec := json.NewDecoder(w.Body)
+		if assert.NoError(t, dec.Decode(&body), name) {
+			assert.Contains(t, body.Issues, tc.param, name)
+			assert.False(t, dec.More(), name+": more than one response")
+		}
+		assert.Equal(t, 0, s.calls, name+": storage called")
+	}
+}
+
+func TestHandlerIDDecoder(t *testing.T) {
+	conf := resource.DefaultConf
+	conf.IDDecoder = func(raw string) (interface{}, error) {
+		return strconv.Atoi(raw)
+	}
+	s := &findRecorder{Storer: mem.NewHandler()}
+	s.Insert(context.Background(), []*resource.Item{
+		{ID: 42, ETag: "a", Payload: map[string]interface{}{"id": 42, "name": "foo"}},
+	})
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":   {Validator: &schema.Integer{}},
+		"name": {},
+	}}, s, conf)
+	h, _ := NewHandler(i)
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, url, "")
+	}
+
+	w := serve("GET", "/foo/42")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id": 42, "name": "foo"}`, w.Body.String())
+	if assert.Len(t, s.queries, 1) {
+		assert.Equal(t, query.Predicate{&query.Equal{Field: "id", Value: 42}}, s.queries[0].Predicate)
+	}
+
+	w = serve("GET", "/foo/abc")
+	assert.Equal(t, 400, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"code": 400, "message": "Invalid id: strconv.Atoi: parsing \"abc\": invalid syntax"}`, w.Body.String())
+	assert.Len(t, s.queries, 1)
+}
+
+// consistencyRecorder records the read consistency of the Find calls, as
+// passed to FindWithConsistency and through the context.
+type consistencyRecorder struct {
+	resource.Storer
+	consistencies []resource.Consistency
+}
+
+func (s *consistencyRecorder) Find(ctx context.Context, q *query.Query) (*resource.ItemList, error) {
+	s.consistencies = append(s.consistencies, resource.ConsistencyFromContext(ctx))
+	return s.Storer.Find(ctx, q)
+}
+
+func (s *consistencyRecorder) FindWithConsistency(ctx context.Context, q *query.Query, c resource.Consistency) (*resource.ItemList, error) {
+	if resource.ConsistencyFromContext(ctx) != c {
+		return nil, errors.New("consistency not in context")
+	}
+	s.consistencies = append(s.consistencies, c)
+	return s.Storer.Find(ctx, q)
+}
+
+func TestHandlerConsistency(t *testing.T) {
+	s := &consistencyRecorder{Storer: mem.NewHandler()}
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":   {},
+		"name": {},
+	}}, s, resource.DefaultConf)
+	h, _ := NewHandler(i)
+	serve := func(method, url, consistency, body string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, url, body, "Consistency", consistency)
+	}
+
+	w := serve("PUT", "/foo/1", "", `{"name": "foo"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	w = serve("GET", "/foo/1", "strong", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = serve("GET", "/foo", "Strong", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = serve("GET", "/foo", "", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, []resource.Consistency{
+		resource.DefaultConsistency, // PUT lookup
+		resource.StrongConsistency,
+		resource.StrongConsistency,
+		resource.DefaultConsistency,
+	}, s.consistencies)
+
+	w = serve("GET", "/foo", "eventual", "")
+	assert.Equal(t, 400, w.Code, w.Body.String())
+	assert.JSONEq(t, "{\"code\": 400, \"message\": \"Invalid Consistency header: `eventual' not supported\"}", w.Body.String())
+	assert.Len(t, s.consistencies, 4)
+}
+
+func TestHandlerSunset(t *testing.T) {
+	conf := resource.DefaultConf
+	conf.SunsetDate = time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	conf.SunsetLink = "https://example.com/retirement"
+	i := resource.NewIndex()
+	i.Bind("old", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), conf)
+	i.Bind("new", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.DefaultConf)
+	h, _ := NewHandler(i)
+
+	for _, w := range []*httptest.ResponseRecorder{
+		serveRequest(h, "GET", "/old", ""),
+		serveRequest(h, "POST", "/old", `{"id": "1"}`),
+		serveRequest(h, "GET", "/old/2", ""),
+	} {
+		assert.Equal(t, "Wed, 02 Jan 2030 02:04:05 GMT", w.Header().Get("Sunset"))
+		assert.Contains(t, w.Header()["Link"], `<https://example.com/retirement>; rel="sunset"`)
+	}
+	w := serveRequest(h, "GET", "/new", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Nil(t, w.Header()["Sunset"])
+}
+
 func TestHandlerServeHTTPNoStorage(t *testing.T) {
 	i := resource.NewIndex()
 	i.Bind("foo", schema.Schema{}, nil, resource.DefaultConf)
@@ -124,6 +1407,102 @@ func TestHandlerServeHTTPNotFound(t *testing.T) {
 	assert.Equal(t, "{\"code\":404,\"message\":\"Resource Not Found\"}", string(b))
 }
 
+func TestHandlerServeHTTPRootOptions(t *testing.T) {
+	i := resource.NewIndex()
+	users := i.Bind("users", schema.Schema{
+		Description: "The users",
+		Fields:      schema.Fields{"id": {}},
+	}, mem.NewHandler(), resource.DefaultConf)
+	users.Bind("posts", "user", schema.Schema{Fields: schema.Fields{
+		"id":   {},
+		"user": {Validator: &schema.Reference{Path: "users"}},
+	}}, mem.NewHandler(), resource.Conf{AllowedModes: resource.ReadOnly})
+	i.Bind("stats", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.Conf{
+		AllowedModes: []resource.Mode{resource.List},
+	})
+	i.Bind("internal", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.Conf{
+		AllowedModes: resource.ReadWrite,
+		Unlisted:     true,
+	})
+	h, err := NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("OPTIONS", "/", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "OPTIONS", w.Header().Get("Allow"))
+	assert.JSONEq(t, `{"resources": [
+		{"name": "stats", "path": "/stats", "modes": ["list"]},
+		{
+			"name": "users",
+			"path": "/users",
+			"description": "The users",
+			"modes": ["create", "read", "update", "replace", "delete", "list", "clear"],
+			"resources": [
+				{"name": "posts", "path": "/users/{id}/posts", "modes": ["read", "list"]}
+			]
+		}
+	]}`, w.Body.String())
+
+	// Unlisted resources are still served.
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/internal", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestHandlerServeHTTPNotFoundVsInvalidMethod(t *testing.T) {
+	i := resource.NewIndex()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.Conf{
+		AllowedModes: []resource.Mode{resource.Read, resource.List, resource.Delete},
+	})
+	h, _ := NewHandler(i)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		return serveRequest(h, method, path, `{}`)
+	}
+	// Unknown paths are not found whatever the method.
+	for _, method := range []string{"GET", "POST", "FOO"} {
+		w := serve(method, "/unknown")
+		assert.Equal(t, 404, w.Code, method)
+		assert.Empty(t, w.Header().Get("Allow"), method)
+		assert.JSONEq(t, `{"code": 404, "message": "Resource Not Found"}`, w.Body.String(), method)
+	}
+	w := serve("GET", "/foo/1/unknown")
+	assert.Equal(t, 404, w.Code)
+
+	// Known paths with unsupported methods.
+	w = serve("POST", "/foo")
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+	assert.JSONEq(t, `{"code": 405, "message": "Invalid Method", "issues": {
+		"method": ["POST: mode not enabled"],
+		"allowed_methods": ["GET", "HEAD"]
+	}}`, w.Body.String())
+	w = serve("FOO", "/foo")
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+	assert.JSONEq(t, `{"code": 405, "message": "Invalid Method", "issues": {
+		"method": ["FOO: not supported"],
+		"allowed_methods": ["GET", "HEAD"]
+	}}`, w.Body.String())
+	w = serve("PATCH", "/foo/1")
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "DELETE, GET, HEAD", w.Header().Get("Allow"))
+	assert.JSONEq(t, `{"code": 405, "message": "Invalid Method", "issues": {
+		"method": ["PATCH: mode not enabled"],
+		"allowed_methods": ["DELETE", "GET", "HEAD"]
+	}}`, w.Body.String())
+
+	// Known paths with supported methods.
+	w = serve("GET", "/foo")
+	assert.Equal(t, 200, w.Code)
+	w = serve("GET", "/foo/1")
+	assert.Equal(t, 404, w.Code)
+	assert.JSONEq(t, `{"code": 404, "message": "Not Found"}`, w.Body.String())
+}
+
 func TestHandlerServeHTTPParentNotFound(t *testing.T) {
 	i := resource.NewIndex()
 	foo := i.Bind("foo", schema.Schema{}, mem.NewHandler(), resource.DefaultConf)
@@ -0,0 +1,332 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+)
+
+// routeKeyCases returns the input and output key conventions of the routed
+// resource.
+func routeKeyCases(ctx context.Context) (in, out resource.KeyCase) {
+	if route, ok := RouteFromContext(ctx); ok {
+		if rsrc := route.Resource(); rsrc != nil {
+			conf := rsrc.Conf()
+			return conf.InputKeyCase, conf.OutputKeyCase
+		}
+	}
+	return resource.KeyCaseNone, resource.KeyCaseNone
+}
+
+// routeFields returns the schema of the routed resource, or nil if no resource
+// is routed.
+func routeFields(ctx context.Context) schema.FieldGetter {
+	if route, ok := RouteFromContext(ctx); ok {
+		if rsrc := route.Resource(); rsrc != nil {
+			return rsrc.Validator()
+		}
+	}
+	return nil
+}
+
+// convertDocKeys returns a copy of doc with its keys converted to the c
+// convention. Sub-documents are converted only for the fields of fg declaring
+// a sub-schema (thru Schema, schema.Object or schema.Reference): the keys of
+// dicts and free-form maps are data and are left untouched.
+func convertDocKeys(doc map[string]interface{}, fg schema.FieldGetter, c resource.KeyCase) map[string]interface{} {
+	if doc == nil || c == resource.KeyCaseNone {
+		return doc
+	}
+	conv := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		name, f := convertFieldKey(k, fg, c)
+		conv[name] = convertValueKeys(v, f, c)
+	}
+	return conv
+}
+
+func convertValueKeys(v interface{}, f *schema.Field, c resource.KeyCase) interface{} {
+	if f == nil {
+		return v
+	}
+	if a, ok := f.Validator.(*schema.Array); ok {
+		switch t := v.(type) {
+		case []interface{}:
+			conv := make([]interface{}, len(t))
+			for i, v := range t {
+				conv[i] = convertValueKeys(v, &a.Values, c)
+			}
+			return conv
+		case []map[string]interface{}:
+			conv := make([]map[string]interface{}, len(t))
+			for i, d := range t {
+				conv[i] = convertDocKeys(d, subFields(&a.Values), c)
+			}
+			return conv
+		}
+		return v
+	}
+	if d, ok := v.(map[string]interface{}); ok {
+		if fg := subFields(f); fg != nil {
+			return convertDocKeys(d, fg, c)
+		}
+	}
+	return v
+}
+
+// convertFieldKey returns key converted to the c convention, with the field of
+// fg it names in either convention, if any.
+func convertFieldKey(key string, fg schema.FieldGetter, c resource.KeyCase) (string, *schema.Field) {
+	name := c.Convert(key)
+	if fg == nil {
+		return name, nil
+	}
+	if f := fg.GetField(name); f != nil {
+		return name, f
+	}
+	return name, fg.GetField(key)
+}
+
+// subFields returns the schema of the sub-documents of f, or nil if f holds no
+// sub-documents. The sub-documents of arrays are those of their values.
+func subFields(f *schema.Field) schema.FieldGetter {
+	if f.Schema != nil {
+		return f.Schema
+	}
+	switch v := f.Validator.(type) {
+	case *schema.Object:
+		if v.Schema != nil {
+			return v.Schema
+		}
+	case *schema.Reference:
+		if v.SchemaValidator != nil {
+			return v
+		}
+	case *schema.Array:
+		return subFields(&v.Values)
+	}
+	return nil
+}
+
+// convertFieldPath returns the dotted field path converted to the c
+// convention, with the field it names. Path components are converted as long
+// as they name fields with a sub-schema; the rest, i.e.: dict keys, is left
+// untouched. Unknown fields are left untouched so errors report them as
+// given.
+func convertFieldPath(path string, fg schema.FieldGetter, c resource.KeyCase) (string, *schema.Field) {
+	if c == resource.KeyCaseNone || fg == nil {
+		return path, nil
+	}
+	names := strings.Split(path, ".")
+	var f *schema.Field
+	for i, key := range names {
+		if fg == nil {
+			break
+		}
+		var name string
+		if name, f = convertFieldKey(key, fg, c); f == nil {
+			break
+		}
+		names[i] = name
+		fg = subFields(f)
+	}
+	return strings.Join(names, "."), f
+}
+
+// convertPatchKeys returns the JSON Patch document (RFC 6902) with the field
+// names of the paths of its operations and the keys of their values converted
+// to the c convention.
+func convertPatchKeys(patchJSON []byte, fg schema.FieldGetter, c resource.KeyCase) ([]byte, error) {
+	if c == resource.KeyCaseNone || fg == nil {
+		return patchJSON, nil
+	}
+	var ops []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(patchJSON))
+	dec.UseNumber()
+	if err := dec.Decode(&ops); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if from, ok := op["from"].(string); ok {
+			op["from"], _ = convertPatchPath(from, fg, c)
+		}
+		if path, ok := op["path"].(string); ok {
+			var f *schema.Field
+			op["path"], f = convertPatchPath(path, fg, c)
+			if value, found := op["value"]; found {
+				if f == nil {
+					// The value replaces the whole document.
+					if d, ok := value.(map[string]interface{}); ok && path == "" {
+						op["value"] = convertDocKeys(d, fg, c)
+					}
+				} else {
+					op["value"] = convertValueKeys(value, f, c)
+				}
+			}
+		}
+	}
+	return json.Marshal(ops)
+}
+
+// convertPatchPath returns the JSON Pointer path (RFC 6901) converted to the c
+// convention like convertFieldPath, with the field or array value it points
+// to, if any. Array indexes are left untouched.
+func convertPatchPath(path string, fg schema.FieldGetter, c resource.KeyCase) (string, *schema.Field) {
+	tokens := strings.Split(path, "/")
+	var f *schema.Field
+	for i := 1; i < len(tokens); i++ {
+		if f != nil {
+			if a, ok := f.Validator.(*schema.Array); ok {
+				// The token is an index of the array.
+				f = &a.Values
+				continue
+			}
+			if fg = subFields(f); fg == nil {
+				// The rest of the path is made of data keys (i.e.: dict).
+				return strings.Join(tokens, "/"), nil
+			}
+		}
+		name, sub := convertFieldKey(pointerUnescaper.Replace(tokens[i]), fg, c)
+		if sub == nil {
+			// Unknown fields are left untouched.
+			return strings.Join(tokens, "/"), nil
+		}
+		tokens[i] = pointerEscaper.Replace(name)
+		f = sub
+	}
+	return strings.Join(tokens, "/"), f
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// convertPredicateKeys converts in place the field names of the expressions
+// to the c convention.
+func convertPredicateKeys(exps []query.Expression, fg schema.FieldGetter, c resource.KeyCase) {
+	for _, exp := range exps {
+		switch e := exp.(type) {
+		case *query.And:
+			convertPredicateKeys(*e, fg, c)
+		case *query.Or:
+			convertPredicateKeys(*e, fg, c)
+		case *query.ElemMatch:
+			var f *schema.Field
+			e.Field, f = convertFieldPath(e.Field, fg, c)
+			if f != nil {
+				if sub := subFields(f); sub != nil {
+					convertPredicateKeys(e.Exps, sub, c)
+				}
+			}
+		case *query.In:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.NotIn:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.Equal:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.NotEqual:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.Exist:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.NotExist:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.GreaterThan:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.GreaterOrEqual:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.LowerThan:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.LowerOrEqual:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		case *query.Regex:
+			e.Field, _ = convertFieldPath(e.Field, fg, c)
+		}
+	}
+}
+
+// convertProjectionKeys converts in place the field names of the projection
+// to the c convention. Aliases are left untouched.
+func convertProjectionKeys(p query.Projection, fg schema.FieldGetter, c resource.KeyCase) {
+	for i := range p {
+		if p[i].Name == "*" {
+			continue
+		}
+		var f *schema.Field
+		p[i].Name, f = convertFieldPath(p[i].Name, fg, c)
+		if f != nil && len(p[i].Children) > 0 {
+			if sub := subFields(f); sub != nil {
+				convertProjectionKeys(p[i].Children, sub, c)
+			}
+		}
+	}
+}
+
+// convertIssueKeys returns a copy of the issues with the field names
+// converted to the c convention.
+func convertIssueKeys(issues map[string][]interface{}, c resource.KeyCase) map[string][]interface{} {
+	if issues == nil || c == resource.KeyCaseNone {
+		return issues
+	}
+	conv := make(map[string][]interface{}, len(issues))
+	for field, errs := range issues {
+		conv[c.Convert(field)] = convertIssueList(errs, c)
+	}
+	return conv
+}
+
+func convertIssueList(errs []interface{}, c resource.KeyCase) []interface{} {
+	conv := make([]interface{}, len(errs))
+	for i, err := range errs {
+		switch t := err.(type) {
+		case map[string][]interface{}:
+			conv[i] = convertIssueKeys(t, c)
+		case schema.ErrorMap:
+			conv[i] = schema.ErrorMap(convertIssueKeys(t, c))
+		case []interface{}:
+			conv[i] = convertIssueList(t, c)
+		default:
+			conv[i] = err
+		}
+	}
+	return conv
+}
+
+// convertResponseKeys returns a copy of the resp items, list or error with
+// their document keys and issue field names converted to the output
+// convention of the routed resource.
+func convertResponseKeys(ctx context.Context, resp interface{}) interface{} {
+	_, c := routeKeyCases(ctx)
+	if c == resource.KeyCaseNone {
+		return resp
+	}
+	fg := routeFields(ctx)
+	switch t := resp.(type) {
+	case *resource.Item:
+		i := *t
+		i.Payload = convertDocKeys(t.Payload, fg, c)
+		return &i
+	case *resource.ItemList:
+		l := *t
+		l.Items = make([]*resource.Item, len(t.Items))
+		for n, item := range t.Items {
+			i := *item
+			i.Payload = convertDocKeys(item.Payload, fg, c)
+			l.Items[n] = &i
+		}
+		return &l
+	case *Error:
+		return &Error{t.Code, t.Message, convertIssueKeys(t.Issues, c)}
+	case *ValidationError:
+		return &ValidationError{
+			Err:   &Error{t.Err.Code, t.Err.Message, convertIssueKeys(t.Err.Issues, c)},
+			Valid: convertDocKeys(t.Valid, fg, c),
+		}
+	}
+	return resp
+}
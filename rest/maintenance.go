@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Maintenance defines a maintenance mode during which requests are answered
+// with a 503 Service Unavailable error without being routed to the resources
+// and their storage.
+type Maintenance struct {
+	// ReadOnly lets GET, HEAD and OPTIONS requests thru so only writes are
+	// blocked.
+	ReadOnly bool
+	// RetryAfter is sent as the Retry-After header (in seconds) of the 503
+	// responses. If zero, no Retry-After header is sent.
+	RetryAfter time.Duration
+}
+
+// SetMaintenance puts the handler in the given maintenance mode. Passing nil
+// ends the maintenance. It is safe to call while the handler is serving
+// requests.
+func (h *Handler) SetMaintenance(m *Maintenance) {
+	if m != nil {
+		// Copy the configuration so it can't be altered once set.
+		c := *m
+		m = &c
+	}
+	h.maintenance.Store(m)
+}
+
+// allows returns true if the method can be served during the maintenance.
+func (m *Maintenance) allows(method string) bool {
+	if !m.ReadOnly {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func (m *Maintenance) setRetryAfter(headers http.Header) {
+	if m.RetryAfter <= 0 {
+		return
+	}
+	secs := int64((m.RetryAfter + time.Second - 1) / time.Second)
+	headers.Set("Retry-After", strconv.FormatInt(secs, 10))
+}
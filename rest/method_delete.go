@@ -4,15 +4,94 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema/query"
 )
 
 // listDelete handles DELETE resquests on a resource URL.
+//
+// If ids are listed in the ids query-string parameter (comma separated) or in
+// the ids array of the request body, only the listed items are deleted
+// (BulkDelete mode). An If-Match header holding a list of etags then requires
+// each listed item to match one of them. Otherwise, all the items matching
+// the filter are deleted (Clear mode). An X-If-Match-Version header then
+// requires the collection to still be at this version, so a collection changed
+// since the client last read it is not cleared. The version is checked and the
+// collection cleared in a transaction if the storage handler supports it. The
+// check is skipped if the storage handler does not implement
+// resource.CollectionVersioner.
 func listDelete(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
-	q, e := route.Query()
+	rsrc := route.Resource()
+	ids, e := bulkDeleteIDs(ctx, r, route)
 	if e != nil {
 		return e.Code, nil, e
 	}
-	total, err := route.Resource().Clear(ctx, q)
+	mode := resource.Clear
+	if ids != nil {
+		mode = resource.BulkDelete
+	}
+	if !rsrc.Conf().IsModeAllowed(mode) {
+		status = http.StatusMethodNotAllowed
+		headers = http.Header{}
+		setAllowHeader(headers, false, rsrc.Conf())
+		return status, headers, &Error{status, http.StatusText(status), nil}
+	}
+	q, e := route.query(ctx, mode)
+	if e != nil {
+		return e.Code, nil, e
+	}
+	if ids != nil {
+		headers = http.Header{}
+		if len(ids) == 0 {
+			headers.Set("X-Total", "0")
+			return 204, headers, nil
+		}
+		q.Predicate = append(q.Predicate, &query.In{Field: "id", Values: ids})
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			l, err := rsrc.Find(ctx, &query.Query{Predicate: q.Predicate, Window: &query.Window{Limit: len(ids)}})
+			if err != nil {
+				e = NewError(err)
+				return e.Code, nil, e
+			}
+			for _, item := range l.Items {
+				if !matchEtagList(ifMatch, item.ETag) {
+					return ErrPreconditionFailed.Code, nil, ErrPreconditionFailed
+				}
+			}
+		}
+	} else if ifMatch := r.Header.Get("X-If-Match-Version"); ifMatch != "" {
+		var total int
+		inTx := false
+		clearVersion := func(rsrc *resource.Resource) error {
+			version, err := collectionVersion(ctx, rsrc, route, q)
+			if err != nil && err != resource.ErrNotImplemented {
+				return err
+			}
+			// Backends without versioning skip the check.
+			if err == nil && version != ifMatch {
+				return ErrPreconditionFailed
+			}
+			total, err = rsrc.Clear(ctx, q)
+			return err
+		}
+		err := rsrc.WithTransaction(ctx, func(tx *resource.Resource) error {
+			inTx = true
+			return clearVersion(tx)
+		})
+		if err == resource.ErrNotImplemented && !inTx {
+			err = clearVersion(rsrc)
+		}
+		if err != nil {
+			e = NewError(err)
+			return e.Code, nil, e
+		}
+		headers = http.Header{}
+		headers.Set("X-Total", strconv.Itoa(total))
+		return 204, headers, nil
+	}
+	total, err := rsrc.Clear(ctx, q)
 	if err != nil {
 		e = NewError(err)
 		return e.Code, nil, e
@@ -21,3 +100,55 @@ func listDelete(ctx context.Context, r *http.Request, route *RouteMatch) (status
 	headers.Set("X-Total", strconv.Itoa(total))
 	return 204, headers, nil
 }
+
+// bulkDeleteIDs returns the decoded ids listed by a bulk delete request, or
+// nil if the request lists no ids.
+func bulkDeleteIDs(ctx context.Context, r *http.Request, route *RouteMatch) ([]query.Value, *Error) {
+	var raw []interface{}
+	if p := route.Params.Get("ids"); p != "" {
+		for _, id := range strings.Split(p, ",") {
+			raw = append(raw, strings.TrimSpace(id))
+		}
+	} else if r.Body != nil && r.ContentLength != 0 {
+		var payload map[string]interface{}
+		if e := decodePayload(ctx, r, &payload); e != nil {
+			return nil, e
+		}
+		list, found := payload["ids"]
+		if !found {
+			return nil, nil
+		}
+		var ok bool
+		if raw, ok = list.([]interface{}); !ok {
+			return nil, &Error{422, "Invalid ids: not an array", nil}
+		}
+		if raw == nil {
+			raw = []interface{}{}
+		}
+	} else {
+		return nil, nil
+	}
+	ids := make([]query.Value, 0, len(raw))
+	for _, id := range raw {
+		id, err := decodeID(route.Resource(), id)
+		if err != nil {
+			if e, ok := err.(*Error); ok {
+				return nil, e
+			}
+			return nil, &Error{400, "Invalid id: " + err.Error(), nil}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// matchEtagList returns true if one of the etags of the comma separated list
+// of an If-Match header matches etag.
+func matchEtagList(ifMatch, etag string) bool {
+	for _, e := range strings.Split(ifMatch, ",") {
+		if compareRawEtag(strings.TrimSpace(e), etag) {
+			return true
+		}
+	}
+	return false
+}
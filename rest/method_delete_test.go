@@ -1,6 +1,7 @@
 package rest_test
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 	"testing"
@@ -12,29 +13,33 @@ import (
 )
 
 func TestDeleteList(t *testing.T) {
-	sharedInit := func() *requestTestVars {
-		s := mem.NewHandler()
-		s.Insert(context.Background(), []*resource.Item{
-			{ID: "1", Payload: map[string]interface{}{"id": "1", "foo": "odd"}},
-			{ID: "2", Payload: map[string]interface{}{"id": "2", "foo": "even"}},
-			{ID: "3", Payload: map[string]interface{}{"id": "3", "foo": "odd"}},
-			{ID: "4", Payload: map[string]interface{}{"id": "4", "foo": "even"}},
-			{ID: "5", Payload: map[string]interface{}{"id": "5", "foo": "odd"}},
-		})
+	modesInit := func(modes ...resource.Mode) func() *requestTestVars {
+		return func() *requestTestVars {
+			s := mem.NewHandler()
+			s.Insert(context.Background(), []*resource.Item{
+				{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "odd"}},
+				{ID: "2", ETag: "b", Payload: map[string]interface{}{"id": "2", "foo": "even"}},
+				{ID: "3", ETag: "c", Payload: map[string]interface{}{"id": "3", "foo": "odd"}},
+				{ID: "4", ETag: "d", Payload: map[string]interface{}{"id": "4", "foo": "even"}},
+				{ID: "5", ETag: "e", Payload: map[string]interface{}{"id": "5", "foo": "odd"}},
+			})
 
-		idx := resource.NewIndex()
-		idx.Bind("foo", schema.Schema{
-			Fields: schema.Fields{
-				"id":  {Sortable: true, Filterable: true},
-				"foo": {Filterable: true},
-			},
-		}, s, resource.Conf{AllowedModes: resource.ReadWrite, PaginationDefaultLimit: 2})
+			idx := resource.NewIndex()
+			idx.Bind("foo", schema.Schema{
+				Fields: schema.Fields{
+					"id":  {Sortable: true, Filterable: true},
+					"foo": {Filterable: true},
+				},
+			}, s, resource.Conf{AllowedModes: modes, PaginationDefaultLimit: 2})
 
-		return &requestTestVars{
-			Index:   idx,
-			Storers: map[string]resource.Storer{"foo": s},
+			return &requestTestVars{
+				Index:   idx,
+				Storers: map[string]resource.Storer{"foo": s},
+			}
 		}
 	}
+	sharedInit := modesInit(resource.ReadWrite...)
+	bulkInit := modesInit(resource.List, resource.BulkDelete)
 	checkFooIDs := func(ids ...interface{}) requestCheckerFunc {
 		return func(t *testing.T, vars *requestTestVars) {
 			s := vars.Storers["foo"]
@@ -140,6 +145,148 @@ func TestDeleteList(t *testing.T) {
 			ResponseHeader: http.Header{"X-Total": []string{"2"}},
 			ExtraTest:      checkFooIDs("1", "2", "4"),
 		},
+		`ids=2,4,9`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("DELETE", `/foo?ids=2,4,9`, nil)
+			},
+			ResponseCode:   http.StatusNoContent,
+			ResponseBody:   ``,
+			ResponseHeader: http.Header{"X-Total": []string{"2"}},
+			ExtraTest:      checkFooIDs("1", "3", "5"),
+		},
+		`ids=1,2,filter={foo:"odd"}`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("DELETE", `/foo?ids=1,2&filter={foo:"odd"}`, nil)
+			},
+			ResponseCode:   http.StatusNoContent,
+			ResponseBody:   ``,
+			ResponseHeader: http.Header{"X-Total": []string{"1"}},
+			ExtraTest:      checkFooIDs("2", "3", "4", "5"),
+		},
+		`body={ids:[1,3]}`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("DELETE", "/foo", bytes.NewBufferString(`{"ids": ["1", "3"]}`))
+			},
+			ResponseCode:   http.StatusNoContent,
+			ResponseBody:   ``,
+			ResponseHeader: http.Header{"X-Total": []string{"2"}},
+			ExtraTest:      checkFooIDs("2", "4", "5"),
+		},
+		`body={ids:[]}`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("DELETE", "/foo", bytes.NewBufferString(`{"ids": []}`))
+			},
+			ResponseCode:   http.StatusNoContent,
+			ResponseBody:   ``,
+			ResponseHeader: http.Header{"X-Total": []string{"0"}},
+			ExtraTest:      checkFooIDs("1", "2", "3", "4", "5"),
+		},
+		`body={ids:invalid}`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("DELETE", "/foo", bytes.NewBufferString(`{"ids": "1"}`))
+			},
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{"code": 422, "message": "Invalid ids: not an array"}`,
+			ExtraTest:    checkFooIDs("1", "2", "3", "4", "5"),
+		},
+		`ids=1,2,If-Match`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("DELETE", `/foo?ids=1,2`, nil)
+				if err == nil {
+					r.Header.Set("If-Match", `W/"a", W/"b"`)
+				}
+				return r, err
+			},
+			ResponseCode:   http.StatusNoContent,
+			ResponseBody:   ``,
+			ResponseHeader: http.Header{"X-Total": []string{"2"}},
+			ExtraTest:      checkFooIDs("3", "4", "5"),
+		},
+		`ids=1,2,If-Match-Mismatch`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("DELETE", `/foo?ids=1,2`, nil)
+				if err == nil {
+					r.Header.Set("If-Match", `W/"a", W/"x"`)
+				}
+				return r, err
+			},
+			ResponseCode: http.StatusPreconditionFailed,
+			ResponseBody: `{"code": 412, "message": "Precondition Failed"}`,
+			ExtraTest:    checkFooIDs("1", "2", "3", "4", "5"),
+		},
+		`clearAll,If-Match-Version`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("DELETE", "/foo", nil)
+				if err == nil {
+					r.Header.Set("X-If-Match-Version", "5")
+				}
+				return r, err
+			},
+			ResponseCode:   http.StatusNoContent,
+			ResponseBody:   ``,
+			ResponseHeader: http.Header{"X-Total": []string{"5"}},
+			ExtraTest:      checkFooIDs(),
+		},
+		`clearAll,If-Match-Version-Stale`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("DELETE", "/foo", nil)
+				if err == nil {
+					r.Header.Set("X-If-Match-Version", "0")
+				}
+				return r, err
+			},
+			ResponseCode: http.StatusPreconditionFailed,
+			ResponseBody: `{"code": 412, "message": "Precondition Failed"}`,
+			ExtraTest:    checkFooIDs("1", "2", "3", "4", "5"),
+		},
+		`clearAll,If-Match-Version-Unversioned`: {
+			Init: func() *requestTestVars {
+				vars := sharedInit()
+				idx := resource.NewIndex()
+				idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}}}, storerOnly{vars.Storers["foo"]}, resource.DefaultConf)
+				vars.Index = idx
+				return vars
+			},
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("DELETE", "/foo", nil)
+				if err == nil {
+					r.Header.Set("X-If-Match-Version", "0")
+				}
+				return r, err
+			},
+			ResponseCode:   http.StatusNoContent,
+			ResponseBody:   ``,
+			ResponseHeader: http.Header{"X-Total": []string{"5"}},
+			ExtraTest:      checkFooIDs(),
+		},
+		`ids=1,BulkDeleteNotAllowed`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("DELETE", `/foo?ids=1`, nil)
+			},
+			ResponseCode:   http.StatusMethodNotAllowed,
+			ResponseBody:   `{"code": 405, "message": "Method Not Allowed", "issues": {"method": ["DELETE: mode not enabled"], "allowed_methods": ["DELETE", "GET", "HEAD", "PATCH", "POST"]}}`,
+			ResponseHeader: http.Header{"Allow": []string{"DELETE, GET, HEAD, PATCH, POST"}},
+			ExtraTest:      checkFooIDs("1", "2", "3", "4", "5"),
+		},
+		`ClearNotAllowed`: {
+			Init: bulkInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("DELETE", `/foo`, nil)
+			},
+			ResponseCode: http.StatusMethodNotAllowed,
+			ResponseBody: `{"code": 405, "message": "Method Not Allowed", "issues": {"method": ["DELETE: mode not enabled"], "allowed_methods": ["DELETE", "GET", "HEAD"]}}`,
+			ExtraTest:    checkFooIDs("1", "2", "3", "4", "5"),
+		},
 		`NoStorage`: {
 			// FIXME: For NoStorage, it's probably better to error early (during Bind).
 			Init: func() *requestTestVars {
@@ -3,15 +3,37 @@ package rest
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema/query"
 )
 
 // listGet handles GET resquests on a resource URL.
+//
+// The q parameter triggers a full text search on the fields of the resource
+// flagged as Searchable, if its storage handler implements resource.Searcher.
+//
+// If the storage handler implements resource.CollectionVersioner, the version
+// of the collection is returned in the X-Collection-Version header and a 304
+// is returned when it matches the X-If-None-Match-Version request header.
+//
+// A 304 is also returned when the If-None-Match request header matches the
+// etag of the page, computed from the etags of its items.
+//
+// The since parameter returns the changes of the collection instead of its
+// items, if its storage handler implements resource.ChangeTracker.
 func listGet(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
+	if route.Params.Get("group_by") != "" || route.Params.Get("metrics") != "" {
+		return listAggregate(ctx, route)
+	}
+	if since, found := route.Params["since"]; found {
+		return listChanges(ctx, route, since[0])
+	}
 	forceTotal := false
 	rsc := route.Resource()
 	switch rsc.Conf().ForceTotal {
@@ -24,16 +46,35 @@ func listGet(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 			return 422, nil, &Error{422, "Cannot use `total' parameter: denied by configuration", nil}
 		}
 	}
-	q, e := route.Query()
+	q, e := route.query(ctx, resource.List)
 	if e != nil {
 		return e.Code, nil, e
 	}
+	// Read the version before the items so a concurrent write can't be
+	// reported under the previous version.
+	version, err := collectionVersion(ctx, rsc, route, q)
+	if err == resource.ErrNotImplemented {
+		version = ""
+	} else if err != nil {
+		e = NewError(err)
+		return e.Code, nil, e
+	}
+	if version != "" && r.Header.Get("X-If-None-Match-Version") == version {
+		headers = http.Header{}
+		headers.Set("X-Collection-Version", version)
+		setCacheControl(headers, r, rsc.Conf())
+		return 304, headers, nil
+	}
 	var list *resource.ItemList
-	var err error
-	if forceTotal {
-		list, err = rsc.FindWithTotal(ctx, q)
+	if text := route.Params.Get("q"); text != "" {
+		if len(rsc.SearchableFields()) == 0 {
+			return 422, nil, &Error{422, "Cannot use `q' parameter: no searchable field", nil}
+		}
+		list, err = rsc.Search(ctx, text, q)
+	} else if forceTotal {
+		list, err = rsc.FindWithTotal(resource.WithPartialResults(ctx), q)
 	} else {
-		list, err = rsc.Find(ctx, q)
+		list, err = rsc.Find(resource.WithPartialResults(ctx), q)
 	}
 	if err != nil {
 		e = NewError(err)
@@ -42,6 +83,17 @@ func listGet(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 	if win := q.Window; win != nil && win.Offset > 0 {
 		list.Offset = win.Offset
 	}
+	// Handle conditional request: If-None-Match, compared with the etag of
+	// the page.
+	if etag := variantEtag(ctx, listEtag(list)); compareEtag(r.Header.Get("If-None-Match"), etag) {
+		headers = http.Header{}
+		headers.Set("ETag", `W/"`+etag+`"`)
+		if version != "" {
+			headers.Set("X-Collection-Version", version)
+		}
+		setCacheControl(headers, r, rsc.Conf())
+		return 304, headers, nil
+	}
 	for _, item := range list.Items {
 		item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsc})
 		if err != nil {
@@ -49,7 +101,183 @@ func listGet(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 			return e.Code, nil, e
 		}
 	}
-	return 200, nil, list
+	headers = http.Header{}
+	if version != "" {
+		headers.Set("X-Collection-Version", version)
+	}
+	setLinkHeader(headers, r, route, q.Window, list)
+	setCacheControl(headers, r, rsc.Conf())
+	return 200, headers, list
+}
+
+// listAggregate handles GET requests on a resource URL with the group_by or
+// metrics parameters. The items matching the filter are grouped by the
+// group_by fields and the metrics (count by default) are computed for each
+// group.
+func listAggregate(ctx context.Context, route *RouteMatch) (status int, headers http.Header, body interface{}) {
+	rsc := route.Resource()
+	q, e := route.query(ctx, resource.List)
+	if e != nil {
+		return e.Code, nil, e
+	}
+	issues := map[string][]interface{}{}
+	groupBy := []string{}
+	if g := route.Params.Get("group_by"); g != "" {
+		for _, field := range strings.Split(g, ",") {
+			field = strings.TrimSpace(field)
+			if err := checkAggregateField(ctx, rsc, field); err != nil {
+				issues["group_by"] = append(issues["group_by"], err.Error())
+				continue
+			}
+			groupBy = append(groupBy, field)
+		}
+	}
+	metrics := []resource.Metric{{Op: resource.Count}}
+	if m := route.Params.Get("metrics"); m != "" {
+		var err error
+		if metrics, err = resource.ParseMetrics(m); err != nil {
+			issues["metrics"] = append(issues["metrics"], err.Error())
+		}
+		for _, metric := range metrics {
+			err := metric.Validate(rsc.Validator())
+			if err == nil && metric.Field != "" {
+				err = checkAggregateField(ctx, rsc, metric.Field)
+			}
+			if err != nil {
+				issues["metrics"] = append(issues["metrics"], err.Error())
+			}
+		}
+	}
+	if len(issues) > 0 {
+		return 422, nil, &Error{422, "URL parameters contain error(s)", issues}
+	}
+	results, err := rsc.Aggregate(ctx, q.Predicate, groupBy, metrics)
+	if err != nil {
+		e = NewError(err)
+		return e.Code, nil, e
+	}
+	groups := make([]map[string]interface{}, 0, len(results))
+	for _, res := range results {
+		groups = append(groups, map[string]interface{}{
+			"group":   res.Group,
+			"metrics": res.Metrics,
+		})
+	}
+	return 200, nil, groups
+}
+
+// checkAggregateField returns an error if the items of rsc can't be grouped
+// or measured on field. Like filters, aggregations are restricted to
+// filterable fields and can't reveal the values of fields the client can't
+// read.
+func checkAggregateField(ctx context.Context, rsc *resource.Resource, field string) error {
+	def := rsc.Validator().GetField(field)
+	switch {
+	case def == nil || !def.IsEnabled(ctx):
+		return fmt.Errorf("%s: unknown field", field)
+	case def.IsHidden(ctx):
+		return fmt.Errorf("%s: hidden field", field)
+	case def.Encrypter != nil:
+		return fmt.Errorf("%s: encrypted field", field)
+	case !def.Filterable:
+		return fmt.Errorf("%s: field is not filterable", field)
+	}
+	return nil
+}
+
+// listChanges handles GET requests on a resource URL with the since
+// parameter. The items created or updated after the since token are returned
+// as upserts and the ids of the items deleted after it as deletes, along with
+// the token to give as since parameter of the next request.
+func listChanges(ctx context.Context, route *RouteMatch, since string) (status int, headers http.Header, body interface{}) {
+	rsc := route.Resource()
+	q, e := route.query(ctx, resource.List)
+	if e != nil {
+		return e.Code, nil, e
+	}
+	if q.Window != nil {
+		// The position in the history is given by the since token, so only
+		// the limit of the window applies.
+		if q.Window.Limit >= 0 {
+			q.Window = &query.Window{Limit: q.Window.Limit}
+		} else {
+			q.Window = nil
+		}
+	}
+	changes, err := rsc.Changes(ctx, q, since)
+	if err != nil {
+		e = NewError(err)
+		return e.Code, nil, e
+	}
+	if changes == nil {
+		changes = &resource.ChangeList{Token: since}
+	}
+	_, keyCase := routeKeyCases(ctx)
+	upserts := []map[string]interface{}{}
+	deletes := []interface{}{}
+	for _, c := range changes.Changes {
+		if c.Deleted || c.Item == nil {
+			deletes = append(deletes, c.ID)
+			continue
+		}
+		payload, err := q.Projection.Eval(ctx, c.Item.Payload, restResource{rsc})
+		if err != nil {
+			e = NewError(err)
+			return e.Code, nil, e
+		}
+		d := convertDocKeys(payload, rsc.Validator(), keyCase)
+		if c.Item.ETag != "" {
+			d["_etag"] = c.Item.ETag
+		}
+		upserts = append(upserts, d)
+	}
+	return 200, nil, map[string]interface{}{
+		"token":   changes.Token,
+		"upserts": upserts,
+		"deletes": deletes,
+	}
+}
+
+// setLinkHeader sets a RFC 5988 Link header with the first, prev, next and
+// last pages of a paginated list. The next link is omitted on the last page and
+// the prev link on the first. When the total is unknown, the last link is
+// omitted and the next link is only set if the current page is full.
+func setLinkHeader(headers http.Header, r *http.Request, route *RouteMatch, win *query.Window, list *resource.ItemList) {
+	if win == nil || win.Limit <= 0 {
+		return
+	}
+	page := 1
+	if p, found, err := getUintParam(route.Params, "page"); found && err == nil && p > 0 {
+		page = p
+	}
+	skip := 0
+	if s, found, err := getUintParam(route.Params, "skip"); found && err == nil {
+		skip = s
+	}
+	lastPage := -1
+	if list.Total >= 0 {
+		lastPage = (list.Total - skip + win.Limit - 1) / win.Limit
+		if lastPage < 1 {
+			lastPage = 1
+		}
+	}
+	link := func(page int, rel string) string {
+		params := r.URL.Query()
+		params.Set("page", strconv.Itoa(page))
+		params.Set("limit", strconv.Itoa(win.Limit))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, params.Encode(), rel)
+	}
+	links := []string{link(1, "first")}
+	if page > 1 {
+		links = append(links, link(page-1, "prev"))
+	}
+	if (lastPage == -1 && len(list.Items) == win.Limit) || page < lastPage {
+		links = append(links, link(page+1, "next"))
+	}
+	if lastPage != -1 {
+		links = append(links, link(lastPage, "last"))
+	}
+	headers.Set("Link", strings.Join(links, ", "))
 }
 
 func getUintParam(params url.Values, name string) (int, bool, error) {
@@ -1,14 +1,21 @@
 package rest_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/rs/rest-layer/resource"
 	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/rest"
 	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetListInvalidQuery(t *testing.T) {
@@ -16,7 +23,9 @@ func TestGetListInvalidQuery(t *testing.T) {
 		s := mem.NewHandler()
 
 		idx := resource.NewIndex()
-		idx.Bind("foo", schema.Schema{}, s, resource.Conf{AllowedModes: resource.ReadWrite})
+		idx.Bind("foo", schema.Schema{Fields: schema.Fields{
+			"bar": {NotProjectable: true},
+		}}, s, resource.Conf{AllowedModes: resource.ReadWrite})
 
 		return &requestTestVars{
 			Index:   idx,
@@ -25,6 +34,48 @@ func TestGetListInvalidQuery(t *testing.T) {
 	}
 
 	tests := map[string]requestTest{
+		"fields:notProjectable": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?fields=bar", nil)
+			},
+			ResponseCode: 422,
+			ResponseBody: `{
+				"code": 422,
+				"message": "URL parameters contain error(s)",
+				"issues": {
+					"fields": ["bar: field is not projectable"]
+				}
+			}`,
+		},
+		"sort:notSortable": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?sort=bar", nil)
+			},
+			ResponseCode: 422,
+			ResponseBody: `{
+				"code": 422,
+				"message": "URL parameters contain error(s)",
+				"issues": {
+					"sort": ["bar: field is not sortable"]
+				}
+			}`,
+		},
+		"filter:notFilterable": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?filter={bar:"baz"}`, nil)
+			},
+			ResponseCode: 422,
+			ResponseBody: `{
+				"code": 422,
+				"message": "URL parameters contain error(s)",
+				"issues": {
+					"filter": ["bar: field is not filterable"]
+				}
+			}`,
+		},
 		"fields:invalid": {
 			Init: sharedInit,
 			NewRequest: func() (*http.Request, error) {
@@ -208,6 +259,755 @@ func TestGetListPagination(t *testing.T) {
 		t.Run(n, tc.Test)
 	}
 }
+
+func TestGetListDefaultSort(t *testing.T) {
+	s := mem.NewHandler()
+	s.Insert(context.TODO(), []*resource.Item{
+		{ID: "3", Payload: map[string]interface{}{"id": "3"}},
+		{ID: "1", Payload: map[string]interface{}{"id": "1"}},
+		{ID: "4", Payload: map[string]interface{}{"id": "4"}},
+		{ID: "2", Payload: map[string]interface{}{"id": "2"}},
+	})
+	conf := resource.DefaultConf
+	conf.DefaultSort = query.Sort{{Name: "id"}}
+	idx := resource.NewIndex()
+	idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {Sortable: true}}}, s, conf)
+	h, err := rest.NewHandler(idx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	get := func(url string) string {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", url, nil)
+		h.ServeHTTP(w, r)
+		assert.Equal(t, 200, w.Code)
+		return w.Body.String()
+	}
+
+	first := get("/foo")
+	assert.JSONEq(t, `[{"id": "1"}, {"id": "2"}, {"id": "3"}, {"id": "4"}]`, first)
+	assert.Equal(t, first, get("/foo"))
+	assert.JSONEq(t, `[{"id": "4"}, {"id": "3"}, {"id": "2"}, {"id": "1"}]`, get("/foo?sort=-id"))
+}
+
+type aggregatorHandler struct {
+	*mem.MemoryHandler
+	lookup  query.Predicate
+	groupBy []string
+	metrics []resource.Metric
+}
+
+func (h *aggregatorHandler) Aggregate(ctx context.Context, lookup query.Predicate, groupBy []string, metrics []resource.Metric) ([]resource.AggResult, error) {
+	h.lookup, h.groupBy, h.metrics = lookup, groupBy, metrics
+	return []resource.AggResult{
+		{Group: map[string]interface{}{"status": "paid"}, Metrics: map[string]interface{}{"count": 2}},
+		{Group: map[string]interface{}{"status": "open"}, Metrics: map[string]interface{}{"count": 1}},
+	}, nil
+}
+
+func TestGetListAggregate(t *testing.T) {
+	s := schema.Schema{Fields: schema.Fields{
+		"status": {Filterable: true},
+		"total":  {Filterable: true},
+		"secret": {Hidden: true, Filterable: true},
+		"notes":  {},
+	}}
+	sharedInit := func() *requestTestVars {
+		h := &aggregatorHandler{MemoryHandler: mem.NewHandler()}
+		idx := resource.NewIndex()
+		idx.Bind("foo", s, h, resource.DefaultConf)
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": h},
+		}
+	}
+	checkArgs := func(lookup query.Predicate, groupBy []string, metrics []resource.Metric) requestCheckerFunc {
+		return func(t *testing.T, vars *requestTestVars) {
+			h := vars.Storers["foo"].(*aggregatorHandler)
+			assert.Equal(t, lookup, h.lookup)
+			assert.Equal(t, groupBy, h.groupBy)
+			assert.Equal(t, metrics, h.metrics)
+		}
+	}
+
+	tests := map[string]requestTest{
+		"group_by": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?group_by=status&filter={status:{$ne:"void"}}`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[
+				{"group": {"status": "paid"}, "metrics": {"count": 2}},
+				{"group": {"status": "open"}, "metrics": {"count": 1}}
+			]`,
+			ExtraTest: checkArgs(
+				query.Predicate{&query.NotEqual{Field: "status", Value: "void"}},
+				[]string{"status"},
+				[]resource.Metric{{Op: resource.Count}},
+			),
+		},
+		"metrics": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?group_by=status&metrics=count,sum(total)`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[
+				{"group": {"status": "paid"}, "metrics": {"count": 2}},
+				{"group": {"status": "open"}, "metrics": {"count": 1}}
+			]`,
+			ExtraTest: checkArgs(
+				nil,
+				[]string{"status"},
+				[]resource.Metric{{Op: resource.Count}, {Op: resource.Sum, Field: "total"}},
+			),
+		},
+		"invalid": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?group_by=foo&metrics=avg(bar)`, nil)
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "URL parameters contain error(s)", "issues": {
+				"group_by": ["foo: unknown field"],
+				"metrics": ["bar: unknown field"]
+			}}`,
+		},
+		"restricted": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?group_by=secret,notes&metrics=sum(secret)`, nil)
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "URL parameters contain error(s)", "issues": {
+				"group_by": ["secret: hidden field", "notes: field is not filterable"],
+				"metrics": ["secret: hidden field"]
+			}}`,
+		},
+		"find-hook": {
+			Init: func() *requestTestVars {
+				h := &aggregatorHandler{MemoryHandler: mem.NewHandler()}
+				idx := resource.NewIndex()
+				foo := idx.Bind("foo", s, h, resource.DefaultConf)
+				foo.Use(resource.FindEventHandlerFunc(func(ctx context.Context, q *query.Query) error {
+					q.Predicate = append(q.Predicate, &query.Equal{Field: "status", Value: "open"})
+					return nil
+				}))
+				return &requestTestVars{
+					Index:   idx,
+					Storers: map[string]resource.Storer{"foo": h},
+				}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?group_by=status`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[
+				{"group": {"status": "paid"}, "metrics": {"count": 2}},
+				{"group": {"status": "open"}, "metrics": {"count": 1}}
+			]`,
+			ExtraTest: checkArgs(
+				query.Predicate{&query.Equal{Field: "status", Value: "open"}},
+				[]string{"status"},
+				[]resource.Metric{{Op: resource.Count}},
+			),
+		},
+		"not-supported": {
+			Init: func() *requestTestVars {
+				idx := resource.NewIndex()
+				idx.Bind("foo", s, mem.NewHandler(), resource.DefaultConf)
+				return &requestTestVars{Index: idx}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?group_by=status`, nil)
+			},
+			ResponseCode: 405,
+			ResponseBody: `{"code": 405, "message": "Aggregation Not Supported"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+// storerOnly hides the optional interfaces of the wrapped storer.
+type storerOnly struct {
+	resource.Storer
+}
+
+func TestGetListSearch(t *testing.T) {
+	s := schema.Schema{Fields: schema.Fields{
+		"id":     {Sortable: true, Filterable: true},
+		"title":  {Searchable: true},
+		"body":   {Searchable: true},
+		"status": {Filterable: true},
+	}}
+	insert := func(st resource.Storer) {
+		st.Insert(context.Background(), []*resource.Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "title": "Go Generics", "body": "type parameters", "status": "published"}},
+			{ID: "2", Payload: map[string]interface{}{"id": "2", "title": "Rust", "body": "borrowing in go-like style", "status": "draft"}},
+			{ID: "3", Payload: map[string]interface{}{"id": "3", "title": "Python", "body": "", "status": "published"}},
+		})
+	}
+	sharedInit := func() *requestTestVars {
+		h := mem.NewHandler()
+		insert(h)
+		idx := resource.NewIndex()
+		idx.Bind("foo", s, h, resource.DefaultConf)
+		return &requestTestVars{Index: idx}
+	}
+
+	tests := map[string]requestTest{
+		"match": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?q=GO&fields=id`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "1"}, {"id": "2"}]`,
+		},
+		"match-filter": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?q=go&filter={status:"published"}&fields=id`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "1"}]`,
+		},
+		"no-match": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				// The status field is not searchable.
+				return http.NewRequest("GET", `/foo?q=draft`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[]`,
+		},
+		"no-searchable-field": {
+			Init: func() *requestTestVars {
+				idx := resource.NewIndex()
+				idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, mem.NewHandler(), resource.DefaultConf)
+				return &requestTestVars{Index: idx}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?q=go`, nil)
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Cannot use ` + "`q'" + ` parameter: no searchable field"}`,
+		},
+		"not-supported": {
+			Init: func() *requestTestVars {
+				h := mem.NewHandler()
+				insert(h)
+				idx := resource.NewIndex()
+				idx.Bind("foo", s, storerOnly{h}, resource.DefaultConf)
+				return &requestTestVars{Index: idx}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?q=go`, nil)
+			},
+			ResponseCode: 405,
+			ResponseBody: `{"code": 405, "message": "Search Not Supported"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+// estimatingStorer is a storer which Find doesn't compute the total, and
+// which can count or estimate the number of items.
+type estimatingStorer struct {
+	resource.Storer
+	estimate int
+}
+
+func (s estimatingStorer) Find(ctx context.Context, q *query.Query) (*resource.ItemList, error) {
+	l, err := s.Storer.Find(ctx, q)
+	if err == nil {
+		l.Total = -1
+	}
+	return l, err
+}
+
+func (s estimatingStorer) Count(ctx context.Context, q *query.Query) (int, error) {
+	l, err := s.Storer.Find(ctx, q)
+	if err != nil {
+		return -1, err
+	}
+	return len(l.Items), nil
+}
+
+func (s estimatingStorer) EstimateCount(ctx context.Context, q *query.Query) (int, error) {
+	return s.estimate, nil
+}
+
+func TestGetListTotalEstimate(t *testing.T) {
+	init := func(threshold int, estimator bool) func() *requestTestVars {
+		return func() *requestTestVars {
+			h := mem.NewHandler()
+			h.Insert(context.Background(), []*resource.Item{
+				{ID: "1", Payload: map[string]interface{}{"id": "1"}},
+				{ID: "2", Payload: map[string]interface{}{"id": "2"}},
+			})
+			var st resource.Storer = estimatingStorer{Storer: h, estimate: 1000}
+			if !estimator {
+				// Hide both the Counter and CountEstimator interfaces.
+				st = storerOnly{st}
+			}
+			conf := resource.DefaultConf
+			conf.TotalEstimateThreshold = threshold
+			idx := resource.NewIndex()
+			idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, st, conf)
+			return &requestTestVars{Index: idx}
+		}
+	}
+	newRequest := func() (*http.Request, error) {
+		return http.NewRequest("GET", "/foo?total=1&limit=1", nil)
+	}
+
+	tests := map[string]requestTest{
+		"Estimated": {
+			Init:           init(100, true),
+			NewRequest:     newRequest,
+			ResponseCode:   200,
+			ResponseHeader: http.Header{"X-Total": []string{"1000"}, "X-Total-Estimated": []string{"true"}},
+			ResponseBody:   `[{"id": "1"}]`,
+		},
+		"BelowThreshold": {
+			Init:           init(10000, true),
+			NewRequest:     newRequest,
+			ResponseCode:   200,
+			ResponseHeader: http.Header{"X-Total": []string{"2"}, "X-Total-Estimated": nil},
+			ResponseBody:   `[{"id": "1"}]`,
+		},
+		"Disabled": {
+			Init:           init(0, true),
+			NewRequest:     newRequest,
+			ResponseCode:   200,
+			ResponseHeader: http.Header{"X-Total": []string{"2"}, "X-Total-Estimated": nil},
+			ResponseBody:   `[{"id": "1"}]`,
+		},
+		"NotSupported": {
+			Init:         init(100, false),
+			NewRequest:   newRequest,
+			ResponseCode: 501,
+			ResponseBody: `{"code": 501, "message": "Not Implemented"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+// slowStorer fetches the items right away but only returns them, along with the
+// context error, once the context is done.
+type slowStorer struct {
+	resource.Storer
+}
+
+func (s slowStorer) Find(ctx context.Context, q *query.Query) (*resource.ItemList, error) {
+	l, err := s.Storer.Find(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	<-ctx.Done()
+	return l, ctx.Err()
+}
+
+func TestGetListPartialResult(t *testing.T) {
+	init := func(timeout time.Duration) func() *requestTestVars {
+		return func() *requestTestVars {
+			h := mem.NewHandler()
+			h.Insert(context.Background(), []*resource.Item{
+				{ID: "1", Payload: map[string]interface{}{"id": "1"}},
+				{ID: "2", Payload: map[string]interface{}{"id": "2"}},
+			})
+			conf := resource.DefaultConf
+			conf.PartialFindTimeout = timeout
+			idx := resource.NewIndex()
+			idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, slowStorer{h}, conf)
+			return &requestTestVars{Index: idx}
+		}
+	}
+
+	tests := map[string]requestTest{
+		"Partial": {
+			Init: init(10 * time.Millisecond),
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?limit=1", nil)
+			},
+			ResponseCode:   200,
+			ResponseHeader: http.Header{"X-Partial-Result": []string{"true"}},
+			ResponseBody:   `[{"id": "1"}]`,
+		},
+		"Item": {
+			// Item requests can't use partial results and fail with the
+			// request deadline.
+			Init: init(10 * time.Millisecond),
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/foo/1", nil)
+				if err != nil {
+					return nil, err
+				}
+				ctx, cancel := context.WithTimeout(r.Context(), 30*time.Millisecond)
+				time.AfterFunc(time.Second, cancel)
+				return r.WithContext(ctx), nil
+			},
+			ResponseCode: 504,
+			ResponseBody: `{"code": 504, "message": "Deadline Exceeded"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestGetListCollectionVersion(t *testing.T) {
+	s := mem.NewHandler()
+	idx := resource.NewIndex()
+	idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}}}, s, resource.DefaultConf)
+	idx.Bind("bar", schema.Schema{Fields: schema.Fields{"id": {}}}, storerOnly{mem.NewHandler()}, resource.DefaultConf)
+	denied := idx.Bind("baz", schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}}}, s, resource.DefaultConf)
+	denied.Use(resource.FindEventHandlerFunc(func(ctx context.Context, q *query.Query) error {
+		return resource.ErrForbidden
+	}))
+	h, err := rest.NewHandler(idx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	list := func(path, version string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		if version != "" {
+			r.Header.Set("X-If-None-Match-Version", version)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	s.Insert(context.Background(), []*resource.Item{{ID: "1", Payload: map[string]interface{}{"id": "1", "foo": "a"}}})
+
+	w := list("/foo", "")
+	assert.Equal(t, 200, w.Code)
+	version := w.Header().Get("X-Collection-Version")
+	assert.NotEqual(t, "", version)
+
+	// Unchanged collection.
+	w = list("/foo", version)
+	assert.Equal(t, 304, w.Code)
+	assert.Equal(t, version, w.Header().Get("X-Collection-Version"))
+	assert.Equal(t, "", w.Body.String())
+
+	// The version is tied to the query-string of the list.
+	for _, path := range []string{"/foo?page=2&limit=1", "/foo?limit=5", "/foo?fields=id"} {
+		w = list(path, version)
+		assert.Equal(t, 200, w.Code, path)
+		v := w.Header().Get("X-Collection-Version")
+		assert.NotEqual(t, version, v, path)
+		w = list(path, v)
+		assert.Equal(t, 304, w.Code, path)
+	}
+
+	// The find hooks are run before the version is checked.
+	w = list("/baz", version)
+	assert.Equal(t, 403, w.Code)
+
+	// Changed collection.
+	s.Insert(context.Background(), []*resource.Item{{ID: "2", Payload: map[string]interface{}{"id": "2", "foo": "b"}}})
+	w = list("/foo", version)
+	assert.Equal(t, 200, w.Code)
+	assert.NotEqual(t, version, w.Header().Get("X-Collection-Version"))
+	assert.JSONEq(t, `[{"id": "1", "foo": "a"}, {"id": "2", "foo": "b"}]`, w.Body.String())
+
+	// Storage handlers without versions always return the list.
+	w = list("/bar", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "", w.Header().Get("X-Collection-Version"))
+	w = list("/bar", "1")
+	assert.Equal(t, 200, w.Code)
+}
+
+// changelogHandler serves the changes of a fixed changelog, the since token
+// being the index of the last change already seen. The tombstones keep the
+// last version of the deleted items so they can be scoped by the lookup.
+type changelogHandler struct {
+	*mem.MemoryHandler
+	log []resource.Change
+}
+
+func (h *changelogHandler) Changes(ctx context.Context, q *query.Query, since string) (*resource.ChangeList, error) {
+	if h.log == nil {
+		return nil, nil
+	}
+	start := 0
+	if since != "" {
+		var err error
+		if start, err = strconv.Atoi(since); err != nil || start > len(h.log) {
+			return nil, &rest.Error{Code: 410, Message: "Expired token"}
+		}
+	}
+	l := &resource.ChangeList{Changes: []resource.Change{}, Token: strconv.Itoa(len(h.log))}
+	for i := start; i < len(h.log); i++ {
+		if q.Window != nil && len(l.Changes) == q.Window.Limit {
+			break
+		}
+		c := h.log[i]
+		l.Token = strconv.Itoa(i + 1)
+		if !q.Predicate.Match(c.Item.Payload) {
+			continue
+		}
+		if c.Deleted {
+			c.Item = nil
+		}
+		l.Changes = append(l.Changes, c)
+	}
+	return l, nil
+}
+
+func TestGetListChanges(t *testing.T) {
+	s := schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}, "bar": {Filterable: true}}}
+	item := func(id, foo, bar string) *resource.Item {
+		return &resource.Item{ID: id, ETag: "e" + id, Payload: map[string]interface{}{"id": id, "foo": foo, "bar": bar}}
+	}
+	h := &changelogHandler{MemoryHandler: mem.NewHandler(), log: []resource.Change{
+		{ID: "1", Item: item("1", "a", "x")},
+		{ID: "2", Deleted: true, Item: item("2", "b", "x")},
+		{ID: "3", Item: item("3", "c", "x")},
+		{ID: "4", Deleted: true, Item: item("4", "d", "y")},
+	}}
+	sharedInit := func() *requestTestVars {
+		idx := resource.NewIndex()
+		idx.Bind("foo", s, h, resource.DefaultConf)
+		return &requestTestVars{Index: idx}
+	}
+	tests := map[string]requestTest{
+		"all": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?since=", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `{
+				"token": "4",
+				"upserts": [
+					{"id": "1", "foo": "a", "bar": "x", "_etag": "e1"},
+					{"id": "3", "foo": "c", "bar": "x", "_etag": "e3"}
+				],
+				"deletes": ["2", "4"]
+			}`,
+		},
+		"since-token": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?since=2&fields=id,foo", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `{
+				"token": "4",
+				"upserts": [{"id": "3", "foo": "c", "_etag": "e3"}],
+				"deletes": ["4"]
+			}`,
+		},
+		"scoped": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?since=&filter={bar:"x"}`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `{
+				"token": "4",
+				"upserts": [
+					{"id": "1", "foo": "a", "bar": "x", "_etag": "e1"},
+					{"id": "3", "foo": "c", "bar": "x", "_etag": "e3"}
+				],
+				"deletes": ["2"]
+			}`,
+		},
+		"limit": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?since=&limit=2", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `{
+				"token": "2",
+				"upserts": [{"id": "1", "foo": "a", "bar": "x", "_etag": "e1"}],
+				"deletes": ["2"]
+			}`,
+		},
+		"no-list": {
+			Init: func() *requestTestVars {
+				idx := resource.NewIndex()
+				idx.Bind("foo", s, &changelogHandler{MemoryHandler: mem.NewHandler()}, resource.DefaultConf)
+				return &requestTestVars{Index: idx}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?since=3", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `{"token": "3", "upserts": [], "deletes": []}`,
+		},
+		"up-to-date": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?since=4", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `{"token": "4", "upserts": [], "deletes": []}`,
+		},
+		"invalid-token": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?since=foo", nil)
+			},
+			ResponseCode: 410,
+			ResponseBody: `{"code": 410, "message": "Expired token"}`,
+		},
+		"not-supported": {
+			Init: func() *requestTestVars {
+				idx := resource.NewIndex()
+				idx.Bind("foo", s, mem.NewHandler(), resource.DefaultConf)
+				return &requestTestVars{Index: idx}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?since=1", nil)
+			},
+			ResponseCode: 405,
+			ResponseBody: `{"code": 405, "message": "Change Tracking Not Supported"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestGetListEtag(t *testing.T) {
+	idx := resource.NewIndex()
+	idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {Sortable: true}, "foo": {}}}, mem.NewHandler(), resource.DefaultConf)
+	h, err := rest.NewHandler(idx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	serve := func(method, path, body, etag string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		w := serve("PUT", "/foo/"+id, `{"foo": "a"}`, "")
+		assert.Equal(t, 201, w.Code, w.Body.String())
+	}
+
+	// The same page yields the same etag.
+	w := serve("GET", "/foo?limit=2&page=1&sort=id", "", "")
+	assert.Equal(t, 200, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEqual(t, "", etag)
+	w = serve("GET", "/foo?limit=2&page=1&sort=id", "", "")
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	w = serve("GET", "/foo?limit=2&page=2&sort=id", "", "")
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// Unchanged page.
+	w = serve("GET", "/foo?limit=2&page=1&sort=id", "", etag)
+	assert.Equal(t, 304, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, "", w.Body.String())
+
+	// Changed item of the page.
+	w = serve("PATCH", "/foo/1", `{"foo": "b"}`, "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = serve("GET", "/foo?limit=2&page=1&sort=id", "", etag)
+	assert.Equal(t, 200, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestGetListPaginationLinkHeader(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.TODO(), []*resource.Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1"}},
+			{ID: "2", Payload: map[string]interface{}{"id": "2"}},
+			{ID: "3", Payload: map[string]interface{}{"id": "3"}},
+			{ID: "4", Payload: map[string]interface{}{"id": "4"}},
+			{ID: "5", Payload: map[string]interface{}{"id": "5"}},
+		})
+
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{
+			Fields: schema.Fields{
+				"id": {Sortable: true, Filterable: true},
+			},
+		}, s, resource.DefaultConf)
+
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": s},
+		}
+	}
+
+	tests := map[string]requestTest{
+		"page:1,limit:2": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?page=1&limit=2", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "1"}, {"id": "2"}]`,
+			ResponseHeader: http.Header{
+				"Link": []string{`</foo?limit=2&page=1>; rel="first", </foo?limit=2&page=2>; rel="next", </foo?limit=2&page=3>; rel="last"`},
+			},
+		},
+		"page:2,limit:2": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?page=2&limit=2", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "3"}, {"id": "4"}]`,
+			ResponseHeader: http.Header{
+				"Link": []string{`</foo?limit=2&page=1>; rel="first", </foo?limit=2&page=1>; rel="prev", </foo?limit=2&page=3>; rel="next", </foo?limit=2&page=3>; rel="last"`},
+			},
+		},
+		"page:3,limit:2": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo?page=3&limit=2", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "5"}]`,
+			ResponseHeader: http.Header{
+				"Link": []string{`</foo?limit=2&page=1>; rel="first", </foo?limit=2&page=2>; rel="prev", </foo?limit=2&page=3>; rel="last"`},
+			},
+		},
+		"page:2,limit:2,sort:-id,filter": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/foo?page=2&limit=2&sort=-id&filter={"id":{"$ne":"1"}}`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "3"}, {"id": "2"}]`,
+			ResponseHeader: http.Header{
+				"Link": []string{`</foo?filter=%7B%22id%22%3A%7B%22%24ne%22%3A%221%22%7D%7D&limit=2&page=1&sort=-id>; rel="first", </foo?filter=%7B%22id%22%3A%7B%22%24ne%22%3A%221%22%7D%7D&limit=2&page=1&sort=-id>; rel="prev", </foo?filter=%7B%22id%22%3A%7B%22%24ne%22%3A%221%22%7D%7D&limit=2&page=2&sort=-id>; rel="last"`},
+			},
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
 func TestGetListFieldHandler(t *testing.T) {
 	sharedInit := func() *requestTestVars {
 		s := mem.NewHandler()
@@ -287,6 +1087,68 @@ func TestGetListFieldHandler(t *testing.T) {
 	}
 }
 
+func TestGetListConnectionCount(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		users := mem.NewHandler()
+		users.Insert(context.TODO(), []*resource.Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "name": "john"}},
+			{ID: "2", Payload: map[string]interface{}{"id": "2", "name": "jane"}},
+		})
+		posts := mem.NewHandler()
+		posts.Insert(context.TODO(), []*resource.Item{
+			{ID: "a", Payload: map[string]interface{}{"id": "a", "user": "1"}},
+			{ID: "b", Payload: map[string]interface{}{"id": "b", "user": "1"}},
+			{ID: "c", Payload: map[string]interface{}{"id": "c", "user": "2"}},
+		})
+
+		idx := resource.NewIndex()
+		u := idx.Bind("users", schema.Schema{
+			Fields: schema.Fields{
+				"id":   {},
+				"name": {},
+				"post_count": {
+					ReadOnly:  true,
+					Validator: &schema.ConnectionCount{Path: ".posts", Field: "user"},
+				},
+			},
+		}, users, resource.DefaultConf)
+		u.Bind("posts", "user", schema.Schema{
+			Fields: schema.Fields{
+				"id":   {},
+				"user": {},
+			},
+		}, posts, resource.DefaultConf)
+
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"users": users, "users.posts": posts},
+		}
+	}
+
+	tests := map[string]requestTest{
+		`fields:id,post_count`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/users?fields=id,post_count`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "1", "post_count": 2}, {"id": "2", "post_count": 1}]`,
+		},
+		`fields:none`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", `/users`, nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "1", "name": "john"}, {"id": "2", "name": "jane"}]`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
 func TestGetListFilter(t *testing.T) {
 	sharedInit := func() *requestTestVars {
 		s := mem.NewHandler()
@@ -4,12 +4,13 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/rs/rest-layer/resource"
 	"github.com/rs/rest-layer/schema/query"
 )
 
 // itemDelete handles DELETE resquests on an item URL.
 func itemDelete(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
-	q, e := route.Query()
+	q, e := route.query(ctx, resource.Delete)
 	if e != nil {
 		return e.Code, nil, e
 	}
@@ -19,7 +20,15 @@ func itemDelete(ctx context.Context, r *http.Request, route *RouteMatch) (status
 		e = NewError(err)
 		return e.Code, nil, e
 	}
+	idempotent := route.Resource().Conf().IdempotentDelete
 	if len(l.Items) == 0 {
+		if idempotent && r.Header.Get("If-Match") == "" {
+			// The item is already gone.
+			return 204, nil, nil
+		} else if idempotent {
+			// There is no current representation to match.
+			return ErrPreconditionFailed.Code, nil, ErrPreconditionFailed
+		}
 		return ErrNotFound.Code, nil, ErrNotFound
 	}
 	original := l.Items[0]
@@ -27,7 +36,7 @@ func itemDelete(ctx context.Context, r *http.Request, route *RouteMatch) (status
 	if err := checkIntegrityRequest(r, original); err != nil {
 		return err.Code, nil, err
 	}
-	if err := route.Resource().Delete(ctx, original); err != nil {
+	if err := route.Resource().Delete(ctx, original); err != nil && !(idempotent && err == resource.ErrNotFound) {
 		e = NewError(err)
 		return e.Code, nil, e
 	}
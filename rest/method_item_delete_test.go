@@ -184,3 +184,70 @@ func TestDeleteItem(t *testing.T) {
 		t.Run(n, tc.Test)
 	}
 }
+
+func TestDeleteItemIdempotent(t *testing.T) {
+	newInit := func(idempotent bool) func() *requestTestVars {
+		return func() *requestTestVars {
+			s := mem.NewHandler()
+			s.Insert(context.Background(), []*resource.Item{
+				{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1"}},
+			})
+			idx := resource.NewIndex()
+			idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, s, resource.Conf{
+				AllowedModes:     resource.ReadWrite,
+				IdempotentDelete: idempotent,
+			})
+			return &requestTestVars{
+				Index:   idx,
+				Storers: map[string]resource.Storer{"foo": s},
+			}
+		}
+	}
+	newRequest := func(path, ifMatch string) func() (*http.Request, error) {
+		return func() (*http.Request, error) {
+			r, err := http.NewRequest("DELETE", path, nil)
+			if err == nil && ifMatch != "" {
+				r.Header.Set("If-Match", ifMatch)
+			}
+			return r, err
+		}
+	}
+
+	tests := map[string]requestTest{
+		`found`: {
+			Init:         newInit(true),
+			NewRequest:   newRequest("/foo/1", ""),
+			ResponseCode: http.StatusNoContent,
+			ResponseBody: ``,
+		},
+		`found,header["If-Match"]:not-matching`: {
+			Init:         newInit(true),
+			NewRequest:   newRequest("/foo/1", "W/x"),
+			ResponseCode: http.StatusPreconditionFailed,
+			ResponseBody: `{"code": 412, "message": "Precondition Failed"}`,
+		},
+		`not-found,strict`: {
+			Init:         newInit(false),
+			NewRequest:   newRequest("/foo/2", ""),
+			ResponseCode: http.StatusNotFound,
+			ResponseBody: `{"code": 404, "message": "Not Found"}`,
+		},
+		`not-found,idempotent`: {
+			Init:         newInit(true),
+			NewRequest:   newRequest("/foo/2", ""),
+			ResponseCode: http.StatusNoContent,
+			ResponseBody: ``,
+		},
+		`not-found,idempotent,header["If-Match"]`: {
+			Init:         newInit(true),
+			NewRequest:   newRequest("/foo/2", "W/a"),
+			ResponseCode: http.StatusPreconditionFailed,
+			ResponseBody: `{"code": 412, "message": "Precondition Failed"}`,
+		},
+	}
+
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
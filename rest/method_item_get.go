@@ -5,12 +5,13 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/rs/rest-layer/resource"
 	"github.com/rs/rest-layer/schema/query"
 )
 
 // itemGet handles GET and HEAD resquests on an item URL.
 func itemGet(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
-	q, e := route.Query()
+	q, e := route.query(ctx, resource.Read)
 	if e != nil {
 		return e.Code, nil, e
 	}
@@ -24,9 +25,11 @@ func itemGet(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 		return ErrNotFound.Code, nil, ErrNotFound
 	}
 	item := list.Items[0]
+	headers = http.Header{}
+	setCacheControl(headers, r, rsrc.Conf())
 	// Handle conditional request: If-None-Match.
-	if compareEtag(r.Header.Get("If-None-Match"), item.ETag) {
-		return 304, nil, nil
+	if compareEtag(r.Header.Get("If-None-Match"), variantEtag(ctx, item.ETag)) {
+		return 304, headers, nil
 	}
 	// Handle conditional request: If-Modified-Since.
 	if r.Header.Get("If-Modified-Since") != "" {
@@ -35,13 +38,17 @@ func itemGet(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 		} else if u := item.Updated.Truncate(time.Second); u.Equal(ifModTime) || u.Before(ifModTime) {
 			// Item's update time is truncated to the second because RFC1123
 			// doesn't support more.
-			return 304, nil, nil
+			return 304, headers, nil
 		}
 	}
+	// Handle partial content requests: Range and If-Range.
+	if status, body, ok := itemRange(ctx, r, rsrc, item, headers); ok {
+		return status, headers, body
+	}
 	item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc})
 	if err != nil {
 		e = NewError(err)
 		return e.Code, nil, e
 	}
-	return 200, nil, item
+	return 200, headers, item
 }
@@ -1,15 +1,20 @@
 package rest_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rs/rest-layer/resource"
 	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/rest"
 	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetItem(t *testing.T) {
@@ -281,6 +286,352 @@ func TestGetItemFieldHandler(t *testing.T) {
 	}
 }
 
+func TestGetItemLocalized(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.TODO(), []*resource.Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "title": map[string]interface{}{"en": "Hello", "fr": "Bonjour"}}},
+		})
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{Fields: schema.Fields{
+			"id":    {},
+			"title": {Validator: &schema.Localized{Default: "en"}},
+		}}, s, resource.DefaultConf)
+		return &requestTestVars{Index: idx}
+	}
+	newRequest := func(path, acceptLanguage string) func() (*http.Request, error) {
+		return func() (*http.Request, error) {
+			r, err := http.NewRequest("GET", path, nil)
+			if acceptLanguage != "" {
+				r.Header.Set("Accept-Language", acceptLanguage)
+			}
+			return r, err
+		}
+	}
+	tests := map[string]requestTest{
+		"AcceptLanguage": {
+			Init:         sharedInit,
+			NewRequest:   newRequest("/foo/1", "de;q=0.5, fr-CH, fr;q=0.9"),
+			ResponseCode: 200,
+			ResponseBody: `{"id": "1", "title": "Bonjour"}`,
+		},
+		"Fallback": {
+			Init:         sharedInit,
+			NewRequest:   newRequest("/foo/1", "de"),
+			ResponseCode: 200,
+			ResponseBody: `{"id": "1", "title": "Hello"}`,
+		},
+		"QueryParam": {
+			Init:         sharedInit,
+			NewRequest:   newRequest("/foo/1?lang=fr", "en"),
+			ResponseCode: 200,
+			ResponseBody: `{"id": "1", "title": "Bonjour"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestGetItemLocalizedVariants(t *testing.T) {
+	s := mem.NewHandler()
+	s.Insert(context.TODO(), []*resource.Item{
+		{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "title": map[string]interface{}{"en": "Hello", "fr": "Bonjour"}}},
+	})
+	idx := resource.NewIndex()
+	idx.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":    {},
+		"title": {Validator: &schema.Localized{Default: "en"}},
+	}}, s, resource.DefaultConf)
+	h, err := rest.NewHandler(idx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	serve := func(method, lang, header, value string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, "/foo/1", bytes.NewBufferString(`{"title": {"en": "Hi"}}`))
+		r.Header.Set("Accept-Language", lang)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	fr := serve("GET", "fr", "", "")
+	assert.Equal(t, 200, fr.Code)
+	assert.Equal(t, []string{"Accept", "Accept-Language"}, fr.Header()["Vary"])
+	en := serve("GET", "en", "", "")
+	assert.Equal(t, 200, en.Code)
+	assert.NotEqual(t, fr.Header().Get("Etag"), en.Header().Get("Etag"))
+
+	// A variant is only revalidated with its own etag.
+	assert.Equal(t, 304, serve("GET", "fr", "If-None-Match", fr.Header().Get("Etag")).Code)
+	assert.Equal(t, 200, serve("GET", "en", "If-None-Match", fr.Header().Get("Etag")).Code)
+
+	// Writes are conditioned by the etag of the item, whatever the variant.
+	assert.Equal(t, 200, serve("PATCH", "en", "If-Match", fr.Header().Get("Etag")).Code)
+}
+
+func TestGetCacheControl(t *testing.T) {
+	newInit := func(cc resource.CacheControl) func() *requestTestVars {
+		return func() *requestTestVars {
+			s := mem.NewHandler()
+			s.Insert(context.TODO(), []*resource.Item{
+				{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "bar"}},
+			})
+			conf := resource.DefaultConf
+			conf.CacheControl = &cc
+			idx := resource.NewIndex()
+			idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}}}, s, conf)
+			return &requestTestVars{
+				Index:   idx,
+				Storers: map[string]resource.Storer{"foo": s},
+			}
+		}
+	}
+	swr := newInit(resource.CacheControl{MaxAge: time.Minute, StaleWhileRevalidate: 30 * time.Second, Public: true})
+	noCache := http.Header{"Cache-Control": []string{}}
+
+	tests := map[string]requestTest{
+		"GET:item": {
+			Init: swr,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo/1", nil)
+			},
+			ResponseCode:   http.StatusOK,
+			ResponseHeader: http.Header{"Cache-Control": []string{"public, max-age=60, stale-while-revalidate=30"}},
+			ResponseBody:   `{"id": "1", "foo": "bar"}`,
+		},
+		"GET:item:not-modified": {
+			Init: swr,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/foo/1", nil)
+				r.Header.Set("If-None-Match", `W/"a"`)
+				return r, err
+			},
+			ResponseCode:   http.StatusNotModified,
+			ResponseHeader: http.Header{"Cache-Control": []string{"public, max-age=60, stale-while-revalidate=30"}},
+		},
+		"GET:list": {
+			Init: swr,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo", nil)
+			},
+			ResponseCode:   http.StatusOK,
+			ResponseHeader: http.Header{"Cache-Control": []string{"public, max-age=60, stale-while-revalidate=30"}},
+			ResponseBody:   `[{"id": "1", "foo": "bar", "_etag": "a"}]`,
+		},
+		"GET:private": {
+			Init: newInit(resource.CacheControl{MaxAge: time.Minute}),
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo/1", nil)
+			},
+			ResponseCode:   http.StatusOK,
+			ResponseHeader: http.Header{"Cache-Control": []string{"private, max-age=60"}},
+			ResponseBody:   `{"id": "1", "foo": "bar"}`,
+		},
+		"GET:requires-auth": {
+			Init: newInit(resource.CacheControl{MaxAge: time.Minute, Public: true, RequiresAuth: true}),
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo", nil)
+			},
+			ResponseCode:   http.StatusOK,
+			ResponseHeader: http.Header{"Cache-Control": []string{"private, no-store"}},
+			ResponseBody:   `[{"id": "1", "foo": "bar", "_etag": "a"}]`,
+		},
+		"GET:authorization": {
+			Init: swr,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/foo/1", nil)
+				r.Header.Set("Authorization", "Bearer foo")
+				return r, err
+			},
+			ResponseCode:   http.StatusOK,
+			ResponseHeader: http.Header{"Cache-Control": []string{"private, no-store"}},
+			ResponseBody:   `{"id": "1", "foo": "bar"}`,
+		},
+		"GET:not-found": {
+			Init: swr,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo/2", nil)
+			},
+			ResponseCode:   http.StatusNotFound,
+			ResponseHeader: noCache,
+			ResponseBody:   `{"code": 404, "message": "Not Found"}`,
+		},
+		"PATCH": {
+			Init: swr,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("PATCH", "/foo/1", bytes.NewBufferString(`{"foo": "baz"}`))
+			},
+			ResponseCode:   http.StatusOK,
+			ResponseHeader: noCache,
+			ResponseBody:   `{"id": "1", "foo": "baz"}`,
+		},
+		"POST": {
+			Init: swr,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"id": "2", "foo": "baz"}`))
+			},
+			ResponseCode:   http.StatusCreated,
+			ResponseHeader: noCache,
+			ResponseBody:   `{"id": "2", "foo": "baz"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestGetItemRange(t *testing.T) {
+	updated := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := mem.NewHandler()
+	s.Insert(context.TODO(), []*resource.Item{
+		{ID: "1", ETag: "a", Updated: updated, Payload: map[string]interface{}{"id": "1", "content": "0123456789"}},
+	})
+	conf := resource.DefaultConf
+	conf.RangeField = "content"
+	idx := resource.NewIndex()
+	idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}, "content": {}}}, s, conf)
+	h, err := rest.NewHandler(idx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/foo/1", nil)
+		r.Header = header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get(http.Header{})
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.JSONEq(t, `{"id": "1", "content": "0123456789"}`, w.Body.String())
+
+	w = get(http.Header{"Range": {"bytes=2-5"}})
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "bytes 2-5/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "2345", w.Body.String())
+
+	w = get(http.Header{"Range": {"bytes=-3"}})
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "bytes 7-9/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "789", w.Body.String())
+
+	// Matching If-Range (etag or date) resumes the download.
+	for _, ifRange := range []string{`"a"`, updated.Format(time.RFC1123)} {
+		w = get(http.Header{"Range": {"bytes=8-"}, "If-Range": {ifRange}})
+		assert.Equal(t, 206, w.Code, ifRange)
+		assert.Equal(t, "bytes 8-9/10", w.Header().Get("Content-Range"), ifRange)
+		assert.Equal(t, "89", w.Body.String(), ifRange)
+	}
+
+	// Non matching If-Range, or a weak etag which can't be compared strongly,
+	// returns the full representation.
+	for _, ifRange := range []string{`W/"a"`, `W/"b"`, `"b"`, updated.Add(-time.Hour).Format(time.RFC1123)} {
+		w = get(http.Header{"Range": {"bytes=8-"}, "If-Range": {ifRange}})
+		assert.Equal(t, 200, w.Code, ifRange)
+		assert.Equal(t, "", w.Header().Get("Content-Range"), ifRange)
+		assert.JSONEq(t, `{"id": "1", "content": "0123456789"}`, w.Body.String(), ifRange)
+	}
+
+	// Unsatisfiable and ignored ranges.
+	w = get(http.Header{"Range": {"bytes=10-"}})
+	assert.Equal(t, 416, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+	w = get(http.Header{"Range": {"bytes=0-1,4-5"}})
+	assert.Equal(t, 200, w.Code)
+	w = get(http.Header{"Range": {"lines=0-1"}})
+	assert.Equal(t, 200, w.Code)
+}
+
+// rot13Encrypter is a test Encrypter applying rot13 to string values.
+type rot13Encrypter struct{}
+
+func (rot13Encrypter) Encrypt(value interface{}) (interface{}, error) {
+	return rot13(value)
+}
+
+func (rot13Encrypter) Decrypt(value interface{}) (interface{}, error) {
+	return rot13(value)
+}
+
+func rot13(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return 'a' + (r-'a'+13)%26
+		case r >= 'A' && r <= 'Z':
+			return 'A' + (r-'A'+13)%26
+		}
+		return r
+	}, s), nil
+}
+
+func TestHandlerGetItemRangeField(t *testing.T) {
+	type betaKey struct{}
+	newHandler := func(content schema.Field, stored string) http.Handler {
+		s := mem.NewHandler()
+		s.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "content": stored}},
+		})
+		conf := resource.DefaultConf
+		conf.RangeField = "content"
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}, "content": content}}, s, conf)
+		h, err := rest.NewHandler(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	get := func(h http.Handler, beta bool) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/foo/1", nil)
+		r.Header.Set("Range", "bytes=0-2")
+		if beta {
+			r = r.WithContext(context.WithValue(r.Context(), betaKey{}, true))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// Disabled fields can't be read through a range.
+	h := newHandler(schema.Field{
+		Enabled: func(ctx context.Context) bool { return ctx.Value(betaKey{}) == true },
+	}, "abcdef")
+	w := get(h, false)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "1"}`, w.Body.String())
+	w = get(h, true)
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "abc", w.Body.String())
+
+	// Ranges are served from the plaintext of encrypted fields.
+	w = get(newHandler(schema.Field{Encrypter: rot13Encrypter{}}, "nopqrs"), false)
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "abc", w.Body.String())
+
+	// Ranges are served from the API form of marshaled fields.
+	w = get(newHandler(schema.Field{
+		Marshal: func(value interface{}) (interface{}, error) {
+			return strings.ToUpper(value.(string)), nil
+		},
+	}, "abcdef"), false)
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "ABC", w.Body.String())
+}
+
 func TestHandlerGetItemNoStorage(t *testing.T) {
 	sharedInit := func() *requestTestVars {
 		idx := resource.NewIndex()
@@ -300,3 +651,233 @@ func TestHandlerGetItemNoStorage(t *testing.T) {
 	}
 	tc.Test(t)
 }
+
+type tenantKey struct{}
+
+func withTenant(r *http.Request, err error, tenant string) (*http.Request, error) {
+	if err != nil {
+		return nil, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)), nil
+}
+
+func tenantScopedConf() resource.Conf {
+	conf := resource.DefaultConf
+	conf.LookupScoper = func(ctx context.Context) map[string]interface{} {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return map[string]interface{}{"tenant": tenant}
+	}
+	return conf
+}
+
+func TestGetItemLookupScope(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.TODO(), []*resource.Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "tenant": "a", "foo": "bar"}},
+			{ID: "2", Payload: map[string]interface{}{"id": "2", "tenant": "b", "foo": "baz"}},
+		})
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{
+			Fields: schema.Fields{
+				"id":     {},
+				"tenant": {ReadOnly: true},
+				"foo":    {},
+			},
+		}, s, tenantScopedConf())
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": s},
+		}
+	}
+
+	tests := map[string]requestTest{
+		"SameTenant": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/foo/1", nil)
+				return withTenant(r, err, "a")
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "tenant": "a", "foo": "bar"}`,
+		},
+		"OtherTenant": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/foo/2", nil)
+				return withTenant(r, err, "a")
+			},
+			ResponseCode: http.StatusNotFound,
+			ResponseBody: `{"code": 404, "message": "Not Found"}`,
+		},
+		"List": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/foo", nil)
+				return withTenant(r, err, "b")
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `[{"id": "2", "tenant": "b", "foo": "baz"}]`,
+		},
+		"DeleteOtherTenant": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("DELETE", "/foo/2", nil)
+				return withTenant(r, err, "a")
+			},
+			ResponseCode: http.StatusNotFound,
+			ResponseBody: `{"code": 404, "message": "Not Found"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestGetItemEmbedLookupScope(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		users := mem.NewHandler()
+		users.Insert(context.TODO(), []*resource.Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "tenant": "a", "name": "John"}},
+			{ID: "2", Payload: map[string]interface{}{"id": "2", "tenant": "b", "name": "Jane"}},
+		})
+		posts := mem.NewHandler()
+		posts.Insert(context.TODO(), []*resource.Item{
+			{ID: "a", Payload: map[string]interface{}{"id": "a", "tenant": "a", "user": "1"}},
+			{ID: "b", Payload: map[string]interface{}{"id": "b", "tenant": "b", "user": "1"}},
+		})
+		notes := mem.NewHandler()
+		notes.Insert(context.TODO(), []*resource.Item{
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "tenant": "a", "author": "2"}},
+		})
+		idx := resource.NewIndex()
+		u := idx.Bind("users", schema.Schema{Fields: schema.Fields{
+			"id":     {},
+			"tenant": {ReadOnly: true},
+			"name":   {},
+		}}, users, tenantScopedConf())
+		u.Bind("posts", "user", schema.Schema{Fields: schema.Fields{
+			"id":     {},
+			"tenant": {ReadOnly: true},
+			"user":   {},
+		}}, posts, tenantScopedConf())
+		idx.Bind("notes", schema.Schema{Fields: schema.Fields{
+			"id":     {},
+			"tenant": {ReadOnly: true},
+			"author": {Validator: &schema.Reference{Path: "users"}},
+		}}, notes, tenantScopedConf())
+		return &requestTestVars{Index: idx}
+	}
+
+	tests := map[string]requestTest{
+		"Connection": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/users/1?fields=id,posts{id}", nil)
+				return withTenant(r, err, "a")
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "posts": [{"id": "a"}]}`,
+		},
+		"Reference": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("GET", "/notes/1?fields=id,author{name}", nil)
+				return withTenant(r, err, "a")
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "author": {}}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestGetItemEmbed(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.TODO(), []*resource.Item{
+			{ID: "a", Payload: map[string]interface{}{"id": "a", "name": "John", "avatar": "john.png", "bio": "long"}},
+			{ID: "1", Payload: map[string]interface{}{"id": "1", "title": "Hello", "author": "a"}},
+		})
+		idx := resource.NewIndex()
+		idx.Bind("users", schema.Schema{Fields: schema.Fields{
+			"id":     {},
+			"name":   {},
+			"avatar": {},
+			"bio":    {},
+		}}, s, resource.DefaultConf)
+		idx.Bind("posts", schema.Schema{Fields: schema.Fields{
+			"id":     {},
+			"title":  {},
+			"author": {Validator: &schema.Reference{Path: "users"}},
+		}}, s, resource.DefaultConf)
+		return &requestTestVars{Index: idx}
+	}
+
+	tests := map[string]requestTest{
+		"Embed": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/posts/1?embed=author", nil)
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "title": "Hello", "author": {"id": "a", "name": "John", "avatar": "john.png", "bio": "long"}}`,
+		},
+		"EmbedProjected": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/posts/1?embed=author&fields=title,author.name,author.avatar", nil)
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"title": "Hello", "author": {"name": "John", "avatar": "john.png"}}`,
+		},
+		"EmbedSelected": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/posts/1?embed=author&fields=title,author", nil)
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"title": "Hello", "author": {"id": "a", "name": "John", "avatar": "john.png", "bio": "long"}}`,
+		},
+		"Dotted": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/posts/1?fields=id,author.name", nil)
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "author": {"name": "John"}}`,
+		},
+		"EmbedInvalid": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/posts/1?embed=title", nil)
+			},
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{
+				"code": 422,
+				"message": "URL parameters contain error(s)",
+				"issues": {"embed": ["title: field has no children"]}
+			}`,
+		},
+		"DottedInvalid": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/posts/1?fields=author.email", nil)
+			},
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{
+				"code": 422,
+				"message": "URL parameters contain error(s)",
+				"issues": {"fields": ["author.email: unknown field"]}
+			}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
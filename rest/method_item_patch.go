@@ -1,14 +1,17 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
 	"github.com/rs/rest-layer/schema/query"
 )
 
@@ -29,16 +32,21 @@ func itemPatch(ctx context.Context, r *http.Request, route *RouteMatch) (status
 	isJSONPatch := isJSONPatch(r)
 	if isJSONPatch {
 		if r.Body != nil {
-			patchJSON, _ = ioutil.ReadAll(r.Body)
+			var err error
+			patchJSON, err = ioutil.ReadAll(r.Body)
 			r.Body.Close()
+			if err != nil {
+				e := malformedBody(err)
+				return e.Code, nil, e
+			}
 		}
 	} else {
-		if e := decodePayload(r, &payload); e != nil {
+		if e := decodePayload(ctx, r, &payload); e != nil {
 			return e.Code, nil, e
 		}
 	}
 
-	q, e := route.Query()
+	q, e := route.query(ctx, resource.Update)
 	if e != nil {
 		return e.Code, nil, e
 	}
@@ -50,21 +58,56 @@ func itemPatch(ctx context.Context, r *http.Request, route *RouteMatch) (status
 		// If item can't be fetch, return an error.
 		e = NewError(err)
 		return e.Code, nil, e
-	} else if len(l.Items) == 0 {
-		return ErrNotFound.Code, nil, ErrNotFound
-	} else {
+	} else if len(l.Items) == 1 {
 		original = l.Items[0]
 	}
+	// Check if method is allowed based on the type of PATCH:
+	// - PATCH on non existing item = create (if upsert is allowed)
+	// - PATCH on existing item = update
+	conf := rsrc.Conf()
+	mode := resource.Update
+	if original == nil {
+		if !conf.AllowPatchUpsert {
+			return ErrNotFound.Code, nil, ErrNotFound
+		}
+		mode = resource.Create
+	}
+	if !conf.IsModeAllowed(mode) {
+		status := http.StatusMethodNotAllowed
+		headers = http.Header{}
+		setItemAllowHeader(headers, conf, original != nil)
+		return status, headers, &Error{status, http.StatusText(status), nil}
+	}
+	if err := checkContention(r, rsrc, original); err != nil {
+		return err.Code, nil, err
+	}
 	// If-Match / If-Unmodified-Since handling.
 	if err := checkIntegrityRequest(r, original); err != nil {
 		return err.Code, nil, err
 	}
+	// Field-scoped If-Match-Fields handling.
+	if err := checkFieldsIntegrityRequest(ctx, r, rsrc, original); err != nil {
+		return err.Code, nil, err
+	}
 
 	if isJSONPatch {
 		// Recreate the new document
-		originalJSON, err := json.Marshal(original.Payload)
-		if err != nil {
-			return 422, nil, &Error{422, err.Error(), nil}
+		originalJSON := []byte("{}")
+		if original != nil {
+			// Patch the document in its API form as the patched document
+			// goes through Prepare like any client payload.
+			doc, err := marshalPayload(rsrc.Schema(), original.Payload)
+			if err == nil {
+				originalJSON, err = json.Marshal(doc)
+			}
+			if err != nil {
+				return 422, nil, &Error{422, err.Error(), nil}
+			}
+		}
+		in, _ := routeKeyCases(ctx)
+		var err error
+		if patchJSON, err = convertPatchKeys(patchJSON, rsrc.Validator(), in); err != nil {
+			return 400, nil, &Error{400, "Malformed patch document: " + err.Error(), nil}
 		}
 		patch, err := jsonpatch.DecodePatch(patchJSON)
 		if err != nil {
@@ -74,46 +117,149 @@ func itemPatch(ctx context.Context, r *http.Request, route *RouteMatch) (status
 		if err != nil {
 			return 422, nil, &Error{422, err.Error(), nil}
 		}
-		err = json.Unmarshal(payloadJSON, &payload)
+		err = newJSONDecoder(ctx, bytes.NewReader(payloadJSON)).Decode(&payload)
 		if err != nil {
 			return 422, nil, &Error{422, err.Error(), nil}
 		}
 	}
 
-	// If JSON-Patch then `replace=true`, because we can delete fields
-	changes, base := rsrc.Validator().Prepare(ctx, payload, &original.Payload, isJSONPatch)
+	if e := preValidate(ctx, rsrc, payload); e != nil {
+		return e.Code, nil, e
+	}
+	status = rsrc.Conf().ReplacedStatus()
+	var changes map[string]interface{}
+	var base map[string]interface{}
+	if original == nil {
+		// PATCH used to create a new document.
+		changes, base = rsrc.Validator().Prepare(ctx, payload, nil, false)
+		status = rsrc.Conf().CreatedStatus()
+	} else {
+		// If JSON-Patch then `replace=true`, because we can delete fields
+		changes, base = rsrc.Validator().Prepare(ctx, payload, &original.Payload, isJSONPatch)
+	}
 	// Append lookup fields to base payload so it isn't caught by ReadOnly
 	// (i.e.: contains id and parent resource refs if any).
 	for k, v := range route.ResourcePath.Values() {
 		base[k] = v
 	}
-	doc, errs := rsrc.Validator().Validate(changes, base)
+	applyLookupScope(ctx, rsrc, changes, base)
+	vmode := validationMode(mode) | partialMode(r, rsrc, changes, base)
+	vctx := schema.WithWarnings(ctx)
+	doc, errs := schema.ValidateWithContext(vctx, rsrc.Validator(), changes, base, vmode)
 	if len(errs) > 0 {
-		return 422, nil, &Error{422, "Document contains error(s)", errs}
+		return 422, nil, validationError(&Error{422, "Document contains error(s)", errs}, validFields(ctx, r, rsrc, doc, errs))
 	}
-	if id, found := doc["id"]; found && id != original.ID {
-		return 422, nil, &Error{422, "Cannot change document ID", nil}
+	if original != nil {
+		if id, found := doc["id"]; found && id != original.ID {
+			return 422, nil, &Error{422, "Cannot change document ID", nil}
+		}
 	}
+	warnings := schema.WarningsFromContext(vctx)
 	item, err := resource.NewItem(doc)
 	if err != nil {
 		e = NewError(err)
 		return e.Code, nil, e
 	}
-	// Store the modified document by providing the original doc to instruct
-	// handler to ensure the stored document didn't change between in the
-	// interval. An ErrPreconditionFailed will be thrown in case of race
-	// condition (i.e.: another thread modified the document between the Find()
-	// and the Store()).
-	if err = rsrc.Update(ctx, item, original); err != nil {
-		e = NewError(err)
-		return e.Code, nil, e
+	if isDryRun(r) {
+		// Validation only, the document is not stored.
+		if e = dryRunCheck(ctx, rsrc, item, original); e != nil {
+			return e.Code, nil, e
+		}
+		status = 200
+		headers = dryRunHeaders(r)
+	} else if original != nil {
+		// Store the modified document by providing the original doc to
+		// instruct handler to ensure the stored document didn't change between
+		// in the interval. An ErrPreconditionFailed will be thrown in case of
+		// race condition (i.e.: another thread modified the document between
+		// the Find() and the Store()).
+		if err = rsrc.Update(ctx, item, original); err != nil {
+			e = NewError(err)
+			return e.Code, nil, e
+		}
+		logAudit(ctx, rsrc, original, changes, doc)
+	} else {
+		if err = rsrc.Insert(ctx, []*resource.Item{item}); err != nil {
+			e = NewError(err)
+			return e.Code, nil, e
+		}
+	}
+	if rsrc.Conf().AsyncWrites && !isDryRun(r) {
+		status, headers, body = acceptedResponse(r.URL.Path)
+		return status, validationWarningHeaders(warnings, headers), body
 	}
 
+	if hasPreference(r, "return=changes") {
+		// Only return the changed fields with their normalized value so the
+		// client can reconcile its local copy. Removed fields are returned
+		// with a null value. The values are taken from the projected
+		// document so fields the client can't read are never returned.
+		projected, err := query.Projection(nil).Eval(ctx, item.Payload, restResource{rsrc})
+		if err != nil {
+			e = NewError(err)
+			return e.Code, nil, e
+		}
+		changed := map[string]interface{}{"id": projected["id"]}
+		for k := range changes {
+			if v, found := projected[k]; found {
+				changed[k] = v
+				continue
+			}
+			if _, found := doc[k]; found {
+				// Not readable by the client.
+				continue
+			}
+			if def := rsrc.Validator().GetField(k); def != nil && (def.IsHidden(ctx) || !def.IsEnabled(ctx)) {
+				continue
+			}
+			changed[k] = nil
+		}
+		item.Payload = changed
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Add("Preference-Applied", "return=changes")
+		return status, validationWarningHeaders(warnings, headers), item
+	}
 	// Evaluate projection so response gets the same format as read requests.
 	item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc})
 	if err != nil {
 		e = NewError(err)
 		return e.Code, nil, e
 	}
-	return 200, nil, item
+	if original == nil {
+		headers = provenanceHeaders(r, route, payload, item.Payload, headers)
+	}
+	return status, validationWarningHeaders(warnings, headers), item
+}
+
+// marshalPayload returns a copy of a stored payload with the values of the
+// fields having a Marshal function converted back to their API form. The
+// values of encrypted fields are decrypted before being marshaled.
+func marshalPayload(s schema.Schema, payload map[string]interface{}) (map[string]interface{}, error) {
+	doc := make(map[string]interface{}, len(payload))
+	for field, value := range payload {
+		def, found := s.Fields[field]
+		if found && value != nil {
+			if sub, ok := value.(map[string]interface{}); ok && def.Schema != nil {
+				v, err := marshalPayload(*def.Schema, sub)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%v", field, err)
+				}
+				value = v
+			} else if def.Marshal != nil {
+				var err error
+				if def.Encrypter != nil {
+					if value, err = def.Encrypter.Decrypt(value); err != nil {
+						return nil, fmt.Errorf("%s: %v", field, err)
+					}
+				}
+				if value, err = def.Marshal(value); err != nil {
+					return nil, fmt.Errorf("%s: %v", field, err)
+				}
+			}
+		}
+		doc[field] = value
+	}
+	return doc, nil
 }
@@ -3,6 +3,8 @@ package rest_test
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"math"
 	"net/http"
 	"reflect"
 	"testing"
@@ -103,7 +105,7 @@ func TestPatchItem(t *testing.T) {
 			ResponseCode: http.StatusBadRequest,
 			ResponseBody: `{
 				"code": 400,
-				"message": "Malformed body: invalid character 'i' looking for beginning of value"
+				"message": "Malformed JSON: invalid character 'i' looking for beginning of value at offset 1"
 			}`,
 			ExtraTest: checkPayload("foo", "2", map[string]interface{}{"id": "2", "foo": "even", "bar": "baz"}),
 		},
@@ -723,3 +725,440 @@ func TestJSONPatchItem(t *testing.T) {
 		t.Run(n, tc.Test)
 	}
 }
+
+func TestJSONPatchItemFieldMarshal(t *testing.T) {
+	tests := map[string]requestTest{
+		"UntouchedField": {
+			Init: func() *requestTestVars {
+				s := mem.NewHandler()
+				s.Insert(context.Background(), []*resource.Item{
+					{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "name": "x", "price": 1000}},
+				})
+				idx := resource.NewIndex()
+				idx.Bind("foo", schema.Schema{Fields: schema.Fields{
+					"id":   {},
+					"name": {Validator: &schema.String{}},
+					// Prices are stored in cents and exposed in dollars.
+					"price": {
+						Validator: &schema.Integer{},
+						Unmarshal: func(value interface{}) (interface{}, error) {
+							f, ok := value.(float64)
+							if !ok {
+								return nil, fmt.Errorf("not a price")
+							}
+							return int(math.Round(f * 100)), nil
+						},
+						Marshal: func(value interface{}) (interface{}, error) {
+							i, ok := value.(int)
+							if !ok {
+								return nil, fmt.Errorf("not a price")
+							}
+							return float64(i) / 100, nil
+						},
+					},
+				}}, s, resource.DefaultConf)
+				return &requestTestVars{Index: idx, Storers: map[string]resource.Storer{"foo": s}}
+			},
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`[{"op": "replace", "path": "/name", "value": "y"}]`))
+				r, err := http.NewRequest("PATCH", "/foo/1", body)
+				r.Header.Set("Content-Type", "application/json-patch+json")
+				return r, err
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "name": "y", "price": 10}`,
+			ExtraTest:    checkPayload("foo", "1", map[string]interface{}{"id": "1", "name": "y", "price": 1000}),
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestPatchItemUpsert(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "odd", "bar": "baz"}},
+		})
+		conf := resource.DefaultConf
+		conf.AllowPatchUpsert = true
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{
+			Fields: schema.Fields{
+				"id":  {Sortable: true, Filterable: true},
+				"foo": {Required: true},
+				"bar": {Default: "default"},
+			},
+		}, s, conf)
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": s},
+		}
+	}
+	checkPayload := func(id interface{}, payload map[string]interface{}) requestCheckerFunc {
+		return func(t *testing.T, vars *requestTestVars) {
+			q := query.Query{Predicate: query.Predicate{&query.Equal{Field: "id", Value: id}}, Window: &query.Window{Limit: 1}}
+			items, err := vars.Storers["foo"].Find(context.Background(), &q)
+			if err != nil {
+				t.Errorf("s.Find failed: %s", err)
+				return
+			} else if len(items.Items) != 1 {
+				t.Errorf("item with ID %v not found", id)
+				return
+			}
+			if !reflect.DeepEqual(payload, items.Items[0].Payload) {
+				t.Errorf("Unexpected stored payload for item %v:\nexpect: %#v\ngot: %#v", id, payload, items.Items[0].Payload)
+			}
+		}
+	}
+
+	tests := map[string]requestTest{
+		`existing`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`{"foo": "even"}`))
+				return http.NewRequest("PATCH", "/foo/1", body)
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "foo": "even", "bar": "baz"}`,
+			ExtraTest:    checkPayload("1", map[string]interface{}{"id": "1", "foo": "even", "bar": "baz"}),
+		},
+		`missing`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`{"foo": "odd"}`))
+				return http.NewRequest("PATCH", "/foo/2", body)
+			},
+			ResponseCode: http.StatusCreated,
+			ResponseBody: `{"id": "2", "foo": "odd", "bar": "default"}`,
+			ExtraTest:    checkPayload("2", map[string]interface{}{"id": "2", "foo": "odd", "bar": "default"}),
+		},
+		`missing:incomplete`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`{"bar": "baz"}`))
+				return http.NewRequest("PATCH", "/foo/2", body)
+			},
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{"code": 422, "message": "Document contains error(s)", "issues": {"foo": ["required"]}}`,
+		},
+		`missing:create-denied`: {
+			Init: func() *requestTestVars {
+				idx := resource.NewIndex()
+				idx.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}, "foo": {}}}, mem.NewHandler(), resource.Conf{
+					AllowedModes:     []resource.Mode{resource.Read, resource.Update},
+					AllowPatchUpsert: true,
+				})
+				return &requestTestVars{Index: idx}
+			},
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`{"foo": "odd"}`))
+				return http.NewRequest("PATCH", "/foo/2", body)
+			},
+			ResponseCode:   http.StatusMethodNotAllowed,
+			ResponseHeader: http.Header{"Allow": []string{"GET, HEAD"}},
+			ResponseBody:   `{"code": 405, "message": "Method Not Allowed", "issues": {"method": ["PATCH: mode not enabled"], "allowed_methods": ["GET", "HEAD"]}}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestPatchItemReturnChanges(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "odd", "bar": "baz", "url": "http://foo.com/"}},
+		})
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{
+			Fields: schema.Fields{
+				"id":     {Sortable: true, Filterable: true},
+				"foo":    {},
+				"bar":    {},
+				"url":    {Validator: &schema.URL{}},
+				"secret": {Hidden: true},
+			},
+		}, s, resource.DefaultConf)
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": s},
+		}
+	}
+
+	tests := map[string]requestTest{
+		`hidden`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`{"foo": "even", "secret": "s"}`))
+				r, err := http.NewRequest("PATCH", "/foo/1", body)
+				r.Header.Set("Prefer", "return=changes")
+				return r, err
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "foo": "even"}`,
+		},
+		`merge`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`{"foo": "even", "url": "HTTP://BAR.com/"}`))
+				r, err := http.NewRequest("PATCH", "/foo/1", body)
+				r.Header.Set("Prefer", "return=changes")
+				return r, err
+			},
+			ResponseCode: http.StatusOK,
+			ResponseHeader: http.Header{
+				"Etag":               []string{`W/"614015d82ca9423eced06de93661766b"`},
+				"Preference-Applied": []string{"return=changes"},
+			},
+			ResponseBody: `{"id": "1", "foo": "even", "url": "http://bar.com/"}`,
+		},
+		`json-patch`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`[{"op": "remove", "path": "/bar"}]`))
+				r, err := http.NewRequest("PATCH", "/foo/1", body)
+				r.Header.Set("Content-Type", "application/json-patch+json")
+				r.Header.Set("Prefer", "return=changes")
+				return r, err
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "bar": null}`,
+		},
+		`minimal`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				body := bytes.NewReader([]byte(`{"foo": "even"}`))
+				r, err := http.NewRequest("PATCH", "/foo/1", body)
+				r.Header.Set("Prefer", "return=minimal")
+				return r, err
+			},
+			ResponseCode: http.StatusNoContent,
+			ResponseBody: ``,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestPatchItemIfMatchFields(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		// The title was changed by another client since the document was
+		// read with the "a" etag.
+		s.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "b", Payload: map[string]interface{}{"id": "1", "title": "changed", "status": "draft", "count": 1, "secret": "s"}},
+		})
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{
+			Fields: schema.Fields{
+				"id":     {},
+				"title":  {},
+				"status": {},
+				"count":  {Validator: &schema.Integer{}},
+				"secret": {Hidden: true},
+			},
+		}, s, resource.DefaultConf)
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": s},
+		}
+	}
+	patch := func(url, ifMatch, ifMatchFields, body string) func() (*http.Request, error) {
+		return func() (*http.Request, error) {
+			r, err := http.NewRequest("PATCH", url, bytes.NewBufferString(body))
+			if ifMatch != "" {
+				r.Header.Set("If-Match", ifMatch)
+			}
+			r.Header.Set("If-Match-Fields", ifMatchFields)
+			return r, err
+		}
+	}
+
+	tests := map[string]requestTest{
+		`UnrelatedChange`: {
+			Init:         sharedInit,
+			NewRequest:   patch("/foo/1", "", `{"status": "draft", "count": 1}`, `{"status": "published"}`),
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "title": "changed", "status": "published", "count": 1}`,
+		},
+		`StaleEtag`: {
+			Init:         sharedInit,
+			NewRequest:   patch("/foo/1", "a", `{"status": "draft"}`, `{"status": "published"}`),
+			ResponseCode: http.StatusPreconditionFailed,
+			ResponseBody: `{"code": 412, "message": "Precondition Failed"}`,
+		},
+		`FieldChanged`: {
+			Init:         sharedInit,
+			NewRequest:   patch("/foo/1", "", `{"title": "original", "status": "draft"}`, `{"title": "mine"}`),
+			ResponseCode: http.StatusPreconditionFailed,
+			ResponseBody: `{"code": 412, "message": "Precondition Failed", "issues": {"title": ["has changed"]}}`,
+		},
+		`Invalid`: {
+			Init:         sharedInit,
+			NewRequest:   patch("/foo/1", "", `status`, `{"status": "published"}`),
+			ResponseCode: http.StatusBadRequest,
+			ResponseBody: `{"code": 400, "message": "Invalid If-Match-Fields header"}`,
+		},
+		`HiddenField`: {
+			Init:         sharedInit,
+			NewRequest:   patch("/foo/1", "", `{"secret": "s"}`, `{"status": "published"}`),
+			ResponseCode: http.StatusBadRequest,
+			ResponseBody: `{"code": 400, "message": "Invalid If-Match-Fields header", "issues": {"secret": ["unknown field"]}}`,
+		},
+		`UnknownField`: {
+			Init:         sharedInit,
+			NewRequest:   patch("/foo/1", "", `{"other": null}`, `{"status": "published"}`),
+			ResponseCode: http.StatusBadRequest,
+			ResponseBody: `{"code": 400, "message": "Invalid If-Match-Fields header", "issues": {"other": ["unknown field"]}}`,
+		},
+		`NotFound`: {
+			Init:         sharedInit,
+			NewRequest:   patch("/foo/2", "", `{"status": "draft"}`, `{"status": "published"}`),
+			ResponseCode: http.StatusNotFound,
+			ResponseBody: `{"code": 404, "message": "Not Found"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestPatchItemRequiredOn(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "odd"}},
+		})
+		idx := resource.NewIndex()
+		idx.Bind("foo", schema.Schema{
+			Fields: schema.Fields{
+				"id":  {Sortable: true, Filterable: true},
+				"foo": {},
+				"bar": {RequiredOn: []schema.Mode{schema.Create}},
+			},
+		}, s, resource.DefaultConf)
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": s},
+		}
+	}
+
+	tests := map[string]requestTest{
+		`patch`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("PATCH", "/foo/1", bytes.NewReader([]byte(`{"foo": "even"}`)))
+			},
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "foo": "even"}`,
+		},
+		`post`: {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewReader([]byte(`{"id": "2", "foo": "even"}`)))
+			},
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{
+				"code": 422,
+				"message": "Document contains error(s)",
+				"issues": {"bar": ["required"]}
+			}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+// conflictOnceStorer reports a conflict on the first update, as if another
+// client had concurrently modified the item.
+type conflictOnceStorer struct {
+	resource.Storer
+	conflicted bool
+}
+
+func (s *conflictOnceStorer) Update(ctx context.Context, item *resource.Item, original *resource.Item) error {
+	if !s.conflicted {
+		s.conflicted = true
+		return resource.ErrConflict
+	}
+	return s.Storer.Update(ctx, item, original)
+}
+
+func TestPatchItemContention(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "bar"}},
+			{ID: "2", ETag: "b", Payload: map[string]interface{}{"id": "2", "foo": "bar"}},
+		})
+		conf := resource.DefaultConf
+		conf.ContentionCooldown = time.Hour
+		idx := resource.NewIndex()
+		rsrc := idx.Bind("foo", schema.Schema{
+			Fields: schema.Fields{
+				"id":  {},
+				"foo": {},
+			},
+		}, &conflictOnceStorer{Storer: s}, conf)
+		// Simulate a concurrent write on the item 1.
+		original := &resource.Item{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "bar"}}
+		item := &resource.Item{ID: "1", Payload: map[string]interface{}{"id": "1", "foo": "baz"}}
+		if err := rsrc.Update(context.Background(), item, original); err != resource.ErrConflict {
+			t.Fatalf("expected a conflict, got %v", err)
+		}
+		return &requestTestVars{
+			Index:   idx,
+			Storers: map[string]resource.Storer{"foo": s},
+		}
+	}
+	request := func(method, url, ifMatch, body string) func() (*http.Request, error) {
+		return func() (*http.Request, error) {
+			r, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+			if ifMatch != "" {
+				r.Header.Set("If-Match", ifMatch)
+			}
+			return r, err
+		}
+	}
+
+	tests := map[string]requestTest{
+		`PatchUnconditioned`: {
+			Init:         sharedInit,
+			NewRequest:   request("PATCH", "/foo/1", "", `{"foo": "baz"}`),
+			ResponseCode: http.StatusPreconditionRequired,
+			ResponseBody: `{"code": 428, "message": "Precondition Required"}`,
+		},
+		`PutUnconditioned`: {
+			Init:         sharedInit,
+			NewRequest:   request("PUT", "/foo/1", "", `{"foo": "baz"}`),
+			ResponseCode: http.StatusPreconditionRequired,
+			ResponseBody: `{"code": 428, "message": "Precondition Required"}`,
+		},
+		`PatchConditioned`: {
+			Init:         sharedInit,
+			NewRequest:   request("PATCH", "/foo/1", `W/"a"`, `{"foo": "baz"}`),
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "1", "foo": "baz"}`,
+		},
+		`PatchOtherItem`: {
+			Init:         sharedInit,
+			NewRequest:   request("PATCH", "/foo/2", "", `{"foo": "baz"}`),
+			ResponseCode: http.StatusOK,
+			ResponseBody: `{"id": "2", "foo": "baz"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
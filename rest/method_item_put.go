@@ -14,10 +14,10 @@ import (
 // Reference: http://tools.ietf.org/html/rfc2616#section-9.6
 func itemPut(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
 	var payload map[string]interface{}
-	if e := decodePayload(r, &payload); e != nil {
+	if e := decodePayload(ctx, r, &payload); e != nil {
 		return e.Code, nil, e
 	}
-	q, e := route.Query()
+	q, e := route.query(ctx, resource.Replace)
 	if e != nil {
 		return e.Code, nil, e
 	}
@@ -42,19 +42,27 @@ func itemPut(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 	}
 	if !rsrc.Conf().IsModeAllowed(mode) {
 		status := http.StatusMethodNotAllowed
-		return status, nil, &Error{status, http.StatusText(status), nil}
+		headers = http.Header{}
+		setItemAllowHeader(headers, rsrc.Conf(), original != nil)
+		return status, headers, &Error{status, http.StatusText(status), nil}
+	}
+	if err := checkContention(r, rsrc, original); err != nil {
+		return err.Code, nil, err
 	}
 	// If-Match / If-Unmodified-Since handling.
 	if err := checkIntegrityRequest(r, original); err != nil {
 		return err.Code, nil, err
 	}
-	status = 200
+	if e := preValidate(ctx, rsrc, payload); e != nil {
+		return e.Code, nil, e
+	}
+	status = rsrc.Conf().ReplacedStatus()
 	var changes map[string]interface{}
 	var base map[string]interface{}
 	if original == nil {
 		// PUT used to create a new document.
 		changes, base = rsrc.Validator().Prepare(ctx, payload, nil, false)
-		status = 201
+		status = rsrc.Conf().CreatedStatus()
 	} else {
 		// PUT used to replace an existing document.
 		changes, base = rsrc.Validator().Prepare(ctx, payload, &original.Payload, true)
@@ -68,15 +76,19 @@ func itemPut(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 			delete(changes, k)
 		}
 	}
-	doc, errs := rsrc.Validator().Validate(changes, base)
+	applyLookupScope(ctx, rsrc, changes, base)
+	vmode := validationMode(mode) | partialMode(r, rsrc, changes, base)
+	vctx := schema.WithWarnings(ctx)
+	doc, errs := schema.ValidateWithContext(vctx, rsrc.Validator(), changes, base, vmode)
 	if len(errs) > 0 {
-		return 422, nil, &Error{422, "Document contains error(s)", errs}
+		return 422, nil, validationError(&Error{422, "Document contains error(s)", errs}, validFields(ctx, r, rsrc, doc, errs))
 	}
 	if original != nil {
 		if id, found := doc["id"]; found && id != original.ID {
 			return 422, nil, &Error{422, "Cannot change document ID", nil}
 		}
 	}
+	warnings := schema.WarningsFromContext(vctx)
 	item, err := resource.NewItem(doc)
 	if err != nil {
 		e = NewError(err)
@@ -86,22 +98,37 @@ func itemPut(ctx context.Context, r *http.Request, route *RouteMatch) (status in
 	// we are still replacing the same version of the object as handler is
 	// supposed check the original etag before storing when an original object
 	// is provided.
-	if original != nil {
+	if isDryRun(r) {
+		// Validation only, the document is not stored.
+		if e = dryRunCheck(ctx, rsrc, item, original); e != nil {
+			return e.Code, nil, e
+		}
+		status = 200
+		headers = dryRunHeaders(r)
+	} else if original != nil {
 		if err = rsrc.Update(ctx, item, original); err != nil {
 			e = NewError(err)
 			return e.Code, nil, e
 		}
+		logAudit(ctx, rsrc, original, changes, doc)
 	} else {
 		if err = rsrc.Insert(ctx, []*resource.Item{item}); err != nil {
 			e = NewError(err)
 			return e.Code, nil, e
 		}
 	}
+	if rsrc.Conf().AsyncWrites && !isDryRun(r) {
+		status, headers, body = acceptedResponse(r.URL.Path)
+		return status, validationWarningHeaders(warnings, headers), body
+	}
 	// Evaluate projection so response gets the same format as read requests.
 	item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc})
 	if err != nil {
 		e = NewError(err)
 		return e.Code, nil, e
 	}
-	return status, nil, item
+	if original == nil {
+		headers = provenanceHeaders(r, route, payload, item.Payload, headers)
+	}
+	return status, validationWarningHeaders(warnings, headers), item
 }
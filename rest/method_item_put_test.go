@@ -98,8 +98,9 @@ func TestPutItem(t *testing.T) {
 				body := bytes.NewReader([]byte(`{"foo": "bar"}`))
 				return http.NewRequest("PUT", "/foo/66", body)
 			},
-			ResponseCode: http.StatusMethodNotAllowed,
-			ResponseBody: `{"code": 405, "message": "Method Not Allowed"}`,
+			ResponseCode:   http.StatusMethodNotAllowed,
+			ResponseHeader: http.Header{"Allow": []string{""}},
+			ResponseBody:   `{"code": 405, "message": "Method Not Allowed", "issues": {"method": ["PUT: mode not enabled"], "allowed_methods": []}}`,
 		},
 		`ReplaceModeNotAllowed`: {
 			Init: func() *requestTestVars {
@@ -108,16 +109,17 @@ func TestPutItem(t *testing.T) {
 					{ID: "1", Payload: map[string]interface{}{"id": "1", "foo": "bar"}},
 				})
 				index := resource.NewIndex()
-				index.Bind("foo", schema.Schema{}, s, resource.Conf{AllowedModes: []resource.Mode{resource.Create}})
+				index.Bind("foo", schema.Schema{}, s, resource.Conf{AllowedModes: []resource.Mode{resource.Create, resource.Update}})
 				return &requestTestVars{Index: index, Storers: map[string]resource.Storer{"foo": s}}
 			},
 			NewRequest: func() (*http.Request, error) {
 				body := bytes.NewReader([]byte(`{"foo": "baz"}`))
 				return http.NewRequest("PUT", "/foo/1", body)
 			},
-			ResponseCode: http.StatusMethodNotAllowed,
-			ResponseBody: `{"code": 405, "message": "Method Not Allowed"}`,
-			ExtraTest:    checkPayload("foo", "1", map[string]interface{}{"id": "1", "foo": "bar"}),
+			ResponseCode:   http.StatusMethodNotAllowed,
+			ResponseHeader: http.Header{"Allow": []string{"PATCH"}},
+			ResponseBody:   `{"code": 405, "message": "Method Not Allowed", "issues": {"method": ["PUT: mode not enabled"], "allowed_methods": ["PATCH"]}}`,
+			ExtraTest:      checkPayload("foo", "1", map[string]interface{}{"id": "1", "foo": "bar"}),
 		},
 		`pathID:not-found,body:valid`: {
 			Init: sharedInit,
@@ -138,7 +140,7 @@ func TestPutItem(t *testing.T) {
 			ResponseCode: http.StatusBadRequest,
 			ResponseBody: `{
 				"code": 400,
-				"message": "Malformed body: invalid character 'i' looking for beginning of value"
+				"message": "Malformed JSON: invalid character 'i' looking for beginning of value at offset 1"
 			}`,
 			ExtraTest: checkPayload("foo", "2", map[string]interface{}{"id": "2", "foo": "even", "bar": "baz"}),
 		},
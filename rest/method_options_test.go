@@ -24,6 +24,6 @@ func TestHandlerOptionsList(t *testing.T) {
 	}
 	status, headers, body := listOptions(context.TODO(), r, rm)
 	assert.Equal(t, http.StatusOK, status)
-	assert.Equal(t, http.Header{"Allow": []string{"DELETE, GET, HEAD, POST"}}, headers)
+	assert.Equal(t, http.Header{"Allow": []string{"DELETE, GET, HEAD, PATCH, POST"}}, headers)
 	assert.Nil(t, body)
 }
@@ -0,0 +1,201 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+)
+
+// listPatch handles PATCH requests on a resource URL.
+//
+// The body must contain an array of documents to update as a batch. Each
+// document holds the id of the item to update and the fields to change, as a
+// simple field replacement PATCH on the item URL would. By default, a batch is
+// updated atomically: if any document is invalid or refers to a non existing
+// item, no item is updated. The items are updated in a transaction if the
+// storage handler supports it, otherwise a storage error may leave the items
+// updated before it. With the `Prefer: handling=lenient` header, each document
+// of the batch is processed independently and a 207 multi-status response
+// reports the status of each of them.
+//
+// The documents of a batch can't be conditioned on the etag of their item, so
+// updates of items under contention (see resource.Conf.ContentionCooldown) are
+// refused. The If-Match-Fields header applies to each item of the batch.
+func listPatch(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
+	q, e := route.query(ctx, resource.Update)
+	if e != nil {
+		return e.Code, nil, e
+	}
+	payloads, batch, e := decodeBatchPayload(ctx, r)
+	if e != nil {
+		return e.Code, nil, e
+	}
+	if !batch {
+		return 422, nil, &Error{422, "Batch update requires an array of documents", nil}
+	}
+	return handleBatch(ctx, r, route, q, payloads, listPatchStrict, listPatchLenient)
+}
+
+// listPatchStrict updates a batch of documents atomically. If any of the
+// documents is invalid, no document is updated and the error of each invalid
+// document is reported under its index in the batch.
+func listPatchStrict(ctx context.Context, r *http.Request, route *RouteMatch, q *query.Query, payloads []map[string]interface{}, dryRun bool) (status int, headers http.Header, body interface{}) {
+	rsrc := route.Resource()
+	originals := make([]*resource.Item, 0, len(payloads))
+	items := make([]*resource.Item, 0, len(payloads))
+	changes := make([]map[string]interface{}, 0, len(payloads))
+	issues := map[string][]interface{}{}
+	for i, payload := range payloads {
+		original, item, c, e := updatedItem(ctx, r, route, q, payload)
+		if e != nil {
+			if e.Issues != nil {
+				issues[strconv.Itoa(i)] = append(issues[strconv.Itoa(i)], e.Issues)
+			} else {
+				issues[strconv.Itoa(i)] = append(issues[strconv.Itoa(i)], e.Message)
+			}
+			continue
+		}
+		originals = append(originals, original)
+		items = append(items, item)
+		changes = append(changes, c)
+	}
+	if len(issues) > 0 {
+		return 422, nil, &Error{422, "Batch contains error(s)", issues}
+	}
+	if dryRun {
+		for i, item := range items {
+			if e := dryRunCheck(ctx, rsrc, item, originals[i]); e != nil {
+				return e.Code, nil, e
+			}
+		}
+	} else {
+		inTx := false
+		update := func(rsrc *resource.Resource) error {
+			for i, item := range items {
+				if err := rsrc.Update(ctx, item, originals[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		err := rsrc.WithTransaction(ctx, func(tx *resource.Resource) error {
+			inTx = true
+			return update(tx)
+		})
+		if err == resource.ErrNotImplemented && !inTx {
+			err = update(rsrc)
+		}
+		if err != nil {
+			e := NewError(err)
+			return e.Code, nil, e
+		}
+		for i, item := range items {
+			logAudit(ctx, rsrc, originals[i], changes[i], item.Payload)
+		}
+		if rsrc.Conf().AsyncWrites {
+			return acceptedResponse("")
+		}
+	}
+	for _, item := range items {
+		var err error
+		item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc})
+		if err != nil {
+			e := NewError(err)
+			return e.Code, nil, e
+		}
+	}
+	status = rsrc.Conf().ReplacedStatus()
+	if dryRun {
+		status = 200
+	}
+	return status, nil, &resource.ItemList{Total: -1, Items: items}
+}
+
+// listPatchLenient updates each document of a batch independently and returns
+// a multi-status response with the status and the body of each of them.
+func listPatchLenient(ctx context.Context, r *http.Request, route *RouteMatch, q *query.Query, payloads []map[string]interface{}, dryRun bool) (status int, headers http.Header, body interface{}) {
+	rsrc := route.Resource()
+	results := make([]map[string]interface{}, len(payloads))
+	for i, payload := range payloads {
+		original, item, changes, e := updatedItem(ctx, r, route, q, payload)
+		if e == nil {
+			if dryRun {
+				e = dryRunCheck(ctx, rsrc, item, original)
+			} else if err := rsrc.Update(ctx, item, original); err != nil {
+				e = NewError(err)
+			} else {
+				logAudit(ctx, rsrc, original, changes, item.Payload)
+			}
+		}
+		if e == nil {
+			var err error
+			if item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc}); err != nil {
+				e = NewError(err)
+			}
+		}
+		results[i] = batchResult(rsrc, rsrc.Conf().ReplacedStatus(), item, e, dryRun)
+	}
+	headers = http.Header{}
+	headers.Set("Preference-Applied", "handling=lenient")
+	return 207, headers, results
+}
+
+// updatedItem looks up the item referred to by the id of the payload and
+// returns it with the updated item to store in its place once the changes of
+// the payload are applied and validated, and the changes themselves.
+func updatedItem(ctx context.Context, r *http.Request, route *RouteMatch, q *query.Query, payload map[string]interface{}) (original, item *resource.Item, changes map[string]interface{}, e *Error) {
+	rsrc := route.Resource()
+	rawID, found := payload["id"]
+	if !found {
+		return nil, nil, nil, &Error{422, "Document contains error(s)", map[string][]interface{}{"id": {"required"}}}
+	}
+	id, err := decodeID(rsrc, rawID)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			return nil, nil, nil, e
+		}
+		return nil, nil, nil, &Error{422, "Document contains error(s)", map[string][]interface{}{"id": {err.Error()}}}
+	}
+	payload["id"] = id
+	lq := &query.Query{
+		Predicate: append(append(query.Predicate{}, q.Predicate...), &query.Equal{Field: "id", Value: id}),
+		Window:    &query.Window{Limit: 1},
+	}
+	l, err := rsrc.Find(ctx, lq)
+	if err != nil {
+		return nil, nil, nil, NewError(err)
+	}
+	if len(l.Items) == 0 {
+		return nil, nil, nil, ErrNotFound
+	}
+	original = l.Items[0]
+	if rsrc.Contended(original.ID) {
+		return nil, nil, nil, ErrPreconditionRequired
+	}
+	if e := checkFieldsIntegrityRequest(ctx, r, rsrc, original); e != nil {
+		return nil, nil, nil, e
+	}
+	if e := preValidate(ctx, rsrc, payload); e != nil {
+		return nil, nil, nil, e
+	}
+	changes, base := rsrc.Validator().Prepare(ctx, payload, &original.Payload, false)
+	// Append lookup fields to base payload so it isn't caught by ReadOnly
+	// (i.e.: contains parent resource refs if any).
+	for k, v := range route.ResourcePath.Values() {
+		base[k] = v
+	}
+	applyLookupScope(ctx, rsrc, changes, base)
+	vmode := validationMode(resource.Update) | partialMode(r, rsrc, changes, base)
+	doc, errs := schema.ValidateWithContext(ctx, rsrc.Validator(), changes, base, vmode)
+	if len(errs) > 0 {
+		return nil, nil, nil, &Error{422, "Document contains error(s)", errs}
+	}
+	if item, err = resource.NewItem(doc); err != nil {
+		return nil, nil, nil, NewError(err)
+	}
+	return original, item, changes, nil
+}
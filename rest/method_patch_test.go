@@ -0,0 +1,206 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerPatchListBatch(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		s := mem.NewHandler()
+		s.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "a"}},
+			{ID: "2", ETag: "b", Payload: map[string]interface{}{"id": "2", "foo": "b"}},
+		})
+		i := resource.NewIndex()
+		i.Bind("foo", schema.Schema{Fields: schema.Fields{
+			"id":  {ReadOnly: true},
+			"foo": {Validator: &schema.String{}},
+		}}, s, resource.DefaultConf)
+		return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+	}
+	checkStored := func(foos ...string) requestCheckerFunc {
+		return func(t *testing.T, vars *requestTestVars) {
+			l, err := vars.Storers["foo"].Find(context.Background(), &query.Query{Sort: query.Sort{{Name: "id"}}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			stored := []string{}
+			for _, item := range l.Items {
+				stored = append(stored, item.Payload["foo"].(string))
+			}
+			assert.Equal(t, foos, stored)
+		}
+	}
+	tests := map[string]requestTest{
+		"Strict:Valid": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "c"}, {"id": "2", "foo": "d"}]`))
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "1", "foo": "c", "_etag": "dc0b61395adfcd621f2bcf54524d5fce"}, {"id": "2", "foo": "d", "_etag": "e6dc60f54393d9e931ca8a7e879a5fb5"}]`,
+			ExtraTest:    checkStored("c", "d"),
+		},
+		"Strict:Mixed": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "c"}, {"id": "2", "foo": 1}, {"id": "3", "foo": "e"}, {"foo": "f"}]`))
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Batch contains error(s)", "issues": {
+				"1": [{"foo": ["not a string"]}],
+				"2": ["Not Found"],
+				"3": [{"id": ["required"]}]
+			}}`,
+			ExtraTest: checkStored("a", "b"),
+		},
+		"Lenient:Mixed": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "c"}, {"id": "2", "foo": 1}, {"id": "3", "foo": "e"}]`))
+				r.Header.Set("Prefer", "handling=lenient")
+				return r, err
+			},
+			ResponseCode:   207,
+			ResponseHeader: http.Header{"Preference-Applied": []string{"handling=lenient"}},
+			ResponseBody: `[
+				{"status": 200, "body": {"id": "1", "foo": "c", "_etag": "dc0b61395adfcd621f2bcf54524d5fce"}},
+				{"status": 422, "body": {"code": 422, "message": "Document contains error(s)", "issues": {"foo": ["not a string"]}}},
+				{"status": 404, "body": {"code": 404, "message": "Not Found"}}
+			]`,
+			ExtraTest: checkStored("c", "b"),
+		},
+		"NotBatch": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`{"id": "1", "foo": "c"}`))
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Batch update requires an array of documents"}`,
+			ExtraTest:    checkStored("a", "b"),
+		},
+		"Empty": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[]`))
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Batch is empty"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+type auditRecorder chan resource.AuditEntry
+
+func (r auditRecorder) LogAudit(ctx context.Context, entry resource.AuditEntry) {
+	r <- entry
+}
+
+func TestHandlerPatchListBatchChecks(t *testing.T) {
+	newInit := func(audit auditRecorder) func() *requestTestVars {
+		return func() *requestTestVars {
+			s := mem.NewHandler()
+			s.Insert(context.Background(), []*resource.Item{
+				{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "foo": "a"}},
+				{ID: "2", ETag: "b", Payload: map[string]interface{}{"id": "2", "foo": "b"}},
+			})
+			conf := resource.DefaultConf
+			conf.ContentionCooldown = time.Hour
+			conf.AuditLogger = audit
+			i := resource.NewIndex()
+			rsrc := i.Bind("foo", schema.Schema{Fields: schema.Fields{
+				"id":  {ReadOnly: true},
+				"foo": {Validator: &schema.String{}},
+			}}, &conflictOnceStorer{Storer: s}, conf)
+			// Simulate a concurrent write on the item 2.
+			original := &resource.Item{ID: "2", ETag: "b", Payload: map[string]interface{}{"id": "2", "foo": "b"}}
+			item := &resource.Item{ID: "2", Payload: map[string]interface{}{"id": "2", "foo": "c"}}
+			if err := rsrc.Update(context.Background(), item, original); err != resource.ErrConflict {
+				t.Fatalf("expected a conflict, got %v", err)
+			}
+			return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+		}
+	}
+	checkAudit := func(audit auditRecorder, changes ...map[string]resource.FieldChange) requestCheckerFunc {
+		return func(t *testing.T, vars *requestTestVars) {
+			for _, c := range changes {
+				select {
+				case entry := <-audit:
+					assert.Equal(t, c, entry.Changes)
+				case <-time.After(time.Second):
+					t.Fatal("no audit entry")
+				}
+			}
+			select {
+			case entry := <-audit:
+				t.Errorf("unexpected audit entry: %v", entry)
+			default:
+			}
+		}
+	}
+	strictAudit := make(auditRecorder, 10)
+	lenientAudit := make(auditRecorder, 10)
+	contendedAudit := make(auditRecorder, 10)
+	tests := map[string]requestTest{
+		"Strict:Audited": {
+			Init: newInit(strictAudit),
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "c"}]`))
+			},
+			ResponseCode: 200,
+			ResponseBody: `[{"id": "1", "foo": "c", "_etag": "dc0b61395adfcd621f2bcf54524d5fce"}]`,
+			ExtraTest:    checkAudit(strictAudit, map[string]resource.FieldChange{"foo": {Before: "a", After: "c"}}),
+		},
+		"Lenient:Audited": {
+			Init: newInit(lenientAudit),
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "c"}]`))
+				r.Header.Set("Prefer", "handling=lenient")
+				return r, err
+			},
+			ResponseCode: 207,
+			ResponseBody: `[{"status": 200, "body": {"id": "1", "foo": "c", "_etag": "dc0b61395adfcd621f2bcf54524d5fce"}}]`,
+			ExtraTest:    checkAudit(lenientAudit, map[string]resource.FieldChange{"foo": {Before: "a", After: "c"}}),
+		},
+		"Contended": {
+			Init: newInit(contendedAudit),
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[{"id": "2", "foo": "d"}]`))
+				// Request level conditions don't apply to the items.
+				r.Header.Set("If-Match", `"b"`)
+				return r, err
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Batch contains error(s)", "issues": {"0": ["Precondition Required"]}}`,
+			ExtraTest:    checkAudit(contendedAudit),
+		},
+		"IfMatchFields": {
+			Init: newInit(make(auditRecorder, 10)),
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("PATCH", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "c"}]`))
+				r.Header.Set("If-Match-Fields", `{"foo": "b"}`)
+				return r, err
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Batch contains error(s)", "issues": {"0": [{"foo": ["has changed"]}]}}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
@@ -4,50 +4,71 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/rs/rest-layer/resource"
 	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
 )
 
 // listPost handles POST resquests on a resource URL.
+//
+// The body may either contain a single document or an array of documents to
+// insert as a batch. By default, a batch is inserted atomically and any error
+// fails the whole batch. With the `Prefer: handling=lenient` header, each
+// document of the batch is processed independently and a 207 multi-status
+// response reports the status of each of them.
+//
+// In dry-run mode (see isDryRun), documents are validated and checked for
+// conflicts with the stored documents (see dryRunCheck) but not stored, and
+// the would-be documents are returned with a 200 status. On resources with
+// asynchronous writes, a 202 status is returned without the documents.
+//
+// With the `Prefer: provenance` header, the fields of a single created
+// document set by the server are listed in the X-Generated-Fields header.
+//
+// The validation warnings raised by the fields of a single document are
+// returned as X-Validation-Warning headers. If a single document is invalid,
+// the fields which passed the validation may be returned with the error (see
+// validFields).
 func listPost(ctx context.Context, r *http.Request, route *RouteMatch) (status int, headers http.Header, body interface{}) {
-	q, e := route.Query()
+	q, e := route.query(ctx, resource.Create)
 	if e != nil {
 		return e.Code, nil, e
 	}
-	var payload map[string]interface{}
-	if e = decodePayload(r, &payload); e != nil {
+	payloads, batch, e := decodeBatchPayload(ctx, r)
+	if e != nil {
 		return e.Code, nil, e
 	}
-	rsrc := route.Resource()
-	changes, base := rsrc.Validator().Prepare(ctx, payload, nil, false)
-	// Append lookup fields to base payload so it isn't caught by ReadOnly
-	// (i.e.: contains id and parent resource refs if any).
-	for k, v := range route.ResourcePath.Values() {
-		base[k] = v
+	if batch {
+		return handleBatch(ctx, r, route, q, payloads, listPostStrict, listPostLenient)
 	}
-	doc, errs := rsrc.Validator().Validate(changes, base)
-	if len(errs) > 0 {
-		return 422, nil, &Error{422, "Document contains error(s)", errs}
+	rsrc := route.Resource()
+	dryRun := isDryRun(r)
+	item, warnings, e, valid := newItem(ctx, r, route, payloads[0])
+	if e != nil {
+		return e.Code, nil, validationError(e, valid)
 	}
-	item, err := resource.NewItem(doc)
-	if err != nil {
+	if dryRun {
+		e = dryRunCheck(ctx, rsrc, item, nil)
+	} else if err := rsrc.Insert(ctx, []*resource.Item{item}); err != nil {
 		e = NewError(err)
-		return e.Code, nil, e
 	}
-	// TODO: add support for batch insert
-	if err = rsrc.Insert(ctx, []*resource.Item{item}); err != nil {
-		e = NewError(err)
+	if e != nil {
 		return e.Code, nil, e
 	}
 	// Evaluate projection so response gets the same format as read requests.
+	var err error
 	item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc})
 	if err != nil {
 		e = NewError(err)
 		return e.Code, nil, e
 	}
+	if dryRun {
+		headers = provenanceHeaders(r, route, payloads[0], item.Payload, dryRunHeaders(r))
+		return 200, validationWarningHeaders(warnings, headers), item
+	}
 	// See https://www.subbu.org/blog/2008/10/location-vs-content-location
-	headers = http.Header{}
 	itemID := item.ID
 	if f := rsrc.Validator().GetField("id"); f != nil {
 		if s, ok := f.Validator.(schema.FieldSerializer); ok {
@@ -56,6 +77,218 @@ func listPost(ctx context.Context, r *http.Request, route *RouteMatch) (status i
 			}
 		}
 	}
-	headers.Set("Content-Location", fmt.Sprintf("%s/%s", r.URL.Path, itemID))
-	return 201, headers, item
+	location := fmt.Sprintf("%s/%s", r.URL.Path, itemID)
+	if rsrc.Conf().AsyncWrites {
+		status, headers, body = acceptedResponse(location)
+		return status, validationWarningHeaders(warnings, headers), body
+	}
+	headers = http.Header{}
+	headers.Set("Content-Location", location)
+	headers = provenanceHeaders(r, route, payloads[0], item.Payload, headers)
+	return rsrc.Conf().CreatedStatus(), validationWarningHeaders(warnings, headers), item
+}
+
+// listPostStrict inserts a batch of documents atomically. If any of the
+// documents is invalid, no document is inserted and the issues of each invalid
+// document are reported under its index in the batch.
+func listPostStrict(ctx context.Context, r *http.Request, route *RouteMatch, q *query.Query, payloads []map[string]interface{}, dryRun bool) (status int, headers http.Header, body interface{}) {
+	rsrc := route.Resource()
+	items := make([]*resource.Item, 0, len(payloads))
+	issues := map[string][]interface{}{}
+	for i, payload := range payloads {
+		item, _, e, _ := newItem(ctx, r, route, payload)
+		if e != nil {
+			if e.Issues != nil {
+				issues[strconv.Itoa(i)] = append(issues[strconv.Itoa(i)], e.Issues)
+			} else {
+				issues[strconv.Itoa(i)] = append(issues[strconv.Itoa(i)], e.Message)
+			}
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(issues) > 0 {
+		return 422, nil, &Error{422, "Batch contains error(s)", issues}
+	}
+	if dryRun {
+		if err := rsrc.CheckInsert(ctx, items); err != nil {
+			e := NewError(err)
+			return e.Code, nil, e
+		}
+	} else {
+		if err := rsrc.Insert(ctx, items); err != nil {
+			e := NewError(err)
+			return e.Code, nil, e
+		}
+		if rsrc.Conf().AsyncWrites {
+			return acceptedResponse("")
+		}
+	}
+	for _, item := range items {
+		var err error
+		item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc})
+		if err != nil {
+			e := NewError(err)
+			return e.Code, nil, e
+		}
+	}
+	status = rsrc.Conf().CreatedStatus()
+	if dryRun {
+		status = 200
+	}
+	return status, nil, &resource.ItemList{Total: -1, Items: items}
+}
+
+// listPostLenient inserts each document of a batch independently and returns
+// a multi-status response with the status and the body of each of them.
+func listPostLenient(ctx context.Context, r *http.Request, route *RouteMatch, q *query.Query, payloads []map[string]interface{}, dryRun bool) (status int, headers http.Header, body interface{}) {
+	rsrc := route.Resource()
+	results := make([]map[string]interface{}, len(payloads))
+	for i, payload := range payloads {
+		item, _, e, _ := newItem(ctx, r, route, payload)
+		if e == nil {
+			if dryRun {
+				e = dryRunCheck(ctx, rsrc, item, nil)
+			} else if err := rsrc.Insert(ctx, []*resource.Item{item}); err != nil {
+				e = NewError(err)
+			}
+		}
+		if e == nil {
+			var err error
+			if item.Payload, err = q.Projection.Eval(ctx, item.Payload, restResource{rsrc}); err != nil {
+				e = NewError(err)
+			}
+		}
+		results[i] = batchResult(rsrc, rsrc.Conf().CreatedStatus(), item, e, dryRun)
+	}
+	headers = http.Header{}
+	headers.Set("Preference-Applied", "handling=lenient")
+	return 207, headers, results
+}
+
+// batchHandler processes a batch of documents sent to a resource URL.
+type batchHandler func(ctx context.Context, r *http.Request, route *RouteMatch, q *query.Query, payloads []map[string]interface{}, dryRun bool) (status int, headers http.Header, body interface{})
+
+// handleBatch processes a batch of documents with the lenient handler if the
+// request prefers a lenient handling, and with the strict handler otherwise.
+func handleBatch(ctx context.Context, r *http.Request, route *RouteMatch, q *query.Query, payloads []map[string]interface{}, strict, lenient batchHandler) (status int, headers http.Header, body interface{}) {
+	if len(payloads) == 0 {
+		return 422, nil, &Error{422, "Batch is empty", nil}
+	}
+	dryRun := isDryRun(r)
+	if hasPreference(r, "handling=lenient") {
+		status, headers, body = lenient(ctx, r, route, q, payloads, dryRun)
+	} else {
+		status, headers, body = strict(ctx, r, route, q, payloads, dryRun)
+	}
+	if dryRun && status < 300 && hasPreference(r, "dry-run") {
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Add("Preference-Applied", "dry-run")
+	}
+	return status, headers, body
+}
+
+// batchResult returns the multi-status entry of a document of a batch
+// processed with the lenient handling. The body of a stored item has the same
+// format as an item of the list returned with the strict handling.
+func batchResult(rsrc *resource.Resource, status int, item *resource.Item, e *Error, dryRun bool) map[string]interface{} {
+	if e != nil {
+		errBody := map[string]interface{}{"code": e.Code, "message": e.Message}
+		if e.Issues != nil {
+			errBody["issues"] = renderIssues(e.Issues)
+		}
+		return map[string]interface{}{"status": e.Code, "body": errBody}
+	}
+	if dryRun {
+		status = 200
+	} else if rsrc.Conf().AsyncWrites {
+		return map[string]interface{}{"status": http.StatusAccepted}
+	}
+	return map[string]interface{}{"status": status, "body": itemPayload(item)}
+}
+
+// newItem prepares and validates a new document from the payload and returns
+// the item to be inserted with the validation warnings raised by its fields.
+// If the document is invalid, the fields which passed the validation are also
+// returned when requested (see validFields). The id of documents without id is
+// derived from the document if the resource has a DeriveID function.
+func newItem(ctx context.Context, r *http.Request, route *RouteMatch, payload map[string]interface{}) (*resource.Item, []string, *Error, map[string]interface{}) {
+	rsrc := route.Resource()
+	if e := preValidate(ctx, rsrc, payload); e != nil {
+		return nil, nil, e, nil
+	}
+	changes, base := rsrc.Validator().Prepare(ctx, payload, nil, false)
+	// Append lookup fields to base payload so it isn't caught by ReadOnly
+	// (i.e.: contains id and parent resource refs if any).
+	for k, v := range route.ResourcePath.Values() {
+		base[k] = v
+	}
+	applyLookupScope(ctx, rsrc, changes, base)
+	vmode := validationMode(resource.Create) | partialMode(r, rsrc, changes, base)
+	vctx := schema.WithWarnings(ctx)
+	doc, errs := schema.ValidateWithContext(vctx, rsrc.Validator(), changes, base, vmode)
+	if len(errs) > 0 {
+		return nil, nil, &Error{422, "Document contains error(s)", errs}, validFields(ctx, r, rsrc, doc, errs)
+	}
+	if _, found := payload["id"]; !found && rsrc.Conf().DeriveID != nil {
+		if e := deriveID(rsrc, doc); e != nil {
+			return nil, nil, e, nil
+		}
+	}
+	item, err := resource.NewItem(doc)
+	if err != nil {
+		return nil, nil, NewError(err), nil
+	}
+	return item, schema.WarningsFromContext(vctx), nil, nil
+}
+
+// deriveID sets the id of the document to the id derived from its content by
+// the resource's DeriveID function, validated by the validator of the id field.
+// The id is derived from the plaintext of the encrypted fields so it doesn't
+// depend on their ciphertext.
+func deriveID(rsrc *resource.Resource, doc map[string]interface{}) *Error {
+	plain, err := decryptPayload(rsrc.Schema(), doc)
+	var id interface{}
+	if err == nil {
+		id, err = rsrc.Conf().DeriveID(plain)
+	}
+	if err == nil {
+		if f := rsrc.Validator().GetField("id"); f != nil && f.Validator != nil {
+			id, err = f.Validator.Validate(id)
+		}
+	}
+	if err != nil {
+		return &Error{422, "Document contains error(s)", map[string][]interface{}{
+			"id": {"can't be derived: " + err.Error()},
+		}}
+	}
+	doc["id"] = id
+	return nil
+}
+
+// decryptPayload returns a copy of a validated payload with the values of the
+// encrypted fields decrypted.
+func decryptPayload(s schema.Schema, payload map[string]interface{}) (map[string]interface{}, error) {
+	doc := make(map[string]interface{}, len(payload))
+	for field, value := range payload {
+		def, found := s.Fields[field]
+		if found && value != nil {
+			if sub, ok := value.(map[string]interface{}); ok && def.Schema != nil {
+				v, err := decryptPayload(*def.Schema, sub)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%v", field, err)
+				}
+				value = v
+			} else if def.Encrypter != nil {
+				var err error
+				if value, err = def.Encrypter.Decrypt(value); err != nil {
+					return nil, fmt.Errorf("%s: %v", field, err)
+				}
+			}
+		}
+		doc[field] = value
+	}
+	return doc, nil
 }
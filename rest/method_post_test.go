@@ -3,9 +3,19 @@ package rest_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
 	"testing"
 
+	"github.com/rs/rest-layer/internal/testutil"
 	"github.com/rs/rest-layer/resource"
 	"github.com/rs/rest-layer/resource/testing/mem"
 	"github.com/rs/rest-layer/rest"
@@ -60,7 +70,22 @@ func TestHandlerPostList(t *testing.T) {
 			ResponseCode: http.StatusBadRequest,
 			ResponseBody: `{
 				"code": 400,
-				"message": "Malformed body: invalid character 'i' looking for beginning of object key string"
+				"message": "Malformed JSON: invalid character 'i' looking for beginning of object key string at offset 2"
+			}`,
+		},
+		"EmptyPayload": {
+			Init: func() *requestTestVars {
+				index := resource.NewIndex()
+				index.Bind("test", schema.Schema{}, nil, resource.DefaultConf)
+				return &requestTestVars{Index: index}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/test", bytes.NewBufferString(``))
+			},
+			ResponseCode: http.StatusBadRequest,
+			ResponseBody: `{
+				"code": 400,
+				"message": "Empty body"
 			}`,
 		},
 		"InvalIDQueryFields": {
@@ -219,7 +244,86 @@ func TestHandlerPostList(t *testing.T) {
 			ResponseBody: `{
 				"code": 422,
 				"message": "Document contains error(s)",
-				"issues": {"foo": ["Not Found"]}
+				"issues": {"foo": [{"code": "not_found", "message": "Not Found", "resource": "foo", "id": "nonexisting"}]}
+			}`,
+		},
+		"WithNotAllowedValue": {
+			Init: func() *requestTestVars {
+				s := mem.NewHandler()
+				index := resource.NewIndex()
+				index.Bind("foo", schema.Schema{Fields: schema.Fields{
+					"id":     {},
+					"status": {Validator: &schema.Enum{Values: map[string]int{"draft": 0, "published": 1}}},
+					"name":   {Validator: &schema.String{MaxLen: 2}},
+				}}, s, resource.DefaultConf)
+				return &requestTestVars{Index: index}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"id": "1", "status": "deleted", "name": "foo"}`))
+			},
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{
+				"code": 422,
+				"message": "Document contains error(s)",
+				"issues": {
+					"status": [{"code": "not_allowed", "message": "invalid enum value", "allowed": ["draft", "published"]}],
+					"name": ["is longer than 2"]
+				}
+			}`,
+		},
+		"WithStripHTML": {
+			Init: func() *requestTestVars {
+				s := mem.NewHandler()
+				index := resource.NewIndex()
+				index.Bind("foo", schema.Schema{Fields: schema.Fields{
+					"id":   {},
+					"name": {Validator: &schema.String{StripHTML: true}},
+				}}, s, resource.DefaultConf)
+				return &requestTestVars{
+					Index:   index,
+					Storers: map[string]resource.Storer{"foo": s},
+				}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"id": "1", "name": "<b>Tom</b> &amp; Jerry<script>alert(1)</script>"}`))
+			},
+			ResponseCode: http.StatusCreated,
+			ResponseBody: `{"id": "1", "name": "Tom &amp; Jerry"}`,
+			ExtraTest: func(t *testing.T, vars *requestTestVars) {
+				l, err := vars.Storers["foo"].Find(context.TODO(), &query.Query{
+					Predicate: query.Predicate{&query.Equal{Field: "id", Value: "1"}},
+				})
+				if assert.NoError(t, err) && assert.Len(t, l.Items, 1) {
+					assert.Equal(t, "Tom &amp; Jerry", l.Items[0].Payload["name"])
+				}
+			},
+		},
+		"WithReferencesNotFound": {
+			Init: func() *requestTestVars {
+				s := mem.NewHandler()
+				s.Insert(context.Background(), []*resource.Item{{ID: "ref", Payload: map[string]interface{}{"id": "ref"}}})
+				index := resource.NewIndex()
+				index.Bind("foo", schema.Schema{Fields: schema.Fields{"id": {}}}, s, resource.DefaultConf)
+				index.Bind("bar", schema.Schema{Fields: schema.Fields{"id": {}}}, s, resource.DefaultConf)
+				index.Bind("baz", schema.Schema{Fields: schema.Fields{
+					"id":    {},
+					"foo":   {Validator: &schema.Reference{Path: "foo"}},
+					"bar":   {Validator: &schema.Reference{Path: "bar"}},
+					"valid": {Validator: &schema.Reference{Path: "foo"}},
+				}}, s, resource.DefaultConf)
+				return &requestTestVars{Index: index}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/baz", bytes.NewBufferString(`{"id": "1", "foo": "missing1", "bar": "missing2", "valid": "ref"}`))
+			},
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{
+				"code": 422,
+				"message": "Document contains error(s)",
+				"issues": {
+					"foo": [{"code": "not_found", "message": "Not Found", "resource": "foo", "id": "missing1"}],
+					"bar": [{"code": "not_found", "message": "Not Found", "resource": "bar", "id": "missing2"}]
+				}
 			}`,
 		},
 		"WithReferenceNoStorage": {
@@ -325,7 +429,7 @@ func TestHandlerPostList(t *testing.T) {
 			ResponseBody: `{
 				"code": 422,
 				"message": "Document contains error(s)",
-				"issues": {"foos":["invalid value at #2: Not Found"]}
+				"issues": {"foos": [{"code": "not_found", "message": "invalid value at #2: Not Found", "resource": "foo", "id": "ref2", "index": 2}]}
 			}`,
 		},
 		"WithArraySchemaReference": {
@@ -369,3 +473,556 @@ func TestHandlerPostListWithInvalidReference(t *testing.T) {
 	assert.Error(t, err, "bar: schema compilation error: foo: can't find resource 'invalid'", "rest.NewHandler(index)")
 	assert.Nil(t, h, "rest.NewHandler(index)")
 }
+
+func TestHandlerPostListMultipart(t *testing.T) {
+	newHandler := func(s *mem.MemoryHandler) *rest.Handler {
+		i := resource.NewIndex()
+		i.Bind("foo", schema.Schema{Fields: schema.Fields{
+			"id":    {OnInit: func(ctx context.Context, v interface{}) interface{} { return "1" }},
+			"name":  {Required: true, Validator: &schema.String{}},
+			"size":  {Validator: &schema.Integer{}},
+			"photo": {Validator: &schema.String{}},
+		}}, s, resource.DefaultConf)
+		h, err := rest.NewHandler(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Uploads = rest.Uploads{
+			FileStore: rest.FileStoreFunc(func(ctx context.Context, f rest.File) (interface{}, error) {
+				b, _ := ioutil.ReadAll(f.Content)
+				return fmt.Sprintf("%s:%s:%d:%s", f.Field, f.Filename, f.Size, b), nil
+			}),
+			MaxFileSize: 10,
+		}
+		return h
+	}
+	newRequest := func(content string) *http.Request {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("name", "bar")
+		pw, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition": {`form-data; name="size"`},
+			"Content-Type":        {"application/json"},
+		})
+		pw.Write([]byte("42"))
+		fw, _ := mw.CreateFormFile("photo", "photo.png")
+		fw.Write([]byte(content))
+		mw.Close()
+		r, _ := http.NewRequest("POST", "/foo", body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		return r
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		s := mem.NewHandler()
+		w := httptest.NewRecorder()
+		newHandler(s).ServeHTTP(w, newRequest("data"))
+		assert.Equal(t, 201, w.Code)
+		testutil.JSONEq(t, []byte(`{"id":"1","name":"bar","size":42,"photo":"photo:photo.png:4:data"}`), w.Body.Bytes())
+	})
+	t.Run("FileTooLarge", func(t *testing.T) {
+		s := mem.NewHandler()
+		w := httptest.NewRecorder()
+		newHandler(s).ServeHTTP(w, newRequest("more than ten bytes"))
+		assert.Equal(t, 413, w.Code)
+		testutil.JSONEq(t, []byte(`{"code":413,"message":"File `+"`photo'"+` exceeds maximum size of 10 bytes"}`), w.Body.Bytes())
+	})
+	t.Run("NoFileStore", func(t *testing.T) {
+		s := mem.NewHandler()
+		h := newHandler(s)
+		h.Uploads = rest.Uploads{}
+		w := httptest.NewRecorder()
+		r := newRequest("data")
+		h.ServeHTTP(w, r)
+		assert.Equal(t, 501, w.Code)
+	})
+}
+
+func TestHandlerPostListLookupScope(t *testing.T) {
+	tests := map[string]requestTest{
+		"TaggedWithTenant": {
+			Init: func() *requestTestVars {
+				i := resource.NewIndex()
+				s := mem.NewHandler()
+				i.Bind("foo", schema.Schema{Fields: schema.Fields{
+					"id":     {OnInit: func(ctx context.Context, v interface{}) interface{} { return "1" }},
+					"tenant": {},
+					"foo":    {},
+				}}, s, tenantScopedConf())
+				return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+			},
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"foo": "bar", "tenant": "b"}`))
+				return withTenant(r, err, "a")
+			},
+			ResponseCode: 201,
+			ResponseBody: `{"foo": "bar", "id": "1", "tenant": "a"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+// saltedEncrypter is a test Encrypter prefixing string values with a random
+// salt, so the same value is encrypted differently each time.
+type saltedEncrypter struct{}
+
+func (saltedEncrypter) Encrypt(value interface{}) (interface{}, error) {
+	return fmt.Sprintf("%x:%v", rand.Int63(), value), nil
+}
+
+func (saltedEncrypter) Decrypt(value interface{}) (interface{}, error) {
+	s, _ := value.(string)
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		return s[i+1:], nil
+	}
+	return nil, errors.New("invalid ciphertext")
+}
+
+func TestHandlerPostListDeriveID(t *testing.T) {
+	newInit := func(encrypter schema.Encrypter) func() *requestTestVars {
+		return func() *requestTestVars {
+			i := resource.NewIndex()
+			s := mem.NewHandler()
+			s.Insert(context.Background(), []*resource.Item{
+				{ID: "existing", Payload: map[string]interface{}{"id": "existing", "title": "Existing"}},
+			})
+			conf := resource.DefaultConf
+			conf.DeriveID = func(doc map[string]interface{}) (interface{}, error) {
+				title, _ := doc["title"].(string)
+				if title == "" {
+					return nil, errors.New("empty title")
+				}
+				return strings.Replace(strings.ToLower(title), " ", "-", -1), nil
+			}
+			i.Bind("foo", schema.Schema{Fields: schema.Fields{
+				"id":    {Validator: &schema.String{Regexp: "^[a-z0-9-]+$"}},
+				"title": {Validator: &schema.String{}, Encrypter: encrypter},
+			}}, s, conf)
+			return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+		}
+	}
+	sharedInit := newInit(nil)
+	tests := map[string]requestTest{
+		"Derived": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"title": "Hello World"}`))
+			},
+			ResponseCode:   201,
+			ResponseHeader: http.Header{"Content-Location": []string{"/foo/hello-world"}},
+			ResponseBody:   `{"id": "hello-world", "title": "Hello World"}`,
+		},
+		"Provided": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"id": "hello", "title": "Hello World"}`))
+			},
+			ResponseCode: 201,
+			ResponseBody: `{"id": "hello", "title": "Hello World"}`,
+		},
+		"Collision": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"title": "existing"}`))
+			},
+			ResponseCode: 409,
+			ResponseBody: `{"code": 409, "message": "Conflict"}`,
+		},
+		"Encrypted": {
+			Init: newInit(saltedEncrypter{}),
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"title": "Hello World"}`))
+			},
+			ResponseCode:   201,
+			ResponseHeader: http.Header{"Content-Location": []string{"/foo/hello-world"}},
+			ResponseBody:   `{"id": "hello-world", "title": "Hello World"}`,
+		},
+		"Invalid": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"title": "Hello, World"}`))
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Document contains error(s)", "issues": {"id": ["can't be derived: does not match ^[a-z0-9-]+$"]}}`,
+		},
+		"Error": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{}`))
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Document contains error(s)", "issues": {"id": ["can't be derived: empty title"]}}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestHandlerPostListBatch(t *testing.T) {
+	sharedInit := func() *requestTestVars {
+		i := resource.NewIndex()
+		s := mem.NewHandler()
+		i.Bind("foo", schema.Schema{Fields: schema.Fields{
+			"id":  {Required: true},
+			"foo": {Validator: &schema.String{}},
+		}}, s, resource.DefaultConf)
+		return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+	}
+	checkStored := func(ids ...string) requestCheckerFunc {
+		return func(t *testing.T, vars *requestTestVars) {
+			l, err := vars.Storers["foo"].Find(context.Background(), &query.Query{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			stored := []string{}
+			for _, item := range l.Items {
+				stored = append(stored, item.ID.(string))
+			}
+			assert.ElementsMatch(t, ids, stored)
+		}
+	}
+	tests := map[string]requestTest{
+		"Strict:Valid": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(` [{"id": "1", "foo": "bar"}, {"id": "2"}]`))
+			},
+			ResponseCode: 201,
+			ResponseBody: `[{"id": "1", "foo": "bar", "_etag": "a7a7495d35d8582c9cf450e1e99a20d1"}, {"id": "2", "_etag": "921c1b373345da64a5088297d6d637cc"}]`,
+			ExtraTest:    checkStored("1", "2"),
+		},
+		"Strict:Mixed": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "bar"}, {"foo": 1}]`))
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Batch contains error(s)", "issues": {"1": [{"id": ["required"], "foo": ["not a string"]}]}}`,
+			ExtraTest:    checkStored(),
+		},
+		"Lenient:Mixed": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				r, err := http.NewRequest("POST", "/foo", bytes.NewBufferString(`[{"id": "1", "foo": "bar"}, {"foo": 1}]`))
+				r.Header.Set("Prefer", "handling=lenient")
+				return r, err
+			},
+			ResponseCode:   207,
+			ResponseHeader: http.Header{"Preference-Applied": []string{"handling=lenient"}},
+			ResponseBody: `[
+				{"status": 201, "body": {"id": "1", "foo": "bar", "_etag": "a7a7495d35d8582c9cf450e1e99a20d1"}},
+				{"status": 422, "body": {"code": 422, "message": "Document contains error(s)", "issues": {"id": ["required"], "foo": ["not a string"]}}}
+			]`,
+			ExtraTest: checkStored("1"),
+		},
+		"Empty": {
+			Init: sharedInit,
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`[]`))
+			},
+			ResponseCode: 422,
+			ResponseBody: `{"code": 422, "message": "Batch is empty"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestHandlerPostListUseJSONNumber(t *testing.T) {
+	newVars := func(useNumber bool) *requestTestVars {
+		i := resource.NewIndex()
+		s := mem.NewHandler()
+		conf := resource.DefaultConf
+		conf.UseJSONNumber = useNumber
+		i.Bind("foo", schema.Schema{Fields: schema.Fields{
+			"id":    {OnInit: func(ctx context.Context, v interface{}) interface{} { return "1" }},
+			"big":   {Validator: &schema.Integer{}},
+			"ratio": {Validator: &schema.Float{}},
+		}}, s, conf)
+		return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+	}
+	storedPayload := func(t *testing.T, vars *requestTestVars) map[string]interface{} {
+		q := &query.Query{
+			Predicate: query.Predicate{&query.Equal{Field: "id", Value: "1"}},
+			Window:    &query.Window{Limit: 1},
+		}
+		l, err := vars.Storers["foo"].Find(context.TODO(), q)
+		assert.NoError(t, err)
+		if !assert.Len(t, l.Items, 1) {
+			return nil
+		}
+		return l.Items[0].Payload
+	}
+	newRequest := func() (*http.Request, error) {
+		// 9007199254740993 is 2^53 + 1 which is rounded when decoded as float64.
+		return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"big": 9007199254740993, "ratio": 0.5}`))
+	}
+	tests := map[string]requestTest{
+		"Enabled": {
+			Init:         func() *requestTestVars { return newVars(true) },
+			NewRequest:   newRequest,
+			ResponseCode: 201,
+			ResponseBody: `{"id": "1", "big": 9007199254740993, "ratio": 0.5}`,
+			ExtraTest: func(t *testing.T, vars *requestTestVars) {
+				assert.Equal(t, map[string]interface{}{"id": "1", "big": 9007199254740993, "ratio": 0.5}, storedPayload(t, vars))
+			},
+		},
+		"Disabled": {
+			Init:         func() *requestTestVars { return newVars(false) },
+			NewRequest:   newRequest,
+			ResponseCode: 201,
+			ResponseBody: `{"id": "1", "big": 9007199254740992, "ratio": 0.5}`,
+			ExtraTest: func(t *testing.T, vars *requestTestVars) {
+				assert.Equal(t, map[string]interface{}{"id": "1", "big": 9007199254740992, "ratio": 0.5}, storedPayload(t, vars))
+			},
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestHandlerPostListFieldMarshal(t *testing.T) {
+	price := schema.Field{
+		Validator: &schema.Integer{},
+		// Prices are stored in cents and exposed in dollars.
+		Unmarshal: func(value interface{}) (interface{}, error) {
+			f, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("not a price")
+			}
+			return int(math.Round(f * 100)), nil
+		},
+		Marshal: func(value interface{}) (interface{}, error) {
+			i, ok := value.(int)
+			if !ok {
+				return nil, fmt.Errorf("not a price")
+			}
+			return float64(i) / 100, nil
+		},
+	}
+	tests := map[string]requestTest{
+		"RoundTrip": {
+			Init: func() *requestTestVars {
+				i := resource.NewIndex()
+				s := mem.NewHandler()
+				i.Bind("foo", schema.Schema{Fields: schema.Fields{
+					"id":    {OnInit: func(ctx context.Context, v interface{}) interface{} { return "1" }},
+					"price": price,
+				}}, s, resource.DefaultConf)
+				return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"price": 12.5}`))
+			},
+			ResponseCode: 201,
+			ResponseBody: `{"id": "1", "price": 12.5}`,
+			ExtraTest: func(t *testing.T, vars *requestTestVars) {
+				q := &query.Query{
+					Predicate: query.Predicate{&query.Equal{Field: "id", Value: "1"}},
+					Window:    &query.Window{Limit: 1},
+				}
+				l, err := vars.Storers["foo"].Find(context.TODO(), q)
+				assert.NoError(t, err)
+				if assert.Len(t, l.Items, 1) {
+					assert.Equal(t, map[string]interface{}{"id": "1", "price": 1250}, l.Items[0].Payload)
+				}
+			},
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+type betaKey struct{}
+
+func TestHandlerPostListEnabledField(t *testing.T) {
+	newVars := func() *requestTestVars {
+		i := resource.NewIndex()
+		s := mem.NewHandler()
+		i.Bind("foo", schema.Schema{Fields: schema.Fields{
+			"id":   {OnInit: func(ctx context.Context, v interface{}) interface{} { return "1" }},
+			"name": {Validator: &schema.String{}},
+			"beta": {
+				Validator: &schema.String{},
+				Enabled: func(ctx context.Context) bool {
+					return ctx.Value(betaKey{}) == true
+				},
+			},
+		}}, s, resource.DefaultConf)
+		return &requestTestVars{Index: i, Storers: map[string]resource.Storer{"foo": s}}
+	}
+	newRequest := func(beta bool) func() (*http.Request, error) {
+		return func() (*http.Request, error) {
+			r, err := http.NewRequest("POST", "/foo", bytes.NewBufferString(`{"name": "foo", "beta": "bar"}`))
+			if err != nil || !beta {
+				return r, err
+			}
+			return r.WithContext(context.WithValue(r.Context(), betaKey{}, true)), nil
+		}
+	}
+	tests := map[string]requestTest{
+		"Enabled": {
+			Init:         newVars,
+			NewRequest:   newRequest(true),
+			ResponseCode: 201,
+			ResponseBody: `{"id": "1", "name": "foo", "beta": "bar"}`,
+		},
+		"Disabled": {
+			Init:         newVars,
+			NewRequest:   newRequest(false),
+			ResponseCode: 422,
+			ResponseBody: `{
+				"code": 422,
+				"message": "Document contains error(s)",
+				"issues": {"beta": ["invalid field"]}
+			}`,
+		},
+		"DisabledOutput": {
+			Init: func() *requestTestVars {
+				vars := newVars()
+				vars.Storers["foo"].Insert(context.Background(), []*resource.Item{
+					{ID: "1", Payload: map[string]interface{}{"id": "1", "name": "foo", "beta": "bar"}},
+				})
+				return vars
+			},
+			NewRequest: func() (*http.Request, error) {
+				return http.NewRequest("GET", "/foo/1", nil)
+			},
+			ResponseCode: 200,
+			ResponseBody: `{"id": "1", "name": "foo"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+// taskStatus rejects opening tasks of a closed project.
+type taskStatus struct{}
+
+func (taskStatus) Validate(value interface{}) (interface{}, error) {
+	return value, nil
+}
+
+func (taskStatus) ValidateContext(ctx context.Context, value interface{}) (interface{}, error) {
+	if value == "open" && schema.ParentFromContext(ctx)["state"] == "closed" {
+		return nil, errors.New("not allowed on a closed project")
+	}
+	return value, nil
+}
+
+func TestHandlerPostListParentValidator(t *testing.T) {
+	newVars := func() *requestTestVars {
+		projects := mem.NewHandler()
+		projects.Insert(context.Background(), []*resource.Item{
+			{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "state": "active"}},
+			{ID: "2", ETag: "b", Payload: map[string]interface{}{"id": "2", "state": "closed"}},
+		})
+		tasks := mem.NewHandler()
+		i := resource.NewIndex()
+		project := i.Bind("projects", schema.Schema{Fields: schema.Fields{
+			"id":    {},
+			"state": {},
+		}}, projects, resource.DefaultConf)
+		project.Bind("tasks", "project", schema.Schema{Fields: schema.Fields{
+			"id":      {},
+			"project": {Validator: &schema.Reference{Path: "projects"}},
+			"status":  {Validator: &taskStatus{}},
+		}}, tasks, resource.DefaultConf)
+		return &requestTestVars{
+			Index:   i,
+			Storers: map[string]resource.Storer{"projects": projects, "projects.tasks": tasks},
+		}
+	}
+	post := func(url, body string) func() (*http.Request, error) {
+		return func() (*http.Request, error) {
+			return http.NewRequest("POST", url, bytes.NewBufferString(body))
+		}
+	}
+	tests := map[string]requestTest{
+		"ActiveParent": {
+			Init:         newVars,
+			NewRequest:   post("/projects/1/tasks", `{"id": "1", "status": "open"}`),
+			ResponseCode: http.StatusCreated,
+			ResponseBody: `{"id": "1", "project": "1", "status": "open"}`,
+		},
+		"ClosedParent": {
+			Init:         newVars,
+			NewRequest:   post("/projects/2/tasks", `{"id": "1", "status": "open"}`),
+			ResponseCode: http.StatusUnprocessableEntity,
+			ResponseBody: `{
+				"code": 422,
+				"message": "Document contains error(s)",
+				"issues": {"status": ["not allowed on a closed project"]}
+			}`,
+		},
+		"ClosedParentAllowedValue": {
+			Init:         newVars,
+			NewRequest:   post("/projects/2/tasks", `{"id": "1", "status": "done"}`),
+			ResponseCode: http.StatusCreated,
+			ResponseBody: `{"id": "1", "project": "2", "status": "done"}`,
+		},
+	}
+	for n, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(n, tc.Test)
+	}
+}
+
+func TestHandlerPostListReferenceEnum(t *testing.T) {
+	statuses := mem.NewHandler()
+	statuses.Insert(context.Background(), []*resource.Item{
+		{ID: "1", ETag: "a", Payload: map[string]interface{}{"id": "1", "name": "draft"}},
+		{ID: "2", ETag: "b", Payload: map[string]interface{}{"id": "2", "name": "published"}},
+	})
+	status := &schema.ReferenceEnum{Path: "statuses", Field: "name"}
+	i := resource.NewIndex()
+	i.Bind("statuses", schema.Schema{Fields: schema.Fields{
+		"id":   {},
+		"name": {},
+	}}, statuses, resource.DefaultConf)
+	i.Bind("posts", schema.Schema{Fields: schema.Fields{
+		"id":     {},
+		"status": {Validator: status},
+	}}, mem.NewHandler(), resource.DefaultConf)
+	h, err := rest.NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+	serve := func(body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/posts", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(`{"id": "1", "status": "draft"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = serve(`{"id": "2", "status": "archived"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{
+		"code": 422,
+		"message": "Document contains error(s)",
+		"issues": {"status": [{"code": "not_allowed", "message": "not one of the allowed values", "allowed": ["draft", "published"]}]}
+	}`, w.Body.String())
+
+	// Drafts are no longer allowed once the cached set is refreshed.
+	statuses.Delete(context.Background(), &resource.Item{ID: "1", ETag: "a"})
+	w = serve(`{"id": "3", "status": "draft"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	status.Invalidate()
+	w = serve(`{"id": "4", "status": "draft"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+}
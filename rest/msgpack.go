@@ -0,0 +1,487 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// msgpackMaxDepth limits the nesting of decoded documents.
+const msgpackMaxDepth = 1000
+
+// MessagePackSerializer is the built-in application/msgpack Serializer. It
+// handles the documents, lists and errors produced by the default formatter.
+// Values without a MessagePack equivalent (i.e.: time.Time or structs) are
+// encoded using their JSON representation.
+//
+// To behave like JSON request bodies, integers decoded from MessagePack are
+// returned as float64 unless they can't be represented exactly as such, in
+// which case they are returned as int.
+type MessagePackSerializer struct{}
+
+// MediaType implements Serializer.
+func (s MessagePackSerializer) MediaType() string {
+	return "application/msgpack"
+}
+
+// Encode implements Serializer.
+func (s MessagePackSerializer) Encode(w io.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	if err := msgpackEncode(&buf, v); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Decode implements Serializer.
+func (s MessagePackSerializer) Decode(r io.Reader, v interface{}) error {
+	val, err := msgpackDecode(bufio.NewReader(r), 0)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	switch t := v.(type) {
+	case *interface{}:
+		*t = val
+	case *map[string]interface{}:
+		m, ok := val.(map[string]interface{})
+		if !ok && val != nil {
+			return errors.New("msgpack: document is not a map")
+		}
+		*t = m
+	default:
+		// Use JSON to map the generic value onto the target type.
+		j, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(j, v)
+	}
+	return nil
+}
+
+func msgpackEncode(buf *bytes.Buffer, v interface{}) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if t {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case string:
+		msgpackWriteString(buf, t)
+	case []byte:
+		msgpackWriteHeader(buf, len(t), 0, 0xc4, 0xc5, 0xc6)
+		buf.Write(t)
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(t))
+	case float32:
+		buf.WriteByte(0xca)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(t))
+	case int:
+		msgpackWriteInt(buf, int64(t))
+	case int64:
+		msgpackWriteInt(buf, t)
+	case int32:
+		msgpackWriteInt(buf, int64(t))
+	case uint64:
+		msgpackWriteUint(buf, t)
+	case uint:
+		msgpackWriteUint(buf, uint64(t))
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			msgpackWriteInt(buf, i)
+		} else if f, err := t.Float64(); err == nil {
+			return msgpackEncode(buf, f)
+		} else {
+			return err
+		}
+	case time.Time:
+		msgpackWriteString(buf, t.Format(time.RFC3339Nano))
+	case map[string]interface{}:
+		return msgpackEncodeMap(buf, len(t), func(keys func(k string, v interface{}) error) error {
+			for _, k := range msgpackSortedKeys(t) {
+				if err := keys(k, t[k]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case []interface{}:
+		msgpackWriteHeader(buf, len(t), 0x90, 0xdc, 0xdc, 0xdd)
+		for _, e := range t {
+			if err := msgpackEncode(buf, e); err != nil {
+				return err
+			}
+		}
+	case []map[string]interface{}:
+		msgpackWriteHeader(buf, len(t), 0x90, 0xdc, 0xdc, 0xdd)
+		for _, e := range t {
+			if err := msgpackEncode(buf, e); err != nil {
+				return err
+			}
+		}
+	default:
+		return msgpackEncodeReflect(buf, v)
+	}
+	return nil
+}
+
+// msgpackEncodeReflect encodes the maps with string keys and slices not
+// handled by msgpackEncode, other values are encoded using their JSON
+// representation.
+func msgpackEncodeReflect(buf *bytes.Buffer, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if _, ok := v.(json.Marshaler); ok {
+			break
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		return msgpackEncodeMap(buf, len(keys), func(each func(k string, v interface{}) error) error {
+			for _, k := range keys {
+				kv := reflect.ValueOf(k).Convert(rv.Type().Key())
+				if err := each(k, rv.MapIndex(kv).Interface()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case reflect.Slice, reflect.Array:
+		if _, ok := v.(json.Marshaler); ok {
+			break
+		}
+		msgpackWriteHeader(buf, rv.Len(), 0x90, 0xdc, 0xdc, 0xdd)
+		for i := 0; i < rv.Len(); i++ {
+			if err := msgpackEncode(buf, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Int8, reflect.Int16:
+		msgpackWriteInt(buf, rv.Int())
+		return nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		msgpackWriteUint(buf, rv.Uint())
+		return nil
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.UseNumber()
+	if err := d.Decode(&generic); err != nil {
+		return err
+	}
+	return msgpackEncode(buf, generic)
+}
+
+func msgpackEncodeMap(buf *bytes.Buffer, n int, each func(func(k string, v interface{}) error) error) error {
+	msgpackWriteHeader(buf, n, 0x80, 0xde, 0xde, 0xdf)
+	return each(func(k string, v interface{}) error {
+		msgpackWriteString(buf, k)
+		return msgpackEncode(buf, v)
+	})
+}
+
+func msgpackSortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func msgpackWriteString(buf *bytes.Buffer, s string) {
+	msgpackWriteHeader(buf, len(s), 0xa0, 0xd9, 0xda, 0xdb)
+	buf.WriteString(s)
+}
+
+// msgpackWriteHeader writes the type and length header of a string, binary,
+// array or map. A fix value of 0 means the type has no fix format, and the
+// 8 bits format is only used by strings and binaries.
+func msgpackWriteHeader(buf *bytes.Buffer, n int, fix, b8, b16, b32 byte) {
+	switch {
+	case fix == 0xa0 && n < 32, (fix == 0x90 || fix == 0x80) && n < 16:
+		buf.WriteByte(fix | byte(n))
+	case b8 != b16 && n <= math.MaxUint8:
+		buf.WriteByte(b8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func msgpackWriteInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		msgpackWriteUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func msgpackWriteUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(u))
+	default:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+	}
+}
+
+func msgpackDecode(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errors.New("msgpack: maximum nesting depth exceeded")
+	}
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return msgpackNumber(int64(c)), nil
+	case c >= 0xe0:
+		return msgpackNumber(int64(int8(c))), nil
+	case c&0xe0 == 0xa0:
+		return msgpackReadString(r, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return msgpackReadArray(r, int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return msgpackReadMap(r, int(c&0x0f), depth)
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := msgpackReadLength(r, c-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		b, err := msgpackReadBytes(r, n)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case 0xca:
+		var u uint32
+		if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(u)), nil
+	case 0xcb:
+		var u uint64
+		if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(u), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		var u uint64
+		switch c {
+		case 0xcc:
+			var v uint8
+			err = binary.Read(r, binary.BigEndian, &v)
+			u = uint64(v)
+		case 0xcd:
+			var v uint16
+			err = binary.Read(r, binary.BigEndian, &v)
+			u = uint64(v)
+		case 0xce:
+			var v uint32
+			err = binary.Read(r, binary.BigEndian, &v)
+			u = uint64(v)
+		default:
+			err = binary.Read(r, binary.BigEndian, &u)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if u > math.MaxInt64 {
+			return float64(u), nil
+		}
+		return msgpackNumber(int64(u)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		var i int64
+		switch c {
+		case 0xd0:
+			var v int8
+			err = binary.Read(r, binary.BigEndian, &v)
+			i = int64(v)
+		case 0xd1:
+			var v int16
+			err = binary.Read(r, binary.BigEndian, &v)
+			i = int64(v)
+		case 0xd2:
+			var v int32
+			err = binary.Read(r, binary.BigEndian, &v)
+			i = int64(v)
+		default:
+			err = binary.Read(r, binary.BigEndian, &i)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return msgpackNumber(i), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := msgpackReadLength(r, c-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadString(r, n)
+	case 0xdc, 0xdd:
+		n, err := msgpackReadLength(r, c-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := msgpackReadLength(r, c-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadMap(r, n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+// msgpackNumber returns integers as float64 like JSON decoding does, unless
+// the value can't be represented exactly.
+func msgpackNumber(i int64) interface{} {
+	if i > 1<<53 || i < -(1<<53) {
+		return int(i)
+	}
+	return float64(i)
+}
+
+// msgpackReadLength reads a 8 (size 0), 16 (size 1) or 32 (size 2) bits
+// length.
+func msgpackReadLength(r *bufio.Reader, size byte) (int, error) {
+	switch size {
+	case 0:
+		b, err := r.ReadByte()
+		return int(b), err
+	case 1:
+		var n uint16
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int(n), err
+	default:
+		var n uint32
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int(n), err
+	}
+}
+
+func msgpackReadBytes(r *bufio.Reader, n int) ([]byte, error) {
+	// Don't trust the announced length to allocate the buffer.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func msgpackReadString(r *bufio.Reader, n int) (interface{}, error) {
+	b, err := msgpackReadBytes(r, n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func msgpackReadArray(r *bufio.Reader, n int, depth int) (interface{}, error) {
+	a := make([]interface{}, 0, msgpackCap(n))
+	for i := 0; i < n; i++ {
+		v, err := msgpackDecode(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func msgpackReadMap(r *bufio.Reader, n int, depth int) (interface{}, error) {
+	m := make(map[string]interface{}, msgpackCap(n))
+	for i := 0; i < n; i++ {
+		k, err := msgpackDecode(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		ks, ok := k.(string)
+		if !ok {
+			return nil, errors.New("msgpack: map key is not a string")
+		}
+		v, err := msgpackDecode(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		m[ks] = v
+	}
+	return m, nil
+}
+
+// msgpackCap returns the capacity to preallocate for n elements, bounded so
+// a malicious length can't trigger a large allocation.
+func msgpackCap(n int) int {
+	if n > 1024 {
+		return 1024
+	}
+	return n
+}
@@ -0,0 +1,156 @@
+package rest_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/rest"
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagePackSerializerRoundTrip(t *testing.T) {
+	s := rest.MessagePackSerializer{}
+	long := string(bytes.Repeat([]byte("a"), 300))
+	doc := map[string]interface{}{
+		"nil":    nil,
+		"true":   true,
+		"false":  false,
+		"small":  1,
+		"neg":    -100,
+		"big":    int64(1) << 60,
+		"float":  1.5,
+		"str":    "foo",
+		"long":   long,
+		"list":   []interface{}{"a", 2, map[string]interface{}{"b": "c"}},
+		"nested": map[string]interface{}{"d": []string{"e"}},
+		"time":   time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	var buf bytes.Buffer
+	if !assert.NoError(t, s.Encode(&buf, doc)) {
+		return
+	}
+	var got map[string]interface{}
+	if !assert.NoError(t, s.Decode(&buf, &got)) {
+		return
+	}
+	assert.Equal(t, map[string]interface{}{
+		"nil":    nil,
+		"true":   true,
+		"false":  false,
+		"small":  1.0,
+		"neg":    -100.0,
+		"big":    1 << 60,
+		"float":  1.5,
+		"str":    "foo",
+		"long":   long,
+		"list":   []interface{}{"a", 2.0, map[string]interface{}{"b": "c"}},
+		"nested": map[string]interface{}{"d": []interface{}{"e"}},
+		"time":   "2018-01-02T03:04:05Z",
+	}, got)
+
+	// Map keys are sorted so documents have a stable encoding.
+	var b1, b2 bytes.Buffer
+	s.Encode(&b1, map[string]interface{}{"a": 1, "b": 2, "c": 3})
+	s.Encode(&b2, map[string]interface{}{"c": 3, "b": 2, "a": 1})
+	assert.Equal(t, b1.Bytes(), b2.Bytes())
+	assert.Equal(t, []byte{0x83, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02, 0xa1, 'c', 0x03}, b1.Bytes())
+
+	// Invalid documents are rejected.
+	assert.Error(t, s.Decode(bytes.NewReader([]byte{0x81, 0x01, 0x01}), &got))
+	assert.Error(t, s.Decode(bytes.NewReader([]byte{0xa3, 'a'}), &got))
+	assert.Error(t, s.Decode(bytes.NewReader([]byte{0x91, 0x01}), &got))
+	assert.Error(t, s.Decode(bytes.NewReader([]byte{0xc1}), &got))
+}
+
+func TestHandlerMessagePack(t *testing.T) {
+	i := resource.NewIndex()
+	s := mem.NewHandler()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":    {Sortable: true, Filterable: true},
+		"name":  {Validator: &schema.String{}},
+		"count": {Validator: &schema.Integer{}},
+		"tags":  {Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{}}}},
+	}}, s, resource.DefaultConf)
+	h, err := rest.NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+	mp := rest.MessagePackSerializer{}
+	doc := map[string]interface{}{
+		"name":  "foo",
+		"count": 42,
+		"tags":  []interface{}{"a", "b"},
+	}
+
+	// Create the same document in msgpack and JSON.
+	var body bytes.Buffer
+	doc["id"] = "1"
+	mp.Encode(&body, doc)
+	r, _ := http.NewRequest("POST", "/foo", &body)
+	r.Header.Set("Content-Type", "application/msgpack")
+	r.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if !assert.Equal(t, 201, w.Code, w.Body.String()) {
+		return
+	}
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	var created map[string]interface{}
+	if assert.NoError(t, mp.Decode(w.Body, &created)) {
+		assert.Equal(t, map[string]interface{}{
+			"id":    "1",
+			"name":  "foo",
+			"count": 42.0,
+			"tags":  []interface{}{"a", "b"},
+		}, created)
+	}
+	mpEtag := w.Header().Get("Etag")
+
+	// Replacing the item with the same document sent as JSON must not change
+	// its Etag. The Etag of the msgpack variant is accepted as a condition.
+	r, _ = http.NewRequest("PUT", "/foo/1", bytes.NewBufferString(`{"name": "foo", "count": 42, "tags": ["a", "b"]}`))
+	r.Header.Set("If-Match", mpEtag)
+	r.Header.Set("Accept", "application/msgpack")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, mpEtag, w.Header().Get("Etag"))
+
+	// Read the item and the list back in msgpack.
+	r, _ = http.NewRequest("GET", "/foo/1", nil)
+	r.Header.Set("Accept", "application/msgpack")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, mpEtag, w.Header().Get("Etag"))
+	var item map[string]interface{}
+	if assert.NoError(t, mp.Decode(w.Body, &item)) {
+		assert.Equal(t, created, item)
+	}
+
+	// The JSON representation has its own Etag.
+	r, _ = http.NewRequest("GET", "/foo/1", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	etag := w.Header().Get("Etag")
+	assert.NotEqual(t, mpEtag, etag)
+
+	r, _ = http.NewRequest("GET", "/foo", nil)
+	r.Header.Set("Accept", "application/json;q=0.5, application/msgpack")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	var list []interface{}
+	if assert.NoError(t, mp.Decode(w.Body, &list)) {
+		created["_etag"] = etag[3 : len(etag)-1]
+		assert.Equal(t, []interface{}{created}, list)
+	}
+}
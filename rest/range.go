@@ -0,0 +1,130 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema/query"
+)
+
+// rawBody is a response body sent as is by the DefaultResponseSender with the
+// application/octet-stream content type.
+type rawBody []byte
+
+// itemRange handles Range requests on the resource's Conf.RangeField. The
+// returned body is the requested range of the field's content, in the form a
+// GET of the item would return it (i.e.: decrypted and marshaled). If the
+// range can't be honored (no or invalid Range header, If-Range mismatch, field
+// not readable by the client or unsupported field type), ok is false and the
+// full item must be returned.
+func itemRange(ctx context.Context, r *http.Request, rsrc *resource.Resource, item *resource.Item, headers http.Header) (status int, body interface{}, ok bool) {
+	field := rsrc.Conf().RangeField
+	if field == "" {
+		return 0, nil, false
+	}
+	if f := rsrc.Validator().GetField(field); f == nil || f.IsHidden(ctx) || !f.IsEnabled(ctx) {
+		return 0, nil, false
+	}
+	payload, err := query.Projection{{Name: field}}.Eval(ctx, item.Payload, restResource{rsrc})
+	if err != nil {
+		return 0, nil, false
+	}
+	var data []byte
+	switch v := payload[field].(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return 0, nil, false
+	}
+	headers.Set("Accept-Ranges", "bytes")
+	rng := r.Header.Get("Range")
+	if rng == "" || !ifRangeMatch(r.Header.Get("If-Range"), item) {
+		return 0, nil, false
+	}
+	size := int64(len(data))
+	start, end, valid, satisfiable := parseRange(rng, size)
+	if !valid {
+		// Invalid or multiple ranges are ignored as permitted by RFC 7233.
+		return 0, nil, false
+	}
+	if !satisfiable {
+		headers.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		status := http.StatusRequestedRangeNotSatisfiable
+		return status, &Error{status, http.StatusText(status), nil}, true
+	}
+	headers.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	return http.StatusPartialContent, rawBody(data[start : end+1]), true
+}
+
+// ifRangeMatch returns true if the If-Range header is empty or matches the
+// item's etag or last modification date. As If-Range requires a strong
+// comparison (RFC 7233 section 3.2), a weak etag never matches.
+func ifRangeMatch(ifRange string, item *resource.Item) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == `"`+item.ETag+`"`
+	}
+	t, err := time.Parse(time.RFC1123, ifRange)
+	return err == nil && item.Updated.Truncate(time.Second).Equal(t)
+}
+
+// parseRange parses a single byte range Range header against a content of the
+// given size. It returns the inclusive start and end offsets of the range.
+func parseRange(rng string, size int64) (start, end int64, valid, satisfiable bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(rng, prefix) {
+		return 0, 0, false, false
+	}
+	spec := strings.TrimSpace(rng[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+	i := strings.IndexByte(spec, '-')
+	if i == -1 {
+		return 0, 0, false, false
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if first == "" {
+		// Suffix range: the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, false
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end, true, true
+}
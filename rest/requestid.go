@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/xid"
+)
+
+// RequestID is a middleware giving each request a correlation id, to trace it
+// across services. The id is read from the X-Request-ID header or from the
+// trace id of a W3C traceparent header, and generated if none is provided. It
+// is stored in the request context, available to hooks thru
+// resource.RequestIDFromContext, echoed in the X-Request-ID response header,
+// logged with the errors and returned in error responses as request_id.
+//
+// The middleware can wrap the Handler or be set in the Middleware of the
+// resources' configuration.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !isValidRequestID(id) {
+			id = traceID(r.Header.Get("traceparent"))
+		}
+		if id == "" {
+			id = xid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(resource.WithRequestID(r.Context(), id)))
+	})
+}
+
+// isValidRequestID returns true if id is a non empty token of at most 128
+// characters safe to echo in headers and logs.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// traceID returns the trace id of a W3C traceparent header value (i.e.:
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01), or an empty string
+// if the value is invalid.
+func traceID(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || !isHex(parts[1]) || strings.Trim(parts[1], "0") == "" {
+		return ""
+	}
+	return parts[1]
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
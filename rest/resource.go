@@ -13,9 +13,32 @@ type restResource struct {
 	*resource.Resource
 }
 
+// scope returns a copy of q with the resource's lookup scope and lookup hook
+// applied, so embedded resources can't reach items outside of the scope of
+// the request. The mode is the operation the query is built for.
+func (r restResource) scope(ctx context.Context, mode resource.Mode, q *query.Query) (*query.Query, error) {
+	scope := lookupScope(ctx, r.Resource)
+	hook := r.Conf().LookupHook
+	if len(scope) == 0 && hook == nil {
+		return q, nil
+	}
+	sq := *q
+	sq.Predicate = append(append(query.Predicate{}, q.Predicate...), scope...)
+	if hook != nil {
+		if err := hook(ctx, mode, &sq); err != nil {
+			return nil, err
+		}
+	}
+	return &sq, nil
+}
+
 // Find implements query.Resource interface.
-func (r restResource) Find(ctx context.Context, query *query.Query) ([]map[string]interface{}, error) {
-	itemList, err := r.Resource.Find(ctx, query)
+func (r restResource) Find(ctx context.Context, q *query.Query) ([]map[string]interface{}, error) {
+	q, err := r.scope(ctx, resource.List, q)
+	if err != nil {
+		return nil, err
+	}
+	itemList, err := r.Resource.Find(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -26,8 +49,30 @@ func (r restResource) Find(ctx context.Context, query *query.Query) ([]map[strin
 	return payloads, nil
 }
 
+// Count implements query.Counter interface.
+func (r restResource) Count(ctx context.Context, q *query.Query) (int, error) {
+	q, err := r.scope(ctx, resource.List, q)
+	if err != nil {
+		return 0, err
+	}
+	// Use an empty window so only the total is computed.
+	itemList, err := r.Resource.FindWithTotal(ctx, &query.Query{
+		Predicate: q.Predicate,
+		Window:    &query.Window{Limit: 0},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return itemList.Total, nil
+}
+
 // MultiGet implements query.Resource interface.
+// Items outside of the lookup scope are returned as not found.
 func (r restResource) MultiGet(ctx context.Context, ids []interface{}) ([]map[string]interface{}, error) {
+	q, err := r.scope(ctx, resource.Read, &query.Query{})
+	if err != nil {
+		return nil, err
+	}
 	items, err := r.Resource.MultiGet(ctx, ids)
 	if err != nil {
 		return nil, err
@@ -35,7 +80,7 @@ func (r restResource) MultiGet(ctx context.Context, ids []interface{}) ([]map[st
 	payloads := make([]map[string]interface{}, 0, len(items))
 	for _, i := range items {
 		var p map[string]interface{}
-		if i != nil {
+		if i != nil && q.Predicate.Match(i.Payload) {
 			p = i.Payload
 		}
 		payloads = append(payloads, p)
@@ -52,13 +52,8 @@ func (p *ResourcePath) Prepend(rsrc *resource.Resource, field string, value inte
 
 func (p *ResourcePath) append(rsrc *resource.Resource, field string, value interface{}, name string) (err error) {
 	if field != "" && value != nil {
-		if f, found := rsrc.Schema().Fields["id"]; found {
-			if f.Validator != nil {
-				value, err = f.Validator.Validate(value)
-				if err != nil {
-					return
-				}
-			}
+		if value, err = decodeID(rsrc, value); err != nil {
+			return
 		}
 	}
 	rp := resourcePathComponentPool.Get().(*ResourcePathComponent)
@@ -70,6 +65,23 @@ func (p *ResourcePath) append(rsrc *resource.Resource, field string, value inter
 	return
 }
 
+// decodeID converts an item id into its typed representation using the
+// resource's IDDecoder, if any, and validates it using the validator of the
+// resource's id field.
+func decodeID(rsrc *resource.Resource, value interface{}) (interface{}, error) {
+	if raw, ok := value.(string); ok && rsrc.Conf().IDDecoder != nil {
+		v, err := rsrc.Conf().IDDecoder(raw)
+		if err != nil {
+			return nil, &Error{400, "Invalid id: " + err.Error(), nil}
+		}
+		value = v
+	}
+	if f, found := rsrc.Schema().Fields["id"]; found && f.Validator != nil {
+		return f.Validator.Validate(value)
+	}
+	return value, nil
+}
+
 func (p *ResourcePath) clear() {
 	for i, rp := range *p {
 		rp.Name = ""
@@ -86,12 +98,19 @@ func (p *ResourcePath) clear() {
 // return either a ErrNotFound or an error returned by on of the intermediate
 // resource.
 func (p ResourcePath) ParentsExist(ctx context.Context) error {
+	_, err := p.parent(ctx)
+	return err
+}
+
+// parent checks the existence of the intermediate parents like ParentsExist
+// and returns the direct parent item of the resource, if any.
+func (p ResourcePath) parent(ctx context.Context) (*resource.Item, error) {
 	// First we check that we have no field conflict on the path (i.e.: two path
 	// components defining the same field with a different value)
 	fields := map[string]interface{}{}
 	for _, rp := range p {
 		if val, found := fields[rp.Field]; found && val != rp.Value {
-			return &Error{404, "Resource Path Conflict", nil}
+			return nil, &Error{404, "Resource Path Conflict", nil}
 		}
 		fields[rp.Field] = rp.Value
 	}
@@ -99,10 +118,11 @@ func (p ResourcePath) ParentsExist(ctx context.Context) error {
 	// Check parents existence
 	parents := len(p) - 1
 	if parents <= 0 {
-		return nil
+		return nil, nil
 	}
 	predicate := query.Predicate{}
 	wait := sync.WaitGroup{}
+	var parent *resource.Item
 
 	defer wait.Wait()
 	c := make(chan error, parents)
@@ -110,10 +130,14 @@ func (p ResourcePath) ParentsExist(ctx context.Context) error {
 		if p[i].Value == nil {
 			continue
 		}
-		// Create a query with the parent path fields + the current path id.
+		// Create a query with the parent path fields + the current path id +
+		// the parent's lookup scope if any.
 		q := &query.Query{
-			Predicate: append(predicate[:], &query.Equal{Field: "id", Value: p[i].Value}),
+			Predicate: make(query.Predicate, 0, len(predicate)+1),
 		}
+		q.Predicate = append(q.Predicate, predicate...)
+		q.Predicate = append(q.Predicate, &query.Equal{Field: "id", Value: p[i].Value})
+		q.Predicate = append(q.Predicate, lookupScope(ctx, p[i].Resource)...)
 		// Execute all intermediate checks concurrently
 		wait.Add(1)
 		go func(index int) {
@@ -125,6 +149,9 @@ func (p ResourcePath) ParentsExist(ctx context.Context) error {
 			} else if len(list.Items) == 0 {
 				c <- &Error{404, "Parent Resource Not Found", nil}
 			} else {
+				if index == parents-1 {
+					parent = list.Items[0]
+				}
 				c <- nil
 			}
 		}(i)
@@ -134,10 +161,10 @@ func (p ResourcePath) ParentsExist(ctx context.Context) error {
 	// Fail on first error.
 	for i := 0; i < parents; i++ {
 		if err := <-c; err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return parent, nil
 }
 
 // Path returns the path to the resource to be used with resource.Root.GetResource.
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/rs/rest-layer/resource"
@@ -119,6 +120,30 @@ func TestResourcePathAppend(t *testing.T) {
 
 }
 
+func TestResourcePathAppendIDDecoder(t *testing.T) {
+	index := resource.NewIndex()
+	conf := resource.DefaultConf
+	conf.IDDecoder = func(raw string) (interface{}, error) {
+		return strconv.Atoi(raw)
+	}
+	posts := index.Bind("posts", schema.Schema{
+		Fields: schema.Fields{
+			"id": {
+				Validator: &schema.Integer{},
+			},
+		},
+	}, mem.NewHandler(), conf)
+	p := ResourcePath{}
+	err := p.append(posts, "id", "abc", "posts")
+	assert.EqualError(t, err, `Invalid id: strconv.Atoi: parsing "abc": invalid syntax`)
+	if e, ok := err.(*Error); assert.True(t, ok) {
+		assert.Equal(t, 400, e.Code)
+	}
+	err = p.append(posts, "id", "123", "posts")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": 123}, p.Values())
+}
+
 func TestResourcePathPrepend(t *testing.T) {
 	p := ResourcePath{
 		&ResourcePathComponent{
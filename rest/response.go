@@ -1,15 +1,17 @@
 package rest
 
 import (
+	"bytes"
 	"context"
-	md5 "crypto/md5"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
 )
 
 // ResponseFormatter defines an interface responsible for formatting a the
@@ -35,6 +37,10 @@ type ResponseSender interface {
 // default. This formatter can easily be extended or replaced by implementing
 // ResponseFormatter interface and setting it on Handler.ResponseFormatter.
 type DefaultResponseFormatter struct {
+	// FlattenIssues makes the per field issues of errors to be returned as a
+	// single level map with dotted keys (i.e.: "address.city" or "tags.0")
+	// instead of nested maps.
+	FlattenIssues bool
 }
 
 // DefaultResponseSender provides a base response sender to be used by default.
@@ -43,9 +49,34 @@ type DefaultResponseFormatter struct {
 type DefaultResponseSender struct {
 }
 
-// Send sends headers with the given status and marshal the data in JSON.
+// Send sends headers with the given status and serializes the data using the
+// serializer negotiated for the request (JSON by default). JSON lists of items
+// are streamed one item at a time.
 func (s DefaultResponseSender) Send(ctx context.Context, w http.ResponseWriter, status int, headers http.Header, body interface{}) {
-	headers.Set("Content-Type", "application/json")
+	if raw, ok := body.(rawBody); ok {
+		headers.Set("Content-Type", "application/octet-stream")
+		for key, values := range headers {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.WriteHeader(status)
+		if _, err := w.Write(raw); err != nil {
+			logErrorf(ctx, "Can't send response: %v", err)
+		}
+		return
+	}
+	serializer := responseSerializerFromContext(ctx)
+	list, isList := body.([]map[string]interface{})
+	if _, ok := serializer.(CSVSerializer); ok {
+		if _, hasColumns := csvColumnsFromContext(ctx); isList || hasColumns {
+			setCSVAttachment(ctx, headers)
+		} else {
+			// Only lists are exported as CSV.
+			serializer = serializersFromContext(ctx).json()
+		}
+	}
+	headers.Set("Content-Type", serializer.MediaType())
 	// Apply headers to the response
 	for key, values := range headers {
 		for _, value := range values {
@@ -55,7 +86,20 @@ func (s DefaultResponseSender) Send(ctx context.Context, w http.ResponseWriter,
 	w.WriteHeader(status)
 
 	if body != nil {
-		j, err := json.Marshal(body)
+		if isList {
+			if _, ok := serializer.(JSONSerializer); ok {
+				s.sendList(ctx, w, list)
+				return
+			}
+		}
+		var buf bytes.Buffer
+		var err error
+		if cs, ok := serializer.(CSVSerializer); ok && isList {
+			columns, _ := csvColumnsFromContext(ctx)
+			err = cs.encode(&buf, columns, list)
+		} else {
+			err = serializer.Encode(&buf, body)
+		}
 		if err != nil {
 			w.WriteHeader(500)
 			logErrorf(ctx, "Can't build response: %v", err)
@@ -63,16 +107,43 @@ func (s DefaultResponseSender) Send(ctx context.Context, w http.ResponseWriter,
 			w.Write([]byte(fmt.Sprintf("{\"code\": 500, \"msg\": \"%s\"}", msg)))
 			return
 		}
-		if _, err = w.Write(j); err != nil {
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			logErrorf(ctx, "Can't send response: %v", err)
+		}
+	}
+}
+
+// sendList writes the list as a JSON array, encoding items one at a time
+// directly to the response writer so large lists are never entirely
+// serialized in memory. As the status has already been sent, encoding errors
+// can only be logged and the response is left truncated.
+func (s DefaultResponseSender) sendList(ctx context.Context, w io.Writer, list []map[string]interface{}) {
+	enc := json.NewEncoder(w)
+	if _, err := io.WriteString(w, "["); err != nil {
+		logErrorf(ctx, "Can't send response: %v", err)
+		return
+	}
+	for i, item := range list {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				logErrorf(ctx, "Can't send response: %v", err)
+				return
+			}
+		}
+		if err := enc.Encode(item); err != nil {
 			logErrorf(ctx, "Can't send response: %v", err)
+			return
 		}
 	}
+	if _, err := io.WriteString(w, "]"); err != nil {
+		logErrorf(ctx, "Can't send response: %v", err)
+	}
 }
 
 // FormatItem implements ResponseFormatter.
 func (f DefaultResponseFormatter) FormatItem(ctx context.Context, headers http.Header, i *resource.Item, skipBody bool) (context.Context, interface{}) {
 	if i.ETag != "" {
-		headers.Set("Etag", `W/"`+i.ETag+`"`)
+		headers.Set("Etag", `W/"`+variantEtag(ctx, i.ETag)+`"`)
 	}
 	if !i.Updated.IsZero() {
 		headers.Set("Last-Modified", i.Updated.In(time.UTC).Format("Mon, 02 Jan 2006 15:04:05 GMT"))
@@ -87,41 +158,51 @@ func (f DefaultResponseFormatter) FormatItem(ctx context.Context, headers http.H
 func (f DefaultResponseFormatter) FormatList(ctx context.Context, headers http.Header, l *resource.ItemList, skipBody bool) (context.Context, interface{}) {
 	if l.Total >= 0 {
 		headers.Set("X-Total", strconv.Itoa(l.Total))
+		if l.TotalEstimated {
+			headers.Set("X-Total-Estimated", "true")
+		}
+	}
+	if l.Partial {
+		headers.Set("X-Partial-Result", "true")
 	}
 	if l.Offset > 0 {
 		headers.Set("X-Offset", strconv.Itoa(l.Offset))
 	}
 
-	hash := md5.New()
-	for _, item := range l.Items {
-		if item.ETag != "" {
-			hash.Write([]byte(item.ETag))
-		}
-	}
-	headers.Set("ETag", `W/"`+fmt.Sprintf("%x", hash.Sum(nil))+`"`)
+	headers.Set("ETag", `W/"`+variantEtag(ctx, listEtag(l))+`"`)
+	ctx = contextWithCSVColumns(ctx)
 
 	if !skipBody {
 		payload := make([]map[string]interface{}, len(l.Items))
 		for i, item := range l.Items {
-			// Clone item payload to add the etag to the items in the list.
-			d := map[string]interface{}{}
-			for k, v := range item.Payload {
-				d[k] = v
-			}
-			if item.ETag != "" {
-				d["_etag"] = item.ETag
-			}
-			payload[i] = d
+			payload[i] = itemPayload(item)
 		}
 		return ctx, payload
 	}
 	return ctx, nil
 }
 
+// itemPayload returns a copy of the item payload with the etag of the item
+// added, as rendered in a list.
+func itemPayload(item *resource.Item) map[string]interface{} {
+	d := make(map[string]interface{}, len(item.Payload)+1)
+	for k, v := range item.Payload {
+		d[k] = v
+	}
+	if item.ETag != "" {
+		d["_etag"] = item.ETag
+	}
+	return d
+}
+
 // FormatError implements ResponseFormatter.
 func (f DefaultResponseFormatter) FormatError(ctx context.Context, headers http.Header, err error, skipBody bool) (context.Context, interface{}) {
 	code := 500
 	message := "Server Error"
+	var valid map[string]interface{}
+	if ve, ok := err.(*ValidationError); ok {
+		err, valid = ve.Err, ve.Valid
+	}
 	if err != nil {
 		message = err.Error()
 		if e, ok := err.(*Error); ok {
@@ -138,19 +219,117 @@ func (f DefaultResponseFormatter) FormatError(ctx context.Context, headers http.
 		}
 		if e, ok := err.(*Error); ok {
 			if e.Issues != nil {
-				payload["issues"] = e.Issues
+				if f.FlattenIssues {
+					payload["issues"] = renderIssues(flattenIssues(e.Issues))
+				} else {
+					payload["issues"] = renderIssues(e.Issues)
+				}
 			}
 		}
+		if valid != nil {
+			payload["valid"] = valid
+		}
+		if id := resource.RequestIDFromContext(ctx); id != "" {
+			payload["request_id"] = id
+		}
 		return ctx, payload
 	}
 	return ctx, nil
 }
 
+// flattenIssues flattens nested per field issues into a single level map with
+// dotted keys. The error of an invalid array item is keyed by the zero-based
+// position of the item (i.e.: "tags.0").
+func flattenIssues(issues map[string][]interface{}) map[string][]interface{} {
+	flat := map[string][]interface{}{}
+	for field, errs := range issues {
+		flattenIssueList(flat, field, errs)
+	}
+	return flat
+}
+
+func flattenIssueList(flat map[string][]interface{}, path string, errs []interface{}) {
+	for _, err := range errs {
+		switch t := err.(type) {
+		case schema.ItemError:
+			flattenIssueList(flat, joinIssuePath(path, strconv.Itoa(t.ItemIndex())), []interface{}{t.Unwrap()})
+		case map[string][]interface{}:
+			for field, subErrs := range t {
+				flattenIssueList(flat, joinIssuePath(path, field), subErrs)
+			}
+		case schema.ErrorMap:
+			for field, subErrs := range t {
+				flattenIssueList(flat, joinIssuePath(path, field), subErrs)
+			}
+		case map[string]interface{}:
+			for field, subErr := range t {
+				if subErrs, ok := subErr.([]interface{}); ok {
+					flattenIssueList(flat, joinIssuePath(path, field), subErrs)
+				} else {
+					flattenIssueList(flat, joinIssuePath(path, field), []interface{}{subErr})
+				}
+			}
+		default:
+			flat[path] = append(flat[path], err)
+		}
+	}
+}
+
+// renderIssues returns a copy of issues with schema.DetailedError replaced by
+// their structured details and other schema.StatusError by their message.
+func renderIssues(issues map[string][]interface{}) map[string][]interface{} {
+	rendered := make(map[string][]interface{}, len(issues))
+	for field, errs := range issues {
+		rendered[field] = renderIssueList(errs)
+	}
+	return rendered
+}
+
+func renderIssueList(errs []interface{}) []interface{} {
+	rendered := make([]interface{}, len(errs))
+	for i, err := range errs {
+		rendered[i] = renderIssue(err)
+	}
+	return rendered
+}
+
+func renderIssue(err interface{}) interface{} {
+	switch t := err.(type) {
+	case schema.DetailedError:
+		return t.ErrorDetail()
+	case schema.StatusError:
+		return t.Error()
+	case map[string][]interface{}:
+		return renderIssues(t)
+	case schema.ErrorMap:
+		return schema.ErrorMap(renderIssues(t))
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(t))
+		for field, subErr := range t {
+			rendered[field] = renderIssue(subErr)
+		}
+		return rendered
+	case []interface{}:
+		return renderIssueList(t)
+	}
+	return err
+}
+
+func joinIssuePath(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	if field == "" {
+		return prefix
+	}
+	return prefix + "." + field
+}
+
 // formatResponse routes the type of response on the right ResponseFormater method for
 // internally supported types.
 func formatResponse(ctx context.Context, f ResponseFormatter, w http.ResponseWriter, status int, headers http.Header, resp interface{}, skipBody bool) (context.Context, int, interface{}) {
 	var body interface{}
-	switch resp := resp.(type) {
+	switch resp := convertResponseKeys(ctx, resp).(type) {
 	case *resource.Item:
 		ctx, body = f.FormatItem(ctx, headers, resp, skipBody)
 	case *resource.ItemList:
@@ -160,6 +339,11 @@ func formatResponse(ctx context.Context, f ResponseFormatter, w http.ResponseWri
 			status = resp.Code
 		}
 		ctx, body = f.FormatError(ctx, headers, resp, skipBody)
+	case *ValidationError:
+		if status == 0 {
+			status = resp.Err.Code
+		}
+		ctx, body = f.FormatError(ctx, headers, resp, skipBody)
 	case error:
 		if status == 0 {
 			status = 500
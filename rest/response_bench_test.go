@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return ioutil.Discard.Write(b) }
+func (w discardResponseWriter) WriteHeader(int)             {}
+
+func BenchmarkDefaultResponseSenderSendList(b *testing.B) {
+	list := make([]map[string]interface{}, 1000)
+	for i := range list {
+		list[i] = map[string]interface{}{
+			"id":    fmt.Sprintf("item-%d", i),
+			"_etag": "d41d8cd98f00b204e9800998ecf8427e",
+			"name":  "Lorem ipsum dolor sit amet, consectetur adipiscing elit",
+			"tags":  []interface{}{"foo", "bar", "baz"},
+		}
+	}
+	ctx := context.Background()
+
+	b.Run("Marshal", func(b *testing.B) {
+		// Reference: serialize the whole list in memory before writing it.
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w := discardResponseWriter{header: http.Header{}}
+			j, _ := json.Marshal(list)
+			w.Write(j)
+		}
+	})
+	b.Run("Stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w := discardResponseWriter{header: http.Header{}}
+			DefaultResponseSender{}.Send(ctx, w, 200, http.Header{}, list)
+		}
+	})
+}
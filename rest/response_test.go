@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -152,3 +154,64 @@ func TestDefaultResponseFormatterFormatError(t *testing.T) {
 	assert.Equal(t, rctx, ctx)
 	assert.Equal(t, map[string]interface{}{"code": 123, "message": "test", "issues": map[string][]interface{}{"field": {"error"}}}, payload)
 }
+
+func TestDefaultResponseFormatterFormatErrorFlattenIssues(t *testing.T) {
+	rf := DefaultResponseFormatter{FlattenIssues: true}
+	ctx := context.Background()
+	h := http.Header{}
+	s := schema.Schema{Fields: schema.Fields{
+		"name": {Required: true},
+		"address": {Schema: &schema.Schema{Fields: schema.Fields{
+			"city": {Required: true},
+			"geo": {Schema: &schema.Schema{Fields: schema.Fields{
+				"lat": {Validator: &schema.Float{Boundaries: &schema.Boundaries{Min: -90, Max: 90}}},
+			}}},
+		}}},
+		"tags": {Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{Allowed: []string{"a", "b"}}}}},
+		"matrix": {Validator: &schema.Array{Values: schema.Field{Validator: &schema.Array{
+			Values: schema.Field{Validator: &schema.String{Allowed: []string{"a"}}},
+		}}}},
+		"labels": {Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{MaxLen: 1}}}},
+	}}
+	assert.NoError(t, s.Compile(nil))
+	_, issues := s.Validate(map[string]interface{}{
+		"address": map[string]interface{}{"geo": map[string]interface{}{"lat": 91.0}},
+		"tags":    []interface{}{"a", "c"},
+		"matrix":  []interface{}{[]interface{}{"a"}, []interface{}{"a", "b"}},
+		"labels":  []interface{}{"ab"},
+	}, map[string]interface{}{})
+	err := &Error{422, "Document contains error(s)", issues}
+	notAllowed := func(message string, allowed ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"code": "not_allowed", "message": message, "allowed": allowed}
+	}
+	_, payload := rf.FormatError(ctx, h, err, false)
+	assert.Equal(t, map[string]interface{}{
+		"code":    422,
+		"message": "Document contains error(s)",
+		"issues": map[string][]interface{}{
+			"name":            {"required"},
+			"address.city":    {"required"},
+			"address.geo.lat": {"is greater than 90.00"},
+			"tags.1":          {notAllowed("not one of [a, b]", "a", "b")},
+			"matrix.1.1":      {notAllowed("not one of [a]", "a")},
+			"labels":          {"invalid value at #1: is longer than 1"},
+		},
+	}, payload)
+
+	// Nested form remains the default.
+	_, payload = DefaultResponseFormatter{}.FormatError(ctx, h, err, false)
+	assert.Equal(t, renderIssues(err.Issues), payload.(map[string]interface{})["issues"])
+}
+
+func TestDefaultResponseSenderSendList(t *testing.T) {
+	w := httptest.NewRecorder()
+	list := []map[string]interface{}{{"id": "1", "_etag": "a"}, {"id": "2"}}
+	DefaultResponseSender{}.Send(context.Background(), w, 200, http.Header{"X-Total": []string{"2"}}, list)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Total"))
+	assert.JSONEq(t, `[{"id": "1", "_etag": "a"}, {"id": "2"}]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	DefaultResponseSender{}.Send(context.Background(), w, 200, http.Header{}, []map[string]interface{}{})
+	assert.Equal(t, "[]", w.Body.String())
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 
@@ -31,6 +32,9 @@ type key int
 const (
 	routeKey key = iota
 	indexKey
+	uploadsKey
+	serializersKey
+	responseSerializerKey
 )
 
 var routePool = sync.Pool{
@@ -65,11 +69,16 @@ func IndexFromContext(ctx context.Context) (resource.Index, bool) {
 
 // FindRoute returns the REST route for the given request.
 func FindRoute(index resource.Index, req *http.Request) (*RouteMatch, error) {
+	return findRouteAt(index, req, req.URL.Path)
+}
+
+// findRouteAt returns the REST route for the given request routed on path.
+func findRouteAt(index resource.Index, req *http.Request, path string) (*RouteMatch, error) {
 	route := routePool.Get().(*RouteMatch)
 	route.Method = req.Method
 	route.Params = req.URL.Query()
 
-	err := findRoute(req.URL.Path, index, route)
+	err := findRoute(path, index, route)
 	if err != nil {
 		route.Release()
 		route = nil
@@ -212,6 +221,43 @@ func (r *RouteMatch) Query() (*query.Query, *Error) {
 	return qp.results()
 }
 
+// query builds a query object from the matched route with the resource's
+// lookup scope and lookup hook applied if any. The mode is the operation the
+// query is built for.
+func (r *RouteMatch) query(ctx context.Context, mode resource.Mode) (*query.Query, *Error) {
+	q, e := r.Query()
+	if e != nil {
+		return nil, e
+	}
+	rsrc := r.Resource()
+	q.Predicate = append(q.Predicate, lookupScope(ctx, rsrc)...)
+	if hook := rsrc.Conf().LookupHook; hook != nil {
+		if err := hook(ctx, mode, q); err != nil {
+			return nil, NewError(err)
+		}
+	}
+	return q, nil
+}
+
+// lookupScope returns the predicate enforcing the resource's lookup scope.
+func lookupScope(ctx context.Context, rsrc *resource.Resource) query.Predicate {
+	scoper := rsrc.Conf().LookupScoper
+	if scoper == nil {
+		return nil
+	}
+	scope := scoper(ctx)
+	fields := make([]string, 0, len(scope))
+	for field := range scope {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	p := make(query.Predicate, 0, len(fields))
+	for _, field := range fields {
+		p = append(p, &query.Equal{Field: field, Value: scope[field]})
+	}
+	return p
+}
+
 // Release releases the route so it can be reused.
 func (r *RouteMatch) Release() {
 	r.Params = nil
@@ -244,23 +290,66 @@ func (qp *queryParser) addIssue(field string, err interface{}) {
 
 func (qp *queryParser) parseProjection(params url.Values) {
 	if fields := params.Get("fields"); fields != "" {
-		if p, err := query.ParseProjection(fields); err != nil {
+		p, err := query.ParseProjection(fields)
+		if err != nil {
 			qp.addIssue("fields", err.Error())
-		} else if err := p.Validate(qp.rsc.Validator()); err != nil {
+			return
+		}
+		convertProjectionKeys(p, qp.rsc.Validator(), qp.rsc.Conf().InputKeyCase)
+		if err := p.Validate(qp.rsc.Validator()); err != nil {
 			qp.addIssue("fields", err.Error())
+			return
+		}
+		qp.q.Projection = p
+	}
+	if embed := params.Get("embed"); embed != "" {
+		p := qp.q.Projection
+		for _, name := range strings.Split(embed, ",") {
+			name, _ = convertFieldPath(strings.TrimSpace(name), qp.rsc.Validator(), qp.rsc.Conf().InputKeyCase)
+			p = embedProjectionField(p, name)
+		}
+		if err := p.Validate(qp.rsc.Validator()); err != nil {
+			qp.addIssue("embed", err.Error())
 		} else {
 			qp.q.Projection = p
 		}
 	}
 }
 
+// embedProjectionField returns the projection with the referenced documents
+// of the field embedded with all their fields, unless sub-fields of the field
+// are already selected (i.e.: fields=author.name).
+func embedProjectionField(p query.Projection, name string) query.Projection {
+	all := query.Projection{{Name: "*"}}
+	if len(p) == 0 {
+		// All fields are selected.
+		return query.Projection{{Name: "*"}, {Name: name, Children: all}}
+	}
+	p = append(query.Projection{}, p...)
+	embedded := false
+	for i := range p {
+		if p[i].Name == name && len(p[i].Children) == 0 {
+			p[i].Children = all
+		}
+		embedded = embedded || p[i].Name == name
+	}
+	if !embedded {
+		p = append(p, query.ProjectionField{Name: name, Children: all})
+	}
+	return p
+}
+
 func (qp *queryParser) parsePredicate(params url.Values) {
 	if filters, found := params["filter"]; found {
 		// If several filter parameters are present, merge them using $and
 		for _, filter := range filters {
-			if p, err := query.ParsePredicate(filter); err != nil {
+			p, err := query.ParsePredicate(filter)
+			if err != nil {
 				qp.addIssue("filter", err.Error())
-			} else if err := p.Prepare(qp.rsc.Validator()); err != nil {
+				continue
+			}
+			convertPredicateKeys(p, qp.rsc.Validator(), qp.rsc.Conf().InputKeyCase)
+			if err := p.Prepare(qp.rsc.Validator()); err != nil {
 				qp.addIssue("filter", err.Error())
 			} else {
 				qp.q.Predicate = append(qp.q.Predicate, p...)
@@ -271,13 +360,22 @@ func (qp *queryParser) parsePredicate(params url.Values) {
 
 func (qp *queryParser) parseSort(params url.Values) {
 	if sort := params.Get("sort"); sort != "" {
-		if s, err := query.ParseSort(sort); err != nil {
+		s, err := query.ParseSort(sort)
+		if err != nil {
 			qp.addIssue("sort", err.Error())
-		} else if err := s.Validate(qp.rsc.Validator()); err != nil {
+			return
+		}
+		for i := range s {
+			s[i].Name, _ = convertFieldPath(s[i].Name, qp.rsc.Validator(), qp.rsc.Conf().InputKeyCase)
+		}
+		if err := s.Validate(qp.rsc.Validator()); err != nil {
 			qp.addIssue("sort", err.Error())
 		} else {
 			qp.q.Sort = s
 		}
+	} else if ds := qp.rsc.Conf().DefaultSort; len(ds) > 0 {
+		// Copy the default sort so it can't be altered thru the query.
+		qp.q.Sort = append(query.Sort{}, ds...)
 	}
 }
 
@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Serializer encodes and decodes documents in a given media type. Serializers
+// are registered on a SerializerRegistry so they can be selected by content
+// negotiation.
+type Serializer interface {
+	// MediaType returns the media type handled by the serializer (i.e.:
+	// application/json).
+	MediaType() string
+	// Encode writes the serialized form of v to w.
+	Encode(w io.Writer, v interface{}) error
+	// Decode reads a document from r and stores it in the value pointed to by
+	// v.
+	Decode(r io.Reader, v interface{}) error
+}
+
+// JSONSerializer is the built-in application/json Serializer.
+type JSONSerializer struct {
+	// UseNumber decodes numbers as json.Number instead of float64. It is
+	// automatically enabled for resources with the UseJSONNumber
+	// configuration.
+	UseNumber bool
+}
+
+// MediaType implements Serializer.
+func (s JSONSerializer) MediaType() string {
+	return "application/json"
+}
+
+// Encode implements Serializer.
+func (s JSONSerializer) Encode(w io.Writer, v interface{}) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(j)
+	return err
+}
+
+// Decode implements Serializer.
+func (s JSONSerializer) Decode(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	if s.UseNumber {
+		decoder.UseNumber()
+	}
+	return decoder.Decode(v)
+}
+
+// SerializerRegistry holds the serializers available for request bodies,
+// selected by their Content-Type, and responses, selected by the Accept
+// header of the request. The JSONSerializer is always registered and used
+// when no other serializer matches.
+type SerializerRegistry struct {
+	mu          sync.RWMutex
+	serializers map[string]Serializer
+}
+
+// NewSerializerRegistry returns a registry with the JSONSerializer, the
+// MessagePackSerializer and the CSVSerializer registered.
+func NewSerializerRegistry() *SerializerRegistry {
+	sr := &SerializerRegistry{serializers: map[string]Serializer{}}
+	sr.Register(JSONSerializer{})
+	sr.Register(MessagePackSerializer{})
+	sr.Register(CSVSerializer{})
+	return sr
+}
+
+// Register adds s to the registry, replacing any serializer previously
+// registered for the same media type.
+func (sr *SerializerRegistry) Register(s Serializer) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.serializers[strings.ToLower(s.MediaType())] = s
+}
+
+// Get returns the serializer registered for the given media type. Media types
+// with the +json structured syntax suffix (i.e.: application/vnd.myapi.v2+json)
+// fall back to the application/json serializer.
+func (sr *SerializerRegistry) Get(mediaType string) (Serializer, bool) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	mediaType = strings.ToLower(mediaType)
+	s, found := sr.serializers[mediaType]
+	if !found && strings.HasSuffix(mediaType, "+json") {
+		s, found = sr.serializers["application/json"]
+	}
+	return s, found
+}
+
+// Negotiate returns the serializer best matching the given Accept header
+// value. The JSON serializer is returned if the header is empty or no
+// registered serializer matches.
+func (sr *SerializerRegistry) Negotiate(accept string) Serializer {
+	type weightedType struct {
+		mediaType string
+		q         float64
+	}
+	var wts []weightedType
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mt := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if mt != "" && q > 0 {
+			wts = append(wts, weightedType{mt, q})
+		}
+	}
+	sort.SliceStable(wts, func(i, j int) bool {
+		return wts[i].q > wts[j].q
+	})
+	for _, wt := range wts {
+		if s, found := sr.Get(wt.mediaType); found {
+			return s
+		}
+		if wt.mediaType == "*/*" || wt.mediaType == "application/*" {
+			break
+		}
+	}
+	return sr.json()
+}
+
+// negotiable returns true if several serializers are registered, so the
+// response format depends on the Accept header.
+func (sr *SerializerRegistry) negotiable() bool {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	return len(sr.serializers) > 1
+}
+
+// json returns the serializer registered for application/json.
+func (sr *SerializerRegistry) json() Serializer {
+	if s, found := sr.Get("application/json"); found {
+		return s
+	}
+	return JSONSerializer{}
+}
+
+// defaultSerializers is used by handlers not created with NewHandler.
+var defaultSerializers = NewSerializerRegistry()
+
+func contextWithSerializers(ctx context.Context, sr *SerializerRegistry, response Serializer) context.Context {
+	ctx = context.WithValue(ctx, serializersKey, sr)
+	return context.WithValue(ctx, responseSerializerKey, response)
+}
+
+// serializersFromContext returns the serializer registry of the handler
+// serving the request.
+func serializersFromContext(ctx context.Context) *SerializerRegistry {
+	if sr, ok := ctx.Value(serializersKey).(*SerializerRegistry); ok {
+		return sr
+	}
+	return defaultSerializers
+}
+
+// responseSerializerFromContext returns the serializer negotiated for the
+// response.
+func responseSerializerFromContext(ctx context.Context) Serializer {
+	if s, ok := ctx.Value(responseSerializerKey).(Serializer); ok {
+		return s
+	}
+	return JSONSerializer{}
+}
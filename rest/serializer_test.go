@@ -0,0 +1,126 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/rest"
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// formSerializer is a trivial serializer encoding flat documents of strings
+// as URL encoded forms.
+type formSerializer struct{}
+
+func (formSerializer) MediaType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+func (formSerializer) Encode(w io.Writer, v interface{}) error {
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("not a document")
+	}
+	values := url.Values{}
+	for k, v := range doc {
+		if s, ok := v.(string); ok {
+			values.Set(k, s)
+		}
+	}
+	_, err := io.WriteString(w, values.Encode())
+	return err
+}
+
+func (formSerializer) Decode(r io.Reader, v interface{}) error {
+	doc, ok := v.(*map[string]interface{})
+	if !ok {
+		return errors.New("not a document")
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+	*doc = map[string]interface{}{}
+	for k := range values {
+		(*doc)[k] = values.Get(k)
+	}
+	return nil
+}
+
+func TestSerializerRegistry(t *testing.T) {
+	sr := rest.NewSerializerRegistry()
+	sr.Register(formSerializer{})
+	s, found := sr.Get("application/json")
+	assert.True(t, found)
+	assert.Equal(t, rest.JSONSerializer{}, s)
+	s, found = sr.Get("Application/X-WWW-Form-Urlencoded")
+	assert.True(t, found)
+	assert.Equal(t, formSerializer{}, s)
+	_, found = sr.Get("application/xml")
+	assert.False(t, found)
+
+	assert.Equal(t, rest.JSONSerializer{}, sr.Negotiate(""))
+	assert.Equal(t, rest.JSONSerializer{}, sr.Negotiate("*/*"))
+	assert.Equal(t, rest.JSONSerializer{}, sr.Negotiate("application/xml"))
+	assert.Equal(t, formSerializer{}, sr.Negotiate("application/x-www-form-urlencoded"))
+	assert.Equal(t, formSerializer{}, sr.Negotiate("application/json;q=0.5, application/x-www-form-urlencoded"))
+	assert.Equal(t, rest.JSONSerializer{}, sr.Negotiate("application/json, application/x-www-form-urlencoded;q=0.5"))
+}
+
+func TestHandlerCustomSerializer(t *testing.T) {
+	i := resource.NewIndex()
+	s := mem.NewHandler()
+	i.Bind("foo", schema.Schema{Fields: schema.Fields{
+		"id":  {OnInit: func(ctx context.Context, v interface{}) interface{} { return "1" }},
+		"foo": {},
+	}}, s, resource.DefaultConf)
+	h, err := rest.NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h.Serializers.Register(formSerializer{})
+
+	r, _ := http.NewRequest("POST", "/foo", bytes.NewBufferString(`foo=bar+baz`))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "application/x-www-form-urlencoded", w.Header().Get("Content-Type"))
+	assert.Equal(t, "foo=bar+baz&id=1", w.Body.String())
+
+	// Read back in the custom and the default formats.
+	r, _ = http.NewRequest("GET", "/foo/1", nil)
+	r.Header.Set("Accept", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foo=bar+baz&id=1", w.Body.String())
+	r, _ = http.NewRequest("GET", "/foo/1", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"id": "1", "foo": "bar baz"}`, w.Body.String())
+
+	// Unregistered media types are still rejected.
+	r, _ = http.NewRequest("POST", "/foo", bytes.NewBufferString(`<foo/>`))
+	r.Header.Set("Content-Type", "application/xml")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 501, w.Code)
+}
@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+const (
+	// DefaultMaxFileSize is the maximum size of a single uploaded file used
+	// when Uploads.MaxFileSize is not set.
+	DefaultMaxFileSize = 10 << 20
+	// DefaultMaxUploadSize is the maximum size of a multipart/form-data
+	// request body used when Uploads.MaxUploadSize is not set.
+	DefaultMaxUploadSize = 32 << 20
+)
+
+// File holds a file uploaded thru a multipart/form-data request.
+type File struct {
+	// Field is the name of the form part holding the file. The reference
+	// returned by the FileStore is stored in the document field of the same
+	// name.
+	Field string
+	// Filename is the client provided file name.
+	Filename string
+	// ContentType is the client provided content type of the file.
+	ContentType string
+	// Size is the size of the file in bytes.
+	Size int64
+	// Content is the content of the file.
+	Content io.Reader
+}
+
+// FileStore is an interface to be implemented by a storage able to store
+// files uploaded thru multipart/form-data requests.
+type FileStore interface {
+	// Store persists the uploaded file and returns a reference (i.e.: an id or
+	// an URL) to be stored in the document's field named after the file part.
+	Store(ctx context.Context, f File) (interface{}, error)
+}
+
+// FileStoreFunc converts a function into a FileStore.
+type FileStoreFunc func(ctx context.Context, f File) (interface{}, error)
+
+// Store implements FileStore.
+func (fs FileStoreFunc) Store(ctx context.Context, f File) (interface{}, error) {
+	return fs(ctx, f)
+}
+
+// Uploads configures the handling of multipart/form-data request bodies.
+type Uploads struct {
+	// FileStore stores the file parts of multipart/form-data requests. When
+	// not set, multipart requests are rejected as unsupported.
+	FileStore FileStore
+	// MaxFileSize is the maximum size in bytes of a single file part. If not
+	// set, DefaultMaxFileSize is used.
+	MaxFileSize int64
+	// MaxUploadSize is the maximum size in bytes of the whole request body.
+	// If not set, DefaultMaxUploadSize is used.
+	MaxUploadSize int64
+}
+
+func contextWithUploads(ctx context.Context, u Uploads) context.Context {
+	return context.WithValue(ctx, uploadsKey, u)
+}
+
+func uploadsFromContext(ctx context.Context) (Uploads, bool) {
+	u, ok := ctx.Value(uploadsKey).(Uploads)
+	return u, ok && u.FileStore != nil
+}
+
+// decodeMultipartPayload decodes a multipart/form-data request body. Regular
+// form fields populate the payload as strings, unless the part is sent with an
+// application/json content type in which case its value is decoded as JSON.
+// File parts are handed to the configured FileStore and the returned reference
+// is stored in the payload under the part's name.
+func decodeMultipartPayload(ctx context.Context, r *http.Request, u Uploads, payload *map[string]interface{}) *Error {
+	maxFileSize := u.MaxFileSize
+	if maxFileSize <= 0 {
+		maxFileSize = DefaultMaxFileSize
+	}
+	maxUploadSize := u.MaxUploadSize
+	if maxUploadSize <= 0 {
+		maxUploadSize = DefaultMaxUploadSize
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return malformedBody(err)
+	}
+	defer r.Body.Close()
+	if *payload == nil {
+		*payload = map[string]interface{}{}
+	}
+	var total int64
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return malformedBody(err)
+		}
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+		limit := maxUploadSize - total
+		if part.FileName() != "" && maxFileSize < limit {
+			limit = maxFileSize
+		}
+		var buf bytes.Buffer
+		n, err := io.Copy(&buf, io.LimitReader(part, limit+1))
+		part.Close()
+		if err != nil {
+			return malformedBody(err)
+		}
+		total += n
+		if total > maxUploadSize {
+			return &Error{413, fmt.Sprintf("Request body exceeds maximum size of %d bytes", maxUploadSize), nil}
+		}
+		if n > limit {
+			return &Error{413, fmt.Sprintf("File `%s' exceeds maximum size of %d bytes", name, maxFileSize), nil}
+		}
+		if part.FileName() == "" {
+			if isJSONPart(part) {
+				var v interface{}
+				if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+					return &Error{400, fmt.Sprintf("Malformed body: field `%s': %v", name, err), nil}
+				}
+				(*payload)[name] = v
+			} else {
+				(*payload)[name] = buf.String()
+			}
+			continue
+		}
+		ref, err := u.FileStore.Store(ctx, File{
+			Field:       name,
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Size:        n,
+			Content:     &buf,
+		})
+		if err != nil {
+			return NewError(err)
+		}
+		(*payload)[name] = ref
+	}
+	return nil
+}
+
+func isJSONPart(part *multipart.Part) bool {
+	return mediaType(part.Header.Get("Content-Type")) == "application/json"
+}
@@ -1,14 +1,25 @@
 package rest
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/schema"
+	"github.com/rs/rest-layer/schema/query"
 )
 
 // getMethodHandler returns the method handler for a given HTTP method in item
@@ -35,6 +46,8 @@ func getMethodHandler(isItem bool, method string) methodHandler {
 			return listGet
 		case http.MethodPost:
 			return listPost
+		case http.MethodPatch:
+			return listPatch
 		case http.MethodDelete:
 			return listDelete
 		}
@@ -53,7 +66,7 @@ func isMethodAllowed(isItem bool, method string, conf resource.Conf) bool {
 		case http.MethodPut:
 			return conf.IsModeAllowed(resource.Create) || conf.IsModeAllowed(resource.Replace)
 		case http.MethodPatch:
-			return conf.IsModeAllowed(resource.Update)
+			return conf.IsModeAllowed(resource.Update) || (conf.AllowPatchUpsert && conf.IsModeAllowed(resource.Create))
 		case http.MethodDelete:
 			return conf.IsModeAllowed(resource.Delete)
 		}
@@ -65,8 +78,10 @@ func isMethodAllowed(isItem bool, method string, conf resource.Conf) bool {
 			return conf.IsModeAllowed(resource.List)
 		case http.MethodPost:
 			return conf.IsModeAllowed(resource.Create)
+		case http.MethodPatch:
+			return conf.IsModeAllowed(resource.Update)
 		case http.MethodDelete:
-			return conf.IsModeAllowed(resource.Clear)
+			return conf.IsModeAllowed(resource.Clear) || conf.IsModeAllowed(resource.BulkDelete)
 		}
 	}
 	return false
@@ -86,13 +101,13 @@ func setAllowHeader(headers http.Header, isItem bool, conf resource.Conf) {
 	methods := []string{}
 	if isItem {
 		// Methods are sorted
-		if conf.IsModeAllowed(resource.Update) {
+		if conf.IsModeAllowed(resource.Delete) {
 			methods = append(methods, "DELETE")
 		}
 		if conf.IsModeAllowed(resource.Read) {
 			methods = append(methods, "GET, HEAD")
 		}
-		if conf.IsModeAllowed(resource.Update) {
+		if conf.IsModeAllowed(resource.Update) || (conf.AllowPatchUpsert && conf.IsModeAllowed(resource.Create)) {
 			methods = append(methods, "PATCH")
 			// See http://tools.ietf.org/html/rfc5789#section-3
 			headers.Set("Allow-Patch", "application/json")
@@ -102,12 +117,15 @@ func setAllowHeader(headers http.Header, isItem bool, conf resource.Conf) {
 		}
 	} else {
 		// Methods are sorted
-		if conf.IsModeAllowed(resource.Clear) {
+		if conf.IsModeAllowed(resource.Clear) || conf.IsModeAllowed(resource.BulkDelete) {
 			methods = append(methods, "DELETE")
 		}
 		if conf.IsModeAllowed(resource.List) {
 			methods = append(methods, "GET, HEAD")
 		}
+		if conf.IsModeAllowed(resource.Update) {
+			methods = append(methods, "PATCH")
+		}
 		if conf.IsModeAllowed(resource.Create) {
 			methods = append(methods, "POST")
 		}
@@ -117,6 +135,131 @@ func setAllowHeader(headers http.Header, isItem bool, conf resource.Conf) {
 	}
 }
 
+// setItemAllowHeader builds the Allow header of an item URL from the modes
+// applying to the item in its current state: a PUT or a PATCH replaces or
+// updates an existing item but creates a missing one. Unlike setAllowHeader,
+// the header is set even if no method is allowed.
+func setItemAllowHeader(headers http.Header, conf resource.Conf, exists bool) {
+	methods := []string{}
+	// Methods are sorted
+	if conf.IsModeAllowed(resource.Delete) {
+		methods = append(methods, "DELETE")
+	}
+	if conf.IsModeAllowed(resource.Read) {
+		methods = append(methods, "GET, HEAD")
+	}
+	if (exists && conf.IsModeAllowed(resource.Update)) || (!exists && conf.AllowPatchUpsert && conf.IsModeAllowed(resource.Create)) {
+		methods = append(methods, "PATCH")
+		headers.Set("Allow-Patch", "application/json")
+	}
+	if (exists && conf.IsModeAllowed(resource.Replace)) || (!exists && conf.IsModeAllowed(resource.Create)) {
+		methods = append(methods, "PUT")
+	}
+	headers.Set("Allow", strings.Join(methods, ", "))
+}
+
+// methodNotAllowed returns a copy of the 405 error e detailing, in its issues,
+// why the method is rejected and the methods allowed on the URL as listed by
+// the Allow header.
+func methodNotAllowed(e *Error, method, reason string, headers http.Header) *Error {
+	allowed := []interface{}{}
+	if allow := headers.Get("Allow"); allow != "" {
+		for _, m := range strings.Split(allow, ",") {
+			allowed = append(allowed, strings.TrimSpace(m))
+		}
+	}
+	return &Error{e.Code, e.Message, map[string][]interface{}{
+		"method":          {method + ": " + reason},
+		"allowed_methods": allowed,
+	}}
+}
+
+// isMethodListed returns true if methods is empty or lists the method. HEAD is
+// listed with GET and OPTIONS is always listed.
+func isMethodListed(methods []string, method string) bool {
+	if len(methods) == 0 || method == http.MethodOptions {
+		return true
+	}
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterAllowHeader removes the methods not listed in methods from the Allow
+// header.
+func filterAllowHeader(headers http.Header, methods []string) {
+	allow := headers.Get("Allow")
+	if len(methods) == 0 || allow == "" {
+		return
+	}
+	listed := []string{}
+	for _, m := range strings.Split(allow, ",") {
+		if m = strings.TrimSpace(m); isMethodListed(methods, m) {
+			listed = append(listed, m)
+		}
+	}
+	if !isMethodListed(methods, http.MethodPatch) {
+		headers.Del("Allow-Patch")
+	}
+	if len(listed) == 0 {
+		headers.Del("Allow")
+		return
+	}
+	headers.Set("Allow", strings.Join(listed, ", "))
+}
+
+// applyLookupScope sets the resource's lookup scope values on the base of a
+// document being created or modified. Any change of those fields requested by
+// the client is discarded so the document can't be moved outside of the scope.
+func applyLookupScope(ctx context.Context, rsrc *resource.Resource, changes, base map[string]interface{}) {
+	if scoper := rsrc.Conf().LookupScoper; scoper != nil {
+		for k, v := range scoper(ctx) {
+			base[k] = v
+			delete(changes, k)
+		}
+	}
+}
+
+// setSunset sets the Sunset header (and its Link) of the responses of a
+// resource being retired, as defined by the resource configuration.
+func setSunset(headers http.Header, conf resource.Conf) {
+	if conf.SunsetDate.IsZero() {
+		return
+	}
+	headers.Set("Sunset", conf.SunsetDate.UTC().Format(http.TimeFormat))
+	if conf.SunsetLink != "" {
+		headers.Add("Link", fmt.Sprintf(`<%s>; rel="sunset"`, conf.SunsetLink))
+	}
+}
+
+// setCacheControl sets the Cache-Control header of read responses as defined
+// by the resource's configuration.
+func setCacheControl(headers http.Header, r *http.Request, conf resource.Conf) {
+	cc := conf.CacheControl
+	if cc == nil {
+		return
+	}
+	if cc.RequiresAuth || r.Header.Get("Authorization") != "" {
+		headers.Set("Cache-Control", "private, no-store")
+		return
+	}
+	directives := []string{"private"}
+	if cc.Public {
+		directives[0] = "public"
+	}
+	directives = append(directives, fmt.Sprintf("max-age=%d", int(cc.MaxAge.Seconds())))
+	if cc.StaleWhileRevalidate > 0 {
+		directives = append(directives, fmt.Sprintf("stale-while-revalidate=%d", int(cc.StaleWhileRevalidate.Seconds())))
+	}
+	headers.Set("Cache-Control", strings.Join(directives, ", "))
+}
+
 // compareEtag compares a client provided etag with a base etag. The client
 // provided etag may or may not have quotes while the base etag is never quoted.
 // This loose comparison of etag allows clients not strictly respecting RFC to
@@ -137,19 +280,331 @@ func compareEtag(etag, baseEtag string) bool {
 	return false
 }
 
-// decodePayload decodes the payload from the provided request.
-func decodePayload(r *http.Request, payload *map[string]interface{}) *Error {
-	// Check content-type, if not specified, assume it's JSON and fail later
-	if ct := r.Header.Get("Content-Type"); ct != "" && strings.TrimSpace(strings.SplitN(ct, ";", 2)[0]) != "application/json" {
-		return &Error{501, fmt.Sprintf("Invalid Content-Type header: `%s' not supported", ct), nil}
+// compareRawEtag is like compareEtag but also accepts the etag of any variant
+// of the item (see variantEtag), for conditions on the item itself rather than
+// on one of its representations.
+func compareRawEtag(etag, baseEtag string) bool {
+	if compareEtag(etag, baseEtag) {
+		return true
+	}
+	// Strip the variant suffix: -<8 hex digits>, before the closing quote if
+	// any.
+	quoted := strings.HasSuffix(etag, `"`)
+	raw := strings.TrimSuffix(etag, `"`)
+	i := strings.LastIndexByte(raw, '-')
+	if i == -1 || len(raw)-i != 9 {
+		return false
+	}
+	if _, err := hex.DecodeString(raw[i+1:]); err != nil {
+		return false
+	}
+	raw = raw[:i]
+	if quoted {
+		raw += `"`
+	}
+	return compareEtag(raw, baseEtag)
+}
+
+// listEtag returns the etag of a page of items, computed from the etags of its
+// items so it is stable as long as the items of the page are not changed.
+func listEtag(l *resource.ItemList) string {
+	hash := md5.New()
+	for _, item := range l.Items {
+		if item.ETag != "" {
+			hash.Write([]byte(item.ETag))
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// collectionVersion returns the version token of the rsrc collection for the
+// query of the route (see resource.CollectionVersioner). Unless the route has no
+// lookup and no query-string parameter, the version is qualified with a
+// fingerprint of both, so the token of a page, filter, projection or lookup
+// scope can't validate another one.
+func collectionVersion(ctx context.Context, rsrc *resource.Resource, route *RouteMatch, q *query.Query) (string, error) {
+	version, err := rsrc.CollectionVersion(ctx, q)
+	if err != nil || version == "" {
+		return version, err
+	}
+	params := route.Params.Encode()
+	if len(q.Predicate) == 0 && params == "" {
+		return version, nil
+	}
+	hash := md5.New()
+	hash.Write([]byte(q.Predicate.String()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(params))
+	return fmt.Sprintf("%s-%x", version, hash.Sum(nil)), nil
+}
+
+// mediaType returns the media type of a Content-Type header value without its
+// parameters.
+func mediaType(ct string) string {
+	return strings.TrimSpace(strings.SplitN(ct, ";", 2)[0])
+}
+
+// decodePayload decodes the payload from the provided request using the
+// serializer registered for its Content-Type. If not specified, the payload is
+// assumed to be JSON. Keys are converted to the input convention of the routed
+// resource.
+func decodePayload(ctx context.Context, r *http.Request, payload *map[string]interface{}) *Error {
+	if e := decodeRawPayload(ctx, r, payload); e != nil {
+		return e
+	}
+	in, _ := routeKeyCases(ctx)
+	*payload = convertDocKeys(*payload, routeFields(ctx), in)
+	return nil
+}
+
+func decodeRawPayload(ctx context.Context, r *http.Request, payload *map[string]interface{}) *Error {
+	s := serializersFromContext(ctx).json()
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt := mediaType(ct)
+		if u, ok := uploadsFromContext(ctx); ok && mt == "multipart/form-data" {
+			return decodeMultipartPayload(ctx, r, u, payload)
+		}
+		var found bool
+		if s, found = serializersFromContext(ctx).Get(mt); !found {
+			return &Error{501, fmt.Sprintf("Invalid Content-Type header: `%s' not supported", ct), nil}
+		}
 	}
 	if r.Body == nil {
 		return nil
 	}
-	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
-	if err := decoder.Decode(payload); err != nil {
-		return &Error{400, fmt.Sprintf("Malformed body: %v", err), nil}
+	if err := decodeBody(ctx, s, r.Body, payload); err != nil {
+		return malformedBody(err)
+	}
+	return nil
+}
+
+// decodeBody decodes rd into v using the serializer s. The JSON serializer is
+// configured to decode numbers as json.Number if the routed resource has
+// UseJSONNumber set.
+func decodeBody(ctx context.Context, s Serializer, rd io.Reader, v interface{}) error {
+	if js, ok := s.(JSONSerializer); ok && useJSONNumber(ctx) {
+		js.UseNumber = true
+		s = js
+	}
+	return s.Decode(rd, v)
+}
+
+// bodyTooLargeError is returned when reading a request body limited by
+// limitBody beyond its limit.
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return "http: request body too large"
+}
+
+// maxBytesReader wraps a http.MaxBytesReader to report the limit of the
+// reader when it is exceeded.
+type maxBytesReader struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if err != nil && err != io.EOF && r.read >= r.limit {
+		err = &bodyTooLargeError{r.limit}
+	}
+	return n, err
+}
+
+// limitBody limits the number of bytes read from body to n. Reading beyond
+// the limit returns a *bodyTooLargeError and tells the server to close the
+// connection.
+func limitBody(w http.ResponseWriter, body io.ReadCloser, n int64) io.ReadCloser {
+	return &maxBytesReader{ReadCloser: http.MaxBytesReader(w, body, n), limit: n}
+}
+
+type varyKey struct{}
+
+// contextWithVary returns a copy of ctx recording that the response depends
+// on the given request header, so it is listed in the Vary header of the
+// response (see setVary).
+func contextWithVary(ctx context.Context, header string) context.Context {
+	vary, _ := ctx.Value(varyKey{}).([]string)
+	return context.WithValue(ctx, varyKey{}, append(vary[:len(vary):len(vary)], header))
+}
+
+// setVary adds the request headers recorded in ctx with contextWithVary to the
+// Vary header, unless already listed.
+func setVary(ctx context.Context, headers http.Header) {
+	vary, _ := ctx.Value(varyKey{}).([]string)
+	for _, header := range vary {
+		listed := false
+		for _, v := range headers["Vary"] {
+			for _, h := range strings.Split(v, ",") {
+				if strings.EqualFold(strings.TrimSpace(h), header) {
+					listed = true
+				}
+			}
+		}
+		if !listed {
+			headers.Add("Vary", header)
+		}
+	}
+}
+
+type variantKey struct{}
+
+// contextWithVariant returns a copy of ctx recording a negotiated variant of
+// the response (i.e.: its format or language), mixed into the etags sent to
+// the client (see variantEtag).
+func contextWithVariant(ctx context.Context, variant string) context.Context {
+	variants, _ := ctx.Value(variantKey{}).([]string)
+	return context.WithValue(ctx, variantKey{}, append(variants[:len(variants):len(variants)], variant))
+}
+
+// variantEtag returns the etag identifying the representation of an item or
+// list of the given etag for the variant negotiated in ctx, so caches don't
+// revalidate a variant with the etag of another. The etag is returned as is
+// for the default variant. Writes are conditioned by the raw etag.
+func variantEtag(ctx context.Context, etag string) string {
+	variants, _ := ctx.Value(variantKey{}).([]string)
+	if etag == "" || len(variants) == 0 {
+		return etag
+	}
+	hash := md5.Sum([]byte(strings.Join(variants, "\x00")))
+	return fmt.Sprintf("%s-%x", etag, hash[:4])
+}
+
+// hasLocalizedFields returns true if s or its sub-schemas have
+// schema.Localized fields, which representation depends on the language.
+func hasLocalizedFields(s *schema.Schema) bool {
+	for _, f := range s.Fields {
+		if isLocalizedField(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLocalizedField(f schema.Field) bool {
+	if f.Schema != nil && hasLocalizedFields(f.Schema) {
+		return true
+	}
+	switch v := f.Validator.(type) {
+	case schema.Localized, *schema.Localized:
+		return true
+	case *schema.Object:
+		return v.Schema != nil && hasLocalizedFields(v.Schema)
+	case *schema.Array:
+		return isLocalizedField(v.Values)
+	case *schema.Dict:
+		return isLocalizedField(v.Values)
+	}
+	return false
+}
+
+// malformedBody returns the error to send when the request body can't be read
+// or decoded. Bodies exceeding the Handler's MaxBodySize get a 413 error while
+// empty bodies and invalid JSON documents get distinct 400 errors, the latter
+// including the offset of the error in the body when known.
+func malformedBody(err error) *Error {
+	var mbe *bodyTooLargeError
+	var se *json.SyntaxError
+	var ute *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &mbe):
+		return &Error{413, fmt.Sprintf("Request body exceeds maximum size of %d bytes", mbe.limit), nil}
+	case err == io.EOF:
+		return &Error{400, "Empty body", nil}
+	case errors.As(err, &se):
+		return &Error{400, fmt.Sprintf("Malformed JSON: %v at offset %d", err, se.Offset), nil}
+	case errors.As(err, &ute):
+		return &Error{400, fmt.Sprintf("Malformed JSON: %v at offset %d", err, ute.Offset), nil}
+	case err == io.ErrUnexpectedEOF:
+		return &Error{400, "Malformed JSON: unexpected EOF", nil}
+	}
+	return &Error{400, fmt.Sprintf("Malformed body: %v", err), nil}
+}
+
+// newJSONDecoder returns a JSON decoder reading from rd, configured to decode
+// numbers as json.Number if the routed resource has UseJSONNumber set.
+func newJSONDecoder(ctx context.Context, rd io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(rd)
+	if useJSONNumber(ctx) {
+		decoder.UseNumber()
+	}
+	return decoder
+}
+
+// useJSONNumber returns true if the routed resource has UseJSONNumber set.
+func useJSONNumber(ctx context.Context) bool {
+	if route, ok := RouteFromContext(ctx); ok {
+		if rsrc := route.Resource(); rsrc != nil {
+			return rsrc.Conf().UseJSONNumber
+		}
+	}
+	return false
+}
+
+// decodeBatchPayload decodes the payload from the provided request which may
+// either contain a single document or a JSON array of documents. The batch
+// return value is true when an array was provided.
+func decodeBatchPayload(ctx context.Context, r *http.Request) (payloads []map[string]interface{}, batch bool, e *Error) {
+	if ct := r.Header.Get("Content-Type"); r.Body != nil && (ct == "" || mediaType(ct) == "application/json") {
+		br := bufio.NewReader(r.Body)
+		r.Body = readCloser{br, r.Body}
+		if isJSONArray(br) {
+			defer r.Body.Close()
+			if err := decodeBody(ctx, serializersFromContext(ctx).json(), br, &payloads); err != nil {
+				return nil, true, malformedBody(err)
+			}
+			in, _ := routeKeyCases(ctx)
+			for i, payload := range payloads {
+				payloads[i] = convertDocKeys(payload, routeFields(ctx), in)
+			}
+			return payloads, true, nil
+		}
+	}
+	var payload map[string]interface{}
+	if e = decodePayload(ctx, r, &payload); e != nil {
+		return nil, false, e
+	}
+	return []map[string]interface{}{payload}, false, nil
+}
+
+// isJSONArray returns true if the first non white space character of the
+// reader is the start of a JSON array.
+func isJSONArray(br *bufio.Reader) bool {
+	for i := 1; ; i++ {
+		b, err := br.Peek(i)
+		if err != nil || len(b) < i {
+			return false
+		}
+		switch b[i-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// checkContention ensures writes on an item recently updated concurrently are
+// conditional (see resource.Conf.ContentionCooldown).
+func checkContention(r *http.Request, rsrc *resource.Resource, original *resource.Item) *Error {
+	if original == nil || r.Header.Get("If-Match") != "" || r.Header.Get("If-Unmodified-Since") != "" {
+		return nil
+	}
+	if rsrc.Contended(original.ID) {
+		return ErrPreconditionRequired
 	}
 	return nil
 }
@@ -164,7 +619,7 @@ func checkIntegrityRequest(r *http.Request, original *resource.Item) *Error {
 		if original == nil {
 			return ErrNotFound
 		}
-		if ifMatch != "" && !compareEtag(ifMatch, original.ETag) {
+		if ifMatch != "" && !compareRawEtag(ifMatch, original.ETag) {
 			return ErrPreconditionFailed
 		}
 		if ifUnmod != "" {
@@ -179,8 +634,304 @@ func checkIntegrityRequest(r *http.Request, original *resource.Item) *Error {
 	return nil
 }
 
+// checkFieldsIntegrityRequest checks the If-Match-Fields header, holding a
+// JSON object of fields with their expected current value. Unlike If-Match,
+// only the listed fields must be unchanged, so concurrent changes of other
+// fields of the document do not fail the request. Only the fields the client
+// can read may be listed, and they are compared with their projected value so
+// the header can't be used to guess the value of hidden or encrypted fields.
+func checkFieldsIntegrityRequest(ctx context.Context, r *http.Request, rsrc *resource.Resource, original *resource.Item) *Error {
+	ifMatch := r.Header.Get("If-Match-Fields")
+	if ifMatch == "" {
+		return nil
+	}
+	var expected map[string]interface{}
+	if err := json.Unmarshal([]byte(ifMatch), &expected); err != nil {
+		return &Error{400, "Invalid If-Match-Fields header", nil}
+	}
+	invalid := map[string][]interface{}{}
+	for field := range expected {
+		if def := rsrc.Validator().GetField(field); def == nil || def.IsHidden(ctx) || !def.IsEnabled(ctx) {
+			invalid[field] = []interface{}{"unknown field"}
+		}
+	}
+	if len(invalid) > 0 {
+		return &Error{400, "Invalid If-Match-Fields header", invalid}
+	}
+	if original == nil {
+		return ErrNotFound
+	}
+	current, err := query.Projection(nil).Eval(ctx, original.Payload, restResource{rsrc})
+	if err != nil {
+		return NewError(err)
+	}
+	issues := map[string][]interface{}{}
+	for field, value := range expected {
+		// Compare the JSON representations so numbers and times stored in
+		// their native form are compared with their JSON counterpart.
+		e, err1 := json.Marshal(value)
+		c, err2 := json.Marshal(current[field])
+		if err1 != nil || err2 != nil || !bytes.Equal(e, c) {
+			issues[field] = []interface{}{"has changed"}
+		}
+	}
+	if len(issues) > 0 {
+		return &Error{ErrPreconditionFailed.Code, ErrPreconditionFailed.Message, issues}
+	}
+	return nil
+}
+
 func logErrorf(ctx context.Context, format string, a ...interface{}) {
 	if resource.Logger != nil {
-		resource.Logger(ctx, resource.LogLevelError, fmt.Sprintf(format, a...), nil)
+		var fields map[string]interface{}
+		if id := resource.RequestIDFromContext(ctx); id != "" {
+			fields = map[string]interface{}{"request_id": id}
+		}
+		resource.Logger(ctx, resource.LogLevelError, fmt.Sprintf(format, a...), fields)
+	}
+}
+
+// requestConsistency returns the read consistency requested by the client with
+// the Consistency header. Only the strong consistency can be requested.
+func requestConsistency(r *http.Request) (resource.Consistency, *Error) {
+	switch c := strings.TrimSpace(r.Header.Get("Consistency")); strings.ToLower(c) {
+	case "":
+		return resource.DefaultConsistency, nil
+	case "strong":
+		return resource.StrongConsistency, nil
+	default:
+		return resource.DefaultConsistency, &Error{400, fmt.Sprintf("Invalid Consistency header: `%s' not supported", c), nil}
+	}
+}
+
+// requestLanguages returns the languages requested by the client by order of
+// preference. The lang query-string parameter forces a single language,
+// otherwise languages are taken from the Accept-Language header, ignoring the
+// wildcard.
+func requestLanguages(r *http.Request, route *RouteMatch) []string {
+	if l := route.Params.Get("lang"); l != "" {
+		return []string{l}
+	}
+	al := r.Header.Get("Accept-Language")
+	if al == "" {
+		return nil
+	}
+	type weightedLang struct {
+		lang string
+		q    float64
+	}
+	var wls []weightedLang
+	for _, part := range strings.Split(al, ",") {
+		q := 1.0
+		lang := part
+		if i := strings.IndexByte(part, ';'); i != -1 {
+			lang = part[:i]
+			param := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					continue
+				}
+			}
+		}
+		lang = strings.TrimSpace(lang)
+		if lang == "" || lang == "*" || q <= 0 {
+			continue
+		}
+		wls = append(wls, weightedLang{lang, q})
+	}
+	sort.SliceStable(wls, func(i, j int) bool {
+		return wls[i].q > wls[j].q
+	})
+	langs := make([]string, 0, len(wls))
+	for _, wl := range wls {
+		langs = append(langs, wl.lang)
+	}
+	return langs
+}
+
+// validationMode returns the schema.Mode matching a resource write mode.
+func validationMode(mode resource.Mode) schema.Mode {
+	switch mode {
+	case resource.Create:
+		return schema.Create
+	case resource.Update:
+		return schema.Update
+	case resource.Replace:
+		return schema.Replace
+	}
+	return 0
+}
+
+// preValidate calls the PreValidate function of the resource's schema, if any,
+// on the raw payload of a write request.
+func preValidate(ctx context.Context, rsrc *resource.Resource, payload map[string]interface{}) *Error {
+	fn := rsrc.Schema().PreValidate
+	if fn == nil {
+		return nil
+	}
+	if err := fn(ctx, payload); err != nil {
+		if errs, ok := err.(schema.ErrorMap); ok {
+			return &Error{422, "Document contains error(s)", errs}
+		}
+		return &Error{422, err.Error(), nil}
+	}
+	return nil
+}
+
+// validFields returns, in API format, the fields of an invalid document which
+// passed the validation so the client doesn't lose them (i.e.: to refill a
+// form). They are only returned if the client asked for them with the
+// `Prefer: valid-fields` header or if the resource has EchoValidFields set.
+// Hidden, disabled and encrypted fields are never returned.
+func validFields(ctx context.Context, r *http.Request, rsrc *resource.Resource, doc map[string]interface{}, errs map[string][]interface{}) map[string]interface{} {
+	if !rsrc.Conf().EchoValidFields && !hasPreference(r, "valid-fields") {
+		return nil
+	}
+	valid := map[string]interface{}{}
+	for field, value := range doc {
+		if _, invalid := errs[field]; invalid {
+			continue
+		}
+		if def := rsrc.Validator().GetField(field); def == nil || def.Encrypter != nil {
+			continue
+		}
+		valid[field] = value
+	}
+	// Format the fields as for read requests, skipping hidden and disabled
+	// fields.
+	valid, err := query.Projection(nil).Eval(ctx, valid, restResource{rsrc})
+	if err != nil {
+		return nil
+	}
+	return valid
+}
+
+// validationError returns the body of the 422 error e, with the valid fields
+// of the document if any.
+func validationError(e *Error, valid map[string]interface{}) interface{} {
+	if valid == nil {
+		return e
+	}
+	return &ValidationError{e, valid}
+}
+
+// partialMode returns the schema.Partial flag if the request asks for a
+// partial validation with the `Prefer: validation=partial` header, in which
+// case required fields are not enforced. On resources with a DraftField, the
+// document is flagged as a draft until it is stored with a full validation.
+func partialMode(r *http.Request, rsrc *resource.Resource, changes, base map[string]interface{}) schema.Mode {
+	partial := hasPreference(r, "validation=partial")
+	if f := rsrc.Conf().DraftField; f != "" {
+		base[f] = partial
+		if changes[f] == schema.Tombstone {
+			delete(changes, f)
+		}
+	}
+	if partial {
+		return schema.Partial
+	}
+	return 0
+}
+
+// validationWarningHeaders adds the validation warnings of a successful write
+// (see schema.WarningValidator) to headers as X-Validation-Warning headers,
+// one per warning.
+func validationWarningHeaders(warnings []string, headers http.Header) http.Header {
+	if len(warnings) == 0 {
+		return headers
+	}
+	if headers == nil {
+		headers = http.Header{}
+	}
+	for _, w := range warnings {
+		headers.Add("X-Validation-Warning", w)
+	}
+	return headers
+}
+
+// provenanceHeaders adds the X-Generated-Fields header, listing the fields of
+// a created document not provided by the client in the payload or the URL
+// (i.e.: set by a Default, an OnInit hook or the lookup scope), if requested
+// with the `Prefer: provenance` header.
+func provenanceHeaders(r *http.Request, route *RouteMatch, payload, doc map[string]interface{}, headers http.Header) http.Header {
+	if !hasPreference(r, "provenance") {
+		return headers
+	}
+	values := route.ResourcePath.Values()
+	fields := []string{}
+	for k := range doc {
+		if _, found := payload[k]; found {
+			continue
+		}
+		if _, found := values[k]; found {
+			continue
+		}
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set("X-Generated-Fields", strings.Join(fields, ", "))
+	headers.Add("Preference-Applied", "provenance")
+	return headers
+}
+
+// logAudit sends the fields changed by an update to the resource's
+// AuditLogger, if any.
+func logAudit(ctx context.Context, rsrc *resource.Resource, original *resource.Item, changes, doc map[string]interface{}) {
+	conf := rsrc.Conf()
+	if conf.AuditLogger == nil {
+		return
+	}
+	entry := resource.AuditEntry{
+		Time:     time.Now(),
+		Resource: rsrc.Path(),
+		ID:       original.ID,
+		Changes:  map[string]resource.FieldChange{},
+	}
+	if conf.AuditActor != nil {
+		entry.Actor = conf.AuditActor(ctx)
+	}
+	for k := range changes {
+		if f := rsrc.Validator().GetField(k); f != nil && f.IsHidden(ctx) {
+			continue
+		}
+		before, after := original.Payload[k], doc[k]
+		if reflect.DeepEqual(before, after) {
+			// i.e.: disabled fields keep their stored value.
+			continue
+		}
+		entry.Changes[k] = resource.FieldChange{Before: before, After: after}
+	}
+	if len(entry.Changes) == 0 {
+		return
+	}
+	go conf.AuditLogger.LogAudit(detachedContext{ctx}, entry)
+}
+
+// detachedContext is a context carrying the values of its parent but never
+// cancelled, so it can be used after the request is done.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// acceptedResponse returns the response sent in place of the stored item for
+// resources with asynchronous writes (see resource.Conf.AsyncWrites). The
+// location is the URL of the eventual item, if known.
+func acceptedResponse(location string) (int, http.Header, interface{}) {
+	headers := http.Header{}
+	if location != "" {
+		headers.Set("Content-Location", location)
 	}
+	return http.StatusAccepted, headers, nil
 }
@@ -2,8 +2,10 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -26,7 +28,7 @@ func TestGetMethodHandler(t *testing.T) {
 	assert.NotNil(t, getMethodHandler(false, "GET"))
 	assert.Nil(t, getMethodHandler(false, "PUT"))
 	assert.NotNil(t, getMethodHandler(false, "POST"))
-	assert.Nil(t, getMethodHandler(false, "PATCH"))
+	assert.NotNil(t, getMethodHandler(false, "PATCH"))
 	assert.NotNil(t, getMethodHandler(false, "DELETE"))
 	assert.Nil(t, getMethodHandler(false, "OTHER"))
 }
@@ -61,7 +63,7 @@ func TestIsMethodAllowed(t *testing.T) {
 	assert.True(t, isMethodAllowed(false, "GET", c))
 	assert.True(t, isMethodAllowed(false, "POST", c))
 	assert.False(t, isMethodAllowed(false, "PUT", c))
-	assert.False(t, isMethodAllowed(false, "PATCH", c))
+	assert.True(t, isMethodAllowed(false, "PATCH", c))
 	assert.True(t, isMethodAllowed(false, "DELETE", c))
 	assert.False(t, isMethodAllowed(false, "OTHER", c))
 
@@ -92,7 +94,7 @@ func TestGetAllowedMethodHandler(t *testing.T) {
 	assert.NotNil(t, getAllowedMethodHandler(false, "GET", c))
 	assert.Nil(t, getAllowedMethodHandler(false, "PUT", c))
 	assert.NotNil(t, getAllowedMethodHandler(false, "POST", c))
-	assert.Nil(t, getAllowedMethodHandler(false, "PATCH", c))
+	assert.NotNil(t, getAllowedMethodHandler(false, "PATCH", c))
 	assert.NotNil(t, getAllowedMethodHandler(false, "DELETE", c))
 	assert.Nil(t, getAllowedMethodHandler(false, "OTHER", c))
 
@@ -135,8 +137,8 @@ func TestSetAllowHeader(t *testing.T) {
 	assert.Equal(t, http.Header{"Allow": []string{"GET, HEAD"}}, getAllow(true, resource.ReadOnly))
 
 	assert.Equal(t, http.Header{}, getAllow(false, nil))
-	assert.Equal(t, http.Header{"Allow": []string{"DELETE, GET, HEAD, POST"}}, getAllow(false, resource.ReadWrite))
-	assert.Equal(t, http.Header{"Allow": []string{"DELETE, POST"}}, getAllow(false, resource.WriteOnly))
+	assert.Equal(t, http.Header{"Allow": []string{"DELETE, GET, HEAD, PATCH, POST"}}, getAllow(false, resource.ReadWrite))
+	assert.Equal(t, http.Header{"Allow": []string{"DELETE, PATCH, POST"}}, getAllow(false, resource.WriteOnly))
 	assert.Equal(t, http.Header{"Allow": []string{"GET, HEAD"}}, getAllow(false, resource.ReadOnly))
 }
 
@@ -154,7 +156,7 @@ func TestRequestDecodePayload(t *testing.T) {
 		Body: ioutil.NopCloser(bytes.NewBufferString("{\"foo\":\"bar\"}")),
 	}
 	var p map[string]interface{}
-	err := decodePayload(r, &p)
+	err := decodePayload(context.Background(), r, &p)
 	assert.Nil(t, err)
 	assert.Equal(t, map[string]interface{}{"foo": "bar"}, p)
 }
@@ -165,14 +167,14 @@ func TestRequestDecodePayloadContentType(t *testing.T) {
 		Body:   ioutil.NopCloser(bytes.NewBufferString("{\"foo\":\"bar\"}")),
 	}
 	var p map[string]interface{}
-	err := decodePayload(r, &p)
+	err := decodePayload(context.Background(), r, &p)
 	assert.Nil(t, err)
 	assert.Equal(t, map[string]interface{}{"foo": "bar"}, p)
 	r = &http.Request{
 		Header: map[string][]string{"Content-Type": {"application/json; charset=utf8"}},
 		Body:   ioutil.NopCloser(bytes.NewBufferString("{\"foo\":\"bar\"}")),
 	}
-	err = decodePayload(r, &p)
+	err = decodePayload(context.Background(), r, &p)
 	assert.Nil(t, err)
 	assert.Equal(t, map[string]interface{}{"foo": "bar"}, p)
 }
@@ -183,7 +185,7 @@ func TestRequestDecodePayloadWrongContentType(t *testing.T) {
 		Body:   ioutil.NopCloser(bytes.NewBufferString("{\"foo\":\"bar\"}")),
 	}
 	var p map[string]interface{}
-	err := decodePayload(r, &p)
+	err := decodePayload(context.Background(), r, &p)
 	assert.Equal(t, &Error{501, "Invalid Content-Type header: `text/plain' not supported", nil}, err)
 }
 
@@ -192,8 +194,36 @@ func TestRequestDecodePayloadInvalidJSON(t *testing.T) {
 		Body: ioutil.NopCloser(bytes.NewBufferString("{\"foo\":\"")),
 	}
 	var p map[string]interface{}
-	err := decodePayload(r, &p)
-	assert.Equal(t, &Error{400, "Malformed body: unexpected EOF", nil}, err)
+	err := decodePayload(context.Background(), r, &p)
+	assert.Equal(t, &Error{400, "Malformed JSON: unexpected EOF", nil}, err)
+}
+
+func TestRequestDecodePayloadSyntaxError(t *testing.T) {
+	r := &http.Request{
+		Body: ioutil.NopCloser(bytes.NewBufferString(`{"foo": bar}`)),
+	}
+	var p map[string]interface{}
+	err := decodePayload(context.Background(), r, &p)
+	assert.Equal(t, &Error{400, "Malformed JSON: invalid character 'b' looking for beginning of value at offset 9", nil}, err)
+}
+
+func TestRequestDecodePayloadEmpty(t *testing.T) {
+	r := &http.Request{
+		Body: ioutil.NopCloser(bytes.NewBufferString("")),
+	}
+	var p map[string]interface{}
+	err := decodePayload(context.Background(), r, &p)
+	assert.Equal(t, &Error{400, "Empty body", nil}, err)
+}
+
+func TestRequestDecodePayloadTooLarge(t *testing.T) {
+	r := &http.Request{
+		Body: ioutil.NopCloser(bytes.NewBufferString(`{"foo":"bar"}`)),
+	}
+	r.Body = limitBody(httptest.NewRecorder(), r.Body, 5)
+	var p map[string]interface{}
+	err := decodePayload(context.Background(), r, &p)
+	assert.Equal(t, &Error{413, "Request body exceeds maximum size of 5 bytes", nil}, err)
 }
 
 func TestRequestCheckIntegrityRequestBadDate(t *testing.T) {
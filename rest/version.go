@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rs/rest-layer/resource"
+)
+
+// requestVersion returns the API version selected by the request, if any, and
+// the path to route. The version is either given as the first component of the
+// path (i.e.: /v2/users), in which case it is removed from the returned path,
+// or as the last dot separated part of a vendor media type in the Accept
+// header (i.e.: application/vnd.myapi.v2+json). A path component is only
+// considered as a version if it doesn't name a resource and a version of this
+// name is registered (see resource.Resource.AddVersion).
+func requestVersion(index resource.Index, r *http.Request) (version, path string) {
+	path = r.URL.Path
+	if name, remaining := nextPathComponent(path); name != "" {
+		if _, found := index.GetResource(name, nil); !found && hasVersion(index.GetResources(), name) {
+			return name, remaining
+		}
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt := strings.ToLower(mediaType(part))
+		if !strings.HasPrefix(mt, "application/vnd.") || !strings.HasSuffix(mt, "+json") {
+			continue
+		}
+		vnd := strings.TrimSuffix(mt, "+json")
+		if i := strings.LastIndexByte(vnd, '.'); i > len("application/vnd.") {
+			return vnd[i+1:], path
+		}
+	}
+	return "", path
+}
+
+// hasVersion returns true if one of the resources or their sub-resources has
+// the given version.
+func hasVersion(rsrcs []*resource.Resource, version string) bool {
+	for _, rsrc := range rsrcs {
+		if _, found := rsrc.GetVersion(version); found {
+			return true
+		}
+		if hasVersion(rsrc.GetResources(), version) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVersions returns true if one of the resources of the path has versions,
+// in which case the response depends on the Accept header.
+func (p ResourcePath) hasVersions() bool {
+	for _, rp := range p {
+		if len(rp.Resource.Versions()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// useVersion replaces the resources of the path with their given version.
+// Resources without this version are left untouched.
+func (p ResourcePath) useVersion(version string) {
+	for _, rp := range p {
+		if vr, found := rp.Resource.GetVersion(version); found {
+			rp.Resource = vr
+		}
+	}
+}
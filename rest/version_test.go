@@ -0,0 +1,88 @@
+package rest_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/rest-layer/resource"
+	"github.com/rs/rest-layer/resource/testing/mem"
+	"github.com/rs/rest-layer/rest"
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerVersions(t *testing.T) {
+	i := resource.NewIndex()
+	users := i.Bind("users", schema.Schema{Fields: schema.Fields{
+		"id":   {},
+		"name": {Required: true, Filterable: true, Validator: &schema.String{}},
+	}}, mem.NewHandler(), resource.DefaultConf)
+	users.AddVersion("v2", schema.Schema{Fields: schema.Fields{
+		"id":        {},
+		"full_name": {Required: true, Filterable: true, Validator: &schema.String{}},
+		"email":     {Validator: &schema.String{}},
+	}}, map[string]string{"full_name": "name"})
+	h, err := rest.NewHandler(i)
+	if !assert.NoError(t, err) {
+		return
+	}
+	serve := func(method, url, accept, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+			r.Header.Set("Content-Type", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	const v2 = "application/vnd.myapi.v2+json"
+
+	// Post under v1, read under v2.
+	w := serve("POST", "/users", "", `{"id": "1", "name": "John"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	w = serve("GET", "/users/1", v2, "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "1", "full_name": "John"}`, w.Body.String())
+	assert.Equal(t, []string{"Accept"}, w.Header()["Vary"])
+	w = serve("GET", "/users/1", "", "")
+	assert.Equal(t, []string{"Accept"}, w.Header()["Vary"])
+	w = serve("GET", "/v2/users/1", "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "1", "full_name": "John"}`, w.Body.String())
+
+	// Post under v2, read under v1.
+	w = serve("POST", "/v2/users", "", `{"id": "2", "full_name": "Jane", "email": "jane@example.com"}`)
+	assert.Equal(t, 201, w.Code, w.Body.String())
+	assert.Equal(t, "/v2/users/2", w.Header().Get("Content-Location"))
+	w = serve("POST", "/users", v2, `{"id": "3", "name": "Jim"}`)
+	assert.Equal(t, 422, w.Code)
+	assert.JSONEq(t, `{"code": 422, "message": "Document contains error(s)", "issues": {"full_name": ["required"], "name": ["invalid field"]}}`, w.Body.String())
+	w = serve("GET", "/users/2", "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "2", "name": "Jane"}`, w.Body.String())
+
+	// Fields hidden from a version are preserved when it updates the item.
+	w = serve("PATCH", "/users/2", "", `{"name": "Janet"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = serve("GET", "/users/2", v2, "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "2", "full_name": "Janet", "email": "jane@example.com"}`, w.Body.String())
+
+	// Filters use the fields of the version.
+	w = serve("GET", `/v2/users?filter={"full_name":"John"}`, "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"full_name":"John"`)
+	assert.NotContains(t, w.Body.String(), `"id":"2"`)
+	w = serve("GET", `/users?filter={"full_name":"John"}`, "", "")
+	assert.Equal(t, 422, w.Code)
+
+	// Unknown versions use the resource's schema.
+	w = serve("GET", "/users/1", "application/vnd.myapi.v3+json", "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "1", "name": "John"}`, w.Body.String())
+	w = serve("GET", "/v3/users/1", "", "")
+	assert.Equal(t, 404, w.Code)
+}
@@ -3,6 +3,7 @@ package schema
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
 )
 
@@ -14,6 +15,13 @@ type Array struct {
 	MinLen int
 	// MaxLen defines the maximum array length (default no limit).
 	MaxLen int
+	// Unique rejects arrays containing duplicate values. Values are compared
+	// once validated, numbers of different types being equal if they have the
+	// same value (i.e.: 1 and 1.0).
+	Unique bool
+	// Dedupe removes the duplicate values, compared as with Unique, instead of
+	// rejecting the array. The first occurrence of each value is kept.
+	Dedupe bool
 }
 
 // Compile implements the ReferenceCompiler interface.
@@ -21,6 +29,41 @@ func (v *Array) Compile(rc ReferenceChecker) (err error) {
 	return v.Values.Compile(rc)
 }
 
+// applyMaxArrayLen sets the MaxLen of the *Array validators of the field and
+// its sub-fields not defining one (see Schema.MaxArrayLen).
+func applyMaxArrayLen(f Field, max int) {
+	if f.Schema != nil && f.Schema.MaxArrayLen == 0 {
+		for _, def := range f.Schema.Fields {
+			applyMaxArrayLen(def, max)
+		}
+	}
+	applyValidatorMaxArrayLen(f.Validator, max)
+}
+
+func applyValidatorMaxArrayLen(v FieldValidator, max int) {
+	switch t := v.(type) {
+	case *Array:
+		if t.MaxLen == 0 {
+			t.MaxLen = max
+		}
+		applyMaxArrayLen(t.Values, max)
+	case *Dict:
+		applyMaxArrayLen(t.Values, max)
+	case *Object:
+		if t.Schema != nil {
+			applyMaxArrayLen(Field{Schema: t.Schema}, max)
+		}
+	case AnyOf:
+		for _, v := range t {
+			applyValidatorMaxArrayLen(v, max)
+		}
+	case AllOf:
+		for _, v := range t {
+			applyValidatorMaxArrayLen(v, max)
+		}
+	}
+}
+
 func (v Array) validateValues(values []interface{}, query bool) ([]interface{}, error) {
 	if v.Values.Validator == nil {
 		return values, nil
@@ -35,7 +78,9 @@ func (v Array) validateValues(values []interface{}, query bool) ([]interface{},
 
 	for i, val := range values {
 		val, err := vFunc(val)
-		if err != nil {
+		if de, ok := err.(DetailedError); ok {
+			return nil, arrayItemError{index: i + 1, err: de}
+		} else if err != nil {
 			return nil, fmt.Errorf("invalid value at #%d: %s", i+1, err)
 		}
 		values[i] = val
@@ -78,9 +123,43 @@ func (v Array) Validate(value interface{}) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	if v.Unique || v.Dedupe {
+		unique := dedupe(arr)
+		if len(unique) < len(arr) {
+			if !v.Dedupe {
+				return nil, errors.New("contains duplicate values")
+			}
+			if len(unique) < v.MinLen {
+				return nil, fmt.Errorf("has fewer items than %d", v.MinLen)
+			}
+			arr = unique
+		}
+	}
 	return arr, nil
 }
 
+// dedupe returns the values with the duplicates removed, keeping the first
+// occurrence of each value.
+func dedupe(values []interface{}) []interface{} {
+	unique := make([]interface{}, 0, len(values))
+	normalized := make([]interface{}, 0, len(values))
+	for _, val := range values {
+		n := normalizeNumbers(val)
+		dup := false
+		for _, other := range normalized {
+			if reflect.DeepEqual(n, other) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			unique = append(unique, val)
+			normalized = append(normalized, n)
+		}
+	}
+	return unique
+}
+
 // GetField implements the FieldGetter interface. It will return
 // a Field if name corespond to a legal array index according to
 // parameters set on v.
@@ -92,3 +171,44 @@ func (v Array) GetField(name string) *Field {
 	}
 	return &v.Values
 }
+
+// ItemError is implemented by the detailed errors an Array reports for one of
+// its items, so the invalid item can be located.
+type ItemError interface {
+	DetailedError
+	// ItemIndex returns the zero-based position of the invalid item.
+	ItemIndex() int
+	// Unwrap returns the detailed error of the item.
+	Unwrap() error
+}
+
+// arrayItemError reports the detailed error of an array item along with its
+// position.
+type arrayItemError struct {
+	index int
+	err   DetailedError
+}
+
+func (err arrayItemError) Error() string {
+	return fmt.Sprintf("invalid value at #%d: %s", err.index, err.err)
+}
+
+func (err arrayItemError) Unwrap() error {
+	return err.err
+}
+
+// ItemIndex implements ItemError.
+func (err arrayItemError) ItemIndex() int {
+	return err.index - 1
+}
+
+// ErrorDetail implements DetailedError.
+func (err arrayItemError) ErrorDetail() map[string]interface{} {
+	detail := map[string]interface{}{}
+	for k, v := range err.err.ErrorDetail() {
+		detail[k] = v
+	}
+	detail["message"] = err.Error()
+	detail["index"] = err.index
+	return detail
+}
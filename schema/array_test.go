@@ -89,6 +89,48 @@ func TestArrayValidator(t *testing.T) {
 			Input:     []interface{}{true, false},
 			Error:     "has more items than 1",
 		},
+		{
+			Name:      `Unique=true,Validate([]interface{}{"a","b"})`,
+			Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{}}, Unique: true},
+			Input:     []interface{}{"a", "b"},
+			Expect:    []interface{}{"a", "b"},
+		},
+		{
+			Name:      `Unique=true,Validate([]interface{}{"a","b","a"})`,
+			Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{}}, Unique: true},
+			Input:     []interface{}{"a", "b", "a"},
+			Error:     "contains duplicate values",
+		},
+		{
+			Name:      `Unique=true,Validate([]interface{}{1,1.0})`,
+			Validator: &schema.Array{Unique: true},
+			Input:     []interface{}{1, 1.0},
+			Error:     "contains duplicate values",
+		},
+		{
+			Name:      `Unique=true,Validate([]interface{}{map{"a":1},map{"a":2}})`,
+			Validator: &schema.Array{Unique: true},
+			Input:     []interface{}{map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}},
+			Expect:    []interface{}{map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}},
+		},
+		{
+			Name:      `Dedupe=true,Validate([]interface{}{"b","a","b","a"})`,
+			Validator: &schema.Array{Values: schema.Field{Validator: &schema.String{}}, Dedupe: true},
+			Input:     []interface{}{"b", "a", "b", "a"},
+			Expect:    []interface{}{"b", "a"},
+		},
+		{
+			Name:      `Dedupe=true,Validate([]interface{}{2,int64(2),2.0,3})`,
+			Validator: &schema.Array{Dedupe: true},
+			Input:     []interface{}{2, int64(2), 2.0, 3},
+			Expect:    []interface{}{2, 3},
+		},
+		{
+			Name:      `Dedupe=true,MinLen=2,Validate([]interface{}{true,true})`,
+			Validator: &schema.Array{Values: schema.Field{Validator: &schema.Bool{}}, Dedupe: true, MinLen: 2},
+			Input:     []interface{}{true, true},
+			Error:     "has fewer items than 2",
+		},
 	}
 	for i := range testCases {
 		testCases[i].Run(t)
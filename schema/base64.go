@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Base64 validates small binary blobs sent as standard base64 encoded strings.
+// Values are stored as their canonical base64 string, or as the decoded bytes
+// if Raw is set.
+type Base64 struct {
+	// MaxLen is the maximum number of decoded bytes, if not zero.
+	MaxLen int
+	// Types restricts the content to the listed MIME types (i.e.: image/png,
+	// image/jpeg) as detected from its magic bytes by http.DetectContentType.
+	Types []string
+	// Raw stores the decoded bytes instead of the base64 string.
+	Raw bool
+}
+
+// Validate implements FieldValidator.
+func (v Base64) Validate(value interface{}) (interface{}, error) {
+	var b []byte
+	switch t := value.(type) {
+	case string:
+		var err error
+		if b, err = base64.StdEncoding.DecodeString(t); err != nil {
+			return nil, errors.New("not valid base64")
+		}
+		// Reject non canonical encodings (i.e.: with line breaks).
+		if base64.StdEncoding.EncodeToString(b) != t {
+			return nil, errors.New("not valid base64")
+		}
+	case []byte:
+		b = t
+	default:
+		return nil, errors.New("not valid base64")
+	}
+	if v.MaxLen > 0 && len(b) > v.MaxLen {
+		return nil, fmt.Errorf("is longer than %d bytes", v.MaxLen)
+	}
+	if len(v.Types) > 0 {
+		ct := http.DetectContentType(b)
+		allowed := false
+		for _, t := range v.Types {
+			if t == ct {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("content type %s not allowed", ct)
+		}
+	}
+	if v.Raw {
+		return b, nil
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBase64Validator(t *testing.T) {
+	v, err := Base64{}.Validate("Zm9vYmFy")
+	assert.NoError(t, err)
+	assert.Equal(t, "Zm9vYmFy", v)
+	v, err = Base64{}.Validate("")
+	assert.NoError(t, err)
+	assert.Equal(t, "", v)
+	v, err = Base64{Raw: true}.Validate("Zm9vYmFy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foobar"), v)
+	// Raw stored values are validated again on update.
+	v, err = Base64{Raw: true}.Validate([]byte("foobar"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foobar"), v)
+	v, err = Base64{}.Validate([]byte("foobar"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Zm9vYmFy", v)
+
+	for _, input := range []interface{}{"Zm9vYmFy!", "Zm9vYmE", "Zm9v\nYmFy", "Zm9=", "Zm9vYg", 42, nil} {
+		v, err := Base64{}.Validate(input)
+		assert.EqualError(t, err, "not valid base64", "%v", input)
+		assert.Nil(t, v)
+	}
+}
+
+func TestBase64ValidatorMaxLen(t *testing.T) {
+	_, err := Base64{MaxLen: 6}.Validate("Zm9vYmFy")
+	assert.NoError(t, err)
+	_, err = Base64{MaxLen: 5}.Validate("Zm9vYmFy")
+	assert.EqualError(t, err, "is longer than 5 bytes")
+}
+
+func TestBase64ValidatorTypes(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+	jpeg := base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0\x00\x10JFIF"))
+	v := Base64{Types: []string{"image/png", "image/jpeg"}}
+	_, err := v.Validate(png)
+	assert.NoError(t, err)
+	_, err = v.Validate(jpeg)
+	assert.NoError(t, err)
+	_, err = v.Validate("Zm9vYmFy")
+	assert.EqualError(t, err, "content type text/plain; charset=utf-8 not allowed")
+}
@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColorValidator(t *testing.T) {
+	for input, expect := range map[string]string{
+		"#FF8800": "#ff8800",
+		"#f80":    "#f80",
+		" #AbC ":  "#abc",
+	} {
+		v, err := Color{}.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, v, input)
+	}
+	for _, input := range []string{"", "#", "ff8800", "#ff88", "#ff880", "#ff8800f", "#gg8800", "#ff8800aa", "#f80a", "red"} {
+		v, err := Color{}.Validate(input)
+		assert.EqualError(t, err, "not a valid color", input)
+		assert.Nil(t, v)
+	}
+	_, err := Color{}.Validate(0xff8800)
+	assert.EqualError(t, err, "not a string")
+}
+
+func TestColorValidatorExpandShorthand(t *testing.T) {
+	v := Color{ExpandShorthand: true, AllowAlpha: true}
+	for input, expect := range map[string]string{
+		"#F80":      "#ff8800",
+		"#f80c":     "#ff8800cc",
+		"#FF8800":   "#ff8800",
+		"#ff8800CC": "#ff8800cc",
+	} {
+		c, err := v.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, c, input)
+	}
+}
+
+func TestColorValidatorAlpha(t *testing.T) {
+	v := Color{AllowAlpha: true}
+	for input, expect := range map[string]string{
+		"#FF880080": "#ff880080",
+		"#f808":     "#f808",
+		"#ff8800":   "#ff8800",
+	} {
+		c, err := v.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, c, input)
+	}
+	for _, input := range []string{"#ff88008", "#ff88008000", "#ff8800zz"} {
+		_, err := v.Validate(input)
+		assert.EqualError(t, err, "not a valid color", input)
+	}
+}
+
+func TestColorValidatorNames(t *testing.T) {
+	v := Color{AllowNames: true}
+	for input, expect := range map[string]string{
+		"red":           "#ff0000",
+		"RebeccaPurple": "#663399",
+		"#F80":          "#f80",
+	} {
+		c, err := v.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, c, input)
+	}
+	_, err := v.Validate("reddish")
+	assert.EqualError(t, err, "not a valid color")
+}
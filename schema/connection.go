@@ -14,3 +14,20 @@ func (v *Connection) Validate(value interface{}) (interface{}, error) {
 	// No validation perform at this time.
 	return value, nil
 }
+
+// ConnectionCount is a dummy validator for a read-only field computing the
+// number of items of another resource connected to the document, like the
+// number of posts of a user. The Path and Field properties have the same
+// meaning as for Connection. As the count requires a sub-request per
+// document, the query.Projection only computes it when the field is
+// explicitly requested.
+type ConnectionCount struct {
+	Path  string
+	Field string
+}
+
+// Validate implements the FieldValidator interface.
+func (v *ConnectionCount) Validate(value interface{}) (interface{}, error) {
+	// No validation perform at this time.
+	return value, nil
+}
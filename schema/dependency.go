@@ -13,6 +13,84 @@ func Q() Predicate {
 	panic("schema.Q is deprecated, please use query.MustParsePredicate instead")
 }
 
+// Condition requires some fields to be set on the document when a field has a
+// given value. Conditions are declared on the root schema using When and
+// Require:
+//
+//     schema.Schema{
+//         Fields: schema.Fields{...},
+//         Conditions: []schema.Condition{
+//             schema.When("type", "business").Require("tax_id"),
+//         },
+//     }
+type Condition struct {
+	// Field is the name of the field the condition is tested on. If empty,
+	// the condition matches when any of the Required fields is set (see
+	// AllOrNone).
+	Field string
+	// Values is the list of values matching the condition. The condition
+	// matches if the field is equal to any of the values.
+	Values []interface{}
+	// Required is the list of fields required when the condition matches.
+	Required []string
+}
+
+// When returns a Condition matching documents with field equal to one of the
+// provided values.
+func When(field string, values ...interface{}) Condition {
+	return Condition{Field: field, Values: values}
+}
+
+// AllOrNone returns a Condition requiring all the fields to be set as soon as
+// one of them is set (i.e.: the parts of an address). The missing fields of a
+// partially filled group are reported as "required together".
+func AllOrNone(fields ...string) Condition {
+	return Condition{Required: fields}
+}
+
+// Require returns a copy of the condition with fields added to the list of
+// fields required when the condition matches.
+func (c Condition) Require(fields ...string) Condition {
+	c.Required = append(append([]string{}, c.Required...), fields...)
+	return c
+}
+
+// Match returns true if the condition matches the provided document.
+func (c Condition) Match(doc map[string]interface{}) bool {
+	if c.Field == "" {
+		for _, field := range c.Required {
+			if value, found := doc[field]; found && value != nil {
+				return true
+			}
+		}
+		return false
+	}
+	value, found := doc[c.Field]
+	if !found {
+		return false
+	}
+	for _, v := range c.Values {
+		if isEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile checks the fields referenced by the condition exist in the schema.
+func (c Condition) compile(s Schema) error {
+	fields := c.Required
+	if c.Field != "" {
+		fields = append([]string{c.Field}, fields...)
+	}
+	for _, field := range fields {
+		if _, found := s.Fields[field]; !found {
+			return fmt.Errorf("%s: unknown condition field", field)
+		}
+	}
+	return nil
+}
+
 // compileDependencies recursively compiles all field.Dependency against the
 // validator and report any error.
 func compileDependencies(s Schema, v Validator) error {
@@ -31,7 +109,10 @@ func compileDependencies(s Schema, v Validator) error {
 	return nil
 }
 
-func (s Schema) validateDependencies(changes map[string]interface{}, doc map[string]interface{}, prefix string) (errs map[string][]interface{}) {
+// validateDependencies checks the dependencies of the changed fields and, on
+// the root schema, the conditions of the document. The fields missing from a
+// matching condition are not reported in Partial mode.
+func (s Schema) validateDependencies(changes map[string]interface{}, doc map[string]interface{}, prefix string, mode Mode) (errs map[string][]interface{}) {
 	errs = map[string][]interface{}{}
 	for name, value := range changes {
 		path := prefix + name
@@ -42,10 +123,26 @@ func (s Schema) validateDependencies(changes map[string]interface{}, doc map[str
 			}
 		}
 		if subChanges, ok := value.(map[string]interface{}); ok {
-			if subErrs := s.validateDependencies(subChanges, doc, path+"."); len(subErrs) > 0 {
+			if subErrs := s.validateDependencies(subChanges, doc, path+".", mode); len(subErrs) > 0 {
 				addFieldError(errs, name, subErrs)
 			}
 		}
 	}
+	if prefix == "" && mode&Partial == 0 {
+		for _, c := range s.Conditions {
+			if !c.Match(doc) {
+				continue
+			}
+			msg := "required"
+			if c.Field == "" {
+				msg = "required together"
+			}
+			for _, field := range c.Required {
+				if value, found := doc[field]; !found || value == nil {
+					addFieldError(errs, field, msg)
+				}
+			}
+		}
+	}
 	return errs
 }
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Duration validates durations expressed as Go duration strings (i.e.:
+// "1h30m") or, if Seconds is set, as a number of seconds. Values are
+// normalized to the canonical duration string (i.e.: "1h30m0s").
+type Duration struct {
+	// Min is the shortest duration allowed (inclusive), if not zero.
+	Min time.Duration
+	// Max is the longest duration allowed (inclusive), if not zero.
+	Max time.Duration
+	// Seconds allows the duration to be given as a number of seconds.
+	Seconds bool
+}
+
+// Validate implements FieldValidator.
+func (v Duration) Validate(value interface{}) (interface{}, error) {
+	d, err := v.parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if v.Min != 0 && d < v.Min {
+		return nil, fmt.Errorf("is shorter than %s", v.Min)
+	}
+	if v.Max != 0 && d > v.Max {
+		return nil, fmt.Errorf("is longer than %s", v.Max)
+	}
+	return d.String(), nil
+}
+
+func (v Duration) parse(value interface{}) (time.Duration, error) {
+	if s, ok := value.(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.New("not a valid duration")
+		}
+		return d, nil
+	}
+	if !v.Seconds {
+		return 0, errors.New("not a valid duration")
+	}
+	var secs float64
+	switch t := value.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return 0, errors.New("not a valid duration")
+		}
+		secs = f
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			secs = float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			secs = float64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			secs = rv.Float()
+		default:
+			return 0, errors.New("not a valid duration")
+		}
+	}
+	ns := secs * float64(time.Second)
+	if math.IsNaN(ns) || ns >= math.MaxInt64 || ns < math.MinInt64 {
+		return 0, errors.New("not a valid duration")
+	}
+	return time.Duration(math.Round(ns)), nil
+}
+
+// LessFunc implements the FieldComparator interface comparing the durations
+// rather than their string representation.
+func (v Duration) LessFunc() LessFunc {
+	return v.less
+}
+
+func (v Duration) less(value, other interface{}) bool {
+	d1, err1 := v.parse(value)
+	d2, err2 := v.parse(other)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return d1 < d2
+}
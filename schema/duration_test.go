@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurationValidator(t *testing.T) {
+	for input, expect := range map[string]string{
+		"1h30m":  "1h30m0s",
+		"90m":    "1h30m0s",
+		"1.5s":   "1.5s",
+		"-2m":    "-2m0s",
+		"0":      "0s",
+		"300ms":  "300ms",
+		"1h0m0s": "1h0m0s",
+	} {
+		v, err := Duration{}.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, v, input)
+	}
+	for _, input := range []interface{}{"", "1x", "10", "h", 10, 1.5, true, nil} {
+		v, err := Duration{}.Validate(input)
+		assert.EqualError(t, err, "not a valid duration", "%v", input)
+		assert.Nil(t, v)
+	}
+}
+
+func TestDurationValidatorSeconds(t *testing.T) {
+	for input, expect := range map[interface{}]string{
+		90:                 "1m30s",
+		int64(3600):        "1h0m0s",
+		1.5:                "1.5s",
+		0.001:              "1ms",
+		json.Number("120"): "2m0s",
+		"2h":               "2h0m0s",
+	} {
+		v, err := Duration{Seconds: true}.Validate(input)
+		assert.NoError(t, err, "%v", input)
+		assert.Equal(t, expect, v, "%v", input)
+	}
+	for _, input := range []interface{}{json.Number("x"), 1e20, true} {
+		_, err := Duration{Seconds: true}.Validate(input)
+		assert.EqualError(t, err, "not a valid duration", "%v", input)
+	}
+}
+
+func TestDurationValidatorMinMax(t *testing.T) {
+	v := Duration{Min: time.Second, Max: time.Hour, Seconds: true}
+	_, err := v.Validate("1s")
+	assert.NoError(t, err)
+	_, err = v.Validate(3600)
+	assert.NoError(t, err)
+	_, err = v.Validate("999ms")
+	assert.EqualError(t, err, "is shorter than 1s")
+	_, err = v.Validate("1h0m1s")
+	assert.EqualError(t, err, "is longer than 1h0m0s")
+	_, err = v.Validate(-5)
+	assert.EqualError(t, err, "is shorter than 1s")
+}
+
+func TestDurationLessFunc(t *testing.T) {
+	less := Duration{}.LessFunc()
+	assert.True(t, less("59m0s", "1h0m0s"))
+	assert.False(t, less("1h0m0s", "59m0s"))
+	assert.False(t, less("1h0m0s", "invalid"))
+}
@@ -3,6 +3,7 @@
 package jsonschema_test
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -43,6 +44,71 @@ func TestEncoder(t *testing.T) {
 				}
 			}`,
 		},
+		{
+			name: "UnknownFields=UnknownFieldsAllow",
+			schema: schema.Schema{
+				UnknownFields: schema.UnknownFieldsAllow,
+				Fields: schema.Fields{
+					"name": {Validator: &schema.String{}},
+				},
+			},
+			expect: `{
+				"type": "object",
+				"additionalProperties": true,
+				"properties": {
+					"name": {
+						"type": "string"
+					}
+				}
+			}`,
+		},
+		{
+			name: "UniqueTogether",
+			schema: schema.Schema{
+				Fields: schema.Fields{
+					"a": {Validator: &schema.String{}},
+					"b": {Validator: &schema.String{}},
+				},
+				UniqueTogether: [][]string{{"a", "b"}},
+			},
+			expect: `{
+				"type": "object",
+				"additionalProperties": false,
+				"x-uniqueTogether": [["a", "b"]],
+				"properties": {
+					"a": {
+						"type": "string"
+					},
+					"b": {
+						"type": "string"
+					}
+				}
+			}`,
+		},
+		{
+			name: "Capabilities",
+			schema: schema.Schema{
+				Fields: schema.Fields{
+					"a": {Validator: &schema.String{}, Filterable: true, Sortable: true},
+					"b": {Validator: &schema.String{}, NotProjectable: true},
+				},
+			},
+			expect: `{
+				"type": "object",
+				"additionalProperties": false,
+				"properties": {
+					"a": {
+						"type": "string",
+						"x-filterable": true,
+						"x-sortable": true
+					},
+					"b": {
+						"type": "string",
+						"x-projectable": false
+					}
+				}
+			}`,
+		},
 		// readOnly is a custom extension to JSON Schema, also defined by the Swagger 2.0 Schema Object
 		// specification. See http://swagger.io/specification/#schemaObject.
 		{
@@ -66,6 +132,35 @@ func TestEncoder(t *testing.T) {
 				}
 			}`,
 		},
+		{
+			name: "Hidden=true",
+			schema: schema.Schema{
+				Fields: schema.Fields{
+					"password": {
+						Hidden:    true,
+						Validator: &schema.String{},
+					},
+					"email": {
+						Hidden:       true,
+						HiddenUnless: func(ctx context.Context) bool { return true },
+						Validator:    &schema.String{},
+					},
+				},
+			},
+			expect: `{
+				"type": "object",
+				"additionalProperties": false,
+				"properties": {
+					"password": {
+						"type": "string",
+						"writeOnly": true
+					},
+					"email": {
+						"type": "string"
+					}
+				}
+			}`,
+		},
 		{
 			name: `Validator=String,type(Default)==string`,
 			schema: schema.Schema{
@@ -14,6 +14,9 @@ func (v arrayBuilder) BuildJSONSchema() (map[string]interface{}, error) {
 	if v.MaxLen > 0 {
 		m["maxItems"] = v.MaxLen
 	}
+	if v.Unique && !v.Dedupe {
+		m["uniqueItems"] = true
+	}
 
 	// Retrieve values validator JSON schema.
 	var valuesSchema map[string]interface{}
@@ -58,6 +58,17 @@ func TestArray(t *testing.T) {
 			},
 			customValidate: fieldValidator("a", `{"type": "array", "maxItems": 42}`),
 		},
+		{
+			name: "Unique=true",
+			schema: schema.Schema{
+				Fields: schema.Fields{
+					"a": schema.Field{
+						Validator: &schema.Array{Unique: true},
+					},
+				},
+			},
+			customValidate: fieldValidator("a", `{"type": "array", "uniqueItems": true}`),
+		},
 	}
 	for i := range testCases {
 		testCases[i].Run(t)
@@ -24,8 +24,8 @@ func NewEncoder(w io.Writer) *Encoder {
 // Encode writes the JSON Schema representation of s to the stream, followed by
 // a newline character.
 func (e *Encoder) Encode(s *schema.Schema) error {
-	m := make(map[string]interface{})
-	if err := addSchemaProperties(m, s); err != nil {
+	m, err := Build(s)
+	if err != nil {
 		return err
 	}
 	enc := json.NewEncoder(e.w)
@@ -33,6 +33,16 @@ func (e *Encoder) Encode(s *schema.Schema) error {
 
 }
 
+// Build returns the JSON Schema representation of s as a map, to be embedded
+// in other documents like an OpenAPI specification.
+func Build(s *schema.Schema) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if err := addSchemaProperties(m, s); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // The Builder interface should be implemented by custom schema.FieldValidator
 // implementations to allow JSON Schema serialization.
 type Builder interface {
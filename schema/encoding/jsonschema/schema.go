@@ -21,13 +21,18 @@ func addSchemaProperties(m map[string]interface{}, s *schema.Schema) (err error)
 	if s.Description != "" {
 		m["description"] = s.Description
 	}
-	m["additionalProperties"] = false
+	m["additionalProperties"] = s.UnknownFields != schema.UnknownFieldsReject
 	if s.MinLen > 0 {
 		m["minProperties"] = s.MinLen
 	}
 	if s.MaxLen > 0 {
 		m["maxProperties"] = s.MaxLen
 	}
+	if len(s.UniqueTogether) > 0 {
+		// Not a JSON schema keyword, exposed as an extension for
+		// documentation purpose.
+		m["x-uniqueTogether"] = s.UniqueTogether
+	}
 	if len(s.Fields) > 0 {
 		err = addFields(m, s.Fields)
 	}
@@ -70,9 +75,24 @@ func addFieldProperties(m map[string]interface{}, field schema.Field) {
 	if field.ReadOnly {
 		m["readOnly"] = field.ReadOnly
 	}
+	if field.Hidden && field.HiddenUnless == nil {
+		// Hidden fields are never returned to the clients.
+		m["writeOnly"] = true
+	}
 	if field.Default != nil {
 		m["default"] = field.Default
 	}
+	// Not JSON schema keywords, exposed as extensions for documentation
+	// purpose.
+	if field.Filterable {
+		m["x-filterable"] = true
+	}
+	if field.Sortable {
+		m["x-sortable"] = true
+	}
+	if field.NotProjectable {
+		m["x-projectable"] = false
+	}
 }
 
 // ValidatorBuilder type-casts v to a valid Builder implementation or returns an
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Enum validates enumerated integer values mapped to labels. Both the label
+// and the integer value are accepted as input while only the integer value is
+// stored.
+type Enum struct {
+	// Values maps each label to its integer value.
+	Values map[string]int
+	// SerializeLabels makes the stored integer value to be serialized back to
+	// its label on output.
+	SerializeLabels bool
+}
+
+// ValidateQuery implements schema.FieldQueryValidator interface.
+func (v Enum) ValidateQuery(value interface{}) (interface{}, error) {
+	return v.Validate(value)
+}
+
+// Validate validates and normalizes an enum label or value to its integer
+// value.
+func (v Enum) Validate(value interface{}) (interface{}, error) {
+	// Numbers, including json.Number when UseJSONNumber is set, are compared
+	// as float64.
+	switch t := normalizeNumbers(value).(type) {
+	case string:
+		if i, found := v.Values[t]; found {
+			return i, nil
+		}
+	case float64:
+		// JSON unmarshaling treat all numbers as float64, try to convert it to
+		// int if not fraction.
+		if i, frac := math.Modf(t); frac == 0.0 && v.has(int(i)) {
+			return int(i), nil
+		}
+	}
+	return nil, NotAllowedError{Message: "invalid enum value", Allowed: v.labels()}
+}
+
+// Serialize implements FieldSerializer.
+func (v Enum) Serialize(value interface{}) (interface{}, error) {
+	if !v.SerializeLabels {
+		return value, nil
+	}
+	if i, ok := value.(int); ok {
+		for label, val := range v.Values {
+			if val == i {
+				return label, nil
+			}
+		}
+	}
+	return nil, errors.New("invalid enum value")
+}
+
+// labels returns the sorted labels of the enum.
+func (v Enum) labels() []interface{} {
+	labels := make([]string, 0, len(v.Values))
+	for label := range v.Values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	l := make([]interface{}, len(labels))
+	for i, label := range labels {
+		l[i] = label
+	}
+	return l
+}
+
+func (v Enum) has(i int) bool {
+	for _, val := range v.Values {
+		if val == i {
+			return true
+		}
+	}
+	return false
+}
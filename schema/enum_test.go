@@ -0,0 +1,128 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnumValidator(t *testing.T) {
+	values := map[string]int{"draft": 0, "published": 1}
+	for _, tc := range []fieldValidatorTestCase{
+		{
+			Name:      `Enum.Validate("published")`,
+			Validator: &schema.Enum{Values: values},
+			Input:     "published",
+			Expect:    1,
+		},
+		{
+			Name:      `Enum.Validate(float64(1))`,
+			Validator: &schema.Enum{Values: values},
+			Input:     float64(1),
+			Expect:    1,
+		},
+		{
+			Name:      `Enum.Validate(0)`,
+			Validator: &schema.Enum{Values: values},
+			Input:     0,
+			Expect:    0,
+		},
+		{
+			Name:      `Enum.Validate(json.Number("1"))`,
+			Validator: &schema.Enum{Values: values},
+			Input:     json.Number("1"),
+			Expect:    1,
+		},
+		{
+			Name:      `Enum.Validate(json.Number("1.5"))`,
+			Validator: &schema.Enum{Values: values},
+			Input:     json.Number("1.5"),
+			Error:     "invalid enum value",
+		},
+		{
+			Name:      `Enum.Validate(int64(1))`,
+			Validator: &schema.Enum{Values: values},
+			Input:     int64(1),
+			Expect:    1,
+		},
+		{
+			Name:      `Enum.Validate("unknown")`,
+			Validator: &schema.Enum{Values: values},
+			Input:     "unknown",
+			Error:     "invalid enum value",
+		},
+		{
+			Name:      `Enum.Validate(2)`,
+			Validator: &schema.Enum{Values: values},
+			Input:     2,
+			Error:     "invalid enum value",
+		},
+		{
+			Name:      `Enum.Validate(1.5)`,
+			Validator: &schema.Enum{Values: values},
+			Input:     1.5,
+			Error:     "invalid enum value",
+		},
+	} {
+		tc.Run(t)
+	}
+}
+
+func TestEnumValidatorAllowed(t *testing.T) {
+	v := schema.Enum{Values: map[string]int{"published": 1, "draft": 0}}
+	_, err := v.Validate("deleted")
+	if assert.IsType(t, schema.NotAllowedError{}, err) {
+		assert.Equal(t, map[string]interface{}{
+			"code":    "not_allowed",
+			"message": "invalid enum value",
+			"allowed": []interface{}{"draft", "published"},
+		}, err.(schema.DetailedError).ErrorDetail())
+	}
+}
+
+func TestEnumSerializer(t *testing.T) {
+	values := map[string]int{"draft": 0, "published": 1}
+	for _, tc := range []fieldSerializerTestCase{
+		{
+			Name:       `Enum{}.Serialize(1)`,
+			Serializer: &schema.Enum{Values: values},
+			Input:      1,
+			Expect:     1,
+		},
+		{
+			Name:       `Enum{SerializeLabels:true}.Serialize(1)`,
+			Serializer: &schema.Enum{Values: values, SerializeLabels: true},
+			Input:      1,
+			Expect:     "published",
+		},
+		{
+			Name:       `Enum{SerializeLabels:true}.Serialize(2)`,
+			Serializer: &schema.Enum{Values: values, SerializeLabels: true},
+			Input:      2,
+			Error:      "invalid enum value",
+		},
+	} {
+		tc.Run(t)
+	}
+}
+
+func TestEnumLabelInIntOut(t *testing.T) {
+	v := schema.Enum{Values: map[string]int{"draft": 0, "published": 1}}
+	stored, err := v.Validate("published")
+	assert.NoError(t, err)
+	out, err := v.Serialize(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, out)
+}
+
+func TestEnumIntInLabelOut(t *testing.T) {
+	v := schema.Enum{Values: map[string]int{"draft": 0, "published": 1}, SerializeLabels: true}
+	stored, err := v.Validate(float64(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stored)
+	out, err := v.Serialize(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, "published", out)
+}
@@ -29,6 +29,90 @@ func (err ErrorMap) Merge(other ErrorMap) {
 	}
 }
 
+// DetailedError is an optional interface for validation errors carrying
+// structured details in addition to their message. Such errors are stored as
+// is in the field errors of an ErrorMap so the details can be rendered to the
+// client, while plain errors are stored as their message.
+type DetailedError interface {
+	error
+	// ErrorDetail returns the structured representation of the error. The
+	// "code" key should hold a machine readable identifier of the error.
+	ErrorDetail() map[string]interface{}
+}
+
+// NotAllowedError is returned by validators when a value is not one of their
+// allowed values.
+type NotAllowedError struct {
+	// Message is the error message.
+	Message string
+	// Allowed lists the valid values.
+	Allowed []interface{}
+}
+
+// Error implements the built-in error interface.
+func (err NotAllowedError) Error() string {
+	return err.Message
+}
+
+// ErrorDetail implements DetailedError.
+func (err NotAllowedError) ErrorDetail() map[string]interface{} {
+	return map[string]interface{}{
+		"code":    "not_allowed",
+		"message": err.Message,
+		"allowed": err.Allowed,
+	}
+}
+
+// StatusError is an optional interface for validation errors which should be
+// reported with another HTTP status than the default 422 Unprocessable Entity,
+// i.e.: 403 for a value the client isn't allowed to set or 409 for a value
+// conflicting with another item. Such errors are stored as is in the field
+// errors of an ErrorMap. See WithStatus.
+type StatusError interface {
+	error
+	// HTTPStatus returns the HTTP status code of the error.
+	HTTPStatus() int
+}
+
+type statusError struct {
+	error
+	status int
+}
+
+// HTTPStatus implements StatusError.
+func (err statusError) HTTPStatus() int {
+	return err.status
+}
+
+type detailedStatusError struct {
+	DetailedError
+	status int
+}
+
+// HTTPStatus implements StatusError.
+func (err detailedStatusError) HTTPStatus() int {
+	return err.status
+}
+
+// WithStatus returns err as a StatusError reported with the HTTP status. It may
+// be returned by field validators and document rules. The details of err are
+// kept if it is a DetailedError.
+func WithStatus(err error, status int) error {
+	if de, ok := err.(DetailedError); ok {
+		return detailedStatusError{de, status}
+	}
+	return statusError{err, status}
+}
+
+// fieldError returns the value to store in field errors for err.
+func fieldError(err error) interface{} {
+	switch err.(type) {
+	case DetailedError, StatusError:
+		return err
+	}
+	return err.Error()
+}
+
 // ErrorSlice contains a concatenation of several errors.
 type ErrorSlice []error
 
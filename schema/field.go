@@ -16,7 +16,16 @@ type Field struct {
 	// documentation generation.
 	Description string
 	// Required throws an error when the field is not provided at creation.
+	// Unless the field is Nullable, an explicit null value is also rejected.
 	Required bool
+	// RequiredOn makes the field required, as with Required, only for the
+	// listed write modes (i.e.: required on Create but optional on Update).
+	// It is enforced by ValidateMode.
+	RequiredOn []Mode
+	// Nullable accepts an explicit null value for the field, bypassing its
+	// Validator. Combined with Required, the field must be provided but may
+	// be null.
+	Nullable bool
 	// ReadOnly throws an error when a field is changed by the client.
 	// Default and OnInit/OnUpdate hooks can be used to set/change read-only
 	// fields.
@@ -25,9 +34,29 @@ type Field struct {
 	// this field is enabled, PUTing the document without the field would not
 	// remove the field but use the previous document's value if any.
 	Hidden bool
+	// HiddenUnless, if set, is called with the request context to reveal a
+	// Hidden field to privileged callers (i.e.: admins). The field is hidden
+	// when it returns false. When revealed, the field is treated as a regular
+	// field: PUTing the document without it removes it.
+	HiddenUnless func(ctx context.Context) bool
+	// Enabled, if set, is called with the request context to tell if the
+	// field is enabled for the request (i.e.: beta fields for beta users). A
+	// disabled field is treated as nonexistent: it is rejected as an invalid
+	// field if provided, its stored value is left untouched and it is omitted
+	// from the output.
+	Enabled func(ctx context.Context) bool
 	// Default defines the value be stored on the field when when item is
 	// created and this field is not provided by the client.
 	Default interface{}
+	// DefaultFromDoc can be set to a function computing the value of the
+	// field from the other fields of the document (i.e.: a display name
+	// defaulting to the username) when the item is created and the field is
+	// not provided nor set by Default or OnInit. It is called by Prepare with
+	// the prepared document, which must not be modified, and returns nil when
+	// no default applies. As defaults may depend on each other, the functions
+	// are called in rounds until no more default is set, so a function may be
+	// called several times.
+	DefaultFromDoc func(ctx context.Context, doc map[string]interface{}) interface{}
 	// OnInit can be set to a function to generate the value of this field
 	// when item is created. The function takes the current value if any
 	// and returns the value to be stored.
@@ -36,6 +65,23 @@ type Field struct {
 	// when item is updated. The function takes the current value if any
 	// and returns the value to be stored.
 	OnUpdate func(ctx context.Context, value interface{}) interface{}
+	// Unmarshal converts a non null value received from the client into its
+	// storage representation (i.e.: dollars to cents). It is called by
+	// Prepare, before change detection and validation, so Validator and
+	// Default apply to the storage representation. If it fails, the value is
+	// left untouched for the Validator to reject.
+	Unmarshal func(value interface{}) (interface{}, error)
+	// Marshal converts a non null stored value back into its API
+	// representation (i.e.: cents to dollars) when the document is
+	// serialized. It is the reverse of Unmarshal and is called after the
+	// Validator's FieldSerializer, if any.
+	Marshal func(value interface{}) (interface{}, error)
+	// Encrypter, if set, encrypts the field's value at rest (i.e.: SSNs,
+	// tokens). Values are validated and compared in plaintext, encrypted by
+	// Validate before being stored and decrypted when the document is
+	// serialized. Use Hidden and HiddenUnless to restrict who can read them.
+	// Encrypted fields can't be filtered or sorted on.
+	Encrypter Encrypter
 	// Params defines a param handler for the field. The handler may change the field's
 	// value depending on the passed parameters.
 	Params Params
@@ -48,6 +94,17 @@ type Field struct {
 	// correctly causing unexpected runtime errors.
 	// @see http://research.swtch.com/interfaces for more details.
 	Validator FieldValidator
+	// VariantValidators defines alternative validators for the field, by
+	// variant name, selected by the Variant function (i.e.: stricter rules
+	// rolled out to a cohort of users). The same pointer rules as for
+	// Validator apply.
+	VariantValidators map[string]FieldValidator
+	// Variant, if set, is called with the request context to select the
+	// validator of the field among VariantValidators. Validator is used when
+	// it returns a variant not listed in VariantValidators (i.e.: ""). The
+	// variant is only known when the document is validated with a context
+	// (see ValidateWithContext).
+	Variant func(ctx context.Context) string
 	// Dependency rejects the field if the schema predicate doesn't match the document.
 	// Use query.MustParsePredicate(`{field: "value"}`) to populate this field.
 	Dependency Predicate
@@ -59,10 +116,41 @@ type Field struct {
 	// When this property is set to `true`, you may want to ensure the backend
 	// database has this field indexed.
 	Sortable bool
+	// NotProjectable defines that the field can't be selected with the
+	// `fields` parameter. Unlike Hidden, the field is still returned when no
+	// projection is requested or with the `*` wildcard.
+	NotProjectable bool
+	// Searchable defines that the field is part of the scope of the full text
+	// search (the `q` parameter). Storage handlers are given the list of
+	// searchable fields.
+	Searchable bool
 	// Schema can be set to a sub-schema to allow multi-level schema.
 	Schema *Schema
 }
 
+// IsEnabled returns true unless the field's Enabled function disables it for
+// the request.
+func (f Field) IsEnabled(ctx context.Context) bool {
+	return f.Enabled == nil || f.Enabled(ctx)
+}
+
+// validator returns the validator of the field selected for the request by its
+// Variant function, or the default Validator.
+func (f Field) validator(ctx context.Context) FieldValidator {
+	if f.Variant != nil {
+		if v, found := f.VariantValidators[f.Variant(ctx)]; found {
+			return v
+		}
+	}
+	return f.Validator
+}
+
+// IsHidden returns true if the field is Hidden and its HiddenUnless function,
+// if any, does not reveal it for the request.
+func (f Field) IsHidden(ctx context.Context) bool {
+	return f.Hidden && (f.HiddenUnless == nil || !f.HiddenUnless(ctx))
+}
+
 // Compile implements the ReferenceCompiler interface and recursively compile sub schemas
 // and validators when they implement Compiler interface.
 func (f Field) Compile(rc ReferenceChecker) error {
@@ -73,19 +161,48 @@ func (f Field) Compile(rc ReferenceChecker) error {
 			return fmt.Errorf(".%v", err)
 		}
 	} else if f.Validator != nil {
-		// Compile validator if it implements the ReferenceCompiler or Compiler interface.
-		if c, ok := f.Validator.(Compiler); ok {
-			if err := c.Compile(rc); err != nil {
-				return fmt.Errorf(": %v", err)
-			}
+		if err := compileValidator(f.Validator, rc); err != nil {
+			return fmt.Errorf(": %v", err)
 		}
-		if reflect.ValueOf(f.Validator).Kind() != reflect.Ptr {
-			return errors.New(": not a schema.Validator pointer")
+	}
+	for name, v := range f.VariantValidators {
+		if err := compileValidator(v, rc); err != nil {
+			return fmt.Errorf(": variant %s: %v", name, err)
+		}
+	}
+	if f.Encrypter != nil && (f.Schema != nil || f.Filterable || f.Sortable) {
+		return errors.New(": encrypted fields can't have a sub-schema nor be filterable or sortable")
+	}
+	return nil
+}
+
+// compileValidator compiles v if it implements the ReferenceCompiler or Compiler
+// interface and ensures it is a pointer.
+func compileValidator(v FieldValidator, rc ReferenceChecker) error {
+	if c, ok := v.(Compiler); ok {
+		if err := c.Compile(rc); err != nil {
+			return err
 		}
 	}
+	if reflect.ValueOf(v).Kind() != reflect.Ptr {
+		return errors.New("not a schema.Validator pointer")
+	}
 	return nil
 }
 
+// decrypt returns the plaintext of a stored value of the field. The value is
+// returned untouched if the field is not encrypted or if it can't be
+// decrypted.
+func (f Field) decrypt(value interface{}) interface{} {
+	if f.Encrypter == nil || value == nil {
+		return value
+	}
+	if v, err := f.Encrypter.Decrypt(value); err == nil {
+		return v
+	}
+	return value
+}
+
 // FieldHandler is the piece of logic modifying the field value based on passed
 // parameters
 type FieldHandler func(ctx context.Context, value interface{}, params map[string]interface{}) (interface{}, error)
@@ -97,6 +214,26 @@ type FieldValidator interface {
 	Validate(value interface{}) (interface{}, error)
 }
 
+// UpdateValidator is an optional interface a FieldValidator can implement to
+// validate a new value relative to the value it replaces. When a field is
+// present in both the changes and the base of an update, ValidateUpdate is
+// called instead of Validate with the new and the original values. This is
+// useful for constraints that only make sense relative to the prior value,
+// like a counter that may only increase.
+type UpdateValidator interface {
+	ValidateUpdate(value, original interface{}) (interface{}, error)
+}
+
+// ExtraValidator is an optional interface a FieldValidator can implement to
+// set derived sibling fields along with the normalized value (i.e.: the
+// components of a parsed address). The extra values are merged into the
+// validated document as changed fields, overriding the values it holds, before
+// the dependencies and rules are checked. Extra fields must be defined in the
+// schema, usually as ReadOnly; they are not validated.
+type ExtraValidator interface {
+	ValidateExtra(value interface{}) (interface{}, map[string]interface{}, error)
+}
+
 //FieldValidatorFunc is an adapter to allow the use of ordinary functions as
 // field validators. If f is a function with the appropriate signature,
 // FieldValidatorFunc(f) is a FieldValidator that calls f.
@@ -107,6 +244,14 @@ func (f FieldValidatorFunc) Validate(value interface{}) (interface{}, error) {
 	return f(value)
 }
 
+// FieldContextValidator is like FieldValidator for validators which outcome
+// depends on the request context, like the parent document of a sub-resource
+// item (see ParentFromContext). When implemented, it is used in place of
+// FieldValidator by Schema.ValidateContext.
+type FieldContextValidator interface {
+	ValidateContext(ctx context.Context, value interface{}) (interface{}, error)
+}
+
 // FieldSerializer is used to convert the value between it's representation form
 // and it internal storable form. A FieldValidator which implement this
 // interface will have its Serialize method called before marshaling.
@@ -117,6 +262,27 @@ type FieldSerializer interface {
 	Serialize(value interface{}) (interface{}, error)
 }
 
+// FieldContextSerializer is like FieldSerializer for validators which
+// representation depends on the request context, like the language requested
+// by the client. When implemented, it is used in place of FieldSerializer.
+type FieldContextSerializer interface {
+	// SerializeContext is called when the data is coming from it internal
+	// storable form and needs to be converted into its representation form
+	// for the current request.
+	SerializeContext(ctx context.Context, value interface{}) (interface{}, error)
+}
+
+// Encrypter encrypts and decrypts the values of a field for storage. As
+// encryption may not be deterministic, the same plaintext may give different
+// ciphertexts. The ciphertext should be a value supported by the storage
+// handler, like a string.
+type Encrypter interface {
+	// Encrypt returns the ciphertext to store for the validated value.
+	Encrypt(value interface{}) (interface{}, error)
+	// Decrypt returns the plaintext of a stored ciphertext.
+	Decrypt(value interface{}) (interface{}, error)
+}
+
 // FieldGetter defines an interface for fetching sub-fields from a Schema or
 // FieldValidator implementation that allows (JSON) object values.
 type FieldGetter interface {
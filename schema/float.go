@@ -1,8 +1,12 @@
 package schema
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
 // Boundaries defines min/max for an integer.
@@ -15,6 +19,40 @@ type Boundaries struct {
 type Float struct {
 	Allowed    []float64
 	Boundaries *Boundaries
+	// Precision is the maximum number of decimal places of the values. Values
+	// with more decimal places are rounded half away from zero as written in
+	// decimal (i.e.: 1.005 to 1.01), or rejected if RejectImprecise is set. If
+	// zero, the precision is not limited.
+	Precision int
+	// RejectImprecise rejects the values exceeding Precision instead of
+	// rounding them.
+	RejectImprecise bool
+}
+
+// roundFloat rounds f half away from zero to prec decimal places. The shortest
+// decimal representation of f is rounded rather than its binary value, so 1.005
+// is rounded to 1.01 as written and not to 1.00.
+func roundFloat(f float64, prec int) float64 {
+	s := strconv.FormatFloat(math.Abs(f), 'f', -1, 64)
+	dot := strings.IndexByte(s, '.')
+	if dot < 0 || len(s)-dot-1 <= prec {
+		return f
+	}
+	digits := []byte(s[:dot] + s[dot+1:dot+1+prec])
+	if s[dot+1+prec] >= '5' {
+		i := len(digits) - 1
+		for ; i >= 0 && digits[i] == '9'; i-- {
+			digits[i] = '0'
+		}
+		if i < 0 {
+			digits = append([]byte{'1'}, digits...)
+		} else {
+			digits[i]++
+		}
+	}
+	n := len(digits) - prec
+	r, _ := strconv.ParseFloat(string(digits[:n])+"."+string(digits[n:]), 64)
+	return math.Copysign(r, f)
 }
 
 // ValidateQuery implements schema.FieldQueryValidator interface
@@ -23,6 +61,13 @@ func (v Float) ValidateQuery(value interface{}) (interface{}, error) {
 }
 
 func (v Float) get(value interface{}) (float64, error) {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return 0, errors.New("not a float")
+		}
+		return f, nil
+	}
 	f, ok := value.(float64)
 	if !ok {
 		return 0, errors.New("not a float")
@@ -36,6 +81,17 @@ func (v Float) Validate(value interface{}) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	if v.Precision > 0 {
+		// Values too large to be scaled to the precision have no decimals.
+		if fp := f * math.Pow10(v.Precision); !math.IsInf(fp, 0) && !math.IsNaN(fp) {
+			if r := roundFloat(f, v.Precision); r != f {
+				if v.RejectImprecise {
+					return nil, fmt.Errorf("has more than %d decimal places", v.Precision)
+				}
+				f = r
+			}
+		}
+	}
 	if v.Boundaries != nil {
 		if f < v.Boundaries.Min {
 			return nil, fmt.Errorf("is lower than %.2f", v.Boundaries.Min)
@@ -53,17 +109,20 @@ func (v Float) Validate(value interface{}) (interface{}, error) {
 			}
 		}
 		if !found {
-			// TODO: build the list of allowed values.
-			return nil, fmt.Errorf("not one of the allowed values")
+			allowed := make([]interface{}, len(v.Allowed))
+			for i, a := range v.Allowed {
+				allowed[i] = a
+			}
+			return nil, NotAllowedError{Message: "not one of the allowed values", Allowed: allowed}
 		}
 	}
 	return f, nil
 }
 
 func (v Float) parse(value interface{}) (interface{}, error) {
-	f, ok := value.(float64)
-	if !ok {
-		return nil, errors.New("not a float")
+	f, err := v.get(value)
+	if err != nil {
+		return nil, err
 	}
 	return f, nil
 }
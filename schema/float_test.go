@@ -1,6 +1,7 @@
 package schema_test
 
 import (
+	"encoding/json"
 	"errors"
 	"math"
 	"reflect"
@@ -88,6 +89,71 @@ func TestFloatValidator(t *testing.T) {
 	assert.Equal(t, .2, s)
 }
 
+func TestFloatValidatorJSONNumber(t *testing.T) {
+	s, err := schema.Float{}.Validate(json.Number("1.2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.2, s)
+	s, err = schema.Float{}.Validate(json.Number("1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, s)
+	s, err = schema.Float{Boundaries: &schema.Boundaries{Min: 0, Max: 2}}.Validate(json.Number("3.1"))
+	assert.EqualError(t, err, "is greater than 2.00")
+	assert.Nil(t, s)
+}
+
+func TestFloatValidatorPrecision(t *testing.T) {
+	round := schema.Float{Precision: 1}
+	for input, expect := range map[float64]float64{
+		4.9999999: 5,
+		4.94:      4.9,
+		4.95:      5,
+		4.9:       4.9,
+		-4.94:     -4.9,
+		-4.96:     -5,
+		-4.9:      -4.9,
+		3:         3,
+		9.96:      10,
+		-99.95:    -100,
+		1.05:      1.1,
+	} {
+		s, err := round.Validate(input)
+		assert.NoError(t, err, "%v", input)
+		assert.Equal(t, expect, s, "%v", input)
+	}
+	s, err := round.Validate(json.Number("1.25"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.3, s)
+
+	// Values are rounded as written, not as their nearest binary value.
+	for input, expect := range map[float64]float64{1.005: 1.01, -1.005: -1.01, 2.675: 2.68, 1.004: 1} {
+		s, err := schema.Float{Precision: 2}.Validate(input)
+		assert.NoError(t, err, "%v", input)
+		assert.Equal(t, expect, s, "%v", input)
+	}
+
+	// Values too large to be scaled are kept as is.
+	s, err = schema.Float{Precision: 2}.Validate(math.MaxFloat64)
+	assert.NoError(t, err)
+	assert.Equal(t, math.MaxFloat64, s)
+
+	// Values are rounded before being checked against the boundaries.
+	s, err = schema.Float{Precision: 1, Boundaries: &schema.Boundaries{Min: 0, Max: 5}}.Validate(5.04)
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, s)
+
+	reject := schema.Float{Precision: 2, RejectImprecise: true}
+	for _, input := range []float64{1.23, -1.23, 1.2, -7, 0.1} {
+		s, err := reject.Validate(input)
+		assert.NoError(t, err, "%v", input)
+		assert.Equal(t, input, s)
+	}
+	for _, input := range []float64{1.234, -1.234, 0.001, 4.9999999} {
+		s, err := reject.Validate(input)
+		assert.EqualError(t, err, "has more than 2 decimal places", "%v", input)
+		assert.Nil(t, s)
+	}
+}
+
 func TestFloatLesser(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -0,0 +1,54 @@
+package schema
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// Hostname validates bare hostnames following the RFC 1123 rules: dot
+// separated labels of 1 to 63 letters, digits or hyphens, not starting nor
+// ending with an hyphen, for a total of at most 253 characters. A trailing dot
+// (i.e.: "example.com.") is accepted and removed. Values are normalized to
+// lowercase.
+type Hostname struct {
+	// RequireFQDN requires a fully qualified domain name, with at least two
+	// labels (i.e.: "example.com" but not "localhost").
+	RequireFQDN bool
+	// RejectIP rejects IPv4 addresses, which are otherwise valid hostnames.
+	RejectIP bool
+}
+
+// Validate implements FieldValidator.
+func (v Hostname) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	s = strings.ToLower(strings.TrimSuffix(s, "."))
+	if !isHostname(s) || (v.RejectIP && net.ParseIP(s) != nil) {
+		return nil, errors.New("not a valid hostname")
+	}
+	if v.RequireFQDN && !strings.Contains(s, ".") {
+		return nil, errors.New("not a fully qualified domain name")
+	}
+	return s, nil
+}
+
+// isHostname returns true if s is a valid lowercase RFC 1123 hostname.
+func isHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			if c := label[i]; (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
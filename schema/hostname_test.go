@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostnameValidator(t *testing.T) {
+	for input, expect := range map[string]string{
+		"localhost":             "localhost",
+		"Example.COM":           "example.com",
+		"example.com.":          "example.com",
+		"a-b.c-d.example":       "a-b.c-d.example",
+		"1password.com":         "1password.com",
+		"192.168.0.1":           "192.168.0.1",
+		strings.Repeat("a", 63): strings.Repeat("a", 63),
+	} {
+		v, err := Hostname{}.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, v, input)
+	}
+	for _, input := range []string{
+		"",
+		".",
+		"example..com",
+		".example.com",
+		"-example.com",
+		"example-.com",
+		"exa_mple.com",
+		"exa mple.com",
+		"http://example.com",
+		"example.com:80",
+		"exämple.com",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com",
+	} {
+		v, err := Hostname{}.Validate(input)
+		assert.EqualError(t, err, "not a valid hostname", input)
+		assert.Nil(t, v)
+	}
+	_, err := Hostname{}.Validate(42)
+	assert.EqualError(t, err, "not a string")
+}
+
+func TestHostnameValidatorRequireFQDN(t *testing.T) {
+	v, err := Hostname{RequireFQDN: true}.Validate("www.example.com.")
+	assert.NoError(t, err)
+	assert.Equal(t, "www.example.com", v)
+	_, err = Hostname{RequireFQDN: true}.Validate("localhost.")
+	assert.EqualError(t, err, "not a fully qualified domain name")
+}
+
+func TestHostnameValidatorRejectIP(t *testing.T) {
+	_, err := Hostname{RejectIP: true}.Validate("192.168.0.1")
+	assert.EqualError(t, err, "not a valid hostname")
+	v, err := Hostname{RejectIP: true}.Validate("192.168.0.1.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.0.1.example.com", v)
+}
@@ -0,0 +1,81 @@
+package schema
+
+import "strings"
+
+// StripTags removes the HTML tags and comments from s, as well as the content
+// of script and style elements. Text and character entities are left
+// untouched. A "<" not starting a tag (i.e.: "a < b") is kept.
+func StripTags(s string) string {
+	if strings.IndexByte(s, '<') == -1 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c != '<' || i+1 == len(s) || !isTagStart(s[i+1]) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], "<!--") {
+			end := strings.Index(s[i+4:], "-->")
+			if end == -1 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+		end := tagEnd(s, i+1)
+		if end == -1 {
+			// Unterminated tag, drop the remaining.
+			break
+		}
+		name := strings.ToLower(tagName(s[i+1 : end]))
+		i = end + 1
+		if name == "script" || name == "style" {
+			// Skip the element content up to its closing tag.
+			closing := strings.Index(strings.ToLower(s[i:]), "</"+name)
+			if closing == -1 {
+				break
+			}
+			i += closing
+		}
+	}
+	return b.String()
+}
+
+func isTagStart(c byte) bool {
+	return c == '/' || c == '!' || c == '?' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// tagEnd returns the index of the ">" closing the tag starting at i, ignoring
+// the ones in quoted attribute values, or -1 if the tag is not terminated.
+func tagEnd(s string, i int) int {
+	var quote byte
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// tagName returns the name of an opening tag, or an empty string for closing
+// tags, declarations and processing instructions.
+func tagName(tag string) string {
+	for i := 0; i < len(tag); i++ {
+		switch tag[i] {
+		case ' ', '\t', '\n', '\r', '\f', '/':
+			return tag[:i]
+		}
+	}
+	return tag
+}
@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -52,14 +53,32 @@ func (v Integer) Validate(value interface{}) (interface{}, error) {
 			}
 		}
 		if !found {
-			// TODO: build the list of allowed values.
-			return nil, fmt.Errorf("not one of the allowed values")
+			allowed := make([]interface{}, len(v.Allowed))
+			for i, a := range v.Allowed {
+				allowed[i] = a
+			}
+			return nil, NotAllowedError{Message: "not one of the allowed values", Allowed: allowed}
 		}
 	}
 	return i, nil
 }
 
 func (v Integer) parse(value interface{}) (interface{}, error) {
+	if n, ok := value.(json.Number); ok {
+		// Numbers decoded with json.Decoder.UseNumber are converted without
+		// going thru float64 so large integers keep their precision.
+		if i, err := n.Int64(); err == nil {
+			if int64(int(i)) != i {
+				return nil, errors.New("not an integer")
+			}
+			return int(i), nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, errors.New("not an integer")
+		}
+		value = f
+	}
 	if f, ok := value.(float64); ok {
 		// JSON unmarshaling treat all numbers as float64, try to convert it to
 		// int if not fraction.
@@ -89,3 +108,22 @@ func (v Integer) less(value, other interface{}) bool {
 	}
 	return t < o
 }
+
+// MonotonicInteger validates integer based values which may only increase on
+// update, like counters or sequence numbers.
+type MonotonicInteger struct {
+	Integer
+}
+
+// ValidateUpdate implements the UpdateValidator interface and rejects values
+// lower than the original.
+func (v MonotonicInteger) ValidateUpdate(value, original interface{}) (interface{}, error) {
+	val, err := v.Validate(value)
+	if err != nil {
+		return nil, err
+	}
+	if o, err := v.parse(original); err == nil && val.(int) < o.(int) {
+		return nil, fmt.Errorf("cannot decrease from %d", o)
+	}
+	return val, nil
+}
@@ -1,6 +1,7 @@
 package schema_test
 
 import (
+	"encoding/json"
 	"errors"
 	"math"
 	"reflect"
@@ -87,6 +88,22 @@ func TestIntegerValidator(t *testing.T) {
 	assert.Equal(t, 2, s)
 }
 
+func TestIntegerValidatorJSONNumber(t *testing.T) {
+	// 2^53 + 1 can't be represented as a float64.
+	s, err := schema.Integer{}.Validate(json.Number("9007199254740993"))
+	assert.NoError(t, err)
+	assert.Equal(t, 9007199254740993, s)
+	s, err = schema.Integer{}.Validate(json.Number("1e3"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, s)
+	s, err = schema.Integer{}.Validate(json.Number("1.1"))
+	assert.EqualError(t, err, "not an integer")
+	assert.Nil(t, s)
+	s, err = schema.Integer{Boundaries: &schema.Boundaries{Min: 0, Max: 2}}.Validate(json.Number("3"))
+	assert.EqualError(t, err, "is greater than 2")
+	assert.Nil(t, s)
+}
+
 func TestIntegerLesser(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -111,3 +128,19 @@ func TestIntegerLesser(t *testing.T) {
 		})
 	}
 }
+
+func TestMonotonicIntegerValidateUpdate(t *testing.T) {
+	v := schema.MonotonicInteger{}
+	s, err := v.ValidateUpdate(2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s)
+	s, err = v.ValidateUpdate(1.0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s)
+	s, err = v.ValidateUpdate(1, 2)
+	assert.EqualError(t, err, "cannot decrease from 2")
+	assert.Nil(t, s)
+	s, err = v.ValidateUpdate(1.1, 1)
+	assert.EqualError(t, err, "not an integer")
+	assert.Nil(t, s)
+}
@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+)
+
+// ISOCodeSet is a set of ISO codes validated by the ISOCode validator.
+type ISOCodeSet int
+
+const (
+	// CountryCode is the set of ISO 3166-1 alpha-2 country codes.
+	CountryCode ISOCodeSet = iota
+	// CurrencyCode is the set of ISO 4217 currency codes.
+	CurrencyCode
+)
+
+// ISOCode validates ISO country (ISO 3166-1 alpha-2) or currency (ISO 4217)
+// codes. Values are normalized to uppercase.
+type ISOCode struct {
+	// Set is the set of codes the value must belong to (CountryCode by
+	// default).
+	Set ISOCodeSet
+}
+
+// Validate implements FieldValidator.
+func (v ISOCode) Validate(value interface{}) (interface{}, error) {
+	codes, kind := countryCodes, "country"
+	if v.Set == CurrencyCode {
+		codes, kind = currencyCodes, "currency"
+	}
+	s, ok := value.(string)
+	if ok {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		ok = codes[s]
+	}
+	if !ok {
+		return nil, errors.New("not a valid " + kind + " code")
+	}
+	return s, nil
+}
+
+var (
+	countryCodes = codeSet(`
+		AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ
+		BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+		CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ
+		DE DJ DK DM DO DZ
+		EC EE EG EH ER ES ET
+		FI FJ FK FM FO FR
+		GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY
+		HK HM HN HR HT HU
+		ID IE IL IM IN IO IQ IR IS IT
+		JE JM JO JP
+		KE KG KH KI KM KN KP KR KW KY KZ
+		LA LB LC LI LK LR LS LT LU LV LY
+		MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ
+		NA NC NE NF NG NI NL NO NP NR NU NZ
+		OM
+		PA PE PF PG PH PK PL PM PN PR PS PT PW PY
+		QA
+		RE RO RS RU RW
+		SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ
+		TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ
+		UA UG UM US UY UZ
+		VA VC VE VG VI VN VU
+		WF WS
+		YE YT
+		ZA ZM ZW`)
+	currencyCodes = codeSet(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN
+		BAM BBD BDT BGN BHD BIF BMD BND BOB BOV BRL BSD BTN BWP BYN BZD
+		CAD CDF CHE CHF CHW CLF CLP CNY COP COU CRC CUC CUP CVE CZK
+		DJF DKK DOP DZD
+		EGP ERN ETB EUR
+		FJD FKP
+		GBP GEL GHS GIP GMD GNF GTQ GYD
+		HKD HNL HTG HUF
+		IDR ILS INR IQD IRR ISK
+		JMD JOD JPY
+		KES KGS KHR KMF KPW KRW KWD KYD KZT
+		LAK LBP LKR LRD LSL LYD
+		MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN
+		NAD NGN NIO NOK NPR NZD
+		OMR
+		PAB PEN PGK PHP PKR PLN PYG
+		QAR
+		RON RSD RUB RWF
+		SAR SBD SCR SDG SEK SGD SHP SLE SLL SOS SRD SSP STN SVC SYP SZL
+		THB TJS TMT TND TOP TRY TTD TWD TZS
+		UAH UGX USD USN UYI UYU UYW UZS
+		VED VES VND VUV
+		WST
+		XAF XAG XAU XBA XBB XBC XBD XCD XDR XOF XPD XPF XPT XSU XTS XUA XXX
+		YER
+		ZAR ZMW ZWL`)
+)
+
+func codeSet(codes string) map[string]bool {
+	set := map[string]bool{}
+	for _, code := range strings.Fields(codes) {
+		set[code] = true
+	}
+	return set
+}
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestISOCodeValidatorCountry(t *testing.T) {
+	for input, expect := range map[string]string{
+		"US":   "US",
+		"fr":   "FR",
+		" De ": "DE",
+		"ax":   "AX",
+	} {
+		v, err := ISOCode{}.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, v, input)
+	}
+	for _, input := range []interface{}{"", "USA", "XX", "U", "UK", 42, nil} {
+		v, err := ISOCode{Set: CountryCode}.Validate(input)
+		assert.EqualError(t, err, "not a valid country code", "%v", input)
+		assert.Nil(t, v)
+	}
+	assert.Len(t, countryCodes, 249)
+}
+
+func TestISOCodeValidatorCurrency(t *testing.T) {
+	for input, expect := range map[string]string{
+		"USD": "USD",
+		"eur": "EUR",
+		"Jpy": "JPY",
+	} {
+		v, err := ISOCode{Set: CurrencyCode}.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, v, input)
+	}
+	for _, input := range []interface{}{"", "US", "USDD", "ABC", 840, nil} {
+		v, err := ISOCode{Set: CurrencyCode}.Validate(input)
+		assert.EqualError(t, err, "not a valid currency code", "%v", input)
+		assert.Nil(t, v)
+	}
+}
@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type languagesKey struct{}
+
+// WithLanguages returns a copy of ctx holding the languages requested by the
+// client, by order of preference. Localized fields are serialized using the
+// first language with an available translation.
+func WithLanguages(ctx context.Context, langs ...string) context.Context {
+	return context.WithValue(ctx, languagesKey{}, langs)
+}
+
+// LanguagesFromContext returns the languages stored in ctx by WithLanguages.
+func LanguagesFromContext(ctx context.Context) []string {
+	langs, _ := ctx.Value(languagesKey{}).([]string)
+	return langs
+}
+
+// Localized validates translatable strings stored as a dict of language tags
+// (i.e.: en, fr-CA) to translations. On serialization, the translation best
+// matching the languages of the request context (see WithLanguages) is
+// returned as a flat string.
+type Localized struct {
+	// Languages restricts the accepted language tags if not empty.
+	Languages []string
+	// Default is the language used when none of the requested languages has a
+	// translation. If the default translation is missing too, the field is
+	// serialized as null.
+	Default string
+}
+
+// Compile implements the Compiler interface.
+func (v Localized) Compile(rc ReferenceChecker) error {
+	if v.Default != "" && len(v.Languages) > 0 && !v.allowed(v.Default) {
+		return fmt.Errorf("default language %s is not in languages", v.Default)
+	}
+	return nil
+}
+
+// Validate implements the FieldValidator interface.
+func (v Localized) Validate(value interface{}) (interface{}, error) {
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("not a dict")
+	}
+	for lang, t := range dict {
+		if len(v.Languages) > 0 && !v.allowed(lang) {
+			return nil, fmt.Errorf("invalid language: %s", lang)
+		}
+		if _, ok := t.(string); !ok {
+			return nil, fmt.Errorf("%s: not a string", lang)
+		}
+	}
+	return dict, nil
+}
+
+func (v Localized) allowed(lang string) bool {
+	for _, l := range v.Languages {
+		if strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// SerializeContext implements the FieldContextSerializer interface.
+func (v Localized) SerializeContext(ctx context.Context, value interface{}) (interface{}, error) {
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+	for _, lang := range LanguagesFromContext(ctx) {
+		if t, found := lookupTranslation(dict, lang); found {
+			return t, nil
+		}
+		// Fallback on the primary language (i.e.: fr for fr-CA).
+		if i := strings.IndexByte(lang, '-'); i > 0 {
+			if t, found := lookupTranslation(dict, lang[:i]); found {
+				return t, nil
+			}
+		}
+	}
+	if v.Default != "" {
+		if t, found := lookupTranslation(dict, v.Default); found {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+// lookupTranslation returns the translation for lang, language tags being
+// case insensitive.
+func lookupTranslation(dict map[string]interface{}, lang string) (interface{}, bool) {
+	if t, found := dict[lang]; found {
+		return t, true
+	}
+	for l, t := range dict {
+		if strings.EqualFold(l, lang) {
+			return t, true
+		}
+	}
+	return nil, false
+}
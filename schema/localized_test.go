@@ -0,0 +1,61 @@
+package schema_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalizedValidator(t *testing.T) {
+	v, err := schema.Localized{}.Validate(map[string]interface{}{"en": "Hello", "fr": "Bonjour"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"en": "Hello", "fr": "Bonjour"}, v)
+	v, err = schema.Localized{}.Validate("Hello")
+	assert.EqualError(t, err, "not a dict")
+	assert.Nil(t, v)
+	v, err = schema.Localized{}.Validate(map[string]interface{}{"en": 1})
+	assert.EqualError(t, err, "en: not a string")
+	assert.Nil(t, v)
+	v, err = schema.Localized{Languages: []string{"en", "fr"}}.Validate(map[string]interface{}{"de": "Hallo"})
+	assert.EqualError(t, err, "invalid language: de")
+	assert.Nil(t, v)
+}
+
+func TestLocalizedCompile(t *testing.T) {
+	assert.NoError(t, schema.Localized{Languages: []string{"en", "fr"}, Default: "en"}.Compile(nil))
+	assert.EqualError(t, schema.Localized{Languages: []string{"fr"}, Default: "en"}.Compile(nil), "default language en is not in languages")
+}
+
+func TestLocalizedSerializeContext(t *testing.T) {
+	value := map[string]interface{}{"en": "Hello", "fr": "Bonjour", "pt-BR": "Olá"}
+	v := schema.Localized{Default: "en"}
+	cases := []struct {
+		name   string
+		langs  []string
+		expect interface{}
+	}{
+		{"Exact", []string{"fr"}, "Bonjour"},
+		{"Exact/Case-insensitive", []string{"PT-br"}, "Olá"},
+		{"Preference", []string{"de", "fr", "en"}, "Bonjour"},
+		{"Primary", []string{"fr-CA"}, "Bonjour"},
+		{"Fallback", []string{"de"}, "Hello"},
+		{"Fallback/No-languages", nil, "Hello"},
+	}
+	for i := range cases {
+		tt := cases[i]
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := schema.WithLanguages(context.Background(), tt.langs...)
+			got, err := v.SerializeContext(ctx, value)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+
+	// Missing translation with no default translation.
+	ctx := schema.WithLanguages(context.Background(), "de")
+	got, err := schema.Localized{Default: "es"}.SerializeContext(ctx, value)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Luhn validates numbers protected by a Luhn check digit (i.e.: credit card
+// numbers, IMEI). Spaces and dashes are accepted as separators and values are
+// stored as the digits only string.
+type Luhn struct {
+	// MinLen is the minimum number of digits.
+	MinLen int
+	// MaxLen is the maximum number of digits, if not zero.
+	MaxLen int
+}
+
+// Validate implements FieldValidator.
+func (v Luhn) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, s)
+	if digits == "" {
+		return nil, errors.New("not a valid number")
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return nil, errors.New("not a valid number")
+		}
+	}
+	if l := len(digits); l < v.MinLen {
+		return nil, fmt.Errorf("is shorter than %d digits", v.MinLen)
+	} else if v.MaxLen > 0 && l > v.MaxLen {
+		return nil, fmt.Errorf("is longer than %d digits", v.MaxLen)
+	}
+	if !luhnValid(digits) {
+		return nil, errors.New("invalid check digit")
+	}
+	return digits, nil
+}
+
+// luhnValid returns true if the last digit of digits is its Luhn check digit.
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,46 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLuhnValidator(t *testing.T) {
+	for input, expect := range map[string]string{
+		"4111111111111111":    "4111111111111111",
+		"4111 1111 1111 1111": "4111111111111111",
+		"4111-1111-1111-1111": "4111111111111111",
+		"490154203237518":     "490154203237518",
+		"0":                   "0",
+	} {
+		v, err := Luhn{}.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, v, input)
+	}
+	for input, expect := range map[interface{}]string{
+		"4111111111111112":    "invalid check digit",
+		"4111 1111 1111 1110": "invalid check digit",
+		"490154203237517":     "invalid check digit",
+		"4111.1111.1111.1111": "not a valid number",
+		"41a1":                "not a valid number",
+		" - ":                 "not a valid number",
+		"":                    "not a valid number",
+		4111111111111111:      "not a string",
+	} {
+		v, err := Luhn{}.Validate(input)
+		assert.EqualError(t, err, expect, "%v", input)
+		assert.Nil(t, v)
+	}
+}
+
+func TestLuhnValidatorLength(t *testing.T) {
+	v := Luhn{MinLen: 13, MaxLen: 15}
+	_, err := v.Validate("4111 1111 1111 1111")
+	assert.EqualError(t, err, "is longer than 15 digits")
+	_, err = v.Validate("0")
+	assert.EqualError(t, err, "is shorter than 13 digits")
+	s, err := v.Validate("490154203237518")
+	assert.NoError(t, err)
+	assert.Equal(t, "490154203237518", s)
+}
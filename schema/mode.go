@@ -0,0 +1,92 @@
+package schema
+
+import "context"
+
+// Mode is the kind of write operation a document is validated for. It is
+// used by Field.RequiredOn to vary the requiredness of a field by operation.
+// It may be combined with the Partial flag (i.e.: Create|Partial).
+type Mode int
+
+const (
+	// Create is the mode of a document creation.
+	Create Mode = iota + 1
+	// Update is the mode of a partial update of an existing document (i.e.:
+	// PATCH).
+	Update
+	// Replace is the mode of a full replacement of an existing document (i.e.:
+	// PUT).
+	Replace
+
+	// Partial is a flag skipping the required checks (Field.Required,
+	// Field.RequiredOn and the fields required by Schema.Conditions) while
+	// still validating the provided fields, so incomplete documents (i.e.:
+	// drafts) can be stored.
+	Partial Mode = 1 << 8
+)
+
+// ModeValidator is an optional interface implemented by validators able to
+// validate a document for a given write mode.
+type ModeValidator interface {
+	// ValidateMode behaves like Validate, with requirements specific to mode
+	// enforced.
+	ValidateMode(changes map[string]interface{}, base map[string]interface{}, mode Mode) (doc map[string]interface{}, errs map[string][]interface{})
+}
+
+// ValidateWithMode validates changes applied on base using the ValidateMode
+// method of v if it implements ModeValidator, or its Validate method otherwise.
+func ValidateWithMode(v Validator, changes map[string]interface{}, base map[string]interface{}, mode Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	if mv, ok := v.(ModeValidator); ok {
+		return mv.ValidateMode(changes, base, mode)
+	}
+	return v.Validate(changes, base)
+}
+
+// ContextValidator is an optional interface implemented by validators able to
+// validate a document for a given write mode and request context, i.e.: to
+// select the validators of fields with variants (see Field.Variant).
+type ContextValidator interface {
+	// ValidateContext behaves like ValidateMode, with the validators of the
+	// fields selected for ctx.
+	ValidateContext(ctx context.Context, changes map[string]interface{}, base map[string]interface{}, mode Mode) (doc map[string]interface{}, errs map[string][]interface{})
+}
+
+// ValidateWithContext validates changes applied on base using the
+// ValidateContext method of v if it implements ContextValidator, or
+// ValidateWithMode otherwise.
+func ValidateWithContext(ctx context.Context, v Validator, changes map[string]interface{}, base map[string]interface{}, mode Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	if cv, ok := v.(ContextValidator); ok {
+		return cv.ValidateContext(ctx, changes, base, mode)
+	}
+	return ValidateWithMode(v, changes, base, mode)
+}
+
+// VariantSelector is an optional interface implemented by validators with
+// fields which validator depends on the request context (see Field.Variant).
+type VariantSelector interface {
+	// Variants returns a string identifying the variants of the validators
+	// selected for ctx, or an empty string if the default validators are
+	// used. It is meant to be used in cache keys.
+	Variants(ctx context.Context) string
+}
+
+// ExternalStateSelector is an optional interface implemented by validators
+// with fields which validator depends on data external to the validated
+// document (see ReferenceEnum).
+type ExternalStateSelector interface {
+	// ExternalState returns a string identifying the current state of the
+	// external data, changing each time it is invalidated, and false if the
+	// validation results must not be cached at all. It is meant to be used in
+	// cache keys.
+	ExternalState() (string, bool)
+}
+
+// requiredOn returns true if the mode, ignoring its flags, is listed in modes.
+func requiredOn(modes []Mode, mode Mode) bool {
+	mode &^= Partial
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
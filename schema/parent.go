@@ -0,0 +1,19 @@
+package schema
+
+import "context"
+
+type parentKey struct{}
+
+// WithParent returns a copy of ctx holding the document of the parent item of
+// a sub-resource item being validated, so FieldContextValidator validators can
+// read the parent's fields.
+func WithParent(ctx context.Context, parent map[string]interface{}) context.Context {
+	return context.WithValue(ctx, parentKey{}, parent)
+}
+
+// ParentFromContext returns the parent document stored in ctx by WithParent,
+// or nil if the validated item has no parent.
+func ParentFromContext(ctx context.Context) map[string]interface{} {
+	parent, _ := ctx.Value(parentKey{}).(map[string]interface{})
+	return parent
+}
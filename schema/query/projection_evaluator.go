@@ -29,6 +29,13 @@ type Resource interface {
 	Path() string
 }
 
+// Counter is an optional interface a Resource can implement to support
+// schema.ConnectionCount fields.
+type Counter interface {
+	// Count returns the number of items matching the query predicate.
+	Count(ctx context.Context, query *Query) (int, error)
+}
+
 // Eval evaluate the projection on the given payload with the help of the
 // validator. The resolver is used to fetch payload of references outside of the
 // provided payload.
@@ -186,8 +193,8 @@ func evalProjection(ctx context.Context, p Projection, payload map[string]interf
 			name = pf.Alias
 		}
 		def := fg.GetField(pf.Name)
-		// Skip hidden fields
-		if def != nil && def.Hidden {
+		// Skip hidden fields and fields disabled for the request
+		if def != nil && (def.IsHidden(ctx) || !def.IsEnabled(ctx)) {
 			continue
 		}
 		if val, found := payload[pf.Name]; found {
@@ -295,6 +302,30 @@ func evalProjection(ctx context.Context, p Projection, payload map[string]interf
 					resMu.Unlock()
 					return nil
 				})
+			} else if cnt, ok := def.Validator.(*schema.ConnectionCount); ok {
+				id, ok := payload["id"]
+				if !ok {
+					return nil, fmt.Errorf("%s: error counting sub-resource: item lacks ID field", pf.Name)
+				}
+				subRsc, err := rsc.SubResource(ctx, cnt.Path)
+				if err != nil {
+					return nil, err
+				}
+				c, ok := subRsc.(Counter)
+				if !ok {
+					return nil, fmt.Errorf("%s: error counting sub-resource: %s does not support counting", pf.Name, subRsc.Path())
+				}
+				q := &Query{Predicate: Predicate{&Equal{Field: cnt.Field, Value: id}}}
+				rbr.appendRequest(referenceCountRequest{
+					rsc:   c,
+					query: q,
+					handler: func(count int) error {
+						resMu.Lock()
+						res[name] = count
+						resMu.Unlock()
+						return nil
+					},
+				})
 			}
 		}
 	}
@@ -347,17 +378,33 @@ func resolveFieldHandler(ctx context.Context, pf ProjectionField, def *schema.Fi
 		return val, nil
 	}
 	var err error
+	if def.Encrypter != nil && val != nil {
+		if val, err = def.Encrypter.Decrypt(val); err != nil {
+			return nil, fmt.Errorf("%s: %v", pf.Name, err)
+		}
+	}
 	if def.Handler != nil && len(pf.Params) > 0 {
 		val, err = def.Handler(ctx, val, pf.Params)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %v", pf.Name, err)
 		}
 	}
-	if s, ok := def.Validator.(schema.FieldSerializer); ok {
+	if s, ok := def.Validator.(schema.FieldContextSerializer); ok {
+		val, err = s.SerializeContext(ctx, val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pf.Name, err)
+		}
+	} else if s, ok := def.Validator.(schema.FieldSerializer); ok {
 		val, err = s.Serialize(val)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %v", pf.Name, err)
 		}
 	}
+	if def.Marshal != nil && val != nil {
+		val, err = def.Marshal(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pf.Name, err)
+		}
+	}
 	return val, nil
 }
@@ -35,6 +35,10 @@ func (r resource) Find(ctx context.Context, query *Query) ([]map[string]interfac
 	}
 	return payloads, nil
 }
+func (r resource) Count(ctx context.Context, query *Query) (int, error) {
+	payloads, err := r.Find(ctx, query)
+	return len(payloads), err
+}
 func (r resource) MultiGet(ctx context.Context, ids []interface{}) ([]map[string]interface{}, error) {
 	payloads := make([]map[string]interface{}, len(ids))
 	for i, id := range ids {
@@ -143,6 +147,10 @@ func TestProjectionEval(t *testing.T) {
 					Validator: cnxShema2,
 				},
 			},
+			"connection_count": {
+				ReadOnly:  true,
+				Validator: &schema.ConnectionCount{Path: "cnx", Field: "ref"},
+			},
 			"with_params": {
 				Params: schema.Params{
 					"foo": {Validator: schema.Integer{}},
@@ -324,6 +332,34 @@ func TestProjectionEval(t *testing.T) {
 			nil,
 			`{"connection2":[{"name":"second","subconn":[{"name":"third"}]}]}`,
 		},
+		{
+			"ConnectionCount",
+			`simple,connection_count`,
+			`{"id":"a","simple":"foo"}`,
+			nil,
+			`{"simple":"foo","connection_count":2}`,
+		},
+		{
+			"ConnectionCount/None",
+			`connection_count`,
+			`{"id":"c"}`,
+			nil,
+			`{"connection_count":0}`,
+		},
+		{
+			"ConnectionCount/Not-requested",
+			`*`,
+			`{"id":"a","simple":"foo"}`,
+			nil,
+			`{"id":"a","simple":"foo"}`,
+		},
+		{
+			"ConnectionCount/No-ID",
+			`connection_count`,
+			`{"simple":"foo"}`,
+			errors.New("connection_count: error counting sub-resource: item lacks ID field"),
+			``,
+		},
 		{
 			"Star",
 			`*`,
@@ -40,6 +40,12 @@ Or pass params to sub-fields:
 
 field1{sub-field1(param1:"value"),sub-field2},field2
 
+Sub-fields can also be selected using a dotted notation, the paths sharing the
+same parent field being merged. The following expression is equivalent to the
+previous one, without the params:
+
+field1.sub-field1,field1.sub-field2,field2
+
 Fields can also be renamed (aliased). This is useful when you want to have
 several times the same fields with different sets of parameters. To define
 aliases, prepend the field definition by the alias name and a colon (:):
@@ -80,6 +86,8 @@ func (p *projectionParser) parseExpression(opened bool) (Projection, error) {
 	expectField := false
 	projection := []ProjectionField{}
 	var field *ProjectionField
+	// parents holds the parent fields of a field with a dotted notation.
+	var parents []string
 	for p.more() {
 		if field == nil {
 			p.eatWhitespaces()
@@ -87,6 +95,15 @@ func (p *projectionParser) parseExpression(opened bool) (Projection, error) {
 			if name == "" {
 				return nil, fmt.Errorf("looking for field name at char %d", p.pos)
 			}
+			parents = nil
+			for p.expect('.') {
+				sub := p.scanFieldName()
+				if sub == "" {
+					return nil, fmt.Errorf("looking for field name at char %d", p.pos)
+				}
+				parents = append(parents, name)
+				name = sub
+			}
 			field = &ProjectionField{Name: name, Alias: alias}
 			expectField = false
 			continue
@@ -101,7 +118,7 @@ func (p *projectionParser) parseExpression(opened bool) (Projection, error) {
 			field.Children = children
 		case '}':
 			if opened && !expectField {
-				projection = append(projection, *field)
+				projection = appendProjectionField(projection, parents, *field)
 				return projection, nil
 			}
 			return nil, fmt.Errorf("looking for field name and got `}' at char %d", p.pos)
@@ -113,7 +130,7 @@ func (p *projectionParser) parseExpression(opened bool) (Projection, error) {
 			}
 			field.Params = params
 		case ',':
-			projection = append(projection, *field)
+			projection = appendProjectionField(projection, parents, *field)
 			field = nil
 			expectField = true
 		case ' ', '\n', '\r', '\t':
@@ -130,11 +147,30 @@ func (p *projectionParser) parseExpression(opened bool) (Projection, error) {
 		return nil, fmt.Errorf("looking for `}' at char %d", p.pos)
 	}
 	if field != nil {
-		projection = append(projection, *field)
+		projection = appendProjectionField(projection, parents, *field)
 	}
 	return projection, nil
 }
 
+// appendProjectionField appends the field to the projection, nested under its
+// parents. Parents already in the projection with sub-fields and no alias are
+// reused.
+func appendProjectionField(projection []ProjectionField, parents []string, field ProjectionField) []ProjectionField {
+	if len(parents) == 0 {
+		return append(projection, field)
+	}
+	for i := range projection {
+		if pf := &projection[i]; pf.Name == parents[0] && pf.Alias == "" && len(pf.Children) > 0 {
+			pf.Children = appendProjectionField(pf.Children, parents[1:], field)
+			return projection
+		}
+	}
+	return append(projection, ProjectionField{
+		Name:     parents[0],
+		Children: appendProjectionField(nil, parents[1:], field),
+	})
+}
+
 // p.scanFieldParams parses fields params until it finds a closing
 // parenthesis. If the max length is reached before or a syntax error is found,
 // an error is returned.
@@ -269,3 +269,32 @@ func TestParseProjection(t *testing.T) {
 		})
 	}
 }
+
+func TestParseProjectionDotted(t *testing.T) {
+	cases := []struct {
+		projection string
+		err        error
+		want       string
+	}{
+		{`foo.bar,baz,foo.qux.x,rab:foo.qux.y(a:1),foo.bar{z}`, nil, `foo{bar,qux{x,rab:y(a:1)},bar{z}},baz`},
+		{`foo{bar.baz},foo.*`, nil, `foo{bar{baz},*}`},
+		{`foo,foo.bar`, nil, `foo,foo{bar}`},
+		{`foo.`, errors.New("looking for field name at char 4"), ``},
+		{`foo.{bar}`, errors.New("looking for field name at char 4"), ``},
+	}
+	for i := range cases {
+		tc := cases[i]
+		t.Run(tc.projection, func(t *testing.T) {
+			pr, err := ParseProjection(tc.projection)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("ParseProjection error:\ngot:  %v\nwant: %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := pr.String(); got != tc.want {
+				t.Errorf("Projection.String:\ngot:  %s\nwant: %s", got, tc.want)
+			}
+		})
+	}
+}
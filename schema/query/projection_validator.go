@@ -19,10 +19,14 @@ func (pf ProjectionField) Validate(fg schema.FieldGetter) error {
 	if def == nil {
 		return fmt.Errorf("%s: unknown field", pf.Name)
 	}
-	if def.Hidden {
-		// Hidden fields can't be selected
+	if def.Hidden && def.HiddenUnless == nil {
+		// Hidden fields can't be selected. Those revealed to some callers can,
+		// but are omitted from the output of the others.
 		return fmt.Errorf("%s: hidden field", pf.Name)
 	}
+	if def.NotProjectable {
+		return fmt.Errorf("%s: field is not projectable", pf.Name)
+	}
 	if len(pf.Children) > 0 {
 		if def.Schema != nil {
 			// Sub-field on a dict (sub-schema)
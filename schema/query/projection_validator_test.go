@@ -28,6 +28,7 @@ func TestProjectionValidate(t *testing.T) {
 				},
 			},
 			"simple": schema.Field{},
+			"blob":   {NotProjectable: true},
 			"with_params": {
 				Params: schema.Params{
 					"foo": {
@@ -66,6 +67,7 @@ func TestProjectionValidate(t *testing.T) {
 		{`with_params(bar:false)`, nil},
 		{`with_params(foobar:"foobar")`, nil},
 		{`foo`, errors.New("foo: unknown field")},
+		{`blob`, errors.New("blob: field is not projectable")},
 		{`simple{child}`, errors.New("simple: field has no children")},
 		{`parent{foo}`, errors.New("parent.foo: unknown field")},
 		{`simple(foo:1)`, errors.New("simple: params not allowed")},
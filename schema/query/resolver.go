@@ -93,6 +93,20 @@ func (r referenceSingleRequest) execute(ctx context.Context) error {
 	return r.handler(payloads, r.rsc.Validator(), r.rsc)
 }
 
+type referenceCountRequest struct {
+	rsc     Counter
+	query   *Query
+	handler func(count int) error
+}
+
+func (r referenceCountRequest) execute(ctx context.Context) error {
+	count, err := r.rsc.Count(ctx, r.query)
+	if err != nil {
+		return err
+	}
+	return r.handler(count)
+}
+
 type referenceMultiGetRequest struct {
 	rsc      Resource
 	ids      []interface{}
@@ -36,6 +36,30 @@ func (r Reference) Validate(value interface{}) (interface{}, error) {
 	return r.validator.Validate(value)
 }
 
+// ReferenceNotFoundError is returned by the validators of Reference fields when
+// the referenced document does not exist.
+type ReferenceNotFoundError struct {
+	// Path is the path of the referenced resource.
+	Path string
+	// ID is the missing document id.
+	ID interface{}
+}
+
+// Error implements the built-in error interface.
+func (err ReferenceNotFoundError) Error() string {
+	return "Not Found"
+}
+
+// ErrorDetail implements DetailedError.
+func (err ReferenceNotFoundError) ErrorDetail() map[string]interface{} {
+	return map[string]interface{}{
+		"code":     "not_found",
+		"message":  err.Error(),
+		"resource": err.Path,
+		"id":       err.ID,
+	}
+}
+
 // GetField implements the FieldGetter interface.
 func (r Reference) GetField(name string) *Field {
 	return r.SchemaValidator.GetField(name)
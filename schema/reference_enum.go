@@ -0,0 +1,164 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultReferenceEnumTTL is the duration the allowed values of a
+// ReferenceEnum are cached when its CacheTTL is not set.
+const DefaultReferenceEnumTTL = time.Minute
+
+// ReferenceValuesChecker is an optional interface for ReferenceChecker
+// implementations able to list the values of a field of the documents of a
+// resource, as required by ReferenceEnum.
+type ReferenceValuesChecker interface {
+	// ReferenceValues returns a function listing the values of field in the
+	// documents of the resource at path, or nil if there is no resource
+	// matching path or if it has no such field.
+	ReferenceValues(path, field string) func(ctx context.Context) ([]interface{}, error)
+}
+
+// ReferenceEnum validates that values are one of the values of a field of the
+// documents of another resource, i.e.: a list of allowed values managed by the
+// administrators of the API. The allowed values are fetched from the resource
+// at validation time and cached for CacheTTL.
+//
+// As the cached values are shared by all the requests, they are fetched with a
+// context holding none of the values of the request context (i.e.: the
+// authenticated user or tenant), so the hooks of the referenced resource can't
+// scope them to the request that happened to fill the cache. When the cache is
+// disabled, the values are fetched with the request context.
+//
+// Validation results involving a ReferenceEnum are cached by a resource's
+// ValidationCache until the enum is invalidated, or not at all if its cache is
+// disabled (see Schema.ExternalState).
+type ReferenceEnum struct {
+	// Path is the path of the resource holding the allowed values.
+	Path string
+	// Field is the field of the resource's documents holding the allowed
+	// values.
+	Field string
+	// CacheTTL is the duration the allowed values are cached. If zero,
+	// DefaultReferenceEnumTTL is used. A negative value disables the cache.
+	CacheTTL time.Duration
+
+	values     func(ctx context.Context) ([]interface{}, error)
+	mu         sync.Mutex
+	allowed    []interface{}
+	expires    time.Time
+	generation uint64
+}
+
+// Compile implements the Compiler interface.
+func (v *ReferenceEnum) Compile(rc ReferenceChecker) error {
+	rvc, ok := rc.(ReferenceValuesChecker)
+	if !ok {
+		return errors.New("reference values can't be listed")
+	}
+	if v.values = rvc.ReferenceValues(v.Path, v.Field); v.values == nil {
+		return fmt.Errorf("can't find field '%s' of resource '%s'", v.Field, v.Path)
+	}
+	return nil
+}
+
+// Validate implements FieldValidator.
+func (v *ReferenceEnum) Validate(value interface{}) (interface{}, error) {
+	return v.ValidateContext(context.Background(), value)
+}
+
+// ValidateContext implements FieldContextValidator. The allowed values are
+// fetched using ctx when not cached, without its values if they are to be
+// cached.
+func (v *ReferenceEnum) ValidateContext(ctx context.Context, value interface{}) (interface{}, error) {
+	allowed, err := v.allowedValues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range allowed {
+		if isEqual(value, a) {
+			return value, nil
+		}
+	}
+	return nil, NotAllowedError{Message: "not one of the allowed values", Allowed: allowed}
+}
+
+// Invalidate drops the cached allowed values, i.e.: after the referenced
+// resource has been modified.
+func (v *ReferenceEnum) Invalidate() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.allowed = nil
+	v.expires = time.Time{}
+	v.generation++
+}
+
+// state returns the number of times the enum has been invalidated, and false
+// if its allowed values are not cached.
+func (v *ReferenceEnum) state() (string, bool) {
+	if v.CacheTTL < 0 {
+		return "", false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return strconv.FormatUint(v.generation, 10), true
+}
+
+// allowedValues returns the distinct values of the referenced field.
+func (v *ReferenceEnum) allowedValues(ctx context.Context) ([]interface{}, error) {
+	if v.values == nil {
+		return nil, errors.New("not successfully compiled")
+	}
+	v.mu.Lock()
+	if v.allowed != nil && time.Now().Before(v.expires) {
+		defer v.mu.Unlock()
+		return v.allowed, nil
+	}
+	v.mu.Unlock()
+	ttl := v.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultReferenceEnumTTL
+	}
+	if ttl > 0 {
+		ctx = valuesContext{ctx}
+	}
+	values, err := v.values(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		if value != nil && !contains(allowed, value) {
+			allowed = append(allowed, value)
+		}
+	}
+	if ttl > 0 {
+		v.mu.Lock()
+		v.allowed, v.expires = allowed, time.Now().Add(ttl)
+		v.mu.Unlock()
+	}
+	return allowed, nil
+}
+
+// valuesContext keeps the cancellation of its parent context but none of its
+// values.
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Value(key interface{}) interface{} {
+	return nil
+}
+
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if isEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package schema_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/rest-layer/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// valuesChecker lists the values of the "name" field of the "statuses"
+// resource.
+type valuesChecker struct {
+	fakeReferenceChecker
+	values  []interface{}
+	queries int
+	tenant  interface{}
+}
+
+type tenantKey struct{}
+
+func (rc *valuesChecker) ReferenceValues(path, field string) func(ctx context.Context) ([]interface{}, error) {
+	if path != "statuses" || field != "name" {
+		return nil
+	}
+	return func(ctx context.Context) ([]interface{}, error) {
+		rc.queries++
+		rc.tenant = ctx.Value(tenantKey{})
+		return rc.values, nil
+	}
+}
+
+func TestReferenceEnumCompile(t *testing.T) {
+	rc := &valuesChecker{}
+	assert.NoError(t, (&schema.ReferenceEnum{Path: "statuses", Field: "name"}).Compile(rc))
+	assert.EqualError(t, (&schema.ReferenceEnum{Path: "statuses", Field: "label"}).Compile(rc),
+		"can't find field 'label' of resource 'statuses'")
+	assert.EqualError(t, (&schema.ReferenceEnum{Path: "statuses", Field: "name"}).Compile(fakeReferenceChecker{}),
+		"reference values can't be listed")
+	_, err := (&schema.ReferenceEnum{Path: "statuses", Field: "name"}).Validate("draft")
+	assert.EqualError(t, err, "not successfully compiled")
+}
+
+func TestReferenceEnumValidate(t *testing.T) {
+	rc := &valuesChecker{values: []interface{}{"draft", "published", "draft", nil}}
+	v := &schema.ReferenceEnum{Path: "statuses", Field: "name", CacheTTL: time.Hour}
+	if !assert.NoError(t, v.Compile(rc)) {
+		return
+	}
+
+	value, err := v.Validate("draft")
+	assert.NoError(t, err)
+	assert.Equal(t, "draft", value)
+	_, err = v.Validate("archived")
+	assert.Equal(t, schema.NotAllowedError{
+		Message: "not one of the allowed values",
+		Allowed: []interface{}{"draft", "published"},
+	}, err)
+	assert.Equal(t, 1, rc.queries, "allowed values are cached")
+
+	// The set changes: the cached values are used until invalidated.
+	rc.values = []interface{}{"published"}
+	_, err = v.Validate("draft")
+	assert.NoError(t, err)
+	v.Invalidate()
+	_, err = v.Validate("draft")
+	assert.Error(t, err)
+	assert.Equal(t, 2, rc.queries)
+
+	// Without cache, the values are listed on each validation.
+	v = &schema.ReferenceEnum{Path: "statuses", Field: "name", CacheTTL: -1}
+	v.Compile(rc)
+	v.Validate("published")
+	v.Validate("published")
+	assert.Equal(t, 4, rc.queries)
+}
+
+func TestReferenceEnumValidateContext(t *testing.T) {
+	rc := &valuesChecker{values: []interface{}{"draft"}}
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+
+	// Cached values are listed without the values of the request context.
+	v := &schema.ReferenceEnum{Path: "statuses", Field: "name"}
+	v.Compile(rc)
+	_, err := v.ValidateContext(ctx, "draft")
+	assert.NoError(t, err)
+	assert.Nil(t, rc.tenant)
+
+	v = &schema.ReferenceEnum{Path: "statuses", Field: "name", CacheTTL: -1}
+	v.Compile(rc)
+	_, err = v.ValidateContext(ctx, "draft")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", rc.tenant)
+}
+
+func TestReferenceEnumExternalState(t *testing.T) {
+	status := &schema.ReferenceEnum{Path: "statuses", Field: "name"}
+	s := schema.Schema{Fields: schema.Fields{
+		"status": {Validator: status},
+		"meta": {Schema: &schema.Schema{Fields: schema.Fields{
+			"tags": {Validator: &schema.Array{Values: schema.Field{Validator: &schema.ReferenceEnum{Path: "statuses", Field: "name"}}}},
+		}}},
+	}}
+	state, ok := s.ExternalState()
+	assert.True(t, ok)
+	assert.Equal(t, "meta.tags[]=0,status=0", state)
+	status.Invalidate()
+	state, ok = s.ExternalState()
+	assert.True(t, ok)
+	assert.Equal(t, "meta.tags[]=0,status=1", state)
+
+	s.Fields["other"] = schema.Field{Validator: &schema.ReferenceEnum{Path: "statuses", Field: "name", CacheTTL: -1}}
+	_, ok = s.ExternalState()
+	assert.False(t, ok)
+}
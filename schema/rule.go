@@ -0,0 +1,78 @@
+package schema
+
+import "fmt"
+
+// Rule is a document level validation rule evaluated on the root document
+// once all its fields have been validated and normalized.
+type Rule interface {
+	// Check checks the document and returns the field in error with the
+	// error, or an empty field and a nil error if the document is valid.
+	Check(doc map[string]interface{}) (field string, err error)
+}
+
+// Membership is a Rule requiring the value of a field to be present in the
+// collection (array) of another field of the same document. It is created
+// using ValueOf and In:
+//
+//     schema.ValueOf("default_variant").In("variants", "id")
+type Membership struct {
+	// Field is the name of the field which value must be found in the
+	// collection.
+	Field string
+	// Collection is the name of the array field holding the allowed values.
+	Collection string
+	// Key, if set, is the key of the objects of the collection holding the
+	// value to compare with (i.e.: "id").
+	Key string
+}
+
+// ValueOf returns a Membership rule on field to be completed with In.
+func ValueOf(field string) Membership {
+	return Membership{Field: field}
+}
+
+// In returns a copy of the membership rule requiring the field's value to be
+// one of the items of the collection field. If key is provided, the field's
+// value is compared with the key's value of each object of the collection.
+func (m Membership) In(collection string, key ...string) Membership {
+	m.Collection = collection
+	if len(key) > 0 {
+		m.Key = key[0]
+	}
+	return m
+}
+
+// Check implements Rule. The rule is ignored when the field is not set.
+func (m Membership) Check(doc map[string]interface{}) (string, error) {
+	value, found := doc[m.Field]
+	if !found || value == nil {
+		return "", nil
+	}
+	items, _ := doc[m.Collection].([]interface{})
+	for _, item := range items {
+		if m.Key != "" {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			item = obj[m.Key]
+		}
+		if isEqual(value, item) {
+			return "", nil
+		}
+	}
+	if m.Key != "" {
+		return m.Field, fmt.Errorf("not found in %s.%s", m.Collection, m.Key)
+	}
+	return m.Field, fmt.Errorf("not found in %s", m.Collection)
+}
+
+// compile checks the fields referenced by the rule exist in the schema.
+func (m Membership) compile(s Schema) error {
+	for _, field := range []string{m.Field, m.Collection} {
+		if _, found := s.Fields[field]; !found {
+			return fmt.Errorf("%s: unknown rule field", field)
+		}
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
+	"strings"
 )
 
 type internal struct{}
@@ -12,6 +14,12 @@ type internal struct{}
 // Tombstone is used to mark a field for removal.
 var Tombstone = internal{}
 
+// disabledField marks, in the changes returned by Prepare, a field disabled for
+// the request. Provided is true if the field was part of the payload.
+type disabledField struct {
+	Provided bool
+}
+
 // Validator is an interface used to validate schema against actual data.
 type Validator interface {
 	GetField(name string) *Field
@@ -29,17 +37,84 @@ type Schema struct {
 	MinLen int
 	// MaxLen defines the maximum number of fields (default no limit).
 	MaxLen int
+	// Conditions defines fields required depending on the value of other
+	// fields. Conditions are only evaluated on the root schema.
+	Conditions []Condition
+	// Rules defines document level validation rules, evaluated on the root
+	// schema once fields are validated and normalized.
+	Rules []Rule
+	// UnknownFields defines how fields not defined in Fields are handled by
+	// Validate (UnknownFieldsReject by default).
+	UnknownFields UnknownFieldsPolicy
+	// UniqueTogether lists groups of root fields which combined values must be
+	// unique across the documents of a resource. The constraints are enforced
+	// by the resource package on insert and update. Documents missing one of
+	// the fields of a group, or with a null value, are not constrained by it.
+	UniqueTogether [][]string
+	// MaxArrayLen is the default maximum length of the *Array validators of
+	// the schema and its sub-schemas not defining their own MaxLen, as a
+	// safety net against oversized arrays. It is applied when the schema is
+	// compiled. Sub-schemas with their own MaxArrayLen use it instead.
+	MaxArrayLen int
+	// PreValidate, if set, is called by the rest package with the raw payload
+	// of write requests before it is prepared and validated, i.e.: to reject
+	// payloads missing a discriminator field before any per-field work. An
+	// ErrorMap error is reported as field errors. For PATCH requests, the
+	// payload is the patch document (merge patch) or the patched document
+	// (JSON Patch). It is only called on the root schema.
+	PreValidate func(ctx context.Context, payload map[string]interface{}) error
 }
 
+// UnknownFieldsPolicy defines Schema.UnknownFields policies.
+type UnknownFieldsPolicy int
+
+const (
+	// UnknownFieldsReject reports fields not defined in the schema as invalid
+	// fields.
+	UnknownFieldsReject UnknownFieldsPolicy = iota
+	// UnknownFieldsStrip silently removes fields not defined in the schema
+	// from the validated document.
+	UnknownFieldsStrip
+	// UnknownFieldsAllow keeps fields not defined in the schema in the
+	// validated document, without validation.
+	UnknownFieldsAllow
+)
+
 // Compile implements the ReferenceCompiler interface and call the same function
 // on each field. Note: if you use schema as a standalone library, it is the
 // *caller's* responsibility to invoke the Compile method before using Prepare
 // or Validate on a Schema instance, otherwise FieldValidator instances may not
 // be initialized correctly.
 func (s Schema) Compile(rc ReferenceChecker) error {
+	if s.MaxArrayLen > 0 {
+		for _, def := range s.Fields {
+			applyMaxArrayLen(def, s.MaxArrayLen)
+		}
+	}
 	if err := compileDependencies(s, s); err != nil {
 		return err
 	}
+	for _, c := range s.Conditions {
+		if err := c.compile(s); err != nil {
+			return err
+		}
+	}
+	for _, fields := range s.UniqueTogether {
+		for _, field := range fields {
+			if _, found := s.Fields[field]; !found {
+				return fmt.Errorf("%s: unknown unique together field", field)
+			}
+		}
+	}
+	for _, r := range s.Rules {
+		if c, ok := r.(interface {
+			compile(s Schema) error
+		}); ok {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+		}
+	}
 	for field, def := range s.Fields {
 		// Compile each field.
 		if err := def.Compile(rc); err != nil {
@@ -104,6 +179,25 @@ func (s Schema) Prepare(ctx context.Context, payload map[string]interface{}, ori
 	base = map[string]interface{}{}
 	for field, def := range s.Fields {
 		value, found := payload[field]
+		if !def.IsEnabled(ctx) {
+			// Disabled fields are treated as nonexistent: Validate() rejects
+			// them if provided and their stored value is kept untouched.
+			changes[field] = disabledField{Provided: found}
+			if original != nil {
+				if oValue, oFound := (*original)[field]; oFound {
+					base[field] = oValue
+				}
+			}
+			continue
+		}
+		if found && value != nil && def.Unmarshal != nil {
+			// Convert the value to its storage form so changes are detected
+			// against the stored value. On error, the original value is kept
+			// and will be rejected by Validate().
+			if v, err := def.Unmarshal(value); err == nil {
+				value = v
+			}
+		}
 		if original == nil {
 			if replace == true {
 				log.Panic("Cannot use replace=true without original")
@@ -112,7 +206,7 @@ func (s Schema) Prepare(ctx context.Context, payload map[string]interface{}, ori
 			if !found || value == nil {
 				// Add default fields
 				if def.Default != nil {
-					base[field] = def.Default
+					base[field] = copyValue(def.Default)
 				}
 			} else if found {
 				changes[field] = value
@@ -120,10 +214,20 @@ func (s Schema) Prepare(ctx context.Context, payload map[string]interface{}, ori
 		} else {
 			// Handle prepare on an updated document (original provided).
 			oValue, oFound := (*original)[field]
+			stored := oValue
+			if oFound && def.Encrypter != nil {
+				// Compare plaintexts as the same value may be encrypted
+				// differently. The stored ciphertext, resubmitted as is
+				// by a JSON Patch, is not a change either.
+				oValue = def.decrypt(oValue)
+				if found && isEqual(value, stored) {
+					value = oValue
+				}
+			}
 			// Apply value to change-set only if the field was not identical same in the original doc.
 			if found {
-				if def.Validator != nil {
-					if validated, err := def.Validator.Validate(value); err != nil {
+				if validator := def.validator(ctx); validator != nil {
+					if validated, err := validateValue(ctx, validator, value); err != nil {
 						// We treat a validation error as a change; the validation
 						// error indicate invalid payload and will be caught
 						// again by schema.Validate().
@@ -131,7 +235,7 @@ func (s Schema) Prepare(ctx context.Context, payload map[string]interface{}, ori
 					} else if !oFound || !reflect.DeepEqual(validated, oValue) {
 						changes[field] = validated
 					}
-				} else if !oFound || !reflect.DeepEqual(value, oValue) {
+				} else if !oFound || !isEqual(value, oValue) {
 					changes[field] = value
 				}
 			} else if oFound && replace {
@@ -140,16 +244,16 @@ func (s Schema) Prepare(ctx context.Context, payload map[string]interface{}, ori
 				// ReadOnly and then the field can be removed from the output document.
 				// One exception to that though: if the field is set to hidden and is not readonly, we use
 				// previous value as the client would have no way to resubmit the stored value.
-				if def.Hidden && !def.ReadOnly {
+				if def.IsHidden(ctx) && !def.ReadOnly {
 					changes[field] = oValue
 				} else if def.Default != nil {
-					changes[field] = def.Default
+					changes[field] = copyValue(def.Default)
 				} else {
 					changes[field] = Tombstone
 				}
 			}
 			if oFound {
-				base[field] = oValue
+				base[field] = stored
 			}
 		}
 		if def.Schema != nil {
@@ -210,6 +314,9 @@ func (s Schema) Prepare(ctx context.Context, payload map[string]interface{}, ori
 			}
 		}
 	}
+	if original == nil {
+		s.applyDefaultsFromDoc(ctx, changes, base)
+	}
 	// Assign all out of schema fields to the changes map so Validate() can
 	// complain about it.
 	for field, value := range payload {
@@ -220,17 +327,180 @@ func (s Schema) Prepare(ctx context.Context, payload map[string]interface{}, ori
 	return
 }
 
+// applyDefaultsFromDoc sets the DefaultFromDoc defaults of the fields absent
+// from a new document in base. The fields are evaluated in rounds, in the
+// alphabetical order, until a round sets no more default so defaults derived
+// from other defaults are resolved whatever their order.
+func (s Schema) applyDefaultsFromDoc(ctx context.Context, changes, base map[string]interface{}) {
+	var pending []string
+	for field, def := range s.Fields {
+		if def.DefaultFromDoc == nil || !def.IsEnabled(ctx) {
+			continue
+		}
+		if _, found := changes[field]; found {
+			continue
+		}
+		if _, found := base[field]; found {
+			continue
+		}
+		pending = append(pending, field)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	sort.Strings(pending)
+	doc := make(map[string]interface{}, len(base)+len(changes))
+	for field, value := range base {
+		doc[field] = value
+	}
+	for field, value := range changes {
+		if _, disabled := value.(disabledField); !disabled {
+			doc[field] = value
+		}
+	}
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		remaining := pending[:0]
+		for _, field := range pending {
+			if value := s.Fields[field].DefaultFromDoc(ctx, doc); value != nil {
+				base[field] = value
+				doc[field] = value
+				progress = true
+			} else {
+				remaining = append(remaining, field)
+			}
+		}
+		pending = remaining
+	}
+}
+
 // Validate validates changes applied on a base document in regard to the schema
 // and generate an result document with the changes applied to the base document.
 // All errors in the process are reported in the returned errs value.
+//
+// As the write mode is unknown, Field.RequiredOn is not enforced. Use
+// ValidateMode to enforce it.
 func (s Schema) Validate(changes map[string]interface{}, base map[string]interface{}) (doc map[string]interface{}, errs map[string][]interface{}) {
-	return s.validate(changes, base, true)
+	return s.validate(context.Background(), changes, base, 0, true)
+}
+
+// ValidateMode implements ModeValidator.
+func (s Schema) ValidateMode(changes map[string]interface{}, base map[string]interface{}, mode Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	return s.validate(context.Background(), changes, base, mode, true)
+}
+
+// ValidateContext implements ContextValidator. The fields' validators are
+// selected for the request context (see Field.Variant).
+func (s Schema) ValidateContext(ctx context.Context, changes map[string]interface{}, base map[string]interface{}, mode Mode) (doc map[string]interface{}, errs map[string][]interface{}) {
+	return s.validate(ctx, changes, base, mode, true)
+}
+
+// Variants implements VariantSelector. The variants of the fields, including
+// those of sub-schemas, are listed as sorted path=variant pairs.
+func (s Schema) Variants(ctx context.Context) string {
+	return strings.Join(s.variants(ctx, ""), ",")
+}
+
+func (s Schema) variants(ctx context.Context, prefix string) []string {
+	var variants []string
+	for field, def := range s.Fields {
+		if def.Schema != nil {
+			variants = append(variants, def.Schema.variants(ctx, prefix+field+".")...)
+		} else if def.Variant != nil {
+			if v := def.Variant(ctx); def.VariantValidators[v] != nil {
+				variants = append(variants, prefix+field+"="+v)
+			}
+		}
+	}
+	sort.Strings(variants)
+	return variants
+}
+
+// ExternalState implements ExternalStateSelector. The states of the
+// ReferenceEnum validators of the fields, including those of sub-schemas, are
+// listed as sorted path=state pairs.
+func (s Schema) ExternalState() (string, bool) {
+	var states []string
+	if !s.externalState("", &states) {
+		return "", false
+	}
+	sort.Strings(states)
+	return strings.Join(states, ","), true
+}
+
+func (s Schema) externalState(prefix string, states *[]string) bool {
+	for field, def := range s.Fields {
+		if !def.externalState(prefix+field, states) {
+			return false
+		}
+	}
+	return true
+}
+
+// externalState adds the states of the ReferenceEnum validators of the field
+// at path to states. It returns false if one of them is not cached.
+func (f Field) externalState(path string, states *[]string) bool {
+	if f.Schema != nil {
+		return f.Schema.externalState(path+".", states)
+	}
+	if !validatorExternalState(path, f.Validator, states) {
+		return false
+	}
+	for _, v := range f.VariantValidators {
+		if !validatorExternalState(path, v, states) {
+			return false
+		}
+	}
+	return true
+}
+
+func validatorExternalState(path string, v FieldValidator, states *[]string) bool {
+	var validators []FieldValidator
+	switch t := v.(type) {
+	case *ReferenceEnum:
+		state, ok := t.state()
+		if ok {
+			*states = append(*states, path+"="+state)
+		}
+		return ok
+	case *Array:
+		return t.Values.externalState(path+"[]", states)
+	case *Dict:
+		return t.Values.externalState(path+"{}", states)
+	case *Object:
+		return t.Schema == nil || t.Schema.externalState(path+".", states)
+	case AllOf:
+		validators = t
+	case *AllOf:
+		validators = *t
+	case AnyOf:
+		validators = t
+	case *AnyOf:
+		validators = *t
+	case Null:
+		validators = t
+	case *Null:
+		validators = *t
+	}
+	for _, v := range validators {
+		if !validatorExternalState(path, v, states) {
+			return false
+		}
+	}
+	return true
 }
 
-func (s Schema) validate(changes map[string]interface{}, base map[string]interface{}, isRoot bool) (doc map[string]interface{}, errs map[string][]interface{}) {
+// validate validates changes applied on base for mode with the validators of
+// the fields selected for ctx.
+func (s Schema) validate(ctx context.Context, changes map[string]interface{}, base map[string]interface{}, mode Mode, isRoot bool) (doc map[string]interface{}, errs map[string][]interface{}) {
 	doc = map[string]interface{}{}
 	errs = map[string][]interface{}{}
+	changes, disabled := removeDisabledFields(changes, errs)
+	partial := mode&Partial != 0
 	for field, def := range s.Fields {
+		if disabled[field] {
+			continue
+		}
 		// Check read only fields.
 		if def.ReadOnly {
 			if _, found := changes[field]; found {
@@ -238,12 +508,13 @@ func (s Schema) validate(changes map[string]interface{}, base map[string]interfa
 			}
 		}
 		// Check required fields.
-		if def.Required {
-			if value, found := changes[field]; !found || value == nil || value == Tombstone {
+		if !partial && (def.Required || requiredOn(def.RequiredOn, mode)) {
+			if value, found := changes[field]; !found || value == Tombstone || (value == nil && !def.Nullable) {
 				if found {
-					// If explicitly set to null, raise the required error.
+					// If explicitly set to null or removed, raise the required
+					// error.
 					addFieldError(errs, field, "required")
-				} else if value, found = base[field]; !found || value == nil {
+				} else if value, found = base[field]; !found || (value == nil && !def.Nullable) {
 					// If field was omitted and isn't set by a Default of a hook, raise.
 					addFieldError(errs, field, "required")
 				}
@@ -251,11 +522,11 @@ func (s Schema) validate(changes map[string]interface{}, base map[string]interfa
 		}
 		// Validate sub-schema on non provided fields in order to enforce
 		// required.
-		if def.Schema != nil {
+		if def.Schema != nil && !partial {
 			if _, found := changes[field]; !found {
 				if _, found := base[field]; !found {
 					empty := map[string]interface{}{}
-					if _, subErrs := def.Schema.validate(empty, empty, false); len(subErrs) > 0 {
+					if _, subErrs := def.Schema.validate(ctx, empty, empty, mode, false); len(subErrs) > 0 {
 						addFieldError(errs, field, subErrs)
 					}
 				}
@@ -274,18 +545,23 @@ func (s Schema) validate(changes map[string]interface{}, base map[string]interfa
 			doc[field] = value
 		}
 	}
-	// Validate all dependency from the root schema only as dependencies can
-	// refers to parent schemas.
-	if isRoot {
-		mergeErrs := s.validateDependencies(changes, doc, "")
-		mergeFieldErrors(errs, mergeErrs)
-	}
+	var extras map[string]interface{}
 	for field, value := range doc {
 		// Check invalid field (fields provided in the payload by not present in
 		// the schema).
 		def, found := s.Fields[field]
 		if !found {
-			addFieldError(errs, field, "invalid field")
+			switch s.UnknownFields {
+			case UnknownFieldsStrip:
+				delete(doc, field)
+			case UnknownFieldsAllow:
+			default:
+				addFieldError(errs, field, "invalid field")
+			}
+			continue
+		}
+		if value == nil && def.Nullable {
+			// Explicit null is stored as is on nullable fields.
 			continue
 		}
 		if def.Schema != nil {
@@ -309,19 +585,108 @@ func (s Schema) validate(changes map[string]interface{}, base map[string]interfa
 				}
 			}
 			// Validate sub document and add the result to the current doc's field.
-			if subDoc, subErrs := def.Schema.validate(subChanges, subBase, false); len(subErrs) > 0 {
+			if subDoc, subErrs := def.Schema.validate(withWarningsField(ctx, field), subChanges, subBase, mode, false); len(subErrs) > 0 {
 				addFieldError(errs, field, subErrs)
 			} else {
 				doc[field] = subDoc
 			}
-		} else if def.Validator != nil {
+		} else if validator := def.validator(ctx); validator != nil {
 			// Apply validator if provided.
 			var err error
-			if value, err = def.Validator.Validate(value); err != nil {
-				addFieldError(errs, field, err.Error())
+			_, changed := changes[field]
+			if !changed {
+				// Stored values of encrypted fields are validated in
+				// plaintext.
+				value = def.decrypt(value)
+			}
+			var extra map[string]interface{}
+			var warnings []string
+			input := value
+			// Only changed fields raise warnings.
+			wv, warns := validator.(WarningValidator)
+			warns = warns && changed && collectsWarnings(ctx)
+			if uv, ok := validator.(UpdateValidator); ok && isUpdate(changes, base, field) {
+				// Validate the new value relative to the value it replaces.
+				value, err = uv.ValidateUpdate(value, def.decrypt(base[field]))
+			} else if ev, ok := validator.(ExtraValidator); ok {
+				value, extra, err = ev.ValidateExtra(value)
+			} else if cv, ok := validator.(FieldContextValidator); ok {
+				value, err = cv.ValidateContext(ctx, value)
+			} else if warns {
+				value, warnings, err = wv.ValidateWarn(value)
+				warns = false
+				if err == nil {
+					addFieldWarnings(ctx, field, warnings)
+				}
+			} else {
+				value, err = validator.Validate(value)
+			}
+			if err == nil && warns {
+				// The value was validated through another entry point: only
+				// collect the warnings it raises.
+				if _, warnings, err := wv.ValidateWarn(input); err == nil {
+					addFieldWarnings(ctx, field, warnings)
+				}
+			}
+			if err != nil {
+				addFieldError(errs, field, fieldError(err))
 			} else {
 				// Store the normalized value.
 				doc[field] = value
+				for name, v := range extra {
+					if extras == nil {
+						extras = map[string]interface{}{}
+					}
+					extras[name] = v
+				}
+			}
+		}
+	}
+	// Merge the derived fields set by ExtraValidator validators once all the
+	// fields are validated, so they are not validated themselves. They are
+	// merged into the changes as well so they are checked by the dependencies
+	// and encrypted like the other changed fields.
+	if len(extras) > 0 {
+		merged := make(map[string]interface{}, len(changes)+len(extras))
+		for field, value := range changes {
+			merged[field] = value
+		}
+		changes = merged
+	}
+	for field, value := range extras {
+		if _, found := s.Fields[field]; !found {
+			addFieldError(errs, field, "invalid field")
+			continue
+		}
+		doc[field] = value
+		changes[field] = value
+	}
+	// Validate all dependency from the root schema only as dependencies can
+	// refers to parent schemas.
+	if isRoot {
+		mergeErrs := s.validateDependencies(changes, doc, "", mode)
+		mergeFieldErrors(errs, mergeErrs)
+	}
+	if isRoot {
+		for _, r := range s.Rules {
+			if field, err := r.Check(doc); err != nil {
+				addFieldError(errs, field, fieldError(err))
+			}
+		}
+	}
+	// Encrypt the changed values of encrypted fields for storage once the
+	// document is valid. Unchanged values keep their stored ciphertext.
+	for field, value := range doc {
+		if len(errs) > 0 {
+			break
+		}
+		if def, found := s.Fields[field]; found && def.Encrypter != nil && value != nil {
+			if _, changed := changes[field]; !changed {
+				doc[field] = base[field]
+			} else if v, err := def.Encrypter.Encrypt(value); err != nil {
+				addFieldError(errs, field, fmt.Sprintf("can't be encrypted: %v", err))
+			} else {
+				doc[field] = v
 			}
 		}
 	}
@@ -337,6 +702,52 @@ func (s Schema) validate(changes map[string]interface{}, base map[string]interfa
 	return doc, errs
 }
 
+// removeDisabledFields returns changes without the fields marked as disabled by
+// Prepare, and the set of those fields. Disabled fields provided by the client
+// are reported as invalid.
+func removeDisabledFields(changes map[string]interface{}, errs map[string][]interface{}) (map[string]interface{}, map[string]bool) {
+	var disabled map[string]bool
+	for field, value := range changes {
+		if d, ok := value.(disabledField); ok {
+			if disabled == nil {
+				disabled = map[string]bool{}
+			}
+			disabled[field] = true
+			if d.Provided {
+				addFieldError(errs, field, "invalid field")
+			}
+		}
+	}
+	if disabled == nil {
+		return changes, nil
+	}
+	filtered := make(map[string]interface{}, len(changes))
+	for field, value := range changes {
+		if !disabled[field] {
+			filtered[field] = value
+		}
+	}
+	return filtered, disabled
+}
+
+// validateValue validates value with validator, passing ctx to it if it is a
+// FieldContextValidator.
+func validateValue(ctx context.Context, validator FieldValidator, value interface{}) (interface{}, error) {
+	if cv, ok := validator.(FieldContextValidator); ok {
+		return cv.ValidateContext(ctx, value)
+	}
+	return validator.Validate(value)
+}
+
+// isUpdate returns true if the field is changed over an existing base value.
+func isUpdate(changes, base map[string]interface{}, field string) bool {
+	if v, found := changes[field]; !found || v == Tombstone {
+		return false
+	}
+	_, found := base[field]
+	return found
+}
+
 func addFieldError(errs map[string][]interface{}, field string, err interface{}) {
 	errs[field] = append(errs[field], err)
 }
@@ -1,6 +1,12 @@
 package schema_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/rs/rest-layer/schema"
@@ -93,3 +99,809 @@ func TestSchemaValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestSchemaValidateDetailedError(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"foo": schema.Field{Validator: &schema.String{Allowed: []string{"a", "b"}}},
+			"bar": schema.Field{Validator: &schema.String{MaxLen: 1}},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+	_, errs := s.Validate(nil, map[string]interface{}{"foo": "c", "bar": "cc"})
+	assert.Equal(t, map[string][]interface{}{
+		"foo": {schema.NotAllowedError{Message: "not one of [a, b]", Allowed: []interface{}{"a", "b"}}},
+		"bar": {"is longer than 1"},
+	}, errs)
+}
+
+func TestSchemaValidateStatusError(t *testing.T) {
+	conflict := schema.WithStatus(errors.New("already taken"), 409)
+	notAllowed := schema.WithStatus(schema.NotAllowedError{Message: "not one of [a]", Allowed: []interface{}{"a"}}, 403)
+	taken := schema.FieldValidatorFunc(func(value interface{}) (interface{}, error) {
+		return nil, conflict
+	})
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"foo": schema.Field{Validator: &taken},
+			"bar": schema.Field{Validator: &schema.String{MaxLen: 1}},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+	_, errs := s.Validate(nil, map[string]interface{}{"foo": "a", "bar": "cc"})
+	assert.Equal(t, map[string][]interface{}{
+		"foo": {conflict},
+		"bar": {"is longer than 1"},
+	}, errs)
+	assert.Equal(t, 409, errs["foo"][0].(schema.StatusError).HTTPStatus())
+	// Details are kept.
+	assert.Equal(t, 403, notAllowed.(schema.StatusError).HTTPStatus())
+	assert.Equal(t, []interface{}{"a"}, notAllowed.(schema.DetailedError).ErrorDetail()["allowed"])
+}
+
+func TestSchemaUnknownFields(t *testing.T) {
+	payload := map[string]interface{}{"foo": "bar", "extra": 1, "sub": map[string]interface{}{"baz": true, "extra": 2}}
+	newSchema := func(policy schema.UnknownFieldsPolicy) schema.Schema {
+		return schema.Schema{
+			UnknownFields: policy,
+			Fields: schema.Fields{
+				"foo": {Validator: &schema.String{}},
+				"sub": {Schema: &schema.Schema{
+					UnknownFields: policy,
+					Fields:        schema.Fields{"baz": {Validator: &schema.Bool{}}},
+				}},
+			},
+		}
+	}
+	validate := func(s schema.Schema) (map[string]interface{}, map[string][]interface{}) {
+		assert.NoError(t, s.Compile(nil))
+		changes, base := s.Prepare(context.Background(), payload, nil, false)
+		return s.Validate(changes, base)
+	}
+
+	_, errs := validate(newSchema(schema.UnknownFieldsReject))
+	assert.Equal(t, map[string][]interface{}{
+		"extra": {"invalid field"},
+		"sub":   {map[string][]interface{}{"extra": {"invalid field"}}},
+	}, errs)
+
+	doc, errs := validate(newSchema(schema.UnknownFieldsStrip))
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"foo": "bar", "sub": map[string]interface{}{"baz": true}}, doc)
+
+	doc, errs = validate(newSchema(schema.UnknownFieldsAllow))
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"foo": "bar", "extra": 1, "sub": map[string]interface{}{"baz": true, "extra": 2}}, doc)
+}
+
+func TestSchemaValidateUpdate(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"counter": {Validator: &schema.MonotonicInteger{}},
+		},
+	}
+	doc, errs := s.Validate(map[string]interface{}{"counter": 3}, map[string]interface{}{"counter": 2})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"counter": 3}, doc)
+
+	_, errs = s.Validate(map[string]interface{}{"counter": 1}, map[string]interface{}{"counter": 2})
+	assert.Equal(t, map[string][]interface{}{"counter": {"cannot decrease from 2"}}, errs)
+
+	// Without base value, the field is validated as a regular integer.
+	doc, errs = s.Validate(map[string]interface{}{"counter": 1}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"counter": 1}, doc)
+}
+
+func TestSchemaPrepareNumericChange(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"count": {},
+			"tags":  {},
+		},
+	}
+	original := map[string]interface{}{"count": 1, "tags": []interface{}{1, 2}}
+	// JSON decoding gives float64 for the same numbers.
+	payload := map[string]interface{}{"count": float64(1), "tags": []interface{}{float64(1), float64(2)}}
+	changes, base := s.Prepare(context.Background(), payload, &original, false)
+	assert.Equal(t, map[string]interface{}{}, changes)
+	assert.Equal(t, original, base)
+
+	payload = map[string]interface{}{"count": float64(2)}
+	changes, _ = s.Prepare(context.Background(), payload, &original, false)
+	assert.Equal(t, map[string]interface{}{"count": float64(2)}, changes)
+
+	// Integers beyond float64 precision are compared exactly.
+	original = map[string]interface{}{"count": int64(9007199254740992)}
+	payload = map[string]interface{}{"count": json.Number("9007199254740993")}
+	changes, _ = s.Prepare(context.Background(), payload, &original, false)
+	assert.Equal(t, payload, changes)
+	payload = map[string]interface{}{"count": json.Number("9007199254740992")}
+	changes, _ = s.Prepare(context.Background(), payload, &original, false)
+	assert.Equal(t, map[string]interface{}{}, changes)
+	payload = map[string]interface{}{"count": json.Number("9007199254740992.0")}
+	changes, _ = s.Prepare(context.Background(), payload, &original, false)
+	assert.Equal(t, map[string]interface{}{}, changes)
+}
+
+func TestSchemaPrepareDefaultCopy(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"tags":   {Default: []interface{}{"a"}},
+			"labels": {Default: []string{"b"}},
+			"meta":   {Default: map[string]interface{}{"k": []interface{}{1}}},
+		},
+	}
+	_, base1 := s.Prepare(context.Background(), map[string]interface{}{}, nil, false)
+	_, base2 := s.Prepare(context.Background(), map[string]interface{}{}, nil, false)
+	base1["tags"].([]interface{})[0] = "x"
+	base1["labels"].([]string)[0] = "x"
+	base1["meta"].(map[string]interface{})["k"].([]interface{})[0] = 2
+	assert.Equal(t, []interface{}{"a"}, base2["tags"])
+	assert.Equal(t, []string{"b"}, base2["labels"])
+	assert.Equal(t, map[string]interface{}{"k": []interface{}{1}}, base2["meta"])
+	assert.Equal(t, []interface{}{"a"}, s.Fields["tags"].Default)
+	assert.Equal(t, []string{"b"}, s.Fields["labels"].Default)
+}
+
+type betaKey struct{}
+
+func TestSchemaEnabled(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"name": {Validator: &schema.String{}},
+			"beta": {
+				Validator: &schema.String{},
+				Required:  true,
+				Enabled: func(ctx context.Context) bool {
+					return ctx.Value(betaKey{}) == true
+				},
+			},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+	beta := context.WithValue(context.Background(), betaKey{}, true)
+	payload := map[string]interface{}{"name": "foo", "beta": "bar"}
+
+	changes, base := s.Prepare(beta, payload, nil, false)
+	doc, errs := s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo", "beta": "bar"}, doc)
+
+	// Disabled fields are rejected when provided and not required otherwise.
+	changes, base = s.Prepare(context.Background(), payload, nil, false)
+	_, errs = s.Validate(changes, base)
+	assert.Equal(t, map[string][]interface{}{"beta": {"invalid field"}}, errs)
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{"name": "foo"}, nil, false)
+	doc, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo"}, doc)
+
+	// The stored value of a disabled field is kept on replace.
+	original := map[string]interface{}{"name": "foo", "beta": "bar"}
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{"name": "baz"}, &original, true)
+	doc, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "baz", "beta": "bar"}, doc)
+}
+
+func TestSchemaDefaultFromDoc(t *testing.T) {
+	// display_name defaults to the username which itself defaults to the
+	// local part of the email, whatever the evaluation order of the fields.
+	fromField := func(field string, transform func(string) string) func(context.Context, map[string]interface{}) interface{} {
+		return func(ctx context.Context, doc map[string]interface{}) interface{} {
+			if v, ok := doc[field].(string); ok {
+				return transform(v)
+			}
+			return nil
+		}
+	}
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"email": {Validator: &schema.String{}},
+			"username": {
+				Validator: &schema.String{},
+				DefaultFromDoc: fromField("email", func(v string) string {
+					return strings.SplitN(v, "@", 2)[0]
+				}),
+			},
+			"display_name": {
+				Validator:      &schema.String{},
+				DefaultFromDoc: fromField("username", strings.ToUpper),
+			},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+
+	changes, base := s.Prepare(context.Background(), map[string]interface{}{"email": "john@example.com"}, nil, false)
+	doc, errs := s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"email": "john@example.com", "username": "john", "display_name": "JOHN"}, doc)
+
+	// Provided fields are not defaulted.
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{"email": "john@example.com", "username": "jdoe"}, nil, false)
+	doc, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"email": "john@example.com", "username": "jdoe", "display_name": "JDOE"}, doc)
+
+	// Fields are left unset when no default applies.
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{}, nil, false)
+	doc, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{}, doc)
+
+	// Defaults are only applied on creation.
+	original := map[string]interface{}{"email": "john@example.com"}
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{"email": "jane@example.com"}, &original, true)
+	doc, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"email": "jane@example.com"}, doc)
+}
+
+// nonceEncrypter is a non deterministic test Encrypter prefixing values with
+// a nonce.
+type nonceEncrypter struct {
+	nonce int
+}
+
+func (e *nonceEncrypter) Encrypt(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	e.nonce++
+	return fmt.Sprintf("%d:%s", e.nonce, strings.ToUpper(s)), nil
+}
+
+func (e *nonceEncrypter) Decrypt(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, ":") {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return strings.ToLower(strings.SplitN(s, ":", 2)[1]), nil
+}
+
+func TestSchemaEncrypter(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"name": {Validator: &schema.String{}},
+			"ssn": {
+				Validator: &schema.String{Regexp: "^[0-9a-z-]+$"},
+				Encrypter: &nonceEncrypter{},
+			},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+
+	// Plaintext is validated and encrypted for storage.
+	changes, base := s.Prepare(context.Background(), map[string]interface{}{"name": "foo", "ssn": "abc-1"}, nil, false)
+	doc, errs := s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo", "ssn": "1:ABC-1"}, doc)
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{"ssn": "ABC"}, nil, false)
+	_, errs = s.Validate(changes, base)
+	assert.Equal(t, map[string][]interface{}{"ssn": {"does not match ^[0-9a-z-]+$"}}, errs)
+
+	// Unchanged plaintexts and resubmitted ciphertexts are not changes.
+	original := doc
+	changes, _ = s.Prepare(context.Background(), map[string]interface{}{"ssn": "abc-1"}, &original, false)
+	assert.Equal(t, map[string]interface{}{}, changes)
+	changes, _ = s.Prepare(context.Background(), map[string]interface{}{"name": "foo", "ssn": "1:ABC-1"}, &original, true)
+	assert.Equal(t, map[string]interface{}{}, changes)
+
+	// Stored values are validated in plaintext and kept encrypted as is.
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{"name": "bar"}, &original, false)
+	doc, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "bar", "ssn": "1:ABC-1"}, doc)
+	changes, base = s.Prepare(context.Background(), map[string]interface{}{"ssn": "def"}, &original, false)
+	doc, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo", "ssn": "2:DEF"}, doc)
+}
+
+func TestSchemaEncrypterCompileError(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"ssn": {Encrypter: &nonceEncrypter{}, Filterable: true},
+		},
+	}
+	assert.EqualError(t, s.Compile(nil), "ssn: encrypted fields can't have a sub-schema nor be filterable or sortable")
+}
+
+// addressValidator parses addresses formatted as "<street>, <postal code>
+// <city>" and sets their normalized form and postal code as extra fields.
+type addressValidator struct {
+	extra string
+}
+
+func (v addressValidator) Validate(value interface{}) (interface{}, error) {
+	value, _, err := v.ValidateExtra(value)
+	return value, err
+}
+
+func (v addressValidator) ValidateExtra(value interface{}) (interface{}, map[string]interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, nil, errors.New("not a string")
+	}
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) != 2 {
+		return nil, nil, errors.New("not an address")
+	}
+	city := strings.Fields(parts[1])
+	if len(city) < 2 {
+		return nil, nil, errors.New("not an address")
+	}
+	extra := map[string]interface{}{
+		"address_normalized": strings.ToUpper(strings.TrimSpace(parts[0]) + ", " + strings.Join(city, " ")),
+		"postal_code":        city[0],
+	}
+	if v.extra != "" {
+		extra[v.extra] = true
+	}
+	return s, extra, nil
+}
+
+func TestSchemaExtraValidator(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"address":            {Validator: &addressValidator{}},
+			"address_normalized": {ReadOnly: true, Validator: &schema.String{}},
+			"postal_code":        {ReadOnly: true},
+		},
+	}
+	if !assert.NoError(t, s.Compile(nil)) {
+		return
+	}
+	doc, errs := s.Validate(map[string]interface{}{"address": "12 Main St,  75001   Paris"}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{
+		"address":            "12 Main St,  75001   Paris",
+		"address_normalized": "12 MAIN ST, 75001 PARIS",
+		"postal_code":        "75001",
+	}, doc)
+
+	// Derived fields override the stored ones.
+	doc, errs = s.Validate(map[string]interface{}{"address": "1 Elm St, 10001 New York"}, doc)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, "1 ELM ST, 10001 NEW YORK", doc["address_normalized"])
+	assert.Equal(t, "10001", doc["postal_code"])
+
+	_, errs = s.Validate(map[string]interface{}{"address": "12 Main St"}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"address": {"not an address"}}, errs)
+
+	s.Fields["address"] = schema.Field{Validator: &addressValidator{extra: "geocoded"}}
+	_, errs = s.Validate(map[string]interface{}{"address": "12 Main St, 75001 Paris"}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"geocoded": {"invalid field"}}, errs)
+}
+
+func TestSchemaExtraValidatorChanges(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"address":            {Validator: &addressValidator{}},
+			"address_normalized": {ReadOnly: true, Encrypter: &nonceEncrypter{}},
+			"postal_code":        {ReadOnly: true},
+			"district":           {},
+		},
+		Conditions: []schema.Condition{schema.When("postal_code", "75001").Require("district")},
+	}
+	if !assert.NoError(t, s.Compile(nil)) {
+		return
+	}
+	doc, errs := s.Validate(map[string]interface{}{"address": "1 Elm St, 10001 New York"}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, "1:1 ELM ST, 10001 NEW YORK", doc["address_normalized"])
+
+	// Derived fields are encrypted again rather than keeping the stored
+	// ciphertext.
+	doc, errs = s.Validate(map[string]interface{}{"address": "2 Elm St, 10001 New York"}, doc)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, "2:2 ELM ST, 10001 NEW YORK", doc["address_normalized"])
+
+	// Derived fields are checked by the conditions.
+	_, errs = s.Validate(map[string]interface{}{"address": "12 Main St, 75001 Paris"}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"district": {"required"}}, errs)
+}
+
+func TestSchemaVariantValidators(t *testing.T) {
+	type cohortKey struct{}
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"name": {Validator: &schema.String{}},
+			"phone": {
+				Validator: &schema.String{},
+				VariantValidators: map[string]schema.FieldValidator{
+					"strict": &schema.String{Regexp: "^[0-9]+$"},
+				},
+				Variant: func(ctx context.Context) string {
+					cohort, _ := ctx.Value(cohortKey{}).(string)
+					return cohort
+				},
+			},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+	strict := context.WithValue(context.Background(), cohortKey{}, "strict")
+	other := context.WithValue(context.Background(), cohortKey{}, "other")
+	payload := map[string]interface{}{"name": "foo", "phone": "+1 555"}
+
+	changes, base := s.Prepare(strict, payload, nil, false)
+	_, errs := s.ValidateContext(strict, changes, base, schema.Create)
+	assert.Equal(t, map[string][]interface{}{"phone": {"does not match ^[0-9]+$"}}, errs)
+	assert.Equal(t, "phone=strict", s.Variants(strict))
+
+	// Unknown variants and validation without context use the Validator.
+	changes, base = s.Prepare(other, payload, nil, false)
+	doc, errs := s.ValidateContext(other, changes, base, schema.Create)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, payload, doc)
+	assert.Equal(t, "", s.Variants(other))
+	_, errs = s.Validate(changes, base)
+	assert.Len(t, errs, 0)
+}
+
+func TestSchemaVariantValidatorsCompileError(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"phone": {
+				Validator: &schema.String{},
+				VariantValidators: map[string]schema.FieldValidator{
+					"strict": schema.String{},
+				},
+			},
+		},
+	}
+	assert.EqualError(t, s.Compile(nil), "phone: variant strict: not a schema.Validator pointer")
+}
+
+func TestSchemaValidateModeRequiredOn(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"name": {RequiredOn: []schema.Mode{schema.Create, schema.Replace}},
+			"sub": {
+				Schema: &schema.Schema{Fields: schema.Fields{
+					"foo": {RequiredOn: []schema.Mode{schema.Create}},
+				}},
+			},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+	changes := map[string]interface{}{"sub": map[string]interface{}{}}
+
+	_, errs := s.ValidateMode(changes, map[string]interface{}{}, schema.Create)
+	assert.Equal(t, map[string][]interface{}{
+		"name": {"required"},
+		"sub":  {map[string][]interface{}{"foo": {"required"}}},
+	}, errs)
+	_, errs = s.ValidateMode(changes, map[string]interface{}{}, schema.Replace)
+	assert.Equal(t, map[string][]interface{}{"name": {"required"}}, errs)
+	_, errs = s.ValidateMode(changes, map[string]interface{}{}, schema.Update)
+	assert.Len(t, errs, 0)
+	// Validate doesn't know the mode and ignores RequiredOn.
+	_, errs = s.Validate(changes, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+}
+
+func TestSchemaValidateModePartial(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"name": {Required: true, Validator: &schema.String{}},
+			"age":  {RequiredOn: []schema.Mode{schema.Create}, Validator: &schema.Integer{}},
+			"sub": {
+				Schema: &schema.Schema{Fields: schema.Fields{
+					"foo": {Required: true},
+				}},
+			},
+			"type":   {Validator: &schema.String{}},
+			"tax_id": {Validator: &schema.String{}},
+			"street": {Validator: &schema.String{}},
+			"city":   {Validator: &schema.String{}},
+		},
+		Conditions: []schema.Condition{
+			schema.When("type", "business").Require("tax_id"),
+			schema.AllOrNone("street", "city"),
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+
+	// Required fields are skipped.
+	doc, errs := s.ValidateMode(map[string]interface{}{"name": "foo"}, map[string]interface{}{}, schema.Create|schema.Partial)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"name": "foo"}, doc)
+	// Provided fields are still validated.
+	_, errs = s.ValidateMode(map[string]interface{}{"age": "foo"}, map[string]interface{}{}, schema.Create|schema.Partial)
+	assert.Equal(t, map[string][]interface{}{"age": {"not an integer"}}, errs)
+	// Fields required by conditions are skipped.
+	draft := map[string]interface{}{"name": "foo", "type": "business", "street": "main st"}
+	_, errs = s.ValidateMode(draft, map[string]interface{}{}, schema.Create|schema.Partial)
+	assert.Len(t, errs, 0)
+	// A full validation enforces required fields.
+	_, errs = s.ValidateMode(draft, map[string]interface{}{}, schema.Create)
+	assert.Equal(t, map[string][]interface{}{
+		"age":    {"required"},
+		"sub":    {map[string][]interface{}{"foo": {"required"}}},
+		"tax_id": {"required"},
+		"city":   {"required together"},
+	}, errs)
+}
+
+func TestSchemaPrepareUnmarshal(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"price": {
+				Validator: &schema.Integer{},
+				Unmarshal: func(value interface{}) (interface{}, error) {
+					f, ok := value.(float64)
+					if !ok {
+						return nil, errors.New("not a price")
+					}
+					return int(math.Round(f * 100)), nil
+				},
+			},
+		},
+	}
+	changes, _ := s.Prepare(context.Background(), map[string]interface{}{"price": 12.5}, nil, false)
+	assert.Equal(t, map[string]interface{}{"price": 1250}, changes)
+
+	// Change detection compares the storage form.
+	original := map[string]interface{}{"price": 1250}
+	changes, _ = s.Prepare(context.Background(), map[string]interface{}{"price": 12.5}, &original, false)
+	assert.Equal(t, map[string]interface{}{}, changes)
+	changes, _ = s.Prepare(context.Background(), map[string]interface{}{"price": 12.75}, &original, false)
+	assert.Equal(t, map[string]interface{}{"price": 1275}, changes)
+
+	// Values failing to unmarshal are left for the validator to reject.
+	changes, base := s.Prepare(context.Background(), map[string]interface{}{"price": "free"}, nil, false)
+	assert.Equal(t, map[string]interface{}{"price": "free"}, changes)
+	_, errs := s.Validate(changes, base)
+	assert.Equal(t, map[string][]interface{}{"price": {"not an integer"}}, errs)
+}
+
+func TestSchemaConditions(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"type":    {},
+			"tax_id":  {},
+			"company": {},
+			"age":     {},
+		},
+		Conditions: []schema.Condition{
+			schema.When("type", "business").Require("tax_id", "company"),
+			schema.When("type", "minor", "student").Require("age"),
+		},
+	}
+	if !assert.NoError(t, s.Compile(nil)) {
+		return
+	}
+
+	// Condition met: fields are required.
+	_, errs := s.Validate(map[string]interface{}{"type": "business", "company": "ACME"}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"tax_id": {"required"}}, errs)
+	_, errs = s.Validate(map[string]interface{}{"type": "student", "age": nil}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"age": {"required"}}, errs)
+	// Condition met from the base document.
+	_, errs = s.Validate(map[string]interface{}{"company": "ACME"}, map[string]interface{}{"type": "business"})
+	assert.Equal(t, map[string][]interface{}{"tax_id": {"required"}}, errs)
+	doc, errs := s.Validate(map[string]interface{}{"type": "business", "company": "ACME", "tax_id": "123"}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"type": "business", "company": "ACME", "tax_id": "123"}, doc)
+
+	// Condition not met: fields are not required.
+	_, errs = s.Validate(map[string]interface{}{"type": "person"}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	_, errs = s.Validate(map[string]interface{}{}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+}
+
+func TestSchemaAllOrNone(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"name":   {},
+			"street": {},
+			"city":   {},
+			"zip":    {},
+			"type":   {},
+			"vat":    {},
+		},
+		Conditions: []schema.Condition{
+			schema.AllOrNone("street", "city", "zip"),
+			schema.When("type", "business").Require("street"),
+		},
+	}
+	if !assert.NoError(t, s.Compile(nil)) {
+		return
+	}
+
+	// None present.
+	_, errs := s.Validate(map[string]interface{}{"name": "John"}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	_, errs = s.Validate(map[string]interface{}{"street": nil}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+
+	// All present.
+	doc, errs := s.Validate(map[string]interface{}{"street": "Main St", "city": "Paris", "zip": "75001"}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"street": "Main St", "city": "Paris", "zip": "75001"}, doc)
+
+	// Partially filled, including from the base document.
+	_, errs = s.Validate(map[string]interface{}{"city": "Paris"}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"street": {"required together"}, "zip": {"required together"}}, errs)
+	_, errs = s.Validate(map[string]interface{}{"zip": "75001"}, map[string]interface{}{"street": "Main St"})
+	assert.Equal(t, map[string][]interface{}{"city": {"required together"}}, errs)
+
+	// Composed with other conditions.
+	_, errs = s.Validate(map[string]interface{}{"type": "business"}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"street": {"required"}}, errs)
+	_, errs = s.Validate(map[string]interface{}{"type": "business", "street": "Main St"}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{"city": {"required together"}, "zip": {"required together"}}, errs)
+}
+
+func TestSchemaConditionsCompileError(t *testing.T) {
+	s := schema.Schema{
+		Fields:     schema.Fields{"type": {}},
+		Conditions: []schema.Condition{schema.When("type", "business").Require("tax_id")},
+	}
+	assert.EqualError(t, s.Compile(nil), "tax_id: unknown condition field")
+	s.Conditions = []schema.Condition{schema.AllOrNone("type", "zip")}
+	assert.EqualError(t, s.Compile(nil), "zip: unknown condition field")
+}
+
+func TestSchemaUniqueTogetherCompileError(t *testing.T) {
+	s := schema.Schema{
+		Fields:         schema.Fields{"team": {}},
+		UniqueTogether: [][]string{{"team", "user"}},
+	}
+	assert.EqualError(t, s.Compile(nil), "user: unknown unique together field")
+}
+
+func TestSchemaMaxArrayLen(t *testing.T) {
+	s := schema.Schema{
+		MaxArrayLen: 2,
+		Fields: schema.Fields{
+			"tags":  {Validator: &schema.Array{}},
+			"names": {Validator: &schema.Array{MaxLen: 3}},
+			"sub": {Schema: &schema.Schema{Fields: schema.Fields{
+				"ids": {Validator: &schema.Array{}},
+			}}},
+			"own": {Schema: &schema.Schema{MaxArrayLen: 4, Fields: schema.Fields{
+				"ids": {Validator: &schema.Array{}},
+			}}},
+			"matrix": {Validator: &schema.Array{MaxLen: 5, Values: schema.Field{Validator: &schema.Array{}}}},
+		},
+	}
+	assert.NoError(t, s.Compile(nil))
+	three := []interface{}{1, 2, 3}
+	validate := func(doc map[string]interface{}) map[string][]interface{} {
+		_, errs := s.Validate(doc, map[string]interface{}{})
+		return errs
+	}
+
+	// The default applies where MaxLen is not set.
+	assert.Equal(t, map[string][]interface{}{"tags": {"has more items than 2"}}, validate(map[string]interface{}{"tags": three}))
+	assert.Equal(t, map[string][]interface{}{"sub": {map[string][]interface{}{"ids": {"has more items than 2"}}}},
+		validate(map[string]interface{}{"sub": map[string]interface{}{"ids": three}}))
+	assert.Equal(t, map[string][]interface{}{"matrix": {"invalid value at #1: has more items than 2"}},
+		validate(map[string]interface{}{"matrix": []interface{}{three}}))
+	// Explicit values win.
+	assert.Len(t, validate(map[string]interface{}{"names": three}), 0)
+	assert.Equal(t, map[string][]interface{}{"names": {"has more items than 3"}},
+		validate(map[string]interface{}{"names": []interface{}{1, 2, 3, 4}}))
+	assert.Len(t, validate(map[string]interface{}{"own": map[string]interface{}{"ids": three}}), 0)
+	assert.Len(t, validate(map[string]interface{}{"matrix": []interface{}{[]interface{}{1}, []interface{}{2}, []interface{}{3}}}), 0)
+}
+
+func TestSchemaValidateNullable(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"required":          {Required: true, Validator: &schema.String{}},
+			"required_nullable": {Required: true, Nullable: true, Validator: &schema.String{}},
+			"nullable":          {Nullable: true, Validator: &schema.String{}},
+		},
+	}
+	cases := []struct {
+		name    string
+		changes map[string]interface{}
+		doc     map[string]interface{}
+		errs    map[string][]interface{}
+	}{
+		{
+			name:    "present-value",
+			changes: map[string]interface{}{"required": "a", "required_nullable": "b", "nullable": "c"},
+			doc:     map[string]interface{}{"required": "a", "required_nullable": "b", "nullable": "c"},
+		},
+		{
+			name:    "present-null",
+			changes: map[string]interface{}{"required": "a", "required_nullable": nil, "nullable": nil},
+			doc:     map[string]interface{}{"required": "a", "required_nullable": nil, "nullable": nil},
+		},
+		{
+			name:    "present-null:not-nullable",
+			changes: map[string]interface{}{"required": nil, "required_nullable": "b"},
+			errs:    map[string][]interface{}{"required": {"required", "not a string"}},
+		},
+		{
+			name:    "absent",
+			changes: map[string]interface{}{},
+			errs:    map[string][]interface{}{"required": {"required"}, "required_nullable": {"required"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, errs := s.Validate(tc.changes, map[string]interface{}{})
+			if tc.errs != nil {
+				assert.Equal(t, tc.errs, errs)
+				return
+			}
+			assert.Len(t, errs, 0)
+			assert.Equal(t, tc.doc, doc)
+		})
+	}
+
+	// A null base value satisfies a required nullable field.
+	doc, errs := s.Validate(map[string]interface{}{"required": "a"}, map[string]interface{}{"required_nullable": nil})
+	assert.Len(t, errs, 0)
+	assert.Equal(t, map[string]interface{}{"required": "a", "required_nullable": nil}, doc)
+}
+
+func TestSchemaRulesMembership(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{
+			"default_variant": {Validator: &schema.String{}},
+			"variants": {
+				Validator: &schema.Array{
+					Values: schema.Field{
+						Validator: &schema.Object{
+							Schema: &schema.Schema{Fields: schema.Fields{"id": {Validator: &schema.String{}}}},
+						},
+					},
+				},
+			},
+			"main_tag": {},
+			"tags":     {},
+		},
+		Rules: []schema.Rule{
+			schema.ValueOf("default_variant").In("variants", "id"),
+			schema.ValueOf("main_tag").In("tags"),
+		},
+	}
+	if !assert.NoError(t, s.Compile(nil)) {
+		return
+	}
+	variants := []interface{}{
+		map[string]interface{}{"id": "a"},
+		map[string]interface{}{"id": "b"},
+	}
+
+	// Referenced ids are present.
+	_, errs := s.Validate(map[string]interface{}{
+		"default_variant": "b",
+		"variants":        variants,
+		"main_tag":        1,
+		"tags":            []interface{}{float64(1), float64(2)},
+	}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+
+	// Referenced ids are missing.
+	_, errs = s.Validate(map[string]interface{}{
+		"default_variant": "c",
+		"variants":        variants,
+		"main_tag":        "foo",
+	}, map[string]interface{}{})
+	assert.Equal(t, map[string][]interface{}{
+		"default_variant": {"not found in variants.id"},
+		"main_tag":        {"not found in tags"},
+	}, errs)
+
+	// Rule is ignored when the field is not set.
+	_, errs = s.Validate(map[string]interface{}{"variants": variants}, map[string]interface{}{})
+	assert.Len(t, errs, 0)
+}
+
+func TestSchemaRulesCompileError(t *testing.T) {
+	s := schema.Schema{
+		Fields: schema.Fields{"default_variant": {}},
+		Rules:  []schema.Rule{schema.ValueOf("default_variant").In("variants", "id")},
+	}
+	assert.EqualError(t, s.Compile(nil), "variants: unknown rule field")
+}
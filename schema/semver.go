@@ -0,0 +1,223 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer validates semantic version strings (major.minor.patch with optional
+// -prerelease and +build suffixes) as defined by https://semver.org. An
+// optional leading "v" is accepted and removed from the normalized value.
+type SemVer struct {
+	// Min is the lowest version allowed (inclusive).
+	Min string
+	// Max is the highest version allowed (inclusive).
+	Max string
+}
+
+// semver holds a parsed semantic version.
+type semver struct {
+	major, minor, patch uint64
+	pre                 []string
+	build               string
+}
+
+// Compile implements the Compiler interface and validates Min and Max.
+func (v SemVer) Compile(rc ReferenceChecker) error {
+	if v.Min != "" {
+		if _, err := parseSemVer(v.Min); err != nil {
+			return fmt.Errorf(": invalid min version: %v", err)
+		}
+	}
+	if v.Max != "" {
+		if _, err := parseSemVer(v.Max); err != nil {
+			return fmt.Errorf(": invalid max version: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate implements FieldValidator.
+func (v SemVer) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("invalid type")
+	}
+	ver, err := parseSemVer(s)
+	if err != nil {
+		return nil, err
+	}
+	if v.Min != "" {
+		if min, err := parseSemVer(v.Min); err == nil && ver.compare(min) < 0 {
+			return nil, fmt.Errorf("is lower than %s", min)
+		}
+	}
+	if v.Max != "" {
+		if max, err := parseSemVer(v.Max); err == nil && ver.compare(max) > 0 {
+			return nil, fmt.Errorf("is greater than %s", max)
+		}
+	}
+	return ver.String(), nil
+}
+
+// LessFunc implements the FieldComparator interface using the semantic
+// version precedence.
+func (v SemVer) LessFunc() LessFunc {
+	return v.less
+}
+
+func (v SemVer) less(value, other interface{}) bool {
+	s1, ok1 := value.(string)
+	s2, ok2 := other.(string)
+	if !ok1 || !ok2 {
+		return false
+	}
+	v1, err1 := parseSemVer(s1)
+	v2, err2 := parseSemVer(s2)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return v1.compare(v2) < 0
+}
+
+func parseSemVer(s string) (semver, error) {
+	var v semver
+	str := strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(str, '+'); i != -1 {
+		v.build = str[i+1:]
+		str = str[:i]
+		if err := checkSemVerIdents(v.build, false); err != nil {
+			return v, fmt.Errorf("invalid build metadata: %v", err)
+		}
+	}
+	if i := strings.IndexByte(str, '-'); i != -1 {
+		pre := str[i+1:]
+		str = str[:i]
+		if err := checkSemVerIdents(pre, true); err != nil {
+			return v, fmt.Errorf("invalid prerelease: %v", err)
+		}
+		v.pre = strings.Split(pre, ".")
+	}
+	parts := strings.Split(str, ".")
+	if len(parts) != 3 {
+		return v, errors.New("invalid version format")
+	}
+	nums := make([]uint64, 3)
+	for i, p := range parts {
+		if !isSemVerNumber(p) {
+			return v, errors.New("invalid version format")
+		}
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return v, errors.New("invalid version format")
+		}
+		nums[i] = n
+	}
+	v.major, v.minor, v.patch = nums[0], nums[1], nums[2]
+	return v, nil
+}
+
+// checkSemVerIdents checks a dot separated list of identifiers made of
+// alphanumerics and hyphens. In prereleases, numeric identifiers must not
+// have leading zeros.
+func checkSemVerIdents(s string, pre bool) error {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return errors.New("empty identifier")
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return fmt.Errorf("invalid character in %q", id)
+			}
+		}
+		if pre && isNumeric(id) && !isSemVerNumber(id) {
+			return fmt.Errorf("leading zero in %q", id)
+		}
+	}
+	return nil
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isSemVerNumber returns true if s is a number without leading zeros.
+func isSemVerNumber(s string) bool {
+	return isNumeric(s) && (s == "0" || s[0] != '0')
+}
+
+// compare returns -1, 0 or 1 if v is respectively lower, equal or greater
+// than o. Build metadata is ignored.
+func (v semver) compare(o semver) int {
+	for _, c := range [][2]uint64{{v.major, o.major}, {v.minor, o.minor}, {v.patch, o.patch}} {
+		if c[0] < c[1] {
+			return -1
+		} else if c[0] > c[1] {
+			return 1
+		}
+	}
+	// A version without prerelease has a higher precedence.
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		if c := comparePreIdent(v.pre[i], o.pre[i]); c != 0 {
+			return c
+		}
+	}
+	// A larger set of prerelease fields has a higher precedence.
+	switch {
+	case len(v.pre) < len(o.pre):
+		return -1
+	case len(v.pre) > len(o.pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePreIdent compares prerelease identifiers: numeric identifiers are
+// compared numerically and have a lower precedence than alphanumeric ones,
+// which are compared lexically.
+func comparePreIdent(a, b string) int {
+	an, bn := isNumeric(a), isNumeric(b)
+	switch {
+	case an && bn:
+		if len(a) != len(b) {
+			// No leading zeros, so the longest is the greatest.
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// String returns the normalized representation of the version.
+func (v semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if len(v.pre) > 0 {
+		s += "-" + strings.Join(v.pre, ".")
+	}
+	if v.build != "" {
+		s += "+" + v.build
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemVerValidator(t *testing.T) {
+	for input, expect := range map[string]string{
+		"1.2.3":                  "1.2.3",
+		"v1.2.3":                 "1.2.3",
+		"0.0.0":                  "0.0.0",
+		"1.10.0-alpha.1":         "1.10.0-alpha.1",
+		"1.0.0-0.3.7":            "1.0.0-0.3.7",
+		"1.0.0-x-y-z.--":         "1.0.0-x-y-z.--",
+		"1.0.0+20130313144700":   "1.0.0+20130313144700",
+		"1.0.0-beta+exp.sha.511": "1.0.0-beta+exp.sha.511",
+		"1.0.0+001":              "1.0.0+001",
+	} {
+		v, err := SemVer{}.Validate(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expect, v, input)
+	}
+	for input, expect := range map[string]string{
+		"1.2":           "invalid version format",
+		"1.2.3.4":       "invalid version format",
+		"01.2.3":        "invalid version format",
+		"1.2.x":         "invalid version format",
+		"1.2.-3":        "invalid version format",
+		"":              "invalid version format",
+		"1.0.0-":        "invalid prerelease: empty identifier",
+		"1.0.0-alpha..": "invalid prerelease: empty identifier",
+		"1.0.0-01":      `invalid prerelease: leading zero in "01"`,
+		"1.0.0-al_pha":  `invalid prerelease: invalid character in "al_pha"`,
+		"1.0.0+":        "invalid build metadata: empty identifier",
+		"1.0.0+b$":      `invalid build metadata: invalid character in "b$"`,
+	} {
+		v, err := SemVer{}.Validate(input)
+		assert.EqualError(t, err, expect, input)
+		assert.Nil(t, v, input)
+	}
+	v, err := SemVer{}.Validate(1)
+	assert.EqualError(t, err, "invalid type")
+	assert.Nil(t, v)
+}
+
+func TestSemVerValidatorMinMax(t *testing.T) {
+	v := SemVer{Min: "1.9.0", Max: "2.0.0"}
+	assert.NoError(t, v.Compile(nil))
+	_, err := v.Validate("1.10.0")
+	assert.NoError(t, err)
+	_, err = v.Validate("1.9.0")
+	assert.NoError(t, err)
+	_, err = v.Validate("1.9.0-rc.1")
+	assert.EqualError(t, err, "is lower than 1.9.0")
+	_, err = v.Validate("2.0.0+build.5")
+	assert.NoError(t, err)
+	_, err = v.Validate("2.0.1")
+	assert.EqualError(t, err, "is greater than 2.0.0")
+
+	assert.EqualError(t, SemVer{Min: "1.x"}.Compile(nil), ": invalid min version: invalid version format")
+	assert.EqualError(t, SemVer{Max: "1"}.Compile(nil), ": invalid max version: invalid version format")
+}
+
+func TestSemVerLessFunc(t *testing.T) {
+	less := SemVer{}.LessFunc()
+	// Ordering example from https://semver.org/#spec-item-11.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.9.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		assert.True(t, less(ordered[i], ordered[i+1]), "%s < %s", ordered[i], ordered[i+1])
+		assert.False(t, less(ordered[i+1], ordered[i]), "%s > %s", ordered[i+1], ordered[i])
+	}
+	// Build metadata is ignored in comparisons.
+	assert.False(t, less("1.0.0+build.1", "1.0.0+build.2"))
+	assert.False(t, less("1.0.0+build.2", "1.0.0+build.1"))
+	assert.False(t, less("1.0.0", "invalid"))
+	assert.False(t, less(1, "1.0.0"))
+}
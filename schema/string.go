@@ -14,6 +14,13 @@ type String struct {
 	Allowed []string
 	MaxLen  int
 	MinLen  int
+	// StripHTML removes HTML tags from the value before it is validated, so
+	// the cleaned value is stored. The Sanitizer function is used if set,
+	// StripTags otherwise.
+	StripHTML bool
+	// Sanitizer, if set, cleans the value before it is validated (i.e.: a
+	// bluemonday policy's Sanitize method). It implies StripHTML.
+	Sanitizer func(string) string
 }
 
 // Compile compiles and validate regexp if any.
@@ -47,6 +54,11 @@ func (v String) Validate(value interface{}) (interface{}, error) {
 	if !ok {
 		return nil, errors.New("not a string")
 	}
+	if v.Sanitizer != nil {
+		s = v.Sanitizer(s)
+	} else if v.StripHTML {
+		s = StripTags(s)
+	}
 	l := len(s)
 	if l < v.MinLen {
 		return nil, fmt.Errorf("is shorter than %d", v.MinLen)
@@ -63,7 +75,14 @@ func (v String) Validate(value interface{}) (interface{}, error) {
 			}
 		}
 		if !found {
-			return nil, fmt.Errorf("not one of [%s]", strings.Join(v.Allowed, ", "))
+			allowed := make([]interface{}, len(v.Allowed))
+			for i, a := range v.Allowed {
+				allowed[i] = a
+			}
+			return nil, NotAllowedError{
+				Message: fmt.Sprintf("not one of [%s]", strings.Join(v.Allowed, ", ")),
+				Allowed: allowed,
+			}
 		}
 	}
 	if v.Regexp != "" {
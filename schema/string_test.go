@@ -3,6 +3,7 @@ package schema
 import (
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -73,3 +74,33 @@ func TestStringValidator(t *testing.T) {
 	assert.EqualError(t, err, "not a string")
 	assert.Nil(t, s)
 }
+
+func TestStringValidatorStripHTML(t *testing.T) {
+	cases := []struct {
+		input, expect string
+	}{
+		{"plain text", "plain text"},
+		{"a < b && c > d", "a < b && c > d"},
+		{"Tom &amp; Jerry &lt;3", "Tom &amp; Jerry &lt;3"},
+		{"<b>bold</b> and <i class=\"x>y\">italic</i>", "bold and italic"},
+		{"hello<script>alert('<b>xss</b>')</script> world", "hello world"},
+		{"<SCRIPT src=x></SCRIPT>ok<style>p{}</style>", "ok"},
+		{"a<!-- <b>comment</b> -->b", "ab"},
+		{"<img src=x onerror=alert(1)>", ""},
+		{"text<a href='", "text"},
+	}
+	for _, tt := range cases {
+		s, err := String{StripHTML: true}.Validate(tt.input)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expect, s, tt.input)
+	}
+
+	// The length is checked on the cleaned value.
+	_, err := String{StripHTML: true, MaxLen: 4}.Validate("<b>bold</b>")
+	assert.NoError(t, err)
+
+	// A custom sanitizer replaces the default one.
+	s, err := String{Sanitizer: strings.ToUpper}.Validate("<b>foo</b>")
+	assert.NoError(t, err)
+	assert.Equal(t, "<B>FOO</B>", s)
+}
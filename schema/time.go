@@ -52,7 +52,14 @@ var (
 // Time validates time based values
 type Time struct {
 	TimeLayouts []string // TimeLayouts is set of time layouts we want to validate.
-	layouts     []string
+	// NotFuture rejects times after the current time (i.e.: birth dates).
+	NotFuture bool
+	// NotPast rejects times before the current time (i.e.: expiry dates).
+	NotPast bool
+	// Clock returns the current time NotFuture and NotPast are checked
+	// against. If not set, time.Now is used.
+	Clock   func() time.Time
+	layouts []string
 }
 
 // Compile the time formats.
@@ -91,7 +98,22 @@ func (v Time) ValidateQuery(value interface{}) (interface{}, error) {
 
 // Validate validates and normalize time based value.
 func (v Time) Validate(value interface{}) (interface{}, error) {
-	return v.parse(value)
+	value, err := v.parse(value)
+	if err != nil || (!v.NotFuture && !v.NotPast) {
+		return value, err
+	}
+	now := time.Now
+	if v.Clock != nil {
+		now = v.Clock
+	}
+	t, n := value.(time.Time), now()
+	if v.NotFuture && t.After(n) {
+		return nil, errors.New("cannot be in the future")
+	}
+	if v.NotPast && t.Before(n) {
+		return nil, errors.New("cannot be in the past")
+	}
+	return value, nil
 }
 
 func (v Time) get(value interface{}) (time.Time, error) {
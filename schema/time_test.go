@@ -97,3 +97,40 @@ func TestTimeLess(t *testing.T) {
 		})
 	}
 }
+
+func TestTimeValidateNotFutureNotPast(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	past, future := now.Add(-time.Nanosecond), now.Add(time.Nanosecond)
+
+	notFuture := schema.Time{NotFuture: true, Clock: clock}
+	assert.NoError(t, notFuture.Compile(nil))
+	for _, v := range []interface{}{past, now, "2020-06-01T12:00:00Z", "2019-01-01T00:00:00Z"} {
+		_, err := notFuture.Validate(v)
+		assert.NoError(t, err, "%v", v)
+	}
+	for _, v := range []interface{}{future, "2020-06-01T12:00:01Z"} {
+		_, err := notFuture.Validate(v)
+		assert.EqualError(t, err, "cannot be in the future", "%v", v)
+	}
+	// Queries are not constrained.
+	_, err := notFuture.ValidateQuery(future)
+	assert.NoError(t, err)
+
+	notPast := schema.Time{NotPast: true, Clock: clock}
+	assert.NoError(t, notPast.Compile(nil))
+	for _, v := range []interface{}{future, now, "2020-06-01T12:00:00Z"} {
+		_, err := notPast.Validate(v)
+		assert.NoError(t, err, "%v", v)
+	}
+	for _, v := range []interface{}{past, "2020-06-01T11:59:59Z"} {
+		_, err := notPast.Validate(v)
+		assert.EqualError(t, err, "cannot be in the past", "%v", v)
+	}
+	_, err = notPast.Validate("invalid")
+	assert.EqualError(t, err, "not a time")
+
+	// The current time is used by default.
+	_, err = schema.Time{NotFuture: true}.Validate(time.Now().Add(time.Hour))
+	assert.EqualError(t, err, "cannot be in the future")
+}
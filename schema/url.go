@@ -8,10 +8,18 @@ import (
 )
 
 // URL validates URLs values.
+//
+// The returned value is normalized with a lowercase scheme and host.
 type URL struct {
-	AllowRelative  bool
-	AllowLocale    bool
-	AllowNonHTTP   bool
+	// AllowRelative accepts URLs without a scheme and host.
+	AllowRelative bool
+	// AllowLocale accepts hosts without a dot (i.e.: localhost).
+	AllowLocale bool
+	// AllowNonHTTP accepts schemes other than http and https. It is ignored
+	// when AllowedSchemes is set.
+	AllowNonHTTP bool
+	// AllowedSchemes restricts accepted schemes to the given list (i.e.:
+	// []string{"https"}). Schemes are compared case-insensitively.
 	AllowedSchemes []string
 }
 
@@ -23,27 +31,55 @@ func (v URL) Validate(value interface{}) (interface{}, error) {
 	}
 	u, err := url.Parse(str)
 	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			// Format the error ourselves as the url.Error message format
+			// changes between Go versions.
+			return nil, fmt.Errorf("invalid URL: %s %s: %v", uerr.Op, uerr.URL, uerr.Err)
+		}
 		return nil, fmt.Errorf("invalid URL: %s", err.Error())
 	}
 	if !v.AllowRelative && !u.IsAbs() {
 		return nil, errors.New("is relative URL")
 	}
-	if !v.AllowLocale && strings.IndexByte(u.Host, '.') == -1 {
+	if err := v.validateScheme(u.Scheme); err != nil {
+		return nil, err
+	}
+	hostless := u.IsAbs() && u.Host == ""
+	if hostless && hostSchemes[u.Scheme] {
+		return nil, errors.New("missing host")
+	}
+	u.Host = strings.ToLower(u.Host)
+	if !v.AllowLocale && !hostless && strings.IndexByte(u.Host, '.') == -1 {
 		return nil, errors.New("invalid domain")
 	}
+	return u.String(), nil
+}
+
+// hostSchemes lists the schemes of URLs which must have a host. URLs of other
+// schemes, like mailto:, urn: or file:, may be hostless.
+var hostSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+	"ws":    true,
+	"wss":   true,
+	"ftp":   true,
+}
+
+// validateScheme returns an error if scheme is not accepted.
+func (v URL) validateScheme(scheme string) error {
 	if len(v.AllowedSchemes) > 0 {
 		found := false
-		for _, scheme := range v.AllowedSchemes {
-			if scheme == u.Scheme {
+		for _, s := range v.AllowedSchemes {
+			if strings.ToLower(s) == scheme {
 				found = true
 				break
 			}
 		}
 		if !found {
-			return nil, errors.New("invalid scheme")
+			return errors.New("invalid scheme")
 		}
-	} else if !v.AllowNonHTTP && u.Scheme != "http" && u.Scheme != "https" {
-		return nil, errors.New("invalid scheme")
+	} else if !v.AllowNonHTTP && scheme != "http" && scheme != "https" {
+		return errors.New("invalid scheme")
 	}
-	return u.String(), nil
+	return nil
 }
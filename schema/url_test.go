@@ -38,3 +38,49 @@ func TestURLValidator(t *testing.T) {
 	assert.EqualError(t, err, "invalid scheme")
 	assert.Nil(t, u)
 }
+
+func TestURLValidatorRejections(t *testing.T) {
+	webhook := URL{AllowedSchemes: []string{"HTTPS"}}
+	cases := []struct {
+		name, value, err string
+	}{
+		{"Relative", "/hook", "is relative URL"},
+		{"SchemeRelative", "//foo.com/hook", "is relative URL"},
+		{"MissingHost", "https:///hook", "missing host"},
+		{"File", "file:///etc/passwd", "invalid scheme"},
+		{"JavaScript", "javascript:alert(1)", "invalid scheme"},
+		{"DisallowedScheme", "http://foo.com/hook", "invalid scheme"},
+		{"Locale", "https://localhost/hook", "invalid domain"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := webhook.Validate(tc.value)
+			assert.EqualError(t, err, tc.err)
+			assert.Nil(t, u)
+		})
+	}
+	u, err := URL{AllowNonHTTP: true}.Validate("http:///hook")
+	assert.EqualError(t, err, "missing host")
+	assert.Nil(t, u)
+	u, err = URL{AllowNonHTTP: true}.Validate("ftp:///pub")
+	assert.EqualError(t, err, "missing host")
+	assert.Nil(t, u)
+	u, err = URL{}.Validate("javascript:alert(1)")
+	assert.EqualError(t, err, "invalid scheme")
+	assert.Nil(t, u)
+}
+
+func TestURLValidatorHostless(t *testing.T) {
+	v := URL{AllowedSchemes: []string{"mailto", "urn", "file"}}
+	for _, value := range []string{"mailto:john@example.com", "urn:isbn:0451450523", "file:///etc/hosts"} {
+		u, err := v.Validate(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, value, u)
+	}
+}
+
+func TestURLValidatorNormalize(t *testing.T) {
+	u, err := URL{AllowedSchemes: []string{"https"}}.Validate("HTTPS://Foo.COM/Bar?Baz=Qux")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://foo.com/Bar?Baz=Qux", u)
+}
@@ -1,6 +1,11 @@
 package schema
 
-import "strings"
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+)
 
 // spiltFieldPath splits name on the first dot character and returns the left
 // and right sides respectively. The final return parameter indicates weather
@@ -14,3 +19,152 @@ func splitFieldPath(name string) (string, string, bool) {
 	}
 	return name, "", false
 }
+
+// isEqual returns true if value and other are deeply equal once their numeric
+// values are reconciled. JSON decoding treats all numbers as float64 (or
+// json.Number) while the stored value may use another numeric type (i.e.: int)
+// for the same number. Integers are compared exactly; numbers are only compared
+// as float64 when one of them is not an integer.
+func isEqual(value, other interface{}) bool {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		o, ok := other.(map[string]interface{})
+		if !ok || len(o) != len(t) {
+			return false
+		}
+		for k, v := range t {
+			if ov, found := o[k]; !found || !isEqual(v, ov) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		o, ok := other.([]interface{})
+		if !ok || len(o) != len(t) {
+			return false
+		}
+		for i, v := range t {
+			if !isEqual(v, o[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if i, ok := toBigInt(value); ok {
+		if oi, ok := toBigInt(other); ok {
+			return i.Cmp(oi) == 0
+		}
+	}
+	if f, ok := toFloat(value); ok {
+		of, ok := toFloat(other)
+		return ok && f == of
+	}
+	return reflect.DeepEqual(value, other)
+}
+
+// toBigInt returns the value of integers and of json.Number holding an
+// integer.
+func toBigInt(value interface{}) (*big.Int, bool) {
+	if n, ok := value.(json.Number); ok {
+		return new(big.Int).SetString(n.String(), 10)
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint()), true
+	}
+	return nil, false
+}
+
+// toFloat returns the float64 value of numbers.
+func toFloat(value interface{}) (float64, bool) {
+	if f, ok := normalizeNumbers(value).(float64); ok {
+		return f, true
+	}
+	return 0, false
+}
+
+// normalizeNumbers recursively converts all numeric values to float64.
+func normalizeNumbers(value interface{}) interface{} {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = normalizeNumbers(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = normalizeNumbers(v)
+		}
+		return s
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return value
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return value
+}
+
+// copyValue returns a deep copy of the maps and slices of value, so mutable
+// values shared between documents, like field defaults, can't be altered
+// through one of them.
+func copyValue(value interface{}) interface{} {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = copyValue(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = copyValue(v)
+		}
+		return s
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return value
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			m.SetMapIndex(iter.Key(), copyElem(iter.Value()))
+		}
+		return m.Interface()
+	case reflect.Slice:
+		if v.IsNil() {
+			return value
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(copyElem(v.Index(i)))
+		}
+		return s.Interface()
+	}
+	return value
+}
+
+// copyElem returns a deep copy of the map or slice element v.
+func copyElem(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Interface && v.IsNil() {
+		return v
+	}
+	return reflect.ValueOf(copyValue(v.Interface())).Convert(v.Type())
+}
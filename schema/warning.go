@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"context"
+	"sort"
+)
+
+// WarningValidator is an optional interface a FieldValidator can implement to
+// report non fatal warnings on the values it accepts (i.e.: a phone number
+// with an unusual but accepted format). Warnings don't fail the validation;
+// they are collected in the context passed to ValidateWithContext (see
+// WithWarnings) so they can be reported to the client along with a successful
+// write.
+type WarningValidator interface {
+	// ValidateWarn behaves like Validate and also returns the warnings raised
+	// by the value, if any.
+	ValidateWarn(value interface{}) (interface{}, []string, error)
+}
+
+type warningsKey struct{}
+
+// warningCollector holds the warnings collected in a context and the path of
+// the sub-schema being validated.
+type warningCollector struct {
+	warnings *[]string
+	prefix   string
+}
+
+// WithWarnings returns a copy of ctx collecting the warnings raised by the
+// WarningValidator validators of the changed fields validated with it. The
+// collected warnings are read with WarningsFromContext.
+func WithWarnings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, warningsKey{}, warningCollector{warnings: &[]string{}})
+}
+
+// WarningsFromContext returns the warnings collected in ctx, prefixed with the
+// path of the field they apply to (i.e.: "phone: unusual format") and sorted.
+// It returns nil if ctx doesn't collect warnings.
+func WarningsFromContext(ctx context.Context) []string {
+	c, ok := ctx.Value(warningsKey{}).(warningCollector)
+	if !ok || len(*c.warnings) == 0 {
+		return nil
+	}
+	warnings := append([]string{}, *c.warnings...)
+	sort.Strings(warnings)
+	return warnings
+}
+
+// AddWarnings adds already prefixed warnings to the warnings collected in ctx,
+// if any. It lets validators skipping the validation of the fields, like a
+// cache, report the warnings of a previous validation.
+func AddWarnings(ctx context.Context, warnings ...string) {
+	if c, ok := ctx.Value(warningsKey{}).(warningCollector); ok {
+		*c.warnings = append(*c.warnings, warnings...)
+	}
+}
+
+// addFieldWarnings adds the warnings raised by field to the warnings
+// collected in ctx, if any.
+func addFieldWarnings(ctx context.Context, field string, warnings []string) {
+	if c, ok := ctx.Value(warningsKey{}).(warningCollector); ok {
+		for _, w := range warnings {
+			*c.warnings = append(*c.warnings, c.prefix+field+": "+w)
+		}
+	}
+}
+
+// collectsWarnings returns true if ctx collects warnings.
+func collectsWarnings(ctx context.Context) bool {
+	_, ok := ctx.Value(warningsKey{}).(warningCollector)
+	return ok
+}
+
+// withWarningsField returns a copy of ctx collecting the warnings of the
+// sub-schema of field, if ctx collects warnings.
+func withWarningsField(ctx context.Context, field string) context.Context {
+	c, ok := ctx.Value(warningsKey{}).(warningCollector)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, warningsKey{}, warningCollector{warnings: c.warnings, prefix: c.prefix + field + "."})
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// phoneValidator accepts strings of digits and warns on those not starting
+// with a country code.
+type phoneValidator struct{}
+
+func (v phoneValidator) Validate(value interface{}) (interface{}, error) {
+	value, _, err := v.ValidateWarn(value)
+	return value, err
+}
+
+func (phoneValidator) ValidateWarn(value interface{}) (interface{}, []string, error) {
+	s, ok := value.(string)
+	if !ok || strings.Trim(s, "+0123456789") != "" {
+		return nil, nil, errors.New("not a phone number")
+	}
+	if !strings.HasPrefix(s, "+") {
+		return s, []string{"no country code"}, nil
+	}
+	return s, nil, nil
+}
+
+// contextPhoneValidator is a phoneValidator also implementing
+// FieldContextValidator.
+type contextPhoneValidator struct {
+	phoneValidator
+}
+
+func (v contextPhoneValidator) ValidateContext(ctx context.Context, value interface{}) (interface{}, error) {
+	return v.Validate(value)
+}
+
+func TestSchemaWarnings(t *testing.T) {
+	s := Schema{
+		Fields: Fields{
+			"phone":  {Validator: &phoneValidator{}},
+			"name":   {Validator: &String{}},
+			"mobile": {Validator: &contextPhoneValidator{}},
+			"contact": {
+				Schema: &Schema{
+					Fields: Fields{
+						"phone": {Validator: &phoneValidator{}},
+					},
+				},
+			},
+		},
+	}
+	validate := func(changes, base map[string]interface{}) []string {
+		ctx := WithWarnings(context.Background())
+		ValidateWithContext(ctx, s, changes, base, 0)
+		return WarningsFromContext(ctx)
+	}
+	assert.Equal(t, []string{"contact.phone: no country code", "mobile: no country code", "phone: no country code"}, validate(map[string]interface{}{
+		"phone":   "5551234",
+		"mobile":  "5559876",
+		"name":    "foo",
+		"contact": map[string]interface{}{"phone": "5554321"},
+	}, map[string]interface{}{}))
+	assert.Empty(t, validate(map[string]interface{}{
+		"phone":   "+15551234",
+		"contact": map[string]interface{}{"phone": "invalid"},
+	}, map[string]interface{}{}))
+	// Unchanged fields raise no warning.
+	assert.Empty(t, validate(map[string]interface{}{
+		"name": "foo",
+	}, map[string]interface{}{
+		"phone":   "5551234",
+		"contact": map[string]interface{}{"phone": "5554321"},
+	}))
+	// Warnings are only collected when requested.
+	assert.Nil(t, WarningsFromContext(context.Background()))
+	doc, errs := ValidateWithContext(context.Background(), s, map[string]interface{}{"phone": "5551234"}, map[string]interface{}{}, 0)
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]interface{}{"phone": "5551234"}, doc)
+}